@@ -19,6 +19,7 @@ exclude helm.sh/helm/v4 v4.0.0
 require (
 	github.com/Masterminds/semver/v3 v3.4.0
 	github.com/rancherlabs/slsactl v0.1.33
+	golang.org/x/crypto v0.53.0
 )
 
 require (
@@ -304,7 +305,6 @@ require (
 	go.uber.org/zap v1.27.1 // indirect
 	go.yaml.in/yaml/v2 v2.4.3 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
-	golang.org/x/crypto v0.53.0 // indirect
 	golang.org/x/mod v0.37.0 // indirect
 	golang.org/x/net v0.56.0 // indirect
 	golang.org/x/sync v0.21.0 // indirect
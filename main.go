@@ -2,26 +2,36 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/lmittmann/tint"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/util"
 
 	"github.com/rancher/charts-build-scripts/pkg/auto"
+	"github.com/rancher/charts-build-scripts/pkg/change"
 	"github.com/rancher/charts-build-scripts/pkg/charts"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
+	"github.com/rancher/charts-build-scripts/pkg/diff"
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/git"
 	"github.com/rancher/charts-build-scripts/pkg/helm"
 	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
 	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/output"
 	"github.com/rancher/charts-build-scripts/pkg/path"
 	"github.com/rancher/charts-build-scripts/pkg/puller"
+	"github.com/rancher/charts-build-scripts/pkg/pullrequest"
 	"github.com/rancher/charts-build-scripts/pkg/registries"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
 	"github.com/rancher/charts-build-scripts/pkg/validate"
 	"github.com/urfave/cli"
 	"gopkg.in/yaml.v2"
@@ -38,8 +48,20 @@ const (
 	defaultAssetEnvironmentVariable = "ASSET"
 	// defaultPorcelainEnvironmentVariable is the default environment variable that indicates whether we should run on porcelain mode
 	defaultPorcelainEnvironmentVariable = "PORCELAIN"
+	// defaultOutputEnvironmentVariable is the default environment variable that indicates the format of the report of a command
+	defaultOutputEnvironmentVariable = "OUTPUT"
 	// defaultCacheEnvironmentVariable is the default environment variable that indicates that a cache should be used on pulls to remotes
 	defaultCacheEnvironmentVariable = "USE_CACHE"
+	// defaultOfflineEnvironmentVariable is the default environment variable that indicates that every upstream must be served from the cache
+	defaultOfflineEnvironmentVariable = "OFFLINE"
+	// defaultDryRunEnvironmentVariable is the default environment variable that indicates that commands should only print what they would change
+	defaultDryRunEnvironmentVariable = "DRY_RUN"
+	// defaultLogFormatEnvironmentVariable is the default environment variable that indicates the format of the logs
+	defaultLogFormatEnvironmentVariable = "LOG_FORMAT"
+	// defaultLogFileEnvironmentVariable is the default environment variable that indicates a file every log should be appended to
+	defaultLogFileEnvironmentVariable = "LOG_FILE"
+	// defaultCacheMaxSizeEnvironmentVariable is the default environment variable that indicates the maximum size of the cache in MiB
+	defaultCacheMaxSizeEnvironmentVariable = "CACHE_MAX_SIZE"
 	// defaultBranchVersionEnvironmentVariable is the default environment variable that indicates the branch version to compare against
 	defaultBranchVersionEnvironmentVariable = "BRANCH_VERSION"
 	// defaultBranchEnvironmentVariable is the default environment variable that indicates the branch
@@ -52,6 +74,20 @@ const (
 	defaultGHTokenEnvironmentVariable = "GH_TOKEN"
 	// defaultPRNumberEnvironmentVariable is the default environment variable that indicates the PR number
 	defaultPRNumberEnvironmentVariable = "PR_NUMBER"
+	// defaultGithubRepositoryEnvironmentVariable is the default environment variable that indicates the owner/repo of the pull request
+	defaultGithubRepositoryEnvironmentVariable = "GITHUB_REPOSITORY"
+	// defaultDiffBaseEnvironmentVariable is the default environment variable that indicates the revision local changes are compared against
+	defaultDiffBaseEnvironmentVariable = "DIFF_BASE"
+	// defaultIgnoreCreatedEnvironmentVariable is the default environment variable that indicates whether to ignore the created timestamps of index.yaml
+	defaultIgnoreCreatedEnvironmentVariable = "IGNORE_CREATED"
+	// defaultBaseURLEnvironmentVariable is the default environment variable that indicates the URL of the Helm repository serving the charts
+	defaultBaseURLEnvironmentVariable = "BASE_URL"
+	// defaultSignKeyEnvironmentVariable is the default environment variable that indicates the name of the PGP key that signs the generated archives
+	defaultSignKeyEnvironmentVariable = "SIGN_KEY"
+	// defaultKeyringEnvironmentVariable is the default environment variable that indicates the path of the PGP keyring
+	defaultKeyringEnvironmentVariable = "KEYRING"
+	// defaultPassphraseFileEnvironmentVariable is the default environment variable that indicates the path of the file holding the passphrase of the signing key
+	defaultPassphraseFileEnvironmentVariable = "PASSPHRASE_FILE"
 	// default environment variables used by OCI Registry
 	defaultOciDNS        = "OCI_DNS"
 	defaultCustomOCIPAth = "CUSTOM_OCI_PATH"
@@ -73,6 +109,10 @@ const (
 	defaultNewChartVariable = "NEW_CHART"
 	// defaultIsPrimeChartVariable for handling prime charts
 	defaultIsPrimeChartVariable = "IS_PRIME"
+	// defaultJobsEnvironmentVariable is the default environment variable that indicates how many packages can be worked on at the same time
+	defaultJobsEnvironmentVariable = "JOBS"
+	// defaultForceEnvironmentVariable is the default environment variable that indicates whether packages whose inputs did not change should be exported again
+	defaultForceEnvironmentVariable = "FORCE"
 )
 
 var (
@@ -90,6 +130,8 @@ var (
 	CurrentAsset string
 	// PorcelainMode indicates that the output of the scripts should be in an easy-to-parse format for scripts
 	PorcelainMode bool
+	// OutputFormat is the format of the report of a command: table, json or yaml
+	OutputFormat string
 	// LocalMode indicates that only local validation should be run
 	LocalMode bool
 	// RemoteMode indicates that only remote validation should be run
@@ -98,6 +140,20 @@ var (
 	DebugMode bool
 	// CacheMode indicates that caching should be used on all remotely pulled resources
 	CacheMode = false
+	// OfflineMode indicates that every upstream must be served from the cache, without reaching the network
+	OfflineMode = false
+	// DryRun indicates that commands should print a plan of the files, commits and pushes they would make instead of making them
+	DryRun = false
+	// LogFormat is the format of the logs: text or json
+	LogFormat = logger.FormatText
+	// LogFile is a file every log is appended to, if set
+	LogFile string
+	// logFile is the opened LogFile
+	logFile *os.File
+	// CacheMaxSize is the maximum size of the cache in MiB before the least recently used entries are evicted; 0 means unlimited
+	CacheMaxSize = 2048
+	// CacheOlderThan indicates that only cache entries that have not been used for this long should be cleaned
+	CacheOlderThan time.Duration
 	// ForkURL represents the fork URL configured as a remote in your local git repository
 	ForkURL = ""
 	// ChartVersion of the chart to release
@@ -108,6 +164,20 @@ var (
 	PullRequest = ""
 	// GithubToken represents the Github Auth token
 	GithubToken string
+	// GithubRepository represents the owner/repo the pull request was opened against
+	GithubRepository string
+	// DiffBase represents the revision the local changes are validated against instead of a pull request
+	DiffBase string
+	// IgnoreCreated indicates whether to ignore the created timestamps when comparing index.yaml files
+	IgnoreCreated = false
+	// BaseURL represents the URL of the Helm repository serving the charts
+	BaseURL string
+	// SignKey represents the name of the PGP key that signs the generated archives; archives are not signed if it is empty
+	SignKey string
+	// Keyring represents the path of the PGP keyring holding the signing key or the keys trusted to sign the assets
+	Keyring string
+	// PassphraseFile represents the path of the file holding the passphrase of the signing key
+	PassphraseFile string
 	// OciDNS represents the DNS of the OCI Registry
 	OciDNS string
 	// CustomOCIPAth represents a custom override for the OCI Registry
@@ -134,42 +204,66 @@ var (
 	NewChart bool
 	// IsPrimeChart boolean option
 	IsPrimeChart bool
+	// Jobs is the maximum number of packages that are worked on at the same time
+	Jobs = 1
+	// Force indicates whether packages should be exported even if their inputs did not change since their last export
+	Force bool
 )
 
+// dryRunCommands are the commands that support --dry-run: every file they write goes through the in-memory overlay of filesystem.GetFilesystem.
+// The other commands write to the repository directly, e.g. with helm or go-git.
+var dryRunCommands = map[string]bool{
+	"remove":              true,
+	"release":             true,
+	"forward-port":        true,
+	"lifecycle-prune":     true,
+	"chart-bump":          true,
+	"update-oci-registry": true,
+	"scan-registries":     true,
+	"sync-registries":     true,
+}
+
 func init() {
+	// the flags are not parsed yet, the logger is set up again with them before running the command
+	if err := setupLogger(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// setupLogger makes the default logger print to stderr in the format given by --log-format, at the level given by the LOG
+// environment variable, and copies every record to the --log-file if any. Nothing is printed to stderr in porcelain mode.
+func setupLogger() error {
+	opts := logger.Options{Format: LogFormat, Level: slog.LevelInfo, Console: os.Stderr}
+
 	// Disable all logging in PORCELAIN mode
 	if os.Getenv(defaultPorcelainEnvironmentVariable) == "1" {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.NewFile(0, os.DevNull), &slog.HandlerOptions{
-			Level: slog.Level(1000), // Set level extremely high to suppress all logs
-		})))
-		return
+		opts.Console = nil
 	}
 
-	tintOptions := &tint.Options{
-		AddSource:  true,
-		TimeFormat: "15:04:05",
+	// Set the log level based on the LOG environment variable
+	switch os.Getenv("LOG") {
+	case "DEBUG":
+		opts.Level = slog.LevelDebug
+	case "WARN":
+		opts.Level = slog.LevelWarn
+	case "ERROR":
+		opts.Level = slog.LevelError
 	}
 
-	// Set the log level based on the LOG environment variable
-	lvl := os.Getenv("LOG")
-	if lvl != "" {
-		switch lvl {
-		case "DEBUG":
-			tintOptions.Level = slog.LevelDebug
-		case "INFO":
-			tintOptions.Level = slog.LevelInfo
-		case "WARN":
-			tintOptions.Level = slog.LevelWarn
-		case "ERROR":
-			tintOptions.Level = slog.LevelError
-		default:
-			tintOptions.Level = slog.LevelInfo
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+	if LogFile != "" {
+		file, err := os.OpenFile(LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to open log file: %w", err)
 		}
+		logFile = file
+		opts.File = file
 	}
-	// Create a new slog logger with tint handler
-	newLogger := slog.New(tint.NewHandler(os.Stderr, tintOptions))
-	slog.SetDefault(newLogger)
-	logger.Log(context.Background(), slog.LevelInfo, "charts-build-scripts", slog.String("LOG", os.Getenv("LOG")))
+	return logger.Setup(opts)
 }
 
 func main() {
@@ -178,6 +272,7 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "charts-build-scripts"
 	app.Version = fmt.Sprintf("%s (%s)", Version, GitCommit)
+	charts.ToolVersion = app.Version
 	app.Usage = "Build scripts used to maintain patches on Helm charts forked from other repositories"
 	debugFlag := cli.BoolFlag{
 		Name:        "debug,d",
@@ -226,6 +321,18 @@ func main() {
 		Destination: &PorcelainMode,
 		EnvVar:      defaultPorcelainEnvironmentVariable,
 	}
+	outputFlag := cli.StringFlag{
+		Name: "output",
+		Usage: `Usage:
+			./bin/charts-build-scripts <command> --output=<table|json|yaml|markdown|html>
+			OUTPUT=<table|json|yaml|markdown|html> make <command>
+
+		Format of the report printed on stdout; see docs/output.md for the schema of each command.
+		`,
+		Required:    false,
+		Destination: &OutputFormat,
+		EnvVar:      defaultOutputEnvironmentVariable,
+	}
 	cacheFlag := cli.BoolFlag{
 		Name:        "useCache",
 		Usage:       "Experimental: use a cache to speed up scripts",
@@ -233,6 +340,14 @@ func main() {
 		Destination: &CacheMode,
 		EnvVar:      defaultCacheEnvironmentVariable,
 	}
+	cacheMaxSizeFlag := cli.IntFlag{
+		Name:        "cacheMaxSize",
+		Usage:       "Experimental: maximum size of the cache in MiB, the least recently used entries are evicted beyond it (0 means unlimited)",
+		Required:    false,
+		Destination: &CacheMaxSize,
+		Value:       CacheMaxSize,
+		EnvVar:      defaultCacheMaxSizeEnvironmentVariable,
+	}
 	branchVersionFlag := cli.StringFlag{
 		Name: "branch-version",
 		Usage: `Usage:
@@ -312,6 +427,40 @@ func main() {
 		Usage:       "Overwrite existing chart versions in the OCI registry",
 		Destination: &OciOverwrite,
 	}
+	// the OCI registry is only checked by verify-published if it is given
+	optionalOciDNS := ociDNS
+	optionalOciDNS.Required = false
+	optionalOciUser := ociUser
+	optionalOciUser.Required = false
+	optionalOciPass := ociPass
+	optionalOciPass.Required = false
+	baseURLFlag := cli.StringFlag{
+		Name:        "base-url",
+		Usage:       "--base-url=https://charts.rancher.io || BASE_URL=https://charts.rancher.io; defaults to the helmRepo.cname of the configuration",
+		EnvVar:      defaultBaseURLEnvironmentVariable,
+		Destination: &BaseURL,
+	}
+	signKeyFlag := cli.StringFlag{
+		Name:        "sign-key",
+		Usage:       "--sign-key=<name> || SIGN_KEY=<name>; name of the PGP key in --keyring that signs the generated archives with a .prov file",
+		EnvVar:      defaultSignKeyEnvironmentVariable,
+		Destination: &SignKey,
+	}
+	keyringFlag := cli.StringFlag{
+		Name:        "keyring",
+		Usage:       "--keyring=<path> || KEYRING=<path>; PGP keyring holding the secret signing key, or the public keys trusted to sign the assets",
+		EnvVar:      defaultKeyringEnvironmentVariable,
+		Destination: &Keyring,
+	}
+	passphraseFileFlag := cli.StringFlag{
+		Name:        "passphrase-file",
+		Usage:       "--passphrase-file=<path> || PASSPHRASE_FILE=<path>; file whose first line is the passphrase of the signing key",
+		EnvVar:      defaultPassphraseFileEnvironmentVariable,
+		Destination: &PassphraseFile,
+	}
+	// verify-provenance cannot verify anything without trusted keys
+	requiredKeyringFlag := keyringFlag
+	requiredKeyringFlag.Required = true
 	branchFlag := cli.StringFlag{
 		Name: "branch,b",
 		Usage: `Usage:
@@ -348,9 +497,9 @@ func main() {
 					./bin/charts-build-scripts <command> --gh_token="********"
 					GH_TOKEN="*********" make <command>
 
-					Github Auth Token provided by Github Actions job
+					Github Auth Token provided by Github Actions job, not needed with --diff-base
 					`,
-		Required:    true,
+		Required:    false,
 		EnvVar:      defaultGHTokenEnvironmentVariable,
 		Destination: &GithubToken,
 	}
@@ -367,18 +516,62 @@ func main() {
 					./bin/charts-build-scripts <command> --pr_number="****"
 					PR_NUMBER="****" make <command>
 
-					Pull Request identifying number provided by Github Actions job
+					Pull Request identifying number provided by Github Actions job, not needed with --diff-base
 					`,
-		Required:    true,
+		Required:    false,
 		EnvVar:      defaultPRNumberEnvironmentVariable,
 		Destination: &PullRequest,
 	}
+	githubRepositoryFlag := cli.StringFlag{
+		Name:        "github-repository",
+		Usage:       "--github-repository=my-fork/charts || GITHUB_REPOSITORY=my-fork/charts; the owner/repo the pull request was opened against",
+		Value:       pullrequest.DefaultRepository,
+		EnvVar:      defaultGithubRepositoryEnvironmentVariable,
+		Destination: &GithubRepository,
+	}
+	diffBaseFlag := cli.StringFlag{
+		Name: "diff-base",
+		Usage: `Usage:
+					./bin/charts-build-scripts <command> --diff-base="upstream/release-v2.10"
+					DIFF_BASE="upstream/release-v2.10" make <command>
+
+					Validate the local commits since they diverged from this revision instead of a GitHub pull request
+					`,
+		EnvVar:      defaultDiffBaseEnvironmentVariable,
+		Destination: &DiffBase,
+	}
+	ignoreCreatedFlag := cli.BoolFlag{
+		Name:        "ignore-created",
+		Usage:       "--ignore-created || IGNORE_CREATED=true; ignore the created timestamps of the chart versions when comparing index.yaml files",
+		EnvVar:      defaultIgnoreCreatedEnvironmentVariable,
+		Destination: &IgnoreCreated,
+	}
 	skipFlag := cli.BoolFlag{
 		Name:        "skip",
 		Usage:       "Skip the execution and return success",
 		EnvVar:      defaultSkipEnvironmentVariable,
 		Destination: &Skip,
 	}
+	jobsFlag := cli.IntFlag{
+		Name:        "jobs",
+		Usage:       "Maximum number of packages to work on at the same time",
+		EnvVar:      defaultJobsEnvironmentVariable,
+		Value:       1,
+		Destination: &Jobs,
+	}
+	// validation used to generate charts with 5 workers
+	validateJobsFlag := jobsFlag
+	validateJobsFlag.Value = 5
+	// verify-published downloads many chart versions at the same time
+	verifyJobsFlag := jobsFlag
+	verifyJobsFlag.Usage = "Maximum number of chart versions to verify at the same time"
+	verifyJobsFlag.Value = 10
+	forceFlag := cli.BoolFlag{
+		Name:        "force",
+		Usage:       "Export every package, even if its inputs did not change since its last export",
+		EnvVar:      defaultForceEnvironmentVariable,
+		Destination: &Force,
+	}
 	softErrorsFlag := cli.BoolFlag{
 		Name:        "soft-errors",
 		Usage:       "Enables soft error mode - some non-fatal errors will become warnings",
@@ -417,33 +610,95 @@ func main() {
 	}
 
 	// Commands
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:        "offline",
+			Usage:       "Serve every upstream from the cache populated by cache-warm and fail on the ones that are not cached",
+			Destination: &OfflineMode,
+			EnvVar:      defaultOfflineEnvironmentVariable,
+		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Print the files, commits, pushes and image copies the command would make without making them; see docs/dry-run.md for the commands that support it",
+			Destination: &DryRun,
+			EnvVar:      defaultDryRunEnvironmentVariable,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Usage:       "Format of the logs printed on stderr and written to the log file: text or json",
+			Value:       logger.FormatText,
+			Destination: &LogFormat,
+			EnvVar:      defaultLogFormatEnvironmentVariable,
+		},
+		cli.StringFlag{
+			Name:        "log-file",
+			Usage:       "Also append every log to this file, without colors",
+			Destination: &LogFile,
+			EnvVar:      defaultLogFileEnvironmentVariable,
+		},
+	}
+	app.Before = func(c *cli.Context) error {
+		if err := setupLogger(); err != nil {
+			return err
+		}
+		logger.Log(context.Background(), slog.LevelInfo, "charts-build-scripts", slog.String("LOG", os.Getenv("LOG")))
+		if DryRun {
+			if command := c.Args().First(); command != "" && !dryRunCommands[command] {
+				return fmt.Errorf("--dry-run is not supported by %s, see docs/dry-run.md", command)
+			}
+			dryrun.Enable()
+		}
+		return nil
+	}
+	app.After = func(c *cli.Context) error {
+		err := printDryRunPlan(c)
+		if logFile != nil {
+			logFile.Close()
+		}
+		return err
+	}
+
 	app.Commands = []cli.Command{
 		{
 			Name:   "list",
 			Usage:  "Print a list of all packages tracked in the current repository",
 			Action: listPackages,
-			Flags:  []cli.Flag{packageFlag, porcelainFlag},
+			Flags:  []cli.Flag{packageFlag, porcelainFlag, outputFlag},
 		},
 		{
 			Name:   "prepare",
 			Usage:  "Pull in the chart specified from upstream to the charts directory and apply any patch files",
 			Action: prepareCharts,
-			Before: setupCache,
-			Flags:  []cli.Flag{packageFlag, cacheFlag, softErrorsFlag},
+			Before: setupUpstreams,
+			Flags:  []cli.Flag{packageFlag, jobsFlag, cacheFlag, cacheMaxSizeFlag, softErrorsFlag},
+		},
+		{
+			Name:   "patch-rebase",
+			Usage:  "Prepare the charts like prepare, merging the patches that no longer apply to the upstream and leaving conflict markers in the charts directory",
+			Action: rebasePatches,
+			Before: setupUpstreams,
+			Flags:  []cli.Flag{packageFlag, jobsFlag, cacheFlag, cacheMaxSizeFlag},
+		},
+		{
+			Name:   "patch-audit",
+			Usage:  "Report whether each patch still applies to the upstream, applies with fuzz or is redundant because the upstream already contains its changes",
+			Action: auditPatches,
+			Before: setupUpstreams,
+			Flags:  []cli.Flag{packageFlag, jobsFlag, porcelainFlag, outputFlag, cacheFlag, cacheMaxSizeFlag},
 		},
 		{
 			Name:   "patch",
 			Usage:  "Apply a patch between the upstream chart and the current state of the chart in the charts directory",
 			Action: generatePatch,
-			Before: setupCache,
-			Flags:  []cli.Flag{packageFlag, cacheFlag},
+			Before: setupUpstreams,
+			Flags:  []cli.Flag{packageFlag, cacheFlag, cacheMaxSizeFlag},
 		},
 		{
 			Name:   "charts",
 			Usage:  "Create a local chart archive of your finalized chart for testing",
 			Action: generateCharts,
-			Before: setupCache,
-			Flags:  []cli.Flag{packageFlag, configFlag, cacheFlag},
+			Before: setupUpstreams,
+			Flags:  []cli.Flag{packageFlag, jobsFlag, forceFlag, configFlag, cacheFlag, cacheMaxSizeFlag, signKeyFlag, keyringFlag, passphraseFileFlag},
 		},
 		{
 			Name:   "index",
@@ -454,7 +709,7 @@ func main() {
 			Name:   "zip",
 			Usage:  "Take the contents of a chart under charts/ and rezip the asset if it has been changed",
 			Action: zipCharts,
-			Flags:  []cli.Flag{chartFlag},
+			Flags:  []cli.Flag{chartFlag, signKeyFlag, keyringFlag, passphraseFileFlag},
 		},
 		{
 			Name:   "unzip",
@@ -466,18 +721,32 @@ func main() {
 			Name:   "clean",
 			Usage:  "Clean up your current repository to get it ready for a PR",
 			Action: cleanRepo,
-			Flags:  []cli.Flag{packageFlag},
+			Flags:  []cli.Flag{packageFlag, jobsFlag},
 		},
 		{
 			Name:   "clean-cache",
 			Usage:  "Experimental: Clean cache",
 			Action: cleanCache,
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:        "older-than",
+					Usage:       "Only remove the entries that have not been used for this long (e.g. 168h)",
+					Destination: &CacheOlderThan,
+				},
+			},
+		},
+		{
+			Name:   "cache-warm",
+			Usage:  "Pull every upstream referenced by the packages, including their dependencies, into the cache to be used in offline mode. Fails if they take more than cacheMaxSize",
+			Action: warmCache,
+			Flags:  []cli.Flag{packageFlag, cacheMaxSizeFlag},
 		},
 		{
 			Name:   "validate",
 			Usage:  "Run validation to ensure that contents of assets and charts won't overwrite released charts",
 			Action: validateRepository,
-			Flags:  []cli.Flag{packageFlag, configFlag, localModeFlag, remoteModeFlag, skipFlag},
+			Before: setupUpstreams,
+			Flags:  []cli.Flag{packageFlag, validateJobsFlag, configFlag, localModeFlag, remoteModeFlag, skipFlag, cacheFlag, cacheMaxSizeFlag, outputFlag},
 		},
 		{
 			Name:   "standardize",
@@ -489,6 +758,7 @@ func main() {
 			Name:   "check-images",
 			Usage:  "Checks all container images used in the charts repository",
 			Action: checkImages,
+			Flags:  []cli.Flag{outputFlag},
 		},
 		{
 			Name:  "lint-images",
@@ -503,6 +773,7 @@ func main() {
 					Name:  "tgz",
 					Usage: "Directly lint a specific .tgz path, bypassing git diff. Useful for local testing.",
 				},
+				outputFlag,
 			},
 			Action: lintImages,
 		},
@@ -510,19 +781,53 @@ func main() {
 			Name:   "check-rc",
 			Usage:  "Checks if there are any images with RC tags or charts with RC versions in the charts repository",
 			Action: checkRCTagsAndVersions,
+			Flags:  []cli.Flag{outputFlag},
 		},
 		{
 			Name:   "icon",
 			Usage:  "Download the chart icon locally and use it",
 			Action: downloadIcon,
-			Flags:  []cli.Flag{packageFlag, configFlag, cacheFlag},
+			Flags:  []cli.Flag{packageFlag, jobsFlag, configFlag, cacheFlag},
 		},
 		{
 			Name: "lifecycle-status",
 			Usage: `Print the status of the current assets and charts based on the branch version and chart version according to the lifecycle rules.
 			Saves the logs in the logs/ directory.`,
 			Action: lifecycleStatus,
-			Flags:  []cli.Flag{branchVersionFlag, chartFlag},
+			Flags:  []cli.Flag{branchVersionFlag, chartFlag, outputFlag},
+		},
+		{
+			Name: "lifecycle-diff",
+			Usage: `Compare the lifecycle status of the branch version between two git revisions of the charts repository and print the chart versions
+			released, forward-ported, out of the lifecycle and removed in between, as Markdown for release notes by default.`,
+			Action: lifecycleDiff,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:     "from",
+					Usage:    "Git revision (branch, tag or commit) of the start of the period, e.g. the commit of the previous release",
+					Required: true,
+				},
+				cli.StringFlag{
+					Name:     "to",
+					Usage:    "Git revision (branch, tag or commit) of the end of the period",
+					Required: true,
+				},
+				branchVersionFlag, chartFlag, outputFlag,
+			},
+		},
+		{
+			Name: "lifecycle-matrix",
+			Usage: `Print the lifecycle status of every chart on every branch version of the version rules, from the index.yaml of the development and production branches
+			of the upstream remote, with the release state of each version and the forward-port gaps. Prints HTML by default, use --output=json for JSON.`,
+			Action: lifecycleMatrix,
+			Flags:  []cli.Flag{chartFlag, outputFlag},
+		},
+		{
+			Name: "lifecycle-prune",
+			Usage: `Remove the chart versions out of the lifecycle according to the state saved by lifecycle-status from assets/, charts/ and index.yaml,
+			add them to the release.yaml and commit the result. Use the global --dry-run flag to preview the removals.`,
+			Action: lifecyclePrune,
+			Flags:  []cli.Flag{branchVersionFlag, chartFlag, outputFlag},
 		},
 		{
 			Name: "release",
@@ -531,25 +836,32 @@ func main() {
 			Action: release,
 			Flags:  []cli.Flag{branchVersionFlag, chartFlag, chartVersionFlag, forkFlag},
 		},
+		{
+			Name: "forward-port",
+			Usage: `Release on a new branch the chart versions to forward-port according to the state saved by lifecycle-status,
+			with a commit per version of a chart and its related charts, and push the branch to the fork remote to open a PR.`,
+			Action: forwardPort,
+			Flags:  []cli.Flag{branchVersionFlag, chartFlag, forkFlag, outputFlag},
+		},
 		{
 			Name: "validate-release-charts",
 			Usage: `Check charts to release in PR.
 			`,
 			Action: validateRelease,
-			Flags:  []cli.Flag{branchFlag, ghTokenFlag, prNumberFlag, skipFlag},
+			Flags:  []cli.Flag{branchFlag, ghTokenFlag, prNumberFlag, githubRepositoryFlag, diffBaseFlag, skipFlag, outputFlag},
 		},
 		{
 			Name: "compare-index-files",
-			Usage: `Compare the index.yaml between github repository and charts.rancher.io.
+			Usage: `Compare the entries of the index.yaml between github repository and the Helm repository at the CNAME of the configuration.yaml (charts.rancher.io by default).
 			`,
 			Action: compareIndexFiles,
-			Flags:  []cli.Flag{branchFlag},
+			Flags:  []cli.Flag{branchFlag, configFlag, ignoreCreatedFlag, outputFlag},
 		},
 		{
 			Name:   "chart-bump",
-			Usage:  `Generate a new chart bump PR.`,
+			Usage:  `Generate a new chart bump PR. With --dry-run, the repository must be clean since the bump is previewed from HEAD.`,
 			Action: chartBump,
-			Before: setupCache,
+			Before: setupUpstreams,
 			Flags:  []cli.Flag{packageFlag, branchFlag, overrideVersionFlag, multiRCFlag, newChartFlag, isPrimeChartFlag},
 		},
 
@@ -562,6 +874,21 @@ func main() {
 				debugFlag, ociDNS, ociUser, ociPass, customOciPath, ociOverwrite,
 			},
 		},
+		{
+			Name: "verify-published",
+			Usage: `Verify that the Helm repository serves every chart version of index.yaml with its digest and, if --oci-dns is given, that the OCI registry has every chart version.
+			`,
+			Action: verifyPublished,
+			Flags: []cli.Flag{
+				configFlag, baseURLFlag, verifyJobsFlag, debugFlag, optionalOciDNS, optionalOciUser, optionalOciPass, customOciPath, outputFlag,
+			},
+		},
+		{
+			Name:   "verify-provenance",
+			Usage:  "Verify that every asset has a .prov provenance file signed by a key of --keyring",
+			Action: verifyProvenance,
+			Flags:  []cli.Flag{requiredKeyringFlag, outputFlag},
+		},
 		{
 			Name:   "scan-registries",
 			Usage:  "Fetch, list and compare SUSE's registries and create yaml files with what is supposed to be synced from Docker Hub",
@@ -584,7 +911,7 @@ func main() {
 			Name:   "validate-image-versions",
 			Usage:  "Check whether chart images are using the latest minor/patch version available",
 			Action: validateImageVersions,
-			Flags:  []cli.Flag{chartFlag, chartVersionFlag},
+			Flags:  []cli.Flag{chartFlag, chartVersionFlag, outputFlag},
 		},
 	}
 
@@ -593,6 +920,18 @@ func main() {
 	}
 }
 
+// printDryRunPlan prints every change the command would have made in dry-run mode
+func printDryRunPlan(c *cli.Context) error {
+	if !dryrun.Enabled() {
+		return nil
+	}
+	files, err := filesystem.DryRunChanges()
+	if err != nil {
+		return err
+	}
+	return dryrun.NewPlan(files).Print(os.Stdout, PorcelainMode)
+}
+
 func listPackages(c *cli.Context) {
 	ctx := context.Background()
 
@@ -601,12 +940,30 @@ func listPackages(c *cli.Context) {
 	if err != nil {
 		logger.Fatal(ctx, err.Error())
 	}
-	if PorcelainMode {
+	if PorcelainMode && OutputFormat == "" {
 		fmt.Println(strings.Join(packageList, " "))
 		return
 	}
 
-	logger.Log(ctx, slog.LevelInfo, "", slog.Any("packageList", packageList))
+	printReport(ctx, charts.PackageList{Packages: append([]string{}, packageList...)}, output.FormatTable)
+}
+
+// printReport prints the report of a command to stdout in the format given by --output.
+// Without --output, the report is printed as JSON in porcelain mode and in the given format otherwise.
+func printReport(ctx context.Context, report output.Report, defaultFormat output.Format) {
+	format := defaultFormat
+	if PorcelainMode {
+		format = output.FormatJSON
+	}
+	if OutputFormat != "" {
+		var err error
+		if format, err = output.ParseFormat(OutputFormat); err != nil {
+			logger.Fatal(ctx, err.Error())
+		}
+	}
+	if err := output.Print(os.Stdout, format, report); err != nil {
+		logger.Fatal(ctx, fmt.Errorf("printing report: %w", err).Error())
+	}
 }
 
 func prepareCharts(c *cli.Context) {
@@ -617,11 +974,105 @@ func prepareCharts(c *cli.Context) {
 	if len(packages) == 0 {
 		logger.Fatal(ctx, "could not find any packages in packages/ folder")
 	}
-	for _, p := range packages {
-		if err := p.Prepare(ctx); err != nil {
-			logger.Fatal(ctx, err.Error())
+	err := forEachPackage(ctx, packages, func(ctx context.Context, p *charts.Package) error {
+		return p.Prepare(ctx)
+	})
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+}
+
+func rebasePatches(c *cli.Context) {
+	ctx := context.Background()
+
+	packages := getPackages()
+	if len(packages) == 0 {
+		logger.Fatal(ctx, "could not find any packages in packages/ folder")
+	}
+	getRepoRoot()
+	repo, err := git.OpenGitRepo(ctx, RepoRoot)
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	reports := make([]*change.RebaseReport, len(packages))
+	err = forEachPackage(ctx, packages, func(ctx context.Context, p *charts.Package) error {
+		previous, err := previousUpstream(ctx, repo, p)
+		if err != nil {
+			return err
+		}
+		report, err := p.RebasePatches(ctx, previous)
+		if err != nil {
+			return err
+		}
+		logger.Log(ctx, slog.LevelInfo, "patch-rebase summary",
+			slog.Int("clean", report.Count(diff.StatusClean)),
+			slog.Int("fuzzed", report.Count(diff.StatusFuzzed)),
+			slog.Int("conflicted", report.Count(diff.StatusConflicted)))
+		for _, f := range report.Files {
+			if f.Status != diff.StatusClean {
+				logger.Log(ctx, slog.LevelWarn, string(f.Status), slog.String("path", f.Path), slog.String("patch", f.Patch))
+			}
+		}
+		reports[slices.Index(packages, p)] = report
+		return nil
+	})
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	var conflicted []string
+	for i, p := range packages {
+		for _, path := range reports[i].Conflicted() {
+			conflicted = append(conflicted, filepath.Join(p.Name, path))
+		}
+	}
+	if len(conflicted) > 0 {
+		logger.Fatal(ctx, fmt.Sprintf("resolve the conflict markers and run make patch: %s", strings.Join(conflicted, ", ")))
+	}
+}
+
+// previousUpstream returns the upstream of the package.yaml committed at HEAD if it differs from the current one,
+// i.e. the upstream the patches were made against when package.yaml was edited to move to a new upstream
+func previousUpstream(ctx context.Context, repo *git.Git, p *charts.Package) (puller.Puller, error) {
+	packageYaml, err := repo.ShowFile(ctx, "HEAD", filepath.Join(path.RepositoryPackagesDir, p.Name, path.PackageOptionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return charts.GetPreviousUpstream(ctx, p, packageYaml)
+}
+
+func auditPatches(c *cli.Context) {
+	ctx := context.Background()
+
+	packages := getPackages()
+	if len(packages) == 0 {
+		logger.Fatal(ctx, "could not find any packages in packages/ folder")
+	}
+	audit := change.PatchAudit{Packages: make([]change.AuditedPackage, len(packages))}
+	for i, p := range packages {
+		audit.Packages[i].Package = p.Name
+	}
+	err := forEachPackage(ctx, packages, func(ctx context.Context, p *charts.Package) error {
+		report, err := p.AuditPatches(ctx)
+		if err != nil {
+			return err
 		}
+		logger.Log(ctx, slog.LevelInfo, "patch-audit summary",
+			slog.Int("applies", report.Count(change.AuditApplies)),
+			slog.Int("fuzzed", report.Count(change.AuditFuzzed)),
+			slog.Int("partially-redundant", report.Count(change.AuditPartiallyRedundant)),
+			slog.Int("redundant", report.Count(change.AuditRedundant)),
+			slog.Int("fails", report.Count(change.AuditFails)))
+		audit.Packages[slices.Index(packages, p)].AuditReport = *report
+		return nil
+	})
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
 	}
+
+	printReport(ctx, audit, output.FormatTable)
 }
 
 func generatePatch(c *cli.Context) {
@@ -654,12 +1105,25 @@ func generateCharts(c *cli.Context) {
 	}
 
 	chartsScriptOptions := parseScriptOptions(ctx)
-	for _, p := range packages {
-		if p.Auto == false {
-			if err := p.GenerateCharts(ctx, chartsScriptOptions.OmitBuildMetadataOnExport); err != nil {
-				logger.Fatal(ctx, err.Error())
-			}
+	setupSigning(ctx)
+	getRepoRoot()
+	rootFs := filesystem.GetFilesystem(RepoRoot)
+	buildState, err := charts.LoadBuildState(ctx, rootFs)
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	err = forEachPackage(ctx, packages, func(ctx context.Context, p *charts.Package) error {
+		if p.Auto {
+			return nil
 		}
+		return p.GenerateChartsIfChanged(ctx, chartsScriptOptions.OmitBuildMetadataOnExport, buildState, Force)
+	})
+	// Exports that succeeded are recorded even if others failed
+	if saveErr := buildState.Save(ctx, rootFs); saveErr != nil {
+		logger.Log(ctx, slog.LevelWarn, "unable to save build state", logger.Err(saveErr))
+	}
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
 	}
 }
 
@@ -671,11 +1135,11 @@ func downloadIcon(c *cli.Context) {
 		logger.Log(ctx, slog.LevelInfo, "no packages found")
 		return
 	}
-	for _, p := range packages {
-		err := p.DownloadIcon(ctx)
-		if err != nil {
-			logger.Fatal(ctx, err.Error())
-		}
+	err := forEachPackage(ctx, packages, func(ctx context.Context, p *charts.Package) error {
+		return p.DownloadIcon(ctx)
+	})
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
 	}
 }
 
@@ -691,6 +1155,7 @@ func createOrUpdateIndex(c *cli.Context) {
 func zipCharts(c *cli.Context) {
 	ctx := context.Background()
 
+	setupSigning(ctx)
 	getRepoRoot()
 	if err := helm.ArchiveCharts(ctx, RepoRoot, CurrentChart); err != nil {
 		logger.Fatal(ctx, err.Error())
@@ -717,10 +1182,11 @@ func cleanRepo(c *cli.Context) {
 		return
 	}
 
-	for _, p := range packages {
-		if err := p.Clean(ctx); err != nil {
-			logger.Fatal(ctx, err.Error())
-		}
+	err := forEachPackage(ctx, packages, func(ctx context.Context, p *charts.Package) error {
+		return p.Clean(ctx)
+	})
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
 	}
 }
 
@@ -740,7 +1206,9 @@ func validateRepository(c *cli.Context) {
 		logger.Fatal(ctx, "cannot specify both local and remote validation")
 	}
 
-	if err := validate.ChartsRepository(ctx, c, RepoRoot, rootFs, parseScriptOptions(ctx), Skip, RemoteMode, LocalMode, CurrentPackage); err != nil {
+	response, err := validate.ChartsRepository(ctx, c, RepoRoot, rootFs, parseScriptOptions(ctx), Skip, RemoteMode, LocalMode, CurrentPackage, Jobs)
+	printReport(ctx, response, output.FormatTable)
+	if err != nil {
 		logger.Fatal(ctx, err.Error())
 	}
 }
@@ -759,14 +1227,84 @@ func setupCache(c *cli.Context) error {
 	ctx := context.Background()
 
 	getRepoRoot()
-	return puller.InitRootCache(ctx, RepoRoot, CacheMode, path.DefaultCachePath)
+	return puller.InitRootCache(ctx, RepoRoot, CacheMode, path.DefaultCachePath, int64(CacheMaxSize)*1024*1024)
+}
+
+// setupUpstreams prepares everything needed to pull charts from upstreams: the cache and the credentials.
+// In offline mode, it fails early listing every upstream missing from the cache.
+func setupUpstreams(c *cli.Context) error {
+	if OfflineMode {
+		CacheMode = true
+		puller.OfflineMode = true
+	}
+	if err := setupCache(c); err != nil {
+		return err
+	}
+	if err := setupCredentials(c); err != nil {
+		return err
+	}
+	if !OfflineMode {
+		return nil
+	}
+	return charts.CheckCached(context.Background(), getPackages())
+}
+
+func warmCache(c *cli.Context) {
+	ctx := context.Background()
+
+	if OfflineMode {
+		logger.Fatal(ctx, "cache-warm cannot run in offline mode")
+	}
+	CacheMode = true
+	// nothing is evicted while warming, so that every upstream warmed is still cached once done; the limit is checked then
+	maxSize := int64(CacheMaxSize) * 1024 * 1024
+	CacheMaxSize = 0
+	if err := setupCache(c); err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	if err := setupCredentials(c); err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	if err := charts.WarmCache(ctx, RepoRoot, getPackages()); err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	if size := puller.RootCache.Size(); maxSize > 0 && size > maxSize {
+		logger.Fatal(ctx, fmt.Sprintf("the warmed cache takes %d MiB, more than the cacheMaxSize of %d MiB: the next pulls would evict warmed upstreams, raise cacheMaxSize or set it to 0", size/1024/1024, maxSize/1024/1024))
+	}
+	logger.Log(ctx, slog.LevelInfo, "copy the cache to the same path of the repository on the offline host",
+		slog.String("cache", filepath.Join(RepoRoot, path.DefaultCachePath)))
+}
+
+func setupCredentials(c *cli.Context) error {
+	ctx := context.Background()
+
+	getRepoRoot()
+	configFile := ChartsScriptOptionsFile
+	if configFile == "" {
+		configFile = filepath.Join(RepoRoot, defaultChartsScriptOptionsFile)
+	}
+	configYaml, err := os.ReadFile(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		// per-host entries are optional, credentials can still come from the environment, netrc or docker config
+		logger.Log(ctx, slog.LevelDebug, "no configuration file found for credentials", slog.String("config", configFile))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read configuration file: %w", err)
+	}
+	chartsScriptOptions := options.ChartsScriptOptions{}
+	if err := yaml.UnmarshalStrict(configYaml, &chartsScriptOptions); err != nil {
+		return fmt.Errorf("unable to unmarshall configuration file: %w", err)
+	}
+	credentials.InitRootKeychain(ctx, chartsScriptOptions.Credentials)
+	return nil
 }
 
 func cleanCache(c *cli.Context) {
 	ctx := context.Background()
 
 	getRepoRoot()
-	if err := puller.CleanRootCache(ctx, RepoRoot, path.DefaultCachePath); err != nil {
+	if err := puller.CleanRootCache(ctx, RepoRoot, path.DefaultCachePath, CacheOlderThan); err != nil {
 		logger.Fatal(ctx, err.Error())
 	}
 }
@@ -822,6 +1360,14 @@ func getRepoRoot() {
 	RepoRoot = repoRoot
 }
 
+// forEachPackage runs do on every package, working on at most Jobs packages at the same time.
+// The logs of each package carry its name and the errors of every package are returned together.
+func forEachPackage(ctx context.Context, packages []*charts.Package, do func(ctx context.Context, p *charts.Package) error) error {
+	return scheduler.Run(ctx, Jobs, packages, charts.PackageName, func(ctx context.Context, p *charts.Package) error {
+		return do(logger.WithPackage(ctx, p.Name), p)
+	})
+}
+
 func getPackages() []*charts.Package {
 	ctx := context.Background()
 
@@ -836,7 +1382,11 @@ func getPackages() []*charts.Package {
 func checkImages(c *cli.Context) {
 	ctx := context.Background()
 
-	if err := registries.DockerScan(ctx); err != nil {
+	report, err := registries.DockerScan(ctx)
+	if report != nil {
+		printReport(ctx, report, output.FormatTable)
+	}
+	if err != nil {
 		logger.Fatal(ctx, err.Error())
 	}
 }
@@ -849,6 +1399,7 @@ func lintImages(c *cli.Context) {
 		logger.Fatal(ctx, err.Error())
 	}
 
+	printReport(ctx, registries.LintReport{Warnings: append([]registries.LintWarning{}, warnings...)}, output.FormatTable)
 	if len(warnings) > 0 {
 		for _, w := range warnings {
 			logger.Log(ctx, slog.LevelError, "image lint failure",
@@ -876,9 +1427,12 @@ func checkRCTagsAndVersions(c *cli.Context) {
 		logger.Fatal(ctx, fmt.Errorf("unable to check for RC charts: %w", err).Error())
 	}
 
+	report := charts.RCReport{Images: rcImageTagMap, Charts: rcChartVersionMap}
+	printReport(ctx, report, output.FormatTable)
+
 	// If there are any charts that contains RC version or images that contains RC tags
 	// log them and return an error
-	if len(rcChartVersionMap) > 0 || len(rcImageTagMap) > 0 {
+	if report.Failed() {
 		logger.Log(ctx, slog.LevelError, "found images with RC tags", slog.Any("rcImageTagMap", rcImageTagMap))
 		logger.Log(ctx, slog.LevelError, "found charts with RC version", slog.Any("rcChartVersionMap", rcChartVersionMap))
 		logger.Fatal(ctx, "RC check has failed")
@@ -902,10 +1456,74 @@ func lifecycleStatus(c *cli.Context) {
 
 	// Execute lifecycle status check and save the logs
 	logger.Log(ctx, slog.LevelDebug, "checking lifecycle status and saving logs")
-	_, err = lifeCycleDep.CheckLifecycleStatusAndSave(ctx, CurrentChart)
+	status, err := lifeCycleDep.CheckLifecycleStatusAndSave(ctx, CurrentChart)
 	if err != nil {
 		logger.Fatal(ctx, fmt.Errorf("failed to check lifecycle status: %w", err).Error())
 	}
+	printReport(ctx, status, output.FormatTable)
+}
+
+func lifecycleDiff(c *cli.Context) {
+	ctx := context.Background()
+
+	getRepoRoot()
+	repo, err := git.OpenGitRepo(ctx, RepoRoot)
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+
+	from, err := lifecycle.StatusAt(ctx, repo, c.String("from"), c.String("branch-version"))
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("failed to compute the lifecycle status at %s: %w", c.String("from"), err).Error())
+	}
+	to, err := lifecycle.StatusAt(ctx, repo, c.String("to"), c.String("branch-version"))
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("failed to compute the lifecycle status at %s: %w", c.String("to"), err).Error())
+	}
+
+	printReport(ctx, lifecycle.DiffStatus(ctx, from, to, c.String("from"), c.String("to"), CurrentChart), output.FormatMarkdown)
+}
+
+func lifecycleMatrix(c *cli.Context) {
+	ctx := context.Background()
+
+	getRepoRoot()
+	rootFs := filesystem.GetFilesystem(RepoRoot)
+	repo, err := git.OpenGitRepo(ctx, RepoRoot)
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+
+	matrix, err := lifecycle.BuildMatrix(ctx, rootFs, repo, CurrentChart)
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("failed to build the lifecycle matrix: %w", err).Error())
+	}
+	printReport(ctx, matrix, output.FormatHTML)
+}
+
+func lifecyclePrune(c *cli.Context) {
+	ctx := context.Background()
+
+	getRepoRoot()
+	rootFs := filesystem.GetFilesystem(RepoRoot)
+	dependencies, err := lifecycle.InitDependencies(ctx, rootFs, RepoRoot, c.String("branch-version"), CurrentChart, false)
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("encountered error while initializing dependencies: %w", err).Error())
+	}
+
+	status, err := lifecycle.LoadState(rootFs)
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("could not load state; please run lifecycle-status before this command: %w", err).Error())
+	}
+
+	report, err := auto.Prune(ctx, dependencies, status, CurrentChart)
+	if err != nil {
+		if report != nil {
+			printReport(ctx, report, output.FormatTable)
+		}
+		logger.Fatal(ctx, err.Error())
+	}
+	printReport(ctx, report, output.FormatTable)
 }
 
 func release(c *cli.Context) {
@@ -918,6 +1536,7 @@ func release(c *cli.Context) {
 	if CurrentChart == "" {
 		logger.Fatal(ctx, "CHART environment variable must be set to run release cmd")
 	}
+	ctx = logger.WithChart(ctx, CurrentChart, ChartVersion)
 	getRepoRoot()
 	rootFs := filesystem.GetFilesystem(RepoRoot)
 
@@ -957,6 +1576,35 @@ func release(c *cli.Context) {
 	createOrUpdateIndex(c)
 }
 
+func forwardPort(c *cli.Context) {
+	ctx := context.Background()
+
+	if ForkURL == "" {
+		logger.Fatal(ctx, "FORK environment variable must be set to run forward-port cmd")
+	}
+
+	getRepoRoot()
+	rootFs := filesystem.GetFilesystem(RepoRoot)
+	dependencies, err := lifecycle.InitDependencies(ctx, rootFs, RepoRoot, c.String("branch-version"), CurrentChart, false)
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("encountered error while initializing dependencies: %w", err).Error())
+	}
+
+	status, err := lifecycle.LoadState(rootFs)
+	if err != nil {
+		logger.Fatal(ctx, fmt.Errorf("could not load state; please run lifecycle-status before this command: %w", err).Error())
+	}
+
+	report, err := auto.ForwardPort(ctx, dependencies, status, CurrentChart, ForkURL)
+	if err != nil {
+		if report != nil {
+			printReport(ctx, report, output.FormatTable)
+		}
+		logger.Fatal(ctx, fmt.Errorf("failed to forward-port: %w", err).Error())
+	}
+	printReport(ctx, report, output.FormatTable)
+}
+
 func validateRelease(c *cli.Context) {
 	ctx := context.Background()
 
@@ -967,31 +1615,82 @@ func validateRelease(c *cli.Context) {
 		logger.Fatal(ctx, fmt.Errorf("encountered error while initializing dependencies: %w", err).Error())
 	}
 
-	if err := validate.PullRequests(ctx, GithubToken, PullRequest, Branch, dependencies); err != nil {
+	provider, number, err := pullRequestProvider(ctx)
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+
+	report, err := validate.PullRequests(ctx, provider, number, Branch, dependencies)
+	if report != nil {
+		printReport(ctx, report, output.FormatTable)
+	}
+	if err != nil {
 		logger.Fatal(ctx, fmt.Errorf("failed to validate pull request: %w", err).Error())
 	}
 }
 
+// pullRequestProvider returns the provider of the pull request to validate and its number:
+// the local commits since DiffBase if it is set, the pull request PullRequest of GithubRepository otherwise
+func pullRequestProvider(ctx context.Context) (pullrequest.Provider, int, error) {
+	if DiffBase != "" {
+		repo, err := git.OpenGitRepo(ctx, RepoRoot)
+		if err != nil {
+			return nil, 0, err
+		}
+		return pullrequest.NewLocalDiff(repo, DiffBase), 0, nil
+	}
+
+	if GithubToken == "" {
+		return nil, 0, errors.New("GH_TOKEN environment variable must be set to run validate-release-charts, or DIFF_BASE to validate local changes")
+	}
+	if PullRequest == "" {
+		return nil, 0, errors.New("PR_NUMBER environment variable must be set to run validate-release-charts, or DIFF_BASE to validate local changes")
+	}
+	number, err := strconv.Atoi(PullRequest)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid PR number %q: %w", PullRequest, err)
+	}
+	owner, repo, err := pullrequest.SplitRepository(GithubRepository)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pullrequest.NewGitHub(ctx, GithubToken, owner, repo), number, nil
+}
+
 func compareIndexFiles(c *cli.Context) {
 	ctx := context.Background()
 
 	getRepoRoot()
 	rootFs := filesystem.GetFilesystem(RepoRoot)
 
-	if err := validate.CompareIndexFiles(ctx, rootFs, Branch); err != nil {
+	opts := validate.IndexCompareOptions{IgnoreCreated: IgnoreCreated}
+	if _, err := os.Stat(ChartsScriptOptionsFile); err == nil {
+		opts.CNAME = parseScriptOptions(ctx).HelmRepoConfiguration.CNAME
+	}
+
+	report, err := validate.CompareIndexFiles(ctx, rootFs, Branch, opts)
+	if report != nil {
+		printReport(ctx, report, output.FormatTable)
+	}
+	if err != nil {
 		logger.Fatal(ctx, fmt.Errorf("failed to compare index files: %w", err).Error())
 	}
 
-	logger.Log(ctx, slog.LevelInfo, "index.yaml files are the same at git repository and charts.rancher.io")
+	logger.Log(ctx, slog.LevelInfo, "index.yaml files are the same at git repository and "+report.URL)
 }
 
 func chartBump(c *cli.Context) {
-	ctx := context.Background()
+	ctx := logger.WithPackage(context.Background(), CurrentPackage)
 
+	getRepoRoot()
 	ChartsScriptOptionsFile = path.ConfigurationYamlFile
 	chartsScriptOptions := parseScriptOptions(ctx)
 
-	if err := auto.BumpChart(ctx,
+	bumpChart := auto.BumpChart
+	if DryRun {
+		bumpChart = auto.BumpChartDryRun
+	}
+	if err := bumpChart(ctx,
 		MultiRC,      /* multiRC support (doesn't delete previous RC version) */
 		NewChart,     /* newChart (net new chart, no previous versions) */
 		IsPrimeChart, /* isPrimeChart (used by rancher prime charts only) */
@@ -1000,6 +1699,80 @@ func chartBump(c *cli.Context) {
 	}
 }
 
+func verifyPublished(c *cli.Context) {
+	ctx := context.Background()
+
+	getRepoRoot()
+	rootFs := filesystem.GetFilesystem(RepoRoot)
+
+	baseURL := BaseURL
+	if baseURL == "" {
+		helmRepo := options.HelmRepoConfiguration{}
+		if _, err := os.Stat(ChartsScriptOptionsFile); err == nil {
+			helmRepo = parseScriptOptions(ctx).HelmRepoConfiguration
+		}
+		baseURL = helmRepo.URL()
+	}
+
+	report, err := registries.VerifyPublished(ctx, rootFs, registries.PublishedOptions{
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		Jobs:          Jobs,
+		OCIDNS:        OciDNS,
+		OCICustomPath: CustomOCIPAth,
+		OCIUser:       OciUser,
+		OCIPassword:   OciPassword,
+		OCIDebug:      DebugMode,
+	})
+	if report != nil {
+		printReport(ctx, report, output.FormatTable)
+	}
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+
+	logger.Log(ctx, slog.LevelInfo, "every chart version of index.yaml is published", slog.String("baseURL", report.BaseURL), slog.Int("checked", report.Checked))
+}
+
+// setupSigning makes the generated archives signed if a signing key is given
+func setupSigning(ctx context.Context) {
+	if SignKey == "" {
+		return
+	}
+	if Keyring == "" {
+		logger.Fatal(ctx, "a keyring holding the signing key must be provided with --keyring")
+	}
+	err := helm.SetupSigning(helm.SigningOptions{
+		Key:            SignKey,
+		Keyring:        Keyring,
+		PassphraseFile: PassphraseFile,
+	})
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	logger.Log(ctx, slog.LevelInfo, "signing generated archives", slog.String("key", SignKey))
+}
+
+func verifyProvenance(c *cli.Context) {
+	ctx := context.Background()
+
+	getRepoRoot()
+	rootFs := filesystem.GetFilesystem(RepoRoot)
+
+	keyring, err := helm.LoadKeyring(Keyring)
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+	report, err := helm.VerifyAssetsProvenance(ctx, rootFs, keyring)
+	if report != nil {
+		printReport(ctx, report, output.FormatTable)
+	}
+	if err != nil {
+		logger.Fatal(ctx, err.Error())
+	}
+
+	logger.Log(ctx, slog.LevelInfo, "every asset has a valid provenance", slog.Int("checked", report.Checked))
+}
+
 func updateOCIRegistry(c *cli.Context) {
 	ctx := context.Background()
 
@@ -1034,19 +1807,18 @@ func syncRegistries(c *cli.Context) {
 
 func removeAsset(_ *cli.Context) {
 	ctx := context.Background()
+	getRepoRoot()
 	if err := charts.DeleteVersion(ctx, filesystem.GetFilesystem(RepoRoot), CurrentChart, ChartVersion); err != nil {
 		logger.Fatal(ctx, err.Error())
 	}
 }
 
 func validateImageVersions(_ *cli.Context) {
-	ctx := context.Background()
+	ctx := logger.WithChart(context.Background(), CurrentChart, ChartVersion)
 	getRepoRoot()
 	report, err := registries.ValidateImageVersions(ctx, RepoRoot, CurrentChart, ChartVersion)
 	if err != nil {
 		logger.Fatal(ctx, fmt.Errorf("validate-image-versions failed: %w", err).Error())
 	}
-	if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
-		logger.Fatal(ctx, fmt.Errorf("encoding report: %w", err).Error())
-	}
+	printReport(ctx, report, output.FormatJSON)
 }
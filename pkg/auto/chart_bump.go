@@ -7,16 +7,20 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
 	"github.com/rancher/charts-build-scripts/pkg/charts"
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/git"
 	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
 	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/puller"
 	"github.com/rancher/charts-build-scripts/pkg/validate"
 )
 
@@ -77,6 +81,12 @@ type Bump struct {
 	// git and filesystem
 	repo   *git.Git
 	rootFs billy.Filesystem
+	// files left with conflict markers after rebasing the patches onto the new upstream
+	conflicts []string
+	// files whose patches were merged with the new upstream or applied with fuzz, without conflicts
+	fuzzed []string
+	// previousUpstream is the upstream of the last bump the patches are rebased from, if it can be pulled again
+	previousUpstream puller.Puller
 }
 
 // target chart, CRD and additional chart.
@@ -86,12 +96,17 @@ type target struct {
 	additional  []string
 	bumpVersion string
 	branchLine  string
+	// upstreamVersion is the version of a Helm repository upstream the bump is pinned to
+	upstreamVersion string
 }
 
-// BumpOutput defines the structure that will be written to config/bump.json
+// BumpOutput defines the structure that will be written to config/bump_version.json
 type BumpOutput struct {
-	Charts     []string `json:"charts"`      // List of charts processed
-	NewVersion string   `json:"new_version"` // The single version applied
+	Charts     []string `json:"charts"`              // List of charts processed
+	NewVersion string   `json:"new_version"`         // The single version applied
+	Draft      bool     `json:"draft,omitempty"`     // The pull request must be opened as a draft since there are conflicts to resolve or merges to review
+	Conflicts  []string `json:"conflicts,omitempty"` // Files left with conflict markers by the patch rebase
+	Fuzzed     []string `json:"fuzzed,omitempty"`    // Files whose patches the patch rebase merged with the new upstream or applied with fuzz
 }
 
 var (
@@ -110,6 +125,7 @@ var (
 	errChartRepoCommit           = errors.New("chart upstream commit field should not be provided")
 	errChartRepoBranch           = errors.New("chart upstream branch field must be provided")
 	errChartSubDir               = errors.New("chart upstream subdirectory field must be provided")
+	errChartHelmRepo             = errors.New("chart upstream helm repository must provide repoURL and chart fields")
 	errAdditionalChartWorkDir    = errors.New("additional chart template directory not loaded")
 	errCRDWorkDir                = errors.New("additional chart CRDs directory not loaded")
 	errChartLatestVersion        = errors.New("latest version not found for chart")
@@ -169,6 +185,12 @@ func BumpChart(ctx context.Context,
 		return err
 	}
 
+	// the conflict markers are now part of the patches, stop here so that they are resolved in a draft pull request
+	if len(b.conflicts) > 0 {
+		logger.Log(ctx, slog.LevelWarn, "patches conflict with the new upstream, skipping make charts", slog.Any("conflicts", b.conflicts))
+		return b.writeBumpJSON(ctx, b.target.additional, b.Pkg.AutoGeneratedBumpVersion.String())
+	}
+
 	if err := b.clean(ctx); err != nil {
 		return err
 	}
@@ -195,6 +217,95 @@ func BumpChart(ctx context.Context,
 	return b.writeBumpJSON(ctx, b.target.additional, b.Pkg.AutoGeneratedBumpVersion.String())
 }
 
+// BumpChartDryRun previews BumpChart without touching the repository.
+// Bumping a chart runs make targets and commits after each of them, which cannot be done in memory,
+// so the bump runs in a throwaway worktree of HEAD. The files it changed are then written to the dry-run overlay
+// of the repository and its commits are recorded in the plan.
+// Since the worktree does not carry uncommitted changes, the repository must be clean.
+func BumpChartDryRun(ctx context.Context,
+	multiRCs, newChart, isPrimeChart bool,
+	repoRoot, currentPackage, branch, versionOverride string,
+	chartsScriptOptions *options.ChartsScriptOptions) error {
+	repo, err := git.OpenGitRepo(ctx, repoRoot)
+	if err != nil {
+		return err
+	}
+	if err := repo.IsClean(ctx); err != nil {
+		return fmt.Errorf("the dry run bumps the chart from HEAD, commit or stash the local changes first: %w", err)
+	}
+	start, err := repo.HeadCommit(ctx)
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", "chart-bump-dry-run")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	sandboxRoot := filepath.Join(tempDir, "repo")
+	if err := repo.AddWorktree(ctx, sandboxRoot); err != nil {
+		return err
+	}
+	defer func() {
+		if err := repo.RemoveWorktree(ctx, sandboxRoot); err != nil {
+			logger.Log(ctx, slog.LevelWarn, "unable to remove dry-run worktree", logger.Err(err))
+		}
+	}()
+
+	if err := bumpInSandbox(ctx, multiRCs, newChart, isPrimeChart, sandboxRoot, currentPackage, branch, versionOverride, chartsScriptOptions); err != nil {
+		return err
+	}
+
+	sandbox, err := git.OpenGitRepo(ctx, sandboxRoot)
+	if err != nil {
+		return err
+	}
+	commits, err := sandbox.CommitSubjects(ctx, start)
+	if err != nil {
+		return err
+	}
+	for _, commit := range commits {
+		dryrun.Record(ctx, dryrun.ActionCommit, commit, repoRoot)
+	}
+
+	changed, removed, err := sandbox.ChangedFiles(ctx, start)
+	if err != nil {
+		return err
+	}
+	sandboxFs := filesystem.GetFilesystem(sandboxRoot)
+	rootFs := filesystem.GetFilesystem(repoRoot)
+	for _, file := range changed {
+		data, err := billyUtil.ReadFile(sandboxFs, file)
+		if err != nil {
+			return err
+		}
+		if err := rootFs.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			return err
+		}
+		if err := billyUtil.WriteFile(rootFs, file, data, 0644); err != nil {
+			return err
+		}
+	}
+	for _, file := range removed {
+		if err := rootFs.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpInSandbox runs BumpChart for real in the given worktree
+func bumpInSandbox(ctx context.Context,
+	multiRCs, newChart, isPrimeChart bool,
+	sandboxRoot, currentPackage, branch, versionOverride string,
+	chartsScriptOptions *options.ChartsScriptOptions) error {
+	resume := dryrun.Suspend()
+	defer resume()
+
+	return BumpChart(ctx, multiRCs, newChart, isPrimeChart, sandboxRoot, currentPackage, branch, versionOverride, chartsScriptOptions)
+}
+
 // setupBump will load and parse all related information to the chart that should be bumped.
 func setupBump(ctx context.Context, repoRoot, targetPackage, targetBranch string, chScriptOpts *options.ChartsScriptOptions, newChart bool) (*Bump, error) {
 	logger.Log(ctx, slog.LevelInfo, "setup auto-chart-bump")
@@ -289,9 +400,47 @@ func setupBump(ctx context.Context, repoRoot, targetPackage, targetBranch string
 		logger.Log(ctx, slog.LevelInfo, "", slog.String("last version", bump.assetsVersionsMap[bump.target.main][0].Version))
 	}
 
+	if helmRepository, ok := bump.Pkg.Upstream.(puller.HelmRepository); ok {
+		if err := bump.pinHelmRepository(ctx, helmRepository); err != nil {
+			return bump, err
+		}
+	}
+
 	return bump, nil
 }
 
+// pinHelmRepository resolves the newest version of a Helm repository upstream and pins the upstream to it,
+// so that the bump pulls the version checked here even if a newer one is published meanwhile.
+// Like prepare does for git upstreams, it fails if the version was already bumped to.
+func (b *Bump) pinHelmRepository(ctx context.Context, helmRepository puller.HelmRepository) error {
+	latestVersion, err := helmRepository.LatestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Log(ctx, slog.LevelInfo, "", slog.String("newest upstream version", latestVersion))
+
+	alreadyExist, err := checkBumpAppVersion(ctx, &latestVersion, b.assetsVersionsMap[b.target.main])
+	if err != nil {
+		return err
+	}
+	if alreadyExist {
+		return fmt.Errorf("version to bump already exists: %s", latestVersion)
+	}
+
+	if versions := b.assetsVersionsMap[b.target.main]; len(versions) > 0 {
+		if _, previousVersion, found := strings.Cut(versions[0].Version, "+up"); found {
+			previous := helmRepository
+			previous.Version = previousVersion
+			b.previousUpstream = previous
+		}
+	}
+
+	b.target.upstreamVersion = latestVersion
+	helmRepository.Version = latestVersion
+	b.Pkg.Upstream = helmRepository
+	return nil
+}
+
 // parseBranchVersion trims the prefix and returns the branch line
 func parseBranchVersion(targetBranch string) (string, error) {
 	if !strings.HasPrefix(targetBranch, "dev-v") {
@@ -379,6 +528,14 @@ func (b *Bump) parsePackageYaml(packages []*charts.Package) error {
 
 // checkUpstreamOptions checks if the UpstreamOptions fields are properly loaded
 func checkUpstreamOptions(options *options.UpstreamOptions) error {
+	// Helm repositories are resolved through their index.yaml, the newest version matching the constraint is always pulled
+	if options.HelmRepository != nil {
+		if options.HelmRepository.RepoURL == "" || options.HelmRepository.Chart == "" {
+			return errChartHelmRepo
+		}
+		return nil
+	}
+
 	switch {
 	case !strings.HasSuffix(options.URL, ".git"):
 		return errChartURL
@@ -393,11 +550,19 @@ func checkUpstreamOptions(options *options.UpstreamOptions) error {
 	return nil
 }
 
-// prepare = && git status && git add . && git commit -m "make prepare"
+// prepare = make patch-rebase && git status && git add . && git commit -m "make prepare"
+// Conflicts between the patches and the new upstream are kept in b.conflicts instead of failing,
+// and the files merged without conflicts in b.fuzzed so that they are reviewed.
 func (b *Bump) prepare(ctx context.Context) error {
-	if err := b.Pkg.Prepare(ctx); err != nil {
+	report, err := b.Pkg.RebasePatches(ctx, b.previousUpstream)
+	if err != nil {
 		return fmt.Errorf("failed preparing package in auto-bump: %w", err)
 	}
+	b.conflicts = report.Conflicted()
+	b.fuzzed = report.Fuzzed()
+	if len(b.fuzzed) > 0 {
+		logger.Log(ctx, slog.LevelWarn, "patches were merged with the new upstream, the pull request will be a draft", slog.Any("fuzzed", b.fuzzed))
+	}
 
 	if err := b.repo.Status(ctx); err != nil {
 		return fmt.Errorf("failed to check git status in auto-bump prepare: %w", err)
@@ -412,6 +577,10 @@ func (b *Bump) prepare(ctx context.Context) error {
 		b.repo.FullReset() // quitting the job regardless if this works or not
 		return fmt.Errorf("version to bump already exists: %s", *b.Pkg.UpstreamChartVersion)
 	}
+	if b.target.upstreamVersion != "" && *b.Pkg.UpstreamChartVersion != b.target.upstreamVersion {
+		b.repo.FullReset() // quitting the job regardless if this works or not
+		return fmt.Errorf("pulled upstream version %s instead of the pinned version %s", *b.Pkg.UpstreamChartVersion, b.target.upstreamVersion)
+	}
 
 	if err := b.repo.AddAndCommit("make prepare"); err != nil {
 		return fmt.Errorf("failed to add and commit after make prepare: %w", err)
@@ -583,6 +752,9 @@ func (b *Bump) writeBumpJSON(ctx context.Context, targetCharts []string, bumpVer
 	dataToWrite := BumpOutput{
 		Charts:     targetCharts,
 		NewVersion: bumpVersion,
+		Draft:      len(b.conflicts) > 0 || len(b.fuzzed) > 0,
+		Conflicts:  b.conflicts,
+		Fuzzed:     b.fuzzed,
 	}
 
 	jsonData, err := json.MarshalIndent(dataToWrite, "", "  ")
@@ -590,7 +762,7 @@ func (b *Bump) writeBumpJSON(ctx context.Context, targetCharts []string, bumpVer
 		return err
 	}
 
-	if err := os.WriteFile(path.BumpVersionFile, jsonData, 0644); err != nil {
+	if err := billyUtil.WriteFile(b.rootFs, path.BumpVersionFile, jsonData, 0644); err != nil {
 		return err
 	}
 
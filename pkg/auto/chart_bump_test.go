@@ -2,10 +2,13 @@ package auto
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/blang/semver"
 	"github.com/rancher/charts-build-scripts/pkg/charts"
+	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
 	"github.com/rancher/charts-build-scripts/pkg/options"
 	"github.com/rancher/charts-build-scripts/pkg/puller"
 	"github.com/stretchr/testify/assert"
@@ -381,6 +384,14 @@ func Test_parsePackageYaml(t *testing.T) {
 			},
 			expected: expected{err: errChartSubDir},
 		},
+		{
+			name: "#10.1",
+			input: input{
+				packages: newValidPackagesFunc(),
+				b:        &Bump{target: target{main: "rancher-chart"}},
+			},
+			expected: expected{err: errChartHelmRepo},
+		},
 		{
 			name: "#11",
 			input: input{
@@ -448,6 +459,11 @@ func Test_parsePackageYaml(t *testing.T) {
 						Subdirectory:    nil,
 					},
 				)
+			case "#10.1":
+				// charts.GetUpstream already rejects it, build the puller directly
+				tc.input.packages[0].Chart.Upstream = puller.HelmRepository{
+					RepoURL: "https://charts.example.com",
+				}
 
 			// additional chart errors
 			case "#11":
@@ -513,3 +529,43 @@ func Test_parsePackageYaml(t *testing.T) {
 		})
 	}
 }
+
+func Test_pinHelmRepository(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`apiVersion: v1
+entries:
+  chart:
+  - name: chart
+    version: 1.2.0
+    urls:
+    - chart-1.2.0.tgz
+  - name: chart
+    version: 1.1.0
+    urls:
+    - chart-1.1.0.tgz
+`))
+	}))
+	defer server.Close()
+	helmRepository := puller.HelmRepository{RepoURL: server.URL, Chart: "chart", Version: "^1.0.0"}
+
+	// the newest version is pinned
+	b := &Bump{
+		target:            target{main: "rancher-chart"},
+		Pkg:               &charts.Package{Chart: charts.Chart{Upstream: helmRepository}},
+		assetsVersionsMap: map[string][]lifecycle.Asset{"rancher-chart": {{Version: "101.0.0+up1.1.0"}}},
+	}
+	assert.NoError(t, b.pinHelmRepository(context.Background(), helmRepository))
+	assert.Equal(t, "1.2.0", b.target.upstreamVersion)
+	assert.Equal(t, puller.HelmRepository{RepoURL: server.URL, Chart: "chart", Version: "1.2.0"}, b.Pkg.Upstream)
+	// the patches are rebased from the upstream version of the last bump
+	assert.Equal(t, puller.HelmRepository{RepoURL: server.URL, Chart: "chart", Version: "1.1.0"}, b.previousUpstream)
+
+	// the newest version was already bumped to
+	b = &Bump{
+		target:            target{main: "rancher-chart"},
+		Pkg:               &charts.Package{Chart: charts.Chart{Upstream: helmRepository}},
+		assetsVersionsMap: map[string][]lifecycle.Asset{"rancher-chart": {{Version: "101.1.0+up1.2.0"}}},
+	}
+	assert.EqualError(t, b.pinHelmRepository(context.Background(), helmRepository), "version to bump already exists: 1.2.0")
+	assert.Equal(t, helmRepository, b.Pkg.Upstream)
+}
@@ -0,0 +1,173 @@
+package auto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+)
+
+// ForwardPortReport lists the commits made by ForwardPort on the branch pushed to the fork remote
+type ForwardPortReport struct {
+	Branch  string             `json:"branch"`
+	Remote  string             `json:"remote"`
+	Commits []ForwardPortGroup `json:"commits"`
+}
+
+// ForwardPortGroup is a version of a chart of ChartTargetsMap to forward-port along with the same version of its related charts, in a single commit
+type ForwardPortGroup struct {
+	// Chart is the main chart of ChartTargetsMap, or the chart itself if it is not listed there
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+	// Charts are the charts forward-ported, the main chart included
+	Charts []string `json:"charts"`
+}
+
+// Header returns the columns of the forward-port report
+func (r *ForwardPortReport) Header() []string {
+	return []string{"BRANCH", "CHART", "VERSION", "CHARTS"}
+}
+
+// Rows returns a row per commit of the forward-port branch
+func (r *ForwardPortReport) Rows() [][]string {
+	rows := make([][]string, 0, len(r.Commits))
+	for _, c := range r.Commits {
+		rows = append(rows, []string{r.Branch, c.Chart, c.Version, strings.Join(c.Charts, ", ")})
+	}
+	return rows
+}
+
+// CommitMessage returns the message of the commit that forward-ports the group
+func (g ForwardPortGroup) CommitMessage() string {
+	return fmt.Sprintf("forward-port %s %s (%s)", g.Chart, g.Version, strings.Join(g.Charts, ", "))
+}
+
+// ForwardPort releases on a new branch every chart version that the lifecycle-status state lists to be forward-ported,
+// with a commit per version of a chart and its related charts of ChartTargetsMap, and pushes the branch to the fork remote.
+// If chart is not empty, only the versions of its group are forward-ported.
+// The working tree must be clean.
+func ForwardPort(ctx context.Context, d *lifecycle.Dependencies, s *lifecycle.Status, chart, forkURL string) (*ForwardPortReport, error) {
+	// every commit stages all the changes of the working tree, which must only hold the forward-ported versions
+	if err := d.Git.IsClean(ctx); err != nil {
+		return nil, err
+	}
+
+	forkRemote, ok := d.Git.Remotes[forkURL]
+	if !ok {
+		return nil, fmt.Errorf("fork remote not configured: %s", forkURL)
+	}
+
+	report := &ForwardPortReport{
+		Branch: fmt.Sprintf("forward-port-%s-%s", d.VR.ProdBranch, time.Now().UTC().Format("20060102-1504")),
+		Remote: forkRemote,
+	}
+	groups := forwardPortGroups(s.AssetsToBeForwardPorted, chart)
+	if len(groups) == 0 {
+		logger.Log(ctx, slog.LevelInfo, "no chart version to forward-port")
+		return report, nil
+	}
+
+	if err := d.Git.CreateAndCheckoutBranch(report.Branch); err != nil {
+		return report, err
+	}
+	for _, group := range groups {
+		for _, name := range group.Charts {
+			if err := forwardPortVersion(ctx, d, s, name, group.Version, forkURL); err != nil {
+				return report, fmt.Errorf("failed to forward-port %s %s: %w", name, group.Version, err)
+			}
+		}
+		if err := helm.CreateOrUpdateHelmIndex(ctx, d.RootFs); err != nil {
+			return report, err
+		}
+		if err := d.Git.AddAndCommit(group.CommitMessage()); err != nil {
+			return report, err
+		}
+		report.Commits = append(report.Commits, group)
+	}
+
+	if err := d.Git.PushBranch(forkRemote, report.Branch); err != nil {
+		return report, err
+	}
+	logger.Log(ctx, slog.LevelInfo, "forward-port branch pushed", slog.String("remote", forkRemote), slog.String("branch", report.Branch), slog.Int("commits", len(report.Commits)))
+	return report, nil
+}
+
+// forwardPortVersion pulls the asset of the chart version from the development branch, as the release command does,
+// and appends it to the release.yaml
+func forwardPortVersion(ctx context.Context, d *lifecycle.Dependencies, s *lifecycle.Status, chart, version, forkURL string) error {
+	ctx = logger.WithChart(ctx, chart, version)
+
+	r, err := InitRelease(ctx, d, s, version, chart, forkURL)
+	if err != nil {
+		return err
+	}
+	if err := r.PullAsset(); err != nil {
+		return err
+	}
+	if err := helm.DumpAssets(ctx, d.RootFs.Root(), r.Chart+"/"+r.AssetTgz); err != nil {
+		return err
+	}
+	if err := r.PullIcon(ctx, d.RootFs); err != nil {
+		return err
+	}
+	return r.UpdateReleaseYaml(ctx, false)
+}
+
+// forwardPortGroups groups the chart versions to forward-port by main chart of ChartTargetsMap and version,
+// sorted by main chart and version
+func forwardPortGroups(assets map[string][]lifecycle.Asset, chart string) []ForwardPortGroup {
+	byKey := make(map[string]*ForwardPortGroup)
+	var groups []*ForwardPortGroup
+	for name, versions := range assets {
+		main := mainChart(name)
+		if chart != "" && main != mainChart(chart) {
+			continue
+		}
+		for _, version := range versions {
+			key := main + "/" + version.Version
+			group, ok := byKey[key]
+			if !ok {
+				group = &ForwardPortGroup{Chart: main, Version: version.Version}
+				byKey[key] = group
+				groups = append(groups, group)
+			}
+			if !slices.Contains(group.Charts, name) {
+				group.Charts = append(group.Charts, name)
+			}
+		}
+	}
+
+	sorted := make([]ForwardPortGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.Charts)
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Chart != sorted[j].Chart {
+			return sorted[i].Chart < sorted[j].Chart
+		}
+		return util.SortUpstreamAppVersions(sorted[j].Version, sorted[i].Version)
+	})
+	return sorted
+}
+
+// mainChart returns the chart of ChartTargetsMap the chart is related to, or the chart itself if it is not listed there
+func mainChart(chart string) string {
+	if _, ok := ChartTargetsMap[chart]; ok {
+		return chart
+	}
+	for main, targets := range ChartTargetsMap {
+		if slices.Contains(targets, chart) {
+			return main
+		}
+	}
+	return chart
+}
@@ -0,0 +1,68 @@
+package auto
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_forwardPortGroups(t *testing.T) {
+	assets := map[string][]lifecycle.Asset{
+		"fleet":           {{Version: "104.1.0+up0.10.1"}, {Version: "104.0.0+up0.10.0"}},
+		"fleet-crd":       {{Version: "104.0.0+up0.10.0"}, {Version: "104.1.0+up0.10.1"}},
+		"fleet-agent":     {{Version: "104.0.0+up0.10.0"}},
+		"rancher-logging": {{Version: "104.0.0+up4.4.0"}},
+		"not-listed":      {{Version: "1.0.0"}},
+	}
+
+	assert.Equal(t, []ForwardPortGroup{
+		{Chart: "fleet", Version: "104.0.0+up0.10.0", Charts: []string{"fleet", "fleet-agent", "fleet-crd"}},
+		{Chart: "fleet", Version: "104.1.0+up0.10.1", Charts: []string{"fleet", "fleet-crd"}},
+		{Chart: "not-listed", Version: "1.0.0", Charts: []string{"not-listed"}},
+		{Chart: "rancher-logging", Version: "104.0.0+up4.4.0", Charts: []string{"rancher-logging"}},
+	}, forwardPortGroups(assets, ""))
+
+	// the chart filter keeps the related charts
+	assert.Equal(t, []ForwardPortGroup{
+		{Chart: "fleet", Version: "104.0.0+up0.10.0", Charts: []string{"fleet", "fleet-agent", "fleet-crd"}},
+		{Chart: "fleet", Version: "104.1.0+up0.10.1", Charts: []string{"fleet", "fleet-crd"}},
+	}, forwardPortGroups(assets, "fleet-crd"))
+
+	assert.Equal(t, "forward-port fleet 104.0.0+up0.10.0 (fleet, fleet-agent, fleet-crd)", forwardPortGroups(assets, "fleet")[0].CommitMessage())
+	assert.Empty(t, forwardPortGroups(map[string][]lifecycle.Asset{}, ""))
+}
+
+func Test_ForwardPort_dirty(t *testing.T) {
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	dir := t.TempDir()
+	run(dir, "init", "-q", "-b", "dev-v2.10")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("charts"), 0644))
+	run(dir, "add", "-A")
+	run(dir, "commit", "-q", "-m", "init")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("local change"), 0644))
+
+	d := &lifecycle.Dependencies{
+		Git: &git.Git{Dir: dir, Remotes: map[string]string{"https://github.com/fork/charts": "fork"}},
+		VR:  &lifecycle.VersionRules{ProdBranch: "release-v2.10"},
+	}
+	s := &lifecycle.Status{AssetsToBeForwardPorted: map[string][]lifecycle.Asset{"fleet": {{Version: "104.0.0+up0.10.0"}}}}
+
+	_, err := ForwardPort(context.Background(), d, s, "", "https://github.com/fork/charts")
+	assert.Error(t, err)
+	// nothing was committed on a new branch
+	assert.Equal(t, "dev-v2.10", run(dir, "rev-parse", "--abbrev-ref", "HEAD"))
+}
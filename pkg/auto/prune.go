@@ -0,0 +1,155 @@
+package auto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rancher/charts-build-scripts/pkg/charts"
+	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+)
+
+// PruneReport lists the chart versions removed by Prune and the ones it left in place
+type PruneReport struct {
+	BranchVersion string          `json:"branch_version"`
+	Pruned        []PrunedVersion `json:"pruned"`
+	Skipped       []PrunedVersion `json:"skipped"`
+}
+
+// PrunedVersion is a chart version out of the lifecycle according to the lifecycle-status state
+type PrunedVersion struct {
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+	// Rule is the rule of the lifecycle policy that decided the chart version is out of the lifecycle
+	Rule string `json:"rule"`
+	// Reason explains why the chart version was removed or left in place
+	Reason string `json:"reason"`
+}
+
+// Header returns the columns of the prune report
+func (r *PruneReport) Header() []string {
+	return []string{"RESULT", "CHART", "VERSION", "RULE", "REASON"}
+}
+
+// Rows returns a row per pruned chart version, followed by a row per skipped one
+func (r *PruneReport) Rows() [][]string {
+	rows := make([][]string, 0, len(r.Pruned)+len(r.Skipped))
+	for _, p := range r.Pruned {
+		rows = append(rows, []string{"pruned", p.Chart, p.Version, p.Rule, p.Reason})
+	}
+	for _, p := range r.Skipped {
+		rows = append(rows, []string{"skipped", p.Chart, p.Version, p.Rule, p.Reason})
+	}
+	return rows
+}
+
+// CommitMessage returns the message of the commit that removes the pruned chart versions
+func (r *PruneReport) CommitMessage() string {
+	lines := []string{fmt.Sprintf("remove chart versions out of the %s lifecycle", r.BranchVersion), ""}
+	for _, p := range r.Pruned {
+		lines = append(lines, fmt.Sprintf("- %s %s (%s)", p.Chart, p.Version, p.Rule))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Prune removes from assets/, charts/ and index.yaml every chart version of the current branch that the
+// lifecycle-status state lists out of the lifecycle, adds it to the release.yaml so that validate accepts the removal,
+// and commits the result. If chart is not empty, only its versions are pruned.
+// Each chart version is evaluated again against the lifecycle policy, and left in place if the state is outdated.
+// The working tree must be clean, and only the paths of the pruned chart versions are committed.
+func Prune(ctx context.Context, d *lifecycle.Dependencies, s *lifecycle.Status, chart string) (*PruneReport, error) {
+	if err := d.Git.IsClean(ctx); err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{BranchVersion: d.VR.BranchVersion}
+
+	for _, candidate := range pruneCandidates(s, chart) {
+		ctx := logger.WithChart(ctx, candidate.Chart, candidate.Version)
+
+		if !isInBranch(d.AssetsVersionsMap[candidate.Chart], candidate.Version) {
+			logger.Log(ctx, slog.LevelDebug, "not in the index.yaml of the current branch, nothing to prune")
+			continue
+		}
+
+		decision := d.VR.Evaluate(candidate.Chart, candidate.Version)
+		candidate.Rule, candidate.Reason = decision.Rule, decision.Reason
+		if decision.InLifecycle {
+			logger.Log(ctx, slog.LevelWarn, "in the lifecycle since lifecycle-status ran, skipping", slog.String("rule", decision.Rule), slog.String("reason", decision.Reason))
+			candidate.Reason = "in the lifecycle, run lifecycle-status again: " + decision.Reason
+			report.Skipped = append(report.Skipped, candidate)
+			continue
+		}
+
+		if err := charts.DeleteVersion(ctx, d.RootFs, candidate.Chart, candidate.Version); err != nil {
+			return report, fmt.Errorf("failed to prune %s %s: %w", candidate.Chart, candidate.Version, err)
+		}
+		report.Pruned = append(report.Pruned, candidate)
+	}
+
+	logger.Log(ctx, slog.LevelInfo, "pruned chart versions out of the lifecycle", slog.Int("pruned", len(report.Pruned)), slog.Int("skipped", len(report.Skipped)))
+	if len(report.Pruned) == 0 {
+		return report, nil
+	}
+	if err := d.Git.AddAndCommitPaths(report.CommitMessage(), report.paths()...); err != nil {
+		return report, fmt.Errorf("failed to commit the pruned chart versions: %w", err)
+	}
+	return report, nil
+}
+
+// paths returns the paths DeleteVersion changed for the pruned chart versions
+func (r *PruneReport) paths() []string {
+	paths := []string{path.RepositoryHelmIndexFile, path.RepositoryReleaseYaml}
+	seen := make(map[string]bool)
+	for _, p := range r.Pruned {
+		if seen[p.Chart] {
+			continue
+		}
+		seen[p.Chart] = true
+		paths = append(paths, filepath.Join(path.RepositoryAssetsDir, p.Chart), filepath.Join(path.RepositoryChartsDir, p.Chart))
+	}
+	return paths
+}
+
+// pruneCandidates returns the chart versions out of the lifecycle of the current branch and the released ones
+// out of the lifecycle, without duplicates and sorted by chart and version
+func pruneCandidates(s *lifecycle.Status, chart string) []PrunedVersion {
+	seen := make(map[string]bool)
+	var candidates []PrunedVersion
+	for _, assets := range []map[string][]lifecycle.Asset{s.AssetsOutLifecycleCurrentBranch, s.AssetsReleasedOutLifecycle} {
+		for name, versions := range assets {
+			if chart != "" && name != chart {
+				continue
+			}
+			for _, version := range versions {
+				if seen[name+"/"+version.Version] {
+					continue
+				}
+				seen[name+"/"+version.Version] = true
+				candidates = append(candidates, PrunedVersion{Chart: name, Version: version.Version})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Chart != candidates[j].Chart {
+			return candidates[i].Chart < candidates[j].Chart
+		}
+		return candidates[i].Version < candidates[j].Version
+	})
+	return candidates
+}
+
+// isInBranch returns whether the version is one of the assets of the chart in the current branch
+func isInBranch(assets []lifecycle.Asset, version string) bool {
+	for _, asset := range assets {
+		if asset.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package auto
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pruneIndex = `apiVersion: v1
+entries:
+  fleet:
+  - name: fleet
+    version: 104.0.0+up0.10.0
+    urls:
+    - assets/fleet/fleet-104.0.0+up0.10.0.tgz
+  - name: fleet
+    version: 102.0.0+up0.8.0
+    urls:
+    - assets/fleet/fleet-102.0.0+up0.8.0.tgz
+  - name: fleet
+    version: 101.0.0+up0.7.0
+    urls:
+    - assets/fleet/fleet-101.0.0+up0.7.0.tgz
+  rancher-logging:
+  - name: rancher-logging
+    version: 101.0.0+up3.17.0
+    urls:
+    - assets/rancher-logging/rancher-logging-101.0.0+up3.17.0.tgz
+`
+
+func Test_Prune(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+	writeFile := func(name, data string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(rootDir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(rootDir, name), []byte(data), 0644))
+	}
+	assets := map[string][]lifecycle.Asset{
+		"fleet":           {{Version: "104.0.0+up0.10.0"}, {Version: "102.0.0+up0.8.0"}, {Version: "101.0.0+up0.7.0"}},
+		"rancher-logging": {{Version: "101.0.0+up3.17.0"}},
+	}
+	for chart, versions := range assets {
+		for _, version := range versions {
+			writeFile(filepath.Join("assets", chart, chart+"-"+version.Version+".tgz"), "archive")
+			writeFile(filepath.Join("charts", chart, version.Version, "Chart.yaml"), "name: "+chart+"\n")
+		}
+	}
+	writeFile("index.yaml", pruneIndex)
+	writeFile("release.yaml", "")
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", rootDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "-q", "-b", "release-v2.9")
+	run("add", "-A")
+	run("commit", "-q", "-m", "release")
+	rootFs := filesystem.GetFilesystem(rootDir)
+
+	vr := &lifecycle.VersionRules{BranchVersion: "2.9", MinVersion: 102, MaxVersion: 105}
+	// commits are made with the identity of the environment
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	d := &lifecycle.Dependencies{RootFs: rootFs, AssetsVersionsMap: assets, VR: vr, Git: &git.Git{Dir: rootDir}}
+	s := &lifecycle.Status{
+		AssetsOutLifecycleCurrentBranch: map[string][]lifecycle.Asset{
+			"fleet":           {{Version: "101.0.0+up0.7.0"}},
+			"rancher-logging": {{Version: "101.0.0+up3.17.0"}},
+		},
+		AssetsReleasedOutLifecycle: map[string][]lifecycle.Asset{
+			// listed twice, and out of the lifecycle according to an outdated state
+			"fleet": {{Version: "101.0.0+up0.7.0"}, {Version: "102.0.0+up0.8.0"}},
+			// not in the current branch
+			"rancher-monitoring": {{Version: "100.0.0+up40.0.0"}},
+		},
+	}
+
+	// a dirty working tree is refused before anything is removed
+	writeFile("notes.txt", "local change")
+	_, err := Prune(ctx, d, s, "fleet")
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(rootDir, "assets", "fleet", "fleet-101.0.0+up0.7.0.tgz"))
+	require.NoError(t, os.Remove(filepath.Join(rootDir, "notes.txt")))
+
+	report, err := Prune(ctx, d, s, "fleet")
+	require.NoError(t, err)
+	assert.Equal(t, []PrunedVersion{
+		{Chart: "fleet", Version: "101.0.0+up0.7.0", Rule: lifecycle.RuleDefault, Reason: "older than the 2 previous branch versions (< 102)"},
+	}, report.Pruned)
+	assert.Equal(t, []PrunedVersion{
+		{Chart: "fleet", Version: "102.0.0+up0.8.0", Rule: lifecycle.RuleDefault, Reason: "in the lifecycle, run lifecycle-status again: within the 2 previous branch versions (102 <= version < 105)"},
+	}, report.Skipped)
+	assert.Equal(t, "remove chart versions out of the 2.9 lifecycle\n\n- fleet 101.0.0+up0.7.0 (default)", report.CommitMessage())
+
+	assert.NoFileExists(t, filepath.Join(rootDir, "assets", "fleet", "fleet-101.0.0+up0.7.0.tgz"))
+	assert.NoDirExists(t, filepath.Join(rootDir, "charts", "fleet", "101.0.0+up0.7.0"))
+	assert.FileExists(t, filepath.Join(rootDir, "assets", "fleet", "fleet-102.0.0+up0.8.0.tgz"))
+	// the chart filter leaves the other charts in place
+	assert.FileExists(t, filepath.Join(rootDir, "assets", "rancher-logging", "rancher-logging-101.0.0+up3.17.0.tgz"))
+
+	index, err := helm.OpenIndexYaml(ctx, rootFs)
+	require.NoError(t, err)
+	assert.False(t, index.Has("fleet", "101.0.0+up0.7.0"))
+	assert.True(t, index.Has("fleet", "102.0.0+up0.8.0"))
+
+	releaseYaml, err := options.LoadReleaseYaml(ctx, rootFs)
+	require.NoError(t, err)
+	assert.Equal(t, options.ReleaseOptions{"fleet": {"101.0.0+up0.7.0"}}, releaseYaml)
+
+	// the removal is committed
+	assert.Equal(t, "remove chart versions out of the 2.9 lifecycle", run("log", "-1", "--format=%s"))
+	assert.Empty(t, run("status", "--porcelain"))
+}
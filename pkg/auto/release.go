@@ -39,15 +39,12 @@ func InitRelease(ctx context.Context, d *lifecycle.Dependencies, s *lifecycle.St
 		ForkRemoteURL: f,
 	}
 
-	var ok bool
+	// a chart can have new versions to release and older versions to forward-port at the same time
 	var assetVersions []lifecycle.Asset
-
-	assetVersions, ok = s.AssetsToBeReleased[r.Chart]
-	if !ok {
-		assetVersions, ok = s.AssetsToBeForwardPorted[r.Chart]
-		if !ok {
-			return nil, errors.New("no asset version to release for chart:" + r.Chart)
-		}
+	assetVersions = append(assetVersions, s.AssetsToBeReleased[r.Chart]...)
+	assetVersions = append(assetVersions, s.AssetsToBeForwardPorted[r.Chart]...)
+	if len(assetVersions) == 0 {
+		return nil, errors.New("no asset version to release for chart:" + r.Chart)
 	}
 
 	var assetVersion string
@@ -92,6 +89,13 @@ func (r *Release) PullAsset() error {
 		return err
 	}
 
+	// the provenance file of a signed asset is released along with it
+	if err := r.git.CheckFileExists(r.AssetPath+helm.ProvenanceExt, r.VR.DevBranch); err == nil {
+		if err := r.git.CheckoutFile(r.VR.DevBranch, r.AssetPath+helm.ProvenanceExt); err != nil {
+			return err
+		}
+	}
+
 	return r.git.ResetHEAD()
 }
 
@@ -142,6 +146,7 @@ func (r *Release) UpdateReleaseYaml(ctx context.Context, overwrite bool) error {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	return filesystem.UpdateYamlFile(file, releaseVersions)
 }
@@ -4,8 +4,14 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
+	"github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 )
 
@@ -298,3 +304,47 @@ func Test_mountAssetVersionPath(t *testing.T) {
 		})
 	}
 }
+
+func Test_PullAsset(t *testing.T) {
+	run := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	writeFile := func(dir, name string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	// the upstream remote is matched by its path, see getUpstreamRemote
+	upstream := filepath.Join(t.TempDir(), "github.com", "rancher", "charts")
+	require.NoError(t, os.MkdirAll(upstream, 0755))
+	run(upstream, "init", "-q", "-b", "release-v2.9")
+	writeFile(upstream, "README.md")
+	run(upstream, "add", "-A")
+	run(upstream, "commit", "-q", "-m", "release")
+	run(upstream, "checkout", "-q", "-b", "dev-v2.9")
+	writeFile(upstream, "assets/fleet/fleet-104.0.0+up0.10.0.tgz")
+	writeFile(upstream, "assets/fleet/fleet-104.0.0+up0.10.0.tgz.prov")
+	writeFile(upstream, "assets/fleet/fleet-103.0.0+up0.9.0.tgz")
+	run(upstream, "add", "-A")
+	run(upstream, "commit", "-q", "-m", "dev")
+	run(upstream, "checkout", "-q", "release-v2.9")
+
+	local := filepath.Join(t.TempDir(), "charts")
+	run(".", "clone", "-q", "-o", "upstream", "-b", "release-v2.9", upstream, local)
+	g := &git.Git{Dir: local, Branch: "release-v2.9", Remotes: map[string]string{upstream: "upstream"}}
+	vr := &lifecycle.VersionRules{DevBranch: "dev-v2.9"}
+
+	// a signed asset is released with its provenance file
+	r := &Release{git: g, VR: vr, AssetPath: "assets/fleet/fleet-104.0.0+up0.10.0.tgz"}
+	require.NoError(t, r.PullAsset())
+	assert.FileExists(t, filepath.Join(local, "assets/fleet/fleet-104.0.0+up0.10.0.tgz"))
+	assert.FileExists(t, filepath.Join(local, "assets/fleet/fleet-104.0.0+up0.10.0.tgz.prov"))
+
+	// an unsigned asset is released alone
+	r = &Release{git: g, VR: vr, AssetPath: "assets/fleet/fleet-103.0.0+up0.9.0.tgz"}
+	require.NoError(t, r.PullAsset())
+	assert.FileExists(t, filepath.Join(local, "assets/fleet/fleet-103.0.0+up0.9.0.tgz"))
+	assert.NoFileExists(t, filepath.Join(local, "assets/fleet/fleet-103.0.0+up0.9.0.tgz.prov"))
+}
@@ -13,16 +13,34 @@ import (
 	"github.com/rancher/charts-build-scripts/pkg/path"
 )
 
-// ApplyChanges applies the changes from the gcOverlayDirpath, gcExcludeDirpath, and gcPatchDirpath within gcDir to toDir within the package filesystem
+// ApplyChanges applies the changes from the gcOverlayDirpath, gcExcludeDirpath, gcPatchDirpath and gcYamlPatchDirpath within gcDir to toDir within the package filesystem
 func ApplyChanges(ctx context.Context, fs billy.Filesystem, toDir, gcRootDir string) error {
 	logger.Log(ctx, slog.LevelInfo, "applying changes")
 	// gcRootDir should always end with path.GeneratedChangesDir
 	if !strings.HasSuffix(gcRootDir, path.GeneratedChangesDir) {
 		return fmt.Errorf("root directory for generated changes should end with %s, received: %s", path.GeneratedChangesDir, gcRootDir)
 	}
+	auditReport := auditReportFrom(ctx)
+	if auditReport == nil {
+		return applyChanges(ctx, fs, toDir, gcRootDir)
+	}
+	// keep a copy of the upstream to find the patches that leave files as they are upstream
+	upstreamDir := toDir + auditUpstreamDirSuffix
+	if err := filesystem.CopyDir(ctx, fs, toDir, upstreamDir); err != nil {
+		return err
+	}
+	defer filesystem.RemoveAll(fs, upstreamDir)
+	if err := applyChanges(ctx, fs, toDir, gcRootDir); err != nil {
+		return err
+	}
+	return markNoOpPatches(ctx, fs, upstreamDir, toDir, auditReport)
+}
+
+func applyChanges(ctx context.Context, fs billy.Filesystem, toDir, gcRootDir string) error {
 	chartsOverlayDirpath := filepath.Join(gcRootDir, path.GeneratedChangesOverlayDir)
 	chartsExcludeDirpath := filepath.Join(gcRootDir, path.GeneratedChangesExcludeDir)
 	chartsPatchDirpath := filepath.Join(gcRootDir, path.GeneratedChangesPatchDir)
+	chartsYamlPatchDirpath := filepath.Join(gcRootDir, path.GeneratedChangesYamlPatchDir)
 	applyPatchFile := func(ctx context.Context, fs billy.Filesystem, patchPath string, isDir bool) error {
 		if isDir {
 			return nil
@@ -32,6 +50,19 @@ func ApplyChanges(ctx context.Context, fs billy.Filesystem, toDir, gcRootDir str
 		return ApplyPatchDiff(ctx, fs, patchPath, toDir)
 	}
 
+	applyYamlPatchFile := func(ctx context.Context, fs billy.Filesystem, yamlPatchPath string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		filepath, err := filesystem.MovePath(ctx, yamlPatchPath, chartsYamlPatchDirpath, toDir)
+		if err != nil {
+			return err
+		}
+
+		logger.Log(ctx, slog.LevelDebug, "applying YAML patch", slog.String("path", yamlPatchPath))
+		return ApplyYamlPatch(ctx, fs, yamlPatchPath, filepath)
+	}
+
 	applyOverlayFile := func(ctx context.Context, fs billy.Filesystem, overlayPath string, isDir bool) error {
 		if isDir {
 			return nil
@@ -67,6 +98,16 @@ func ApplyChanges(ctx context.Context, fs billy.Filesystem, toDir, gcRootDir str
 			return err
 		}
 	}
+	exists, err = filesystem.PathExists(ctx, fs, chartsYamlPatchDirpath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = filesystem.WalkDir(ctx, fs, chartsYamlPatchDirpath, applyYamlPatchFile)
+		if err != nil {
+			return err
+		}
+	}
 	exists, err = filesystem.PathExists(ctx, fs, chartsExcludeDirpath)
 	if err != nil {
 		return err
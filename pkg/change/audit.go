@@ -0,0 +1,167 @@
+package change
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/diff"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+)
+
+// AuditStatus is the outcome of checking a patch against the upstream of a package
+type AuditStatus string
+
+const (
+	// AuditApplies means every hunk applies where it was expected or at an offset
+	AuditApplies AuditStatus = "applies"
+	// AuditFuzzed means some hunks only apply with fuzz
+	AuditFuzzed AuditStatus = "fuzzed"
+	// AuditPartiallyRedundant means some hunks are already part of the upstream
+	AuditPartiallyRedundant AuditStatus = "partially-redundant"
+	// AuditRedundant means the upstream already contains every change of the patch, or the patch leaves the file as it is upstream
+	AuditRedundant AuditStatus = "redundant"
+	// AuditFails means some hunks neither apply nor are part of the upstream
+	AuditFails AuditStatus = "fails"
+)
+
+// auditUpstreamDirSuffix is appended to the working directory of a chart to keep a copy of its upstream while auditing
+const auditUpstreamDirSuffix = "-audit"
+
+// AuditReport records how each patch of the generated changes of a package fares against the current upstream
+type AuditReport struct {
+	Patches []AuditedPatch `json:"patches"`
+}
+
+// AuditedPatch is the outcome of checking the patch of a single file
+type AuditedPatch struct {
+	// Path is the path of the patched file within the package
+	Path string `json:"path"`
+	// Patch is the path of the patch file within the package
+	Patch  string      `json:"patch"`
+	Status AuditStatus `json:"status"`
+	// Hunks are the statuses of the hunks of the patch, in order
+	Hunks []diff.HunkStatus `json:"hunks,omitempty"`
+}
+
+// Count returns how many patches were audited with the given status
+func (r *AuditReport) Count(status AuditStatus) int {
+	count := 0
+	for _, p := range r.Patches {
+		if p.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// PatchAudit is the report of the patches of several packages, as printed by patch-audit
+type PatchAudit struct {
+	Packages []AuditedPackage `json:"packages"`
+}
+
+// AuditedPackage is the audit of the patches of a package
+type AuditedPackage struct {
+	Package string `json:"package"`
+	AuditReport
+}
+
+// Header returns the columns of the patch audit
+func (a PatchAudit) Header() []string {
+	return []string{"PACKAGE", "PATCH", "STATUS", "HUNKS"}
+}
+
+// Rows returns a row per audited patch
+func (a PatchAudit) Rows() [][]string {
+	var rows [][]string
+	for _, p := range a.Packages {
+		for _, patch := range p.Patches {
+			hunks := make([]string, len(patch.Hunks))
+			for i, h := range patch.Hunks {
+				hunks[i] = string(h)
+			}
+			rows = append(rows, []string{p.Package, patch.Patch, string(patch.Status), strings.Join(hunks, ",")})
+		}
+	}
+	return rows
+}
+
+type auditReportKey struct{}
+
+// WithAuditReport returns a context under which ApplyChanges audits patches instead of failing on the first hunk
+// that does not apply: hunks that apply are applied, hunks whose changes are already part of the file are redundant
+// and every other hunk is left out. The outcome for every patched file is added to report.
+func WithAuditReport(ctx context.Context, report *AuditReport) context.Context {
+	return context.WithValue(ctx, auditReportKey{}, report)
+}
+
+// auditReportFrom returns the report set by WithAuditReport, or nil if patches should not be audited
+func auditReportFrom(ctx context.Context) *AuditReport {
+	report, _ := ctx.Value(auditReportKey{}).(*AuditReport)
+	return report
+}
+
+// auditStatus summarizes the statuses of the hunks of a patch
+func auditStatus(hunks []diff.HunkStatus) AuditStatus {
+	counts := make(map[diff.HunkStatus]int, len(hunks))
+	for _, h := range hunks {
+		counts[h]++
+	}
+	switch {
+	case counts[diff.HunkRedundant] == len(hunks):
+		return AuditRedundant
+	case counts[diff.HunkFails] > 0:
+		return AuditFails
+	case counts[diff.HunkRedundant] > 0:
+		return AuditPartiallyRedundant
+	case counts[diff.HunkFuzzed] > 0:
+		return AuditFuzzed
+	default:
+		return AuditApplies
+	}
+}
+
+// markNoOpPatches compares the upstream at upstreamDir with the chart at toDir once all changes were applied
+// and marks the patches of files that ended up identical to the upstream as redundant, unless some of their hunks failed
+func markNoOpPatches(ctx context.Context, fs billy.Filesystem, upstreamDir, toDir string, report *AuditReport) error {
+	patched := make(map[string][]int)
+	for i, p := range report.Patches {
+		patched[p.Path] = append(patched[p.Path], i)
+	}
+	ignore := func(ctx context.Context, fs billy.Filesystem, path string, isDir bool) error {
+		return nil
+	}
+	compare := func(ctx context.Context, fs billy.Filesystem, upstreamPath, path string, isDir bool) error {
+		indexes, ok := patched[path]
+		if isDir || !ok {
+			return nil
+		}
+		upstream, err := util.ReadFile(fs, upstreamPath)
+		if err != nil {
+			return err
+		}
+		current, err := util.ReadFile(fs, path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(upstream, current) {
+			return nil
+		}
+		for _, i := range indexes {
+			if status := report.Patches[i].Status; status != AuditRedundant && status != AuditFails {
+				logger.Log(ctx, slog.LevelDebug, "patched file is identical to upstream", slog.String("path", path), slog.String("patch", report.Patches[i].Patch))
+				report.Patches[i].Status = AuditRedundant
+			}
+		}
+		return nil
+	}
+	if err := filesystem.CompareDirs(ctx, fs, upstreamDir, toDir, ignore, ignore, compare); err != nil {
+		return fmt.Errorf("unable to compare %s to its upstream: %w", toDir, err)
+	}
+	return nil
+}
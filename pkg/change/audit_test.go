@@ -0,0 +1,95 @@
+package change
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/diff"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ApplyChanges_Audit(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := filesystem.GetFilesystem(root)
+
+	write := func(path, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	patch := func(name string) string {
+		return "--- charts-original/" + name + "\n+++ charts/" + name + "\n@@ -1,3 +1,3 @@\n a: 1\n-b: 2\n+b: 3\n c: 3\n"
+	}
+	// the upstream
+	write("charts/applies.yaml", "a: 1\nb: 2\nc: 3\n")
+	write("charts/redundant.yaml", "a: 1\nb: 3\nc: 3\n")
+	write("charts/fails.yaml", "a: 1\nb: 4\nc: 3\n")
+	write("charts/overlaid.yaml", "a: 1\nb: 2\nc: 3\n")
+	// the generated changes
+	for _, name := range []string{"applies.yaml", "redundant.yaml", "fails.yaml", "overlaid.yaml"} {
+		write("generated-changes/patch/"+name+".patch", patch(name))
+	}
+	// the overlay puts the upstream file back, so its patch has no effect
+	write("generated-changes/overlay/overlaid.yaml", "a: 1\nb: 2\nc: 3\n")
+
+	report := &AuditReport{}
+	assert.NoError(t, ApplyChanges(WithAuditReport(ctx, report), fs, "charts", "generated-changes"))
+
+	statuses := make(map[string]AuditStatus)
+	for _, p := range report.Patches {
+		statuses[p.Path] = p.Status
+	}
+	assert.Equal(t, map[string]AuditStatus{
+		"charts/applies.yaml":   AuditApplies,
+		"charts/redundant.yaml": AuditRedundant,
+		"charts/fails.yaml":     AuditFails,
+		"charts/overlaid.yaml":  AuditRedundant,
+	}, statuses)
+	assert.Equal(t, 2, report.Count(AuditRedundant))
+
+	// hunks that apply are applied and the copy of the upstream is removed
+	applied, err := os.ReadFile(filepath.Join(root, "charts", "applies.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1\nb: 3\nc: 3\n", string(applied))
+	exists, err := filesystem.PathExists(ctx, fs, "charts"+auditUpstreamDirSuffix)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func Test_auditStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		hunks []diff.HunkStatus
+		want  AuditStatus
+	}{
+		{"#1 - every hunk applies", []diff.HunkStatus{diff.HunkApplies, diff.HunkApplies}, AuditApplies},
+		{"#2 - fuzz", []diff.HunkStatus{diff.HunkApplies, diff.HunkFuzzed}, AuditFuzzed},
+		{"#3 - some hunks redundant", []diff.HunkStatus{diff.HunkRedundant, diff.HunkFuzzed}, AuditPartiallyRedundant},
+		{"#4 - every hunk redundant", []diff.HunkStatus{diff.HunkRedundant, diff.HunkRedundant}, AuditRedundant},
+		{"#5 - failure wins over redundancy", []diff.HunkStatus{diff.HunkRedundant, diff.HunkFails}, AuditFails},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, auditStatus(tt.hunks))
+		})
+	}
+}
+
+func Test_PatchAudit_Rows(t *testing.T) {
+	audit := PatchAudit{Packages: []AuditedPackage{
+		{Package: "rancher-monitoring", AuditReport: AuditReport{Patches: []AuditedPatch{
+			{Path: "charts/values.yaml", Patch: "generated-changes/patch/values.yaml.patch", Status: AuditPartiallyRedundant, Hunks: []diff.HunkStatus{diff.HunkApplies, diff.HunkRedundant}},
+			{Path: "charts/Chart.yaml", Patch: "generated-changes/yamlpatch/Chart.yaml", Status: AuditApplies},
+		}}},
+		{Package: "fleet"},
+	}}
+	assert.Equal(t, [][]string{
+		{"rancher-monitoring", "generated-changes/patch/values.yaml.patch", "partially-redundant", "applies,redundant"},
+		{"rancher-monitoring", "generated-changes/yamlpatch/Chart.yaml", "applies", ""},
+	}, audit.Rows())
+}
@@ -1,64 +1,34 @@
 package change
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/diff"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 )
 
-func checkDependencyPackage(pathToCmd string) error {
-	cmd := exec.Command(pathToCmd, "--version")
-	out, err := cmd.Output()
-	if err != nil {
-		return err
-	}
-
-	version := string(out)
-
-	if strings.Contains(version, "Apple") || strings.Contains(version, "FreeBSD") {
-		return fmt.Errorf("detected Apple/FreeBSD version of %[1]s. This will lead to compatibility issues. Install GNU %[1]s: https://github.com/rancher/charts-build-scripts/issues/130", pathToCmd)
-	}
-
-	return nil
-}
-
 // GeneratePatchDiff generates the patch between the files at srcPath and dstPath and outputs it to patchPath
 // It returns whether the patch was generated or any errors that were encountered
 func GeneratePatchDiff(ctx context.Context, fs billy.Filesystem, patchPath, srcPath, dstPath string) (bool, error) {
-	// TODO(aiyengar2): find a better library to actually generate and apply patches
-	// There doesn't seem to be any existing library at the moment that can work with unified patches
-	pathToDiffCmd, err := exec.LookPath("diff")
+	src, err := readFileIfExists(ctx, fs, srcPath)
 	if err != nil {
-		return false, fmt.Errorf("cannot generate patch file if GNU diff is not available")
-	}
-
-	if err := checkDependencyPackage(pathToDiffCmd); err != nil {
 		return false, err
 	}
-
-	var buf bytes.Buffer
-	cmd := exec.Command(pathToDiffCmd, "-uN", "-x *.tgz", "-x *.lock", srcPath, dstPath)
-	cmd.Dir = fs.Root()
-	cmd.Stdout = &buf
-
-	if err = cmd.Run(); err != nil {
-		exitErr, ok := err.(*exec.ExitError)
-		// Exit code of 1 indicates that a difference was observed, so it is expected
-		if !ok || exitErr.ExitCode() != 1 {
-			logger.Log(ctx, slog.LevelError, "unable to generate patch", slog.String("buf", fmt.Sprintf("\n%s\n", &buf)))
-			return false, err
-		}
+	dst, err := readFileIfExists(ctx, fs, dstPath)
+	if err != nil {
+		return false, err
 	}
 
-	if buf.Len() == 0 {
+	patch := diff.Unified(srcPath, dstPath, src, dst)
+	if len(patch) == 0 {
 		return false, nil
 	}
 
@@ -68,59 +38,144 @@ func GeneratePatchDiff(ctx context.Context, fs billy.Filesystem, patchPath, srcP
 		return false, err
 	}
 	defer patchFile.Close()
-	if _, err = removeTimestamps(&buf).WriteTo(patchFile); err != nil {
+	if _, err = patchFile.Write(patch); err != nil {
 		return false, fmt.Errorf("unable to write diff to file: %s", err)
 	}
 	return true, nil
 }
 
-// ApplyPatchDiff applies a patch file located at patchPath to the destDir on the filesystem
+// ApplyPatchDiff applies a patch file located at patchPath to the destDir on the filesystem.
+// The first directory of the paths within the patch is stripped and files left empty are removed.
 func ApplyPatchDiff(ctx context.Context, fs billy.Filesystem, patchPath, destDir string) error {
 	logger.Log(ctx, slog.LevelInfo, "applying patches", slog.String("patchPath", patchPath), slog.String("destDir", destDir))
 
-	// TODO(aiyengar2): find a better library to actually generate and apply patches
-	// There doesn't seem to be any existing library at the moment that can work with unified patches
-	pathToPatchCmd, err := exec.LookPath("patch")
+	patch, err := util.ReadFile(fs, patchPath)
 	if err != nil {
-		return fmt.Errorf("cannot generate patch file if GNU patch is not available")
-	}
-
-	if err := checkDependencyPackage(pathToPatchCmd); err != nil {
 		return err
 	}
-
-	var buf bytes.Buffer
-	patchFile, err := fs.Open(patchPath)
+	fileDiffs, err := diff.Parse(patch)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to parse patch %s: %w", patchPath, err)
 	}
-	defer patchFile.Close()
 
-	cmd := exec.Command(pathToPatchCmd, "-E", "-p1")
-	cmd.Dir = filesystem.GetAbsPath(fs, destDir)
-	cmd.Stdin = patchFile
-	cmd.Stdout = &buf
+	for _, fileDiff := range fileDiffs {
+		path, err := patchTarget(ctx, fs, destDir, fileDiff)
+		if err != nil {
+			return fmt.Errorf("unable to apply patch %s: %w", patchPath, err)
+		}
+		logger.Log(ctx, slog.LevelDebug, "patching file", slog.String("path", path))
 
-	if err = cmd.Run(); err != nil {
-		logger.Log(ctx, slog.LevelError, "unable to apply patch", slog.String("buf", fmt.Sprintf("\n%s\n", &buf)))
+		content, err := readFileIfExists(ctx, fs, path)
+		if err != nil {
+			return err
+		}
+		var patched []byte
+		if report := auditReportFrom(ctx); report != nil {
+			var hunks []diff.HunkStatus
+			patched, hunks = diff.Audit(content, fileDiff)
+			report.Patches = append(report.Patches, AuditedPatch{Path: path, Patch: patchPath, Status: auditStatus(hunks), Hunks: hunks})
+		} else if report := rebaseReportFrom(ctx); report != nil {
+			labels := diff.MergeLabels{Ours: patchPath, Base: rebaseBaseLabel, Theirs: rebaseTheirsLabel}
+			base, found, err := previousUpstreamFile(ctx, fs, destDir, path)
+			if err != nil {
+				return err
+			}
+			var result diff.RebaseResult
+			if found {
+				result = diff.RebaseOnto(base, content, fileDiff, labels)
+			} else {
+				result = diff.Rebase(content, fileDiff, labels)
+			}
+			if result.Status != diff.StatusClean {
+				logger.Log(ctx, slog.LevelWarn, "patch did not apply cleanly", slog.String("path", path), slog.String("status", string(result.Status)), slog.Any("conflicts", result.Conflicts))
+			}
+			report.Files = append(report.Files, RebasedFile{Path: path, Patch: patchPath, Status: result.Status, Conflicts: result.Conflicts})
+			patched = result.Content
+		} else {
+			patched, err = diff.Apply(content, fileDiff)
+			if err != nil {
+				logger.Log(ctx, slog.LevelError, "unable to apply patch", slog.String("patchPath", patchPath), slog.String("path", path), logger.Err(err))
+				return fmt.Errorf("unable to apply patch %s to %s: %w", patchPath, path, err)
+			}
+		}
+
+		if len(patched) == 0 {
+			if err := filesystem.RemoveAll(fs, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeFile(fs, path, patched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// previousUpstreamFile returns the contents of the file at path within the previous upstream of destDir.
+// It returns false if the previous upstream was not pulled; a file missing from it has no contents.
+func previousUpstreamFile(ctx context.Context, fs billy.Filesystem, destDir, path string) ([]byte, bool, error) {
+	previousDir := PreviousUpstreamDir(destDir)
+	exists, err := filesystem.PathExists(ctx, fs, previousDir)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+	rel, err := filepath.Rel(destDir, path)
+	if err != nil {
+		return nil, false, err
 	}
-	return err
+	content, err := readFileIfExists(ctx, fs, filepath.Join(previousDir, rel))
+	return content, err == nil, err
 }
 
-// removeTimestamps removes timestamps from a given patch file
-func removeTimestamps(in *bytes.Buffer) *bytes.Buffer {
-	var out []byte
-	var timestampPath string
-	s := bufio.NewScanner(in)
-	for s.Scan() {
-		line := s.Text()
-		if n, err := fmt.Sscanf(line, "--- %s", &timestampPath); n == 1 && err == nil {
-			line = fmt.Sprintf("--- %s", timestampPath)
+// patchTarget returns the path within destDir of the file a file diff applies to, stripping the first directory of its names.
+// The old name is used if it exists, as patch does.
+func patchTarget(ctx context.Context, fs billy.Filesystem, destDir string, fileDiff *diff.FileDiff) (string, error) {
+	var candidates []string
+	for _, name := range []string{fileDiff.OldName, fileDiff.NewName} {
+		if name == "/dev/null" {
+			continue
 		}
-		if n, err := fmt.Sscanf(line, "+++ %s", &timestampPath); n == 1 && err == nil {
-			line = fmt.Sprintf("+++ %s", timestampPath)
+		_, stripped, found := strings.Cut(name, "/")
+		if !found || len(stripped) == 0 {
+			continue
 		}
-		out = append(out, (line + "\n")...)
+		candidates = append(candidates, filepath.Join(destDir, stripped))
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("unable to find the file to patch from %s and %s", fileDiff.OldName, fileDiff.NewName)
+	}
+	for _, candidate := range candidates {
+		exists, err := filesystem.PathExists(ctx, fs, candidate)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return candidate, nil
+		}
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+// readFileIfExists returns the contents of the file at path, or no contents if it does not exist
+func readFileIfExists(ctx context.Context, fs billy.Filesystem, path string) ([]byte, error) {
+	exists, err := filesystem.PathExists(ctx, fs, path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return util.ReadFile(fs, path)
+}
+
+// writeFile replaces the contents of the file at path, keeping its permissions if it already exists
+func writeFile(fs billy.Filesystem, path string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := fs.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
 	}
-	return bytes.NewBuffer(out)
+	return util.WriteFile(fs, path, content, mode)
 }
@@ -0,0 +1,93 @@
+package change
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GeneratePatchDiff_ApplyPatchDiff(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := filesystem.GetFilesystem(root)
+
+	write := func(path, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	write("charts-original/templates/a.yaml", "a: 1\nb: 2\nc: 3\n")
+	write("charts/templates/a.yaml", "a: 1\nb: 3\nc: 3\n")
+
+	generated, err := GeneratePatchDiff(ctx, fs, "patch/templates/a.yaml.patch", "charts-original/templates/a.yaml", "charts/templates/a.yaml")
+	assert.NoError(t, err)
+	assert.True(t, generated)
+	patch, err := os.ReadFile(filepath.Join(root, "patch/templates/a.yaml.patch"))
+	assert.NoError(t, err)
+	assert.Equal(t, "--- charts-original/templates/a.yaml\n+++ charts/templates/a.yaml\n@@ -1,3 +1,3 @@\n a: 1\n-b: 2\n+b: 3\n c: 3\n", string(patch))
+
+	// no patch is generated for identical files
+	generated, err = GeneratePatchDiff(ctx, fs, "patch/templates/same.yaml.patch", "charts/templates/a.yaml", "charts/templates/a.yaml")
+	assert.NoError(t, err)
+	assert.False(t, generated)
+
+	// the patch applies to a copy of the original chart
+	write("dest/templates/a.yaml", "a: 1\nb: 2\nc: 3\n")
+	assert.NoError(t, ApplyPatchDiff(ctx, fs, "patch/templates/a.yaml.patch", "dest"))
+	patched, err := os.ReadFile(filepath.Join(root, "dest/templates/a.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1\nb: 3\nc: 3\n", string(patched))
+
+	// applying it again fails on its only hunk
+	err = ApplyPatchDiff(ctx, fs, "patch/templates/a.yaml.patch", "dest")
+	assert.ErrorContains(t, err, "hunk #1 (@@ -1,3 +1,3 @@) does not apply")
+}
+
+func Test_ApplyPatchDiff_Rebase(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := filesystem.GetFilesystem(root)
+
+	patch := "--- charts-original/values.yaml\n+++ charts/values.yaml\n@@ -1,3 +1,3 @@\n a: 1\n-b: 2\n+b: 3\n c: 3\n"
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "patch"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "patch", "values.yaml.patch"), []byte(patch), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "charts"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "charts", "values.yaml"), []byte("a: 1\nb: 4\nc: 3\n"), 0644))
+
+	// without a report, a hunk that does not apply fails
+	assert.Error(t, ApplyPatchDiff(ctx, fs, "patch/values.yaml.patch", "charts"))
+
+	report := &RebaseReport{}
+	assert.NoError(t, ApplyPatchDiff(WithRebaseReport(ctx, report), fs, "patch/values.yaml.patch", "charts"))
+	assert.Equal(t, []string{"charts/values.yaml"}, report.Conflicted())
+	assert.Equal(t, []int{1}, report.Files[0].Conflicts)
+
+	rebased, err := os.ReadFile(filepath.Join(root, "charts", "values.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1\n<<<<<<< patch/values.yaml.patch\nb: 3\n||||||| previous upstream\nb: 2\n=======\nb: 4\n>>>>>>> upstream\nc: 3\n", string(rebased))
+}
+
+func Test_ApplyPatchDiff_Rebase_previousUpstream(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := filesystem.GetFilesystem(root)
+
+	patch := "--- charts-original/values.yaml\n+++ charts/values.yaml\n@@ -1,5 +1,5 @@\n a: 1\n b: 2\n-c: 3\n+c: 4\n d: 5\n e: 6\n"
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "patch"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "patch", "values.yaml.patch"), []byte(patch), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "charts"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "charts", "values.yaml"), []byte("z: 0\na: 10\nb: 2\nc: 3\nd: 5\ne: 60\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, PreviousUpstreamDir("charts")), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, PreviousUpstreamDir("charts"), "values.yaml"), []byte("a: 1\nb: 2\nc: 3\nd: 5\ne: 6\n"), 0644))
+
+	report := &RebaseReport{}
+	assert.NoError(t, ApplyPatchDiff(WithRebaseReport(ctx, report), fs, "patch/values.yaml.patch", "charts"))
+	assert.Equal(t, []string{"charts/values.yaml"}, report.Fuzzed())
+
+	rebased, err := os.ReadFile(filepath.Join(root, "charts", "values.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "z: 0\na: 10\nb: 2\nc: 4\nd: 5\ne: 60\n", string(rebased))
+}
@@ -2,6 +2,7 @@ package change
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -18,7 +19,8 @@ const (
 )
 
 // GenerateChanges generates the change between fromDir and toDir and places it in the appropriate directories within gcDir
-func GenerateChanges(ctx context.Context, fs billy.Filesystem, fromDir, toDir, gcRootDir string, replacePaths []string) error {
+// Paths in yamlPatchPaths are described by YAML patches instead of patches whenever both versions are single YAML documents.
+func GenerateChanges(ctx context.Context, fs billy.Filesystem, fromDir, toDir, gcRootDir string, replacePaths, yamlPatchPaths []string) error {
 	logger.Log(ctx, slog.LevelInfo, "generating changes", slog.String("GeneratedChangesDir", path.GeneratedChangesDir))
 
 	// gcRootDir should always end with path.GeneratedChangesDir
@@ -32,6 +34,10 @@ func GenerateChanges(ctx context.Context, fs billy.Filesystem, fromDir, toDir, g
 	for _, path := range replacePaths {
 		replacePathsMap[path] = true
 	}
+	yamlPatchPathsMap := make(map[string]bool, len(yamlPatchPaths))
+	for _, path := range yamlPatchPaths {
+		yamlPatchPathsMap[path] = true
+	}
 	generateOverlayFile := func(ctx context.Context, fs billy.Filesystem, toPath string, isDir bool) error {
 		if isDir {
 			return nil
@@ -82,6 +88,21 @@ func GenerateChanges(ctx context.Context, fs billy.Filesystem, fromDir, toDir, g
 			return nil
 		}
 
+		if _, ok := yamlPatchPathsMap[p]; ok {
+			yamlPatchPath := filepath.Join(gcRootDir, path.GeneratedChangesYamlPatchDir, p)
+			generatedYamlPatch, err := GenerateYamlPatch(ctx, fs, yamlPatchPath, fromPath, toPath)
+			if err == nil {
+				if generatedYamlPatch {
+					logger.Log(ctx, slog.LevelInfo, "yamlpatch", slog.String("yamlPatchPath", yamlPatchPath))
+				}
+				return nil
+			}
+			if !errors.Is(err, errNotYamlPatchable) {
+				return err
+			}
+			logger.Log(ctx, slog.LevelWarn, "falling back to a patch", slog.String("path", p), logger.Err(err))
+		}
+
 		patchPath := filepath.Join(gcRootDir, path.GeneratedChangesPatchDir, p)
 		patchPathWithExt := fmt.Sprintf(patchFmt, patchPath)
 		generatedPatch, err := GeneratePatchDiff(ctx, fs, patchPathWithExt, fromPath, toPath)
@@ -114,6 +135,10 @@ func removeAllGeneratedChanges(ctx context.Context, fs billy.Filesystem, gcRootD
 	if err := filesystem.RemoveAll(fs, filepath.Join(gcRootDir, path.GeneratedChangesPatchDir)); err != nil {
 		return err
 	}
+	// Remove all YAML patches
+	if err := filesystem.RemoveAll(fs, filepath.Join(gcRootDir, path.GeneratedChangesYamlPatchDir)); err != nil {
+		return err
+	}
 	dependenciesPath := filepath.Join(gcRootDir, path.GeneratedChangesDependenciesDir)
 	exists, err := filesystem.PathExists(ctx, fs, dependenciesPath)
 	if err != nil {
@@ -0,0 +1,87 @@
+package change
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/rancher/charts-build-scripts/pkg/diff"
+)
+
+const (
+	// rebaseBaseLabel and rebaseTheirsLabel name the sides of the conflicts written while rebasing; ours is the patch file
+	rebaseBaseLabel   = "previous upstream"
+	rebaseTheirsLabel = "upstream"
+
+	// previousUpstreamDirSuffix is appended to a working directory to name the directory the previous upstream is pulled into
+	previousUpstreamDirSuffix = "-previous-upstream"
+)
+
+// PreviousUpstreamDir returns the directory the previous upstream of the working directory is pulled into while rebasing.
+// If it exists, each patch is applied to the file of the previous upstream and the result is 3-way merged with the new upstream.
+func PreviousUpstreamDir(workingDir string) string {
+	return filepath.Clean(workingDir) + previousUpstreamDirSuffix
+}
+
+// RebaseReport records how each patch applied while rebasing the generated changes of a package onto a new upstream
+type RebaseReport struct {
+	Files []RebasedFile `json:"files"`
+}
+
+// RebasedFile is the outcome of rebasing the patch of a single file
+type RebasedFile struct {
+	// Path is the path of the patched file within the package
+	Path string `json:"path"`
+	// Patch is the path of the patch file within the package
+	Patch  string      `json:"patch"`
+	Status diff.Status `json:"status"`
+	// Conflicts are the 1-based indexes of the hunks of the patch that conflict
+	Conflicts []int `json:"conflicts,omitempty"`
+}
+
+// Count returns how many files were rebased with the given status
+func (r *RebaseReport) Count(status diff.Status) int {
+	count := 0
+	for _, f := range r.Files {
+		if f.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Conflicted returns the paths of the files left with conflict markers
+func (r *RebaseReport) Conflicted() []string {
+	var paths []string
+	for _, f := range r.Files {
+		if f.Status == diff.StatusConflicted {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+// Fuzzed returns the paths of the files whose patches needed fuzz or were merged with the new upstream without conflicts
+func (r *RebaseReport) Fuzzed() []string {
+	var paths []string
+	for _, f := range r.Files {
+		if f.Status == diff.StatusFuzzed {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+type rebaseReportKey struct{}
+
+// WithRebaseReport returns a context under which ApplyChanges rebases patches instead of failing on the first hunk
+// that does not apply: such hunks are merged with the file and conflicts are written with git-style conflict markers.
+// The outcome for every patched file is added to report.
+func WithRebaseReport(ctx context.Context, report *RebaseReport) context.Context {
+	return context.WithValue(ctx, rebaseReportKey{}, report)
+}
+
+// rebaseReportFrom returns the report set by WithRebaseReport, or nil if patches should not be rebased
+func rebaseReportFrom(ctx context.Context) *RebaseReport {
+	report, _ := ctx.Value(rebaseReportKey{}).(*RebaseReport)
+	return report
+}
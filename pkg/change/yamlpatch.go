@@ -0,0 +1,560 @@
+package change
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/diff"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// errNotYamlPatchable is returned when a file cannot be described by a YAML patch (e.g. it is not a single YAML document)
+var errNotYamlPatchable = errors.New("file is not a single YAML document")
+
+// yamlPatchOperation is a JSON Patch (RFC 6902) operation applied to a YAML document.
+// Only add, remove and replace are supported.
+type yamlPatchOperation struct {
+	Op    string    `yaml:"op"`
+	Path  string    `yaml:"path"`
+	Value yaml.Node `yaml:"value,omitempty"`
+}
+
+// generateYamlPatch returns the operations that turn the YAML document from into to.
+// Mappings are compared key by key so that the order of the keys does not matter; sequences and scalars are replaced as a whole.
+// Comments and formatting are not part of the operations.
+func generateYamlPatch(from, to []byte) ([]yamlPatchOperation, error) {
+	fromNode, err := parseYamlDocument(from)
+	if err != nil {
+		return nil, err
+	}
+	toNode, err := parseYamlDocument(to)
+	if err != nil {
+		return nil, err
+	}
+	return diffYamlNodes(nil, "", fromNode.Content[0], toNode.Content[0]), nil
+}
+
+func diffYamlNodes(ops []yamlPatchOperation, path string, from, to *yaml.Node) []yamlPatchOperation {
+	if from.Kind != yaml.MappingNode || to.Kind != yaml.MappingNode {
+		if !equalYamlNodes(from, to) {
+			ops = append(ops, yamlPatchOperation{Op: "replace", Path: path, Value: *to})
+		}
+		return ops
+	}
+
+	fromValues := mappingValues(from)
+	toValues := mappingValues(to)
+	for i := 0; i+1 < len(from.Content); i += 2 {
+		key := from.Content[i].Value
+		if _, ok := toValues[key]; !ok {
+			ops = append(ops, yamlPatchOperation{Op: "remove", Path: path + "/" + escapePointerToken(key)})
+		}
+	}
+	for i := 0; i+1 < len(to.Content); i += 2 {
+		key := to.Content[i].Value
+		keyPath := path + "/" + escapePointerToken(key)
+		fromValue, ok := fromValues[key]
+		if !ok {
+			ops = append(ops, yamlPatchOperation{Op: "add", Path: keyPath, Value: *to.Content[i+1]})
+			continue
+		}
+		ops = diffYamlNodes(ops, keyPath, fromValue, to.Content[i+1])
+	}
+	return ops
+}
+
+// applyYamlPatch applies the operations to the YAML document in content.
+// Only the lines of the entries changed by the operations are rewritten: the comments, blank lines and indentation
+// of the rest of the document are kept as they are.
+func applyYamlPatch(content []byte, ops []yamlPatchOperation) ([]byte, error) {
+	if _, err := parseYamlDocument(content); err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		patched, err := editYamlDocument(content, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation #%d (%s %s) does not apply: %w", i+1, op.Op, op.Path, err)
+		}
+		content = patched
+	}
+	return content, nil
+}
+
+// editYamlDocument applies the operation to the YAML document in content and rewrites the lines of the entry it changes:
+// the entry of the block mapping or sequence that holds the target, or that holds the flow collection the target is in.
+// The whole document is rewritten if its root is a flow collection or is replaced.
+func editYamlDocument(content []byte, op yamlPatchOperation) ([]byte, error) {
+	doc, err := parseYamlDocument(content)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyYamlPatchOperation(doc, op); err != nil {
+		return nil, err
+	}
+	if op.Path == "" {
+		return encodeYaml(doc)
+	}
+
+	// original keeps the positions of the nodes before the operation; doc has the same structure above the target
+	original, err := parseYamlDocument(content)
+	if err != nil {
+		return nil, err
+	}
+	tokens := strings.Split(op.Path[1:], "/")
+	for i := range tokens {
+		tokens[i] = unescapePointerToken(tokens[i])
+	}
+	originalChain := []*yaml.Node{original.Content[0]}
+	patchedChain := []*yaml.Node{doc.Content[0]}
+	for _, token := range tokens[:len(tokens)-1] {
+		originalChild, err := yamlChild(originalChain[len(originalChain)-1], token)
+		if err != nil {
+			return nil, err
+		}
+		patchedChild, err := yamlChild(patchedChain[len(patchedChain)-1], token)
+		if err != nil {
+			return nil, err
+		}
+		originalChain = append(originalChain, resolveYamlAlias(originalChild))
+		patchedChain = append(patchedChain, resolveYamlAlias(patchedChild))
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	parent := originalChain[len(originalChain)-1]
+	patchedParent := patchedChain[len(patchedChain)-1]
+	if len(parent.Content) == 0 {
+		// entries added to an empty collection (e.g. resources: {}) are written as a block
+		patchedParent.Style &^= yaml.FlowStyle
+	}
+	for i, node := range originalChain {
+		// flow collections, and block collections left empty, are rewritten as a whole with the entry of the block collection holding them
+		if node.Style&yaml.FlowStyle == 0 && (node != parent || len(patchedParent.Content) > 0) {
+			continue
+		}
+		if i == 0 {
+			return encodeYaml(doc)
+		}
+		entry := yamlEntryIndex(originalChain[i-1], tokens[i-1])
+		start, end := yamlEntryLines(lines, originalChain[i-1], entry, false)
+		text, err := renderYamlEntry(patchedChain[i-1], entry, yamlEntryIndent(originalChain[i-1], entry))
+		if err != nil {
+			return nil, err
+		}
+		return spliceLines(lines, start, end, text), nil
+	}
+
+	last := tokens[len(tokens)-1]
+	entry := yamlEntryIndex(parent, last)
+	if op.Op == "remove" {
+		start, end := yamlEntryLines(lines, parent, entry, true)
+		return spliceLines(lines, start, end, ""), nil
+	}
+	if entry >= 0 && (parent.Kind == yaml.MappingNode || op.Op == "replace") {
+		start, end := yamlEntryLines(lines, parent, entry, false)
+		text, err := renderYamlEntry(patchedParent, entry, yamlEntryIndent(parent, entry))
+		if err != nil {
+			return nil, err
+		}
+		return spliceLines(lines, start, end, text), nil
+	}
+
+	// a new entry is inserted before the entry it is added at, or after the last entry
+	at := entry
+	if at < 0 {
+		at = len(patchedParent.Content) - 1
+		if parent.Kind == yaml.MappingNode {
+			at--
+		}
+	}
+	var insertAt int
+	if at < len(parent.Content) {
+		insertAt, _ = yamlEntryLines(lines, parent, at, true)
+	} else {
+		lastEntry := len(parent.Content) - 1
+		if parent.Kind == yaml.MappingNode {
+			lastEntry--
+		}
+		_, insertAt = yamlEntryLines(lines, parent, lastEntry, false)
+	}
+	text, err := renderYamlEntry(patchedParent, at, yamlEntryIndent(parent, 0))
+	if err != nil {
+		return nil, err
+	}
+	return spliceLines(lines, insertAt, insertAt, text), nil
+}
+
+// yamlEntryIndex returns the index of the key in the contents of a mapping, or of the item in a sequence,
+// or -1 if the mapping does not have the key or the index is past the end of the sequence
+func yamlEntryIndex(node *yaml.Node, token string) int {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return i
+			}
+		}
+		return -1
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index >= len(node.Content) {
+		return -1
+	}
+	return index
+}
+
+// yamlEntryIndent returns the column of the keys of a block mapping, or of the dashes of a block sequence
+func yamlEntryIndent(node *yaml.Node, entry int) int {
+	if node.Kind == yaml.MappingNode {
+		return node.Content[entry].Column - 1
+	}
+	return node.Column - 1
+}
+
+// yamlEntryLines returns the range of lines [start, end) of an entry of a block mapping or sequence, from its key or dash
+// to its last line that is indented under it. Blank lines and comments that follow it belong to what comes next.
+// If withHeadComment is set, the comment lines right above the entry are included.
+func yamlEntryLines(lines []string, node *yaml.Node, entry int, withHeadComment bool) (int, int) {
+	indent := yamlEntryIndent(node, entry)
+	start := node.Content[entry].Line - 1
+	if node.Kind == yaml.SequenceNode {
+		// the item may start on the line after its dash
+		for start > 0 && !strings.HasPrefix(lines[start][min(indent, len(lines[start])):], "-") {
+			start--
+		}
+	}
+	end := start + 1
+	for i := start + 1; i < len(lines); i++ {
+		text := strings.TrimRight(lines[i], "\r\n")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" {
+			continue
+		}
+		lineIndent := len(text) - len(trimmed)
+		if strings.HasPrefix(trimmed, "#") {
+			if lineIndent > indent {
+				end = i + 1
+			}
+			continue
+		}
+		isDash := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+		if lineIndent < indent || (lineIndent == indent && (node.Kind == yaml.SequenceNode || !isDash)) {
+			break
+		}
+		end = i + 1
+	}
+
+	if withHeadComment {
+		if comment := node.Content[entry].HeadComment; comment != "" {
+			for n := strings.Count(comment, "\n") + 1; n > 0 && start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "#"); n-- {
+				start--
+			}
+		}
+	}
+	return start, end
+}
+
+// renderYamlEntry returns the lines of an entry of a mapping or a sequence, indented by indent spaces.
+// The comments above and below the entry are left out since they are not part of its lines.
+func renderYamlEntry(node *yaml.Node, entry int, indent int) (string, error) {
+	first := *node.Content[entry]
+	first.HeadComment = ""
+	first.FootComment = ""
+	single := &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{&first}}
+	if node.Kind == yaml.MappingNode {
+		value := *node.Content[entry+1]
+		value.FootComment = ""
+		single = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{&first, &value}}
+	}
+	out, err := encodeYaml(single)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString(strings.Repeat(" ", indent))
+		}
+		b.WriteString(line)
+	}
+	return b.String(), nil
+}
+
+// spliceLines replaces the lines [start, end) with text
+func spliceLines(lines []string, start, end int, text string) []byte {
+	var b strings.Builder
+	for _, line := range lines[:start] {
+		b.WriteString(line)
+	}
+	if start > 0 && start == end && text != "" && !strings.HasSuffix(lines[start-1], "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(text)
+	for _, line := range lines[end:] {
+		b.WriteString(line)
+	}
+	return []byte(b.String())
+}
+
+// encodeYaml encodes the node as YAML with an indentation of 2 spaces
+func encodeYaml(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func applyYamlPatchOperation(doc *yaml.Node, op yamlPatchOperation) error {
+	value := &op.Value
+	if op.Op != "add" && op.Op != "remove" && op.Op != "replace" {
+		return fmt.Errorf("unsupported operation")
+	}
+	if op.Op != "remove" && op.Value.IsZero() {
+		return fmt.Errorf("missing value")
+	}
+	if op.Path == "" {
+		if op.Op == "remove" {
+			return fmt.Errorf("cannot remove the whole document")
+		}
+		doc.Content[0] = value
+		return nil
+	}
+	if !strings.HasPrefix(op.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+
+	tokens := strings.Split(op.Path[1:], "/")
+	parent := doc.Content[0]
+	for _, token := range tokens[:len(tokens)-1] {
+		child, err := yamlChild(parent, unescapePointerToken(token))
+		if err != nil {
+			return err
+		}
+		parent = child
+	}
+	last := unescapePointerToken(tokens[len(tokens)-1])
+
+	switch parent.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(parent.Content); i += 2 {
+			if parent.Content[i].Value != last {
+				continue
+			}
+			if op.Op == "remove" {
+				parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			} else {
+				parent.Content[i+1] = value
+			}
+			return nil
+		}
+		if op.Op != "add" {
+			return fmt.Errorf("key %q not found", last)
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}
+		parent.Content = append(parent.Content, key, value)
+		return nil
+	case yaml.SequenceNode:
+		if last == "-" && op.Op == "add" {
+			parent.Content = append(parent.Content, value)
+			return nil
+		}
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index > len(parent.Content) || (index == len(parent.Content) && op.Op != "add") {
+			return fmt.Errorf("index %q out of range", last)
+		}
+		switch op.Op {
+		case "add":
+			parent.Content = append(parent.Content[:index], append([]*yaml.Node{value}, parent.Content[index:]...)...)
+		case "remove":
+			parent.Content = append(parent.Content[:index], parent.Content[index+1:]...)
+		case "replace":
+			parent.Content[index] = value
+		}
+		return nil
+	default:
+		return fmt.Errorf("%q is not a mapping or a sequence", last)
+	}
+}
+
+// yamlChild returns the value at key in a mapping or at index key in a sequence
+func yamlChild(node *yaml.Node, key string) (*yaml.Node, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if value, ok := mappingValues(node)[key]; ok {
+			return value, nil
+		}
+		return nil, fmt.Errorf("key %q not found", key)
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(node.Content) {
+			return nil, fmt.Errorf("index %q out of range", key)
+		}
+		return node.Content[index], nil
+	case yaml.AliasNode:
+		return yamlChild(node.Alias, key)
+	default:
+		return nil, fmt.Errorf("%q is not within a mapping or a sequence", key)
+	}
+}
+
+// resolveYamlAlias returns the node an alias refers to, or the node itself
+func resolveYamlAlias(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return node.Alias
+	}
+	return node
+}
+
+// parseYamlDocument returns the document node of the single YAML document in content
+func parseYamlDocument(content []byte) (*yaml.Node, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	var doc yaml.Node
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errNotYamlPatchable
+	}
+	var next yaml.Node
+	if decoder.Decode(&next) == nil {
+		return nil, errNotYamlPatchable
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, errNotYamlPatchable
+	}
+	return &doc, nil
+}
+
+func mappingValues(node *yaml.Node) map[string]*yaml.Node {
+	values := make(map[string]*yaml.Node, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		values[node.Content[i].Value] = node.Content[i+1]
+	}
+	return values
+}
+
+// equalYamlNodes compares the values of two nodes, ignoring comments and styles
+func equalYamlNodes(a, b *yaml.Node) bool {
+	if a.Kind == yaml.AliasNode {
+		a = a.Alias
+	}
+	if b.Kind == yaml.AliasNode {
+		b = b.Alias
+	}
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+	if a.Kind == yaml.ScalarNode {
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	}
+	if a.Kind == yaml.MappingNode {
+		bValues := mappingValues(b)
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			bValue, ok := bValues[a.Content[i].Value]
+			if !ok || !equalYamlNodes(a.Content[i+1], bValue) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := range a.Content {
+		if !equalYamlNodes(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func escapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+// GenerateYamlPatch generates the YAML patch between the YAML documents at srcPath and dstPath and outputs it to yamlPatchPath.
+// It returns whether the YAML patch was generated; errNotYamlPatchable is returned if either file is not a single YAML document.
+func GenerateYamlPatch(ctx context.Context, fs billy.Filesystem, yamlPatchPath, srcPath, dstPath string) (bool, error) {
+	src, err := util.ReadFile(fs, srcPath)
+	if err != nil {
+		return false, err
+	}
+	dst, err := util.ReadFile(fs, dstPath)
+	if err != nil {
+		return false, err
+	}
+	ops, err := generateYamlPatch(src, dst)
+	if err != nil {
+		return false, err
+	}
+	if len(ops) == 0 {
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(ops); err != nil {
+		return false, err
+	}
+	if err := encoder.Close(); err != nil {
+		return false, err
+	}
+	if err := fs.MkdirAll(filepath.Dir(yamlPatchPath), os.ModePerm); err != nil {
+		return false, err
+	}
+	return true, util.WriteFile(fs, yamlPatchPath, buf.Bytes(), 0644)
+}
+
+// ApplyYamlPatch applies the YAML patch located at yamlPatchPath to the YAML document at destPath on the filesystem
+func ApplyYamlPatch(ctx context.Context, fs billy.Filesystem, yamlPatchPath, destPath string) error {
+	logger.Log(ctx, slog.LevelInfo, "applying YAML patch", slog.String("yamlPatchPath", yamlPatchPath), slog.String("destPath", destPath))
+
+	var ops []yamlPatchOperation
+	data, err := util.ReadFile(fs, yamlPatchPath)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &ops); err != nil {
+		return fmt.Errorf("unable to parse YAML patch %s: %w", yamlPatchPath, err)
+	}
+	content, err := readFileIfExists(ctx, fs, destPath)
+	if err != nil {
+		return err
+	}
+
+	patched, err := applyYamlPatch(content, ops)
+	if report := auditReportFrom(ctx); report != nil {
+		if err != nil {
+			logger.Log(ctx, slog.LevelWarn, "YAML patch does not apply", slog.String("path", destPath), logger.Err(err))
+			report.Patches = append(report.Patches, AuditedPatch{Path: destPath, Patch: yamlPatchPath, Status: AuditFails})
+			return nil
+		}
+		report.Patches = append(report.Patches, AuditedPatch{Path: destPath, Patch: yamlPatchPath, Status: AuditApplies})
+		return writeFile(fs, destPath, patched)
+	}
+	if err != nil {
+		if report := rebaseReportFrom(ctx); report != nil {
+			logger.Log(ctx, slog.LevelWarn, "YAML patch does not apply", slog.String("path", destPath), logger.Err(err))
+			report.Files = append(report.Files, RebasedFile{Path: destPath, Patch: yamlPatchPath, Status: diff.StatusConflicted})
+			return nil
+		}
+		return fmt.Errorf("unable to apply YAML patch %s to %s: %w", yamlPatchPath, destPath, err)
+	}
+	if report := rebaseReportFrom(ctx); report != nil {
+		report.Files = append(report.Files, RebasedFile{Path: destPath, Patch: yamlPatchPath, Status: diff.StatusClean})
+	}
+	return writeFile(fs, destPath, patched)
+}
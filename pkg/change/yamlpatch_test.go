@@ -0,0 +1,198 @@
+package change
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_generateYamlPatch_applyYamlPatch(t *testing.T) {
+	type input struct {
+		from     string
+		to       string
+		upstream string
+	}
+	type expected struct {
+		ops     int
+		patched string
+		err     bool
+	}
+	tests := []struct {
+		name     string
+		input    input
+		expected expected
+	}{
+		{
+			name: "#1 reordered keys",
+			input: input{
+				from:     "a: 1\nb: 2\n",
+				to:       "b: 2\na: 1\n",
+				upstream: "a: 1\nb: 2\n",
+			},
+			expected: expected{ops: 0, patched: "a: 1\nb: 2\n"},
+		},
+		{
+			name: "#2 replace survives an upstream reorder and comments",
+			input: input{
+				from:     "image:\n  repository: upstream/app\n  tag: v1\n",
+				to:       "image:\n  repository: rancher/app\n  tag: v1\n",
+				upstream: "# image settings\nimage:\n  tag: v2\n  # where to pull from\n  repository: upstream/app\n",
+			},
+			expected: expected{ops: 1, patched: "# image settings\nimage:\n  tag: v2\n  # where to pull from\n  repository: rancher/app\n"},
+		},
+		{
+			name: "#3 add and remove",
+			input: input{
+				from:     "a: 1\nb:\n  c: 2\n",
+				to:       "a: 1\nb:\n  d: [x, y]\n",
+				upstream: "a: 1\nb:\n  c: 3\n",
+			},
+			expected: expected{ops: 2, patched: "a: 1\nb:\n  d: [x, y]\n"},
+		},
+		{
+			name: "#4 removed key no longer exists upstream",
+			input: input{
+				from:     "a: 1\nb: 2\n",
+				to:       "a: 1\n",
+				upstream: "a: 1\n",
+			},
+			expected: expected{ops: 1, err: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ops, err := generateYamlPatch([]byte(tc.input.from), []byte(tc.input.to))
+			assert.NoError(t, err)
+			assert.Len(t, ops, tc.expected.ops)
+
+			patched, err := applyYamlPatch([]byte(tc.input.upstream), ops)
+			if tc.expected.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.patched, string(patched))
+		})
+	}
+}
+
+func Test_GenerateYamlPatch_ApplyYamlPatch(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := filesystem.GetFilesystem(root)
+
+	write := func(path, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	write("charts-original/values.yaml", "replicas: 1\n")
+	write("charts/values.yaml", "replicas: 2\n")
+	write("charts-original/multi.yaml", "a: 1\n---\nb: 2\n")
+	write("charts/multi.yaml", "a: 1\n---\nb: 3\n")
+
+	generated, err := GenerateYamlPatch(ctx, fs, "yamlpatch/values.yaml", "charts-original/values.yaml", "charts/values.yaml")
+	assert.NoError(t, err)
+	assert.True(t, generated)
+	yamlPatch, err := os.ReadFile(filepath.Join(root, "yamlpatch/values.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "- op: replace\n  path: /replicas\n  value: 2\n", string(yamlPatch))
+
+	// files with several documents fall back to patches
+	_, err = GenerateYamlPatch(ctx, fs, "yamlpatch/multi.yaml", "charts-original/multi.yaml", "charts/multi.yaml")
+	assert.ErrorIs(t, err, errNotYamlPatchable)
+
+	write("dest/values.yaml", "# number of pods\nreplicas: 1\nimage: app\n")
+	assert.NoError(t, ApplyYamlPatch(ctx, fs, "yamlpatch/values.yaml", "dest/values.yaml"))
+	patched, err := os.ReadFile(filepath.Join(root, "dest/values.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "# number of pods\nreplicas: 2\nimage: app\n", string(patched))
+}
+
+func Test_applyYamlPatch_keepsFormatting(t *testing.T) {
+	upstream := `# Default values for the chart.
+
+image:
+  # the repository to pull from
+  repository: upstream/app
+  tag: v1 # bumped by CI
+
+  pullPolicy: IfNotPresent
+
+tolerations:
+- key: node-role.kubernetes.io/master
+  effect: NoSchedule
+
+- key: node-role.kubernetes.io/control-plane
+  effect: NoSchedule
+
+# extra arguments
+args:
+- --verbose
+- --port=8080
+
+resources: {}
+nodeSelector: {kubernetes.io/os: linux}
+
+# unused
+debug: false
+`
+	patch := `- op: replace
+  path: /image/repository
+  value: rancher/app
+- op: replace
+  path: /tolerations/1/effect
+  value: NoExecute
+- op: add
+  path: /args/-
+  value: --metrics
+- op: add
+  path: /resources/limits
+  value:
+    cpu: 100m
+- op: add
+  path: /nodeSelector/zone
+  value: a
+- op: remove
+  path: /debug
+`
+	want := `# Default values for the chart.
+
+image:
+  # the repository to pull from
+  repository: rancher/app
+  tag: v1 # bumped by CI
+
+  pullPolicy: IfNotPresent
+
+tolerations:
+- key: node-role.kubernetes.io/master
+  effect: NoSchedule
+
+- key: node-role.kubernetes.io/control-plane
+  effect: NoExecute
+
+# extra arguments
+args:
+- --verbose
+- --port=8080
+- --metrics
+
+resources:
+  limits:
+    cpu: 100m
+nodeSelector: {kubernetes.io/os: linux, zone: a}
+
+`
+
+	var ops []yamlPatchOperation
+	assert.NoError(t, yaml.Unmarshal([]byte(patch), &ops))
+	patched, err := applyYamlPatch([]byte(upstream), ops)
+	assert.NoError(t, err)
+	assert.Equal(t, want, string(patched))
+}
@@ -29,6 +29,8 @@ type AdditionalChart struct {
 	IgnoreDependencies []string `yaml:"ignoreDependencies"`
 	// ReplacePaths marks paths as those that should be replaced instead of patches. Consequently, these paths will exist in both generated-changes/excludes and generated-changes/overlay
 	ReplacePaths []string `yaml:"replacePaths"`
+	// YamlPatchPaths marks YAML files whose changes should be stored as JSON Patch operations in generated-changes/yamlpatch instead of patches
+	YamlPatchPaths []string `yaml:"yamlPatchPaths,omitempty"`
 
 	// The version of this chart in Upstream. This value is set to a non-nil value on Prepare.
 	// GenerateChart will fail if this value is not set (e.g. chart must be prepared first)
@@ -239,21 +241,22 @@ func (c *AdditionalChart) GeneratePatch(ctx context.Context, rootFs, pkgFs billy
 		return fmt.Errorf("encountered error while trying to prepare dependencies in %s: %s", c.OriginalDir(), err)
 	}
 	defer filesystem.RemoveAll(pkgFs, c.OriginalDir())
-	if err := change.GenerateChanges(ctx, pkgFs, c.OriginalDir(), c.WorkingDir, c.GeneratedChangesRootDir(), c.ReplacePaths); err != nil {
+	if err := change.GenerateChanges(ctx, pkgFs, c.OriginalDir(), c.WorkingDir, c.GeneratedChangesRootDir(), c.ReplacePaths, c.YamlPatchPaths); err != nil {
 		return fmt.Errorf("encountered error while generating changes from %s to %s and placing it in %s: %s", c.OriginalDir(), c.WorkingDir, c.GeneratedChangesRootDir(), err)
 	}
 	return nil
 }
 
-// GenerateChart generates the chart and stores it in the assets and charts directory
-func (c *AdditionalChart) GenerateChart(ctx context.Context, rootFs, pkgFs billy.Filesystem, packageVersion *int, version *semver.Version, autoGenBumpVersion *semver.Version, omitBuildMetadataOnExport bool) error {
+// GenerateChart generates the chart and stores it in the assets and charts directory. It returns the path of the archive within rootFs.
+func (c *AdditionalChart) GenerateChart(ctx context.Context, rootFs, pkgFs billy.Filesystem, packageVersion *int, version *semver.Version, autoGenBumpVersion *semver.Version, omitBuildMetadataOnExport bool) (string, error) {
 	if c.upstreamChartVersion == nil {
-		return fmt.Errorf("cannot generate chart since it has never been prepared: upstreamChartVersion is not set")
+		return "", fmt.Errorf("cannot generate chart since it has never been prepared: upstreamChartVersion is not set")
 	}
-	if err := helm.ExportHelmChart(ctx, rootFs, pkgFs, c.WorkingDir, packageVersion, version, autoGenBumpVersion, *c.upstreamChartVersion, omitBuildMetadataOnExport); err != nil {
-		return fmt.Errorf("encountered error while trying to export Helm chart for %s: %s", c.WorkingDir, err)
+	tgzPath, err := helm.ExportHelmChart(ctx, rootFs, pkgFs, c.WorkingDir, packageVersion, version, autoGenBumpVersion, *c.upstreamChartVersion, omitBuildMetadataOnExport)
+	if err != nil {
+		return "", fmt.Errorf("encountered error while trying to export Helm chart for %s: %s", c.WorkingDir, err)
 	}
-	return nil
+	return tgzPath, nil
 }
 
 // OriginalDir returns a working directory where we can place the original chart from upstream
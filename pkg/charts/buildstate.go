@@ -0,0 +1,226 @@
+package charts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/puller"
+)
+
+// ToolVersion is the version of charts-build-scripts; it is part of the inputs of every package,
+// so that upgrading charts-build-scripts exports every package again
+var ToolVersion = ""
+
+// BuildState records the inputs and the assets of the last export of each package,
+// so that packages whose inputs did not change are not exported again
+type BuildState struct {
+	Packages map[string]PackageBuildState `json:"packages"`
+
+	mu sync.Mutex
+}
+
+// PackageBuildState is the last export of a single package
+type PackageBuildState struct {
+	// InputsHash is the sha256 digest of every file of the package that is not created by preparing it and of the export options
+	InputsHash string `json:"inputsHash"`
+	// Assets maps the path of each asset exported by the package to its sha256 digest
+	Assets map[string]string `json:"assets"`
+}
+
+// LoadBuildState loads the build state of the repository; it is empty if nothing was exported yet
+func LoadBuildState(ctx context.Context, rootFs billy.Filesystem) (*BuildState, error) {
+	state := &BuildState{Packages: make(map[string]PackageBuildState)}
+	exists, err := filesystem.PathExists(ctx, rootFs, path.BuildStateFile)
+	if err != nil || !exists {
+		return state, err
+	}
+	data, err := util.ReadFile(rootFs, path.BuildStateFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path.BuildStateFile, err)
+	}
+	if state.Packages == nil {
+		state.Packages = make(map[string]PackageBuildState)
+	}
+	return state, nil
+}
+
+// Save writes the build state to the repository
+func (s *BuildState) Save(ctx context.Context, rootFs billy.Filesystem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := rootFs.MkdirAll(filepath.Dir(path.BuildStateFile), os.ModePerm); err != nil {
+		return err
+	}
+	logger.Log(ctx, slog.LevelDebug, "saving build state", slog.String("path", path.BuildStateFile))
+	return util.WriteFile(rootFs, path.BuildStateFile, data, 0644)
+}
+
+// GenerateChartsIfChanged creates Helm chart archives like GenerateCharts, unless state shows that the inputs of the package
+// did not change since its last export and that the assets it exported are untouched. Packages are always exported if force is set
+// or if one of their upstreams is not pinned (e.g. a branch), since their inputs cannot be known without pulling it.
+// Every export is recorded in state.
+func (p *Package) GenerateChartsIfChanged(ctx context.Context, omitBuildMetadataOnExport bool, state *BuildState, force bool) error {
+	inputsHash, err := p.inputsHash(ctx, omitBuildMetadataOnExport)
+	if err != nil {
+		return err
+	}
+	if !force && len(inputsHash) > 0 && state.isUpToDate(ctx, p.rootFs, p.Name, inputsHash) {
+		logger.Log(ctx, slog.LevelInfo, "skipping package whose inputs did not change since its last export")
+		return nil
+	}
+
+	tgzPaths, err := p.generateCharts(ctx, omitBuildMetadataOnExport)
+	if err != nil {
+		return err
+	}
+	if len(inputsHash) == 0 {
+		return nil
+	}
+	assets := make(map[string]string, len(tgzPaths))
+	for _, tgzPath := range tgzPaths {
+		if assets[tgzPath], err = fileDigest(p.rootFs, tgzPath); err != nil {
+			return err
+		}
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.Packages[p.Name] = PackageBuildState{InputsHash: inputsHash, Assets: assets}
+	return nil
+}
+
+// isUpToDate returns whether the last export of the package had the same inputs and its assets are untouched
+func (s *BuildState) isUpToDate(ctx context.Context, rootFs billy.Filesystem, name, inputsHash string) bool {
+	s.mu.Lock()
+	built, ok := s.Packages[name]
+	s.mu.Unlock()
+	if !ok || built.InputsHash != inputsHash || len(built.Assets) == 0 {
+		return false
+	}
+	for asset, digest := range built.Assets {
+		current, err := fileDigest(rootFs, asset)
+		if err != nil || current != digest {
+			logger.Log(ctx, slog.LevelDebug, "asset is missing or was modified since the last export", slog.String("asset", asset))
+			return false
+		}
+	}
+	return true
+}
+
+// inputsHash returns the digest of every file of the package that is not created by preparing it and of the export options.
+// The upstreams of the package and of its dependencies must be pinned, except local packages whose inputs are part of the digest.
+// It is empty if an upstream is not pinned.
+func (p *Package) inputsHash(ctx context.Context, omitBuildMetadataOnExport bool) (string, error) {
+	return p.inputsHashOf(ctx, omitBuildMetadataOnExport, map[string]bool{p.Name: true})
+}
+
+// inputsHashOf returns the inputsHash of the package; visiting holds the packages whose inputs are being hashed,
+// from the package being built to the local package p is the upstream of
+func (p *Package) inputsHashOf(ctx context.Context, omitBuildMetadataOnExport bool, visiting map[string]bool) (string, error) {
+	refs, err := getUpstreamRefs(ctx, []*Package{p})
+	if err != nil {
+		return "", err
+	}
+	var localPackages []string
+	for _, ref := range refs {
+		localPackage, ok := ref.upstream.(LocalPackage)
+		if !ok {
+			if !puller.IsPinned(ref.upstream) {
+				logger.Log(ctx, slog.LevelDebug, "upstream is not pinned", slog.String("source", ref.source), slog.String("url", ref.upstream.GetOptions().URL))
+				return "", nil
+			}
+			continue
+		}
+		if visiting[localPackage.Name] {
+			return "", fmt.Errorf("local package %s of %s depends on itself", localPackage.Name, ref.source)
+		}
+		upstreamPackage, err := GetPackage(ctx, p.rootFs, localPackage.Name)
+		if err != nil {
+			return "", err
+		}
+		if upstreamPackage == nil {
+			return "", fmt.Errorf("could not find local package %s of %s", localPackage.Name, ref.source)
+		}
+		visiting[localPackage.Name] = true
+		upstreamHash, err := upstreamPackage.inputsHashOf(ctx, false, visiting)
+		delete(visiting, localPackage.Name)
+		if err != nil || len(upstreamHash) == 0 {
+			return "", err
+		}
+		localPackages = append(localPackages, fmt.Sprintf("%s=%s", ref.source, upstreamHash))
+	}
+	sort.Strings(localPackages)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "toolVersion=%s\n", ToolVersion)
+	fmt.Fprintf(hash, "omitBuildMetadataOnExport=%t\n", omitBuildMetadataOnExport)
+	if p.AutoGeneratedBumpVersion != nil {
+		fmt.Fprintf(hash, "autoGeneratedBumpVersion=%s\n", p.AutoGeneratedBumpVersion)
+	}
+	for _, localPackage := range localPackages {
+		fmt.Fprintf(hash, "localPackage=%s\n", localPackage)
+	}
+	preparedPaths := p.preparedPaths()
+	err = filesystem.WalkDir(ctx, p.fs, ".", func(ctx context.Context, fs billy.Filesystem, path string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		for _, preparedPath := range preparedPaths {
+			if path == preparedPath || strings.HasPrefix(path, preparedPath+string(filepath.Separator)) {
+				return nil
+			}
+		}
+		f, err := fs.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(hash, "%s\x00", filepath.ToSlash(path))
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+		fmt.Fprint(hash, "\x00")
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to hash the inputs of package %s: %w", p.Name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileDigest returns the sha256 digest of a file, formatted as sha256:<hex>
+func fileDigest(fs billy.Filesystem, path string) (string, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
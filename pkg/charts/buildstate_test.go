@@ -0,0 +1,139 @@
+package charts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/puller"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_inputsHash(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	root := t.TempDir()
+	write := func(path, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	write("package.yaml", "url: https://example.com/chart.tgz\n")
+	write("generated-changes/patch/values.yaml.patch", "--- a\n+++ b\n")
+
+	digest := "sha256:0123"
+	p := &Package{
+		Name:   "test-chart",
+		Chart:  Chart{Upstream: puller.Archive{URL: "https://example.com/chart.tgz", Digest: &digest}, WorkingDir: "charts"},
+		fs:     filesystem.GetFilesystem(root),
+		rootFs: filesystem.GetFilesystem(root),
+	}
+	hash, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, hash)
+
+	// preparing the package does not change its inputs
+	write("charts/Chart.yaml", "name: test-chart\n")
+	write("charts-original/Chart.yaml", "name: test-chart\n")
+	prepared, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, prepared)
+
+	omitted, err := p.inputsHash(ctx, true)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, omitted)
+
+	write("generated-changes/patch/values.yaml.patch", "--- a\n+++ c\n")
+	changed, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+
+	// upgrading charts-build-scripts exports the package again
+	t.Cleanup(func() { ToolVersion = "" })
+	ToolVersion = "v1.2.3 (abcdef)"
+	upgraded, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, changed, upgraded)
+
+	// branches and archives without a digest cannot be pinned
+	for _, upstream := range []puller.Puller{
+		puller.GitRepository{URL: "https://github.com/rancher/charts"},
+		puller.Archive{URL: "https://example.com/chart.tgz"},
+	} {
+		p.Chart.Upstream = upstream
+		unpinned, err := p.inputsHash(ctx, false)
+		assert.NoError(t, err)
+		assert.Empty(t, unpinned)
+	}
+}
+
+func Test_inputsHash_dependencies(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	root := t.TempDir()
+	write := func(path, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), os.ModePerm))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	write("packages/app/package.yaml", "url: https://example.com/app.tgz\ndigest: sha256:0123\n")
+	write("packages/app/generated-changes/dependencies/lib/dependency.yaml", "url: packages/lib\n")
+	write("packages/lib/package.yaml", "url: https://example.com/lib.tgz\ndigest: sha256:4567\n")
+	write("packages/lib/generated-changes/patch/values.yaml.patch", "--- a\n+++ b\n")
+
+	rootFs := filesystem.GetFilesystem(root)
+	p, err := GetPackage(ctx, rootFs, "app")
+	assert.NoError(t, err)
+	hash, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, hash)
+
+	// a change to the local package the dependency is pulled from forces a rebuild
+	write("packages/lib/generated-changes/patch/values.yaml.patch", "--- a\n+++ c\n")
+	changed, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+
+	// so does an unpinned dependency
+	write("packages/app/generated-changes/dependencies/lib/dependency.yaml", "url: https://github.com/rancher/lib.git\nchartRepoBranch: main\n")
+	unpinned, err := p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.Empty(t, unpinned)
+
+	// and the unpinned upstream of the local package
+	write("packages/app/generated-changes/dependencies/lib/dependency.yaml", "url: packages/lib\n")
+	write("packages/lib/package.yaml", "url: https://example.com/lib.tgz\n")
+	unpinned, err = p.inputsHash(ctx, false)
+	assert.NoError(t, err)
+	assert.Empty(t, unpinned)
+}
+
+func Test_BuildState(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	rootFs := filesystem.GetFilesystem(root)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "assets/test-chart"), os.ModePerm))
+	asset := "assets/test-chart/test-chart-1.0.0.tgz"
+	assert.NoError(t, os.WriteFile(filepath.Join(root, asset), []byte("chart"), 0644))
+	digest, err := fileDigest(rootFs, asset)
+	assert.NoError(t, err)
+
+	state, err := LoadBuildState(ctx, rootFs)
+	assert.NoError(t, err)
+	assert.Empty(t, state.Packages)
+	assert.False(t, state.isUpToDate(ctx, rootFs, "test-chart", "hash"))
+
+	state.Packages["test-chart"] = PackageBuildState{InputsHash: "hash", Assets: map[string]string{asset: digest}}
+	assert.NoError(t, state.Save(ctx, rootFs))
+	state, err = LoadBuildState(ctx, rootFs)
+	assert.NoError(t, err)
+	assert.True(t, state.isUpToDate(ctx, rootFs, "test-chart", "hash"))
+	assert.False(t, state.isUpToDate(ctx, rootFs, "test-chart", "other"))
+
+	// assets that were modified or removed are exported again
+	assert.NoError(t, os.WriteFile(filepath.Join(root, asset), []byte("modified"), 0644))
+	assert.False(t, state.isUpToDate(ctx, rootFs, "test-chart", "hash"))
+	assert.NoError(t, os.Remove(filepath.Join(root, asset)))
+	assert.False(t, state.isUpToDate(ctx, rootFs, "test-chart", "hash"))
+}
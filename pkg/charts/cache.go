@@ -0,0 +1,119 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/puller"
+)
+
+// upstreamRef is an upstream referenced by a package, along with where it is referenced for logging
+type upstreamRef struct {
+	upstream puller.Puller
+	// source is the package, additional chart or dependency that references the upstream
+	source string
+}
+
+// getUpstreamRefs returns every upstream referenced by the packages: main charts, additional charts
+// and dependencies declared in dependency.yaml files under generated-changes/dependencies
+func getUpstreamRefs(ctx context.Context, packages []*Package) ([]upstreamRef, error) {
+	var refs []upstreamRef
+	for _, p := range packages {
+		refs = append(refs, upstreamRef{upstream: p.Chart.Upstream, source: p.Name})
+		dependencyMap, err := GetDependencyMap(ctx, p.fs, p.Chart.GeneratedChangesRootDir())
+		if err != nil {
+			return nil, fmt.Errorf("unable to load dependencies of %s: %w", p.Name, err)
+		}
+		for name, dependency := range dependencyMap {
+			refs = append(refs, upstreamRef{upstream: dependency.Upstream, source: filepath.Join(p.Name, name)})
+		}
+
+		for _, additionalChart := range p.AdditionalCharts {
+			if additionalChart.Upstream == nil {
+				continue
+			}
+			source := filepath.Join(p.Name, additionalChart.WorkingDir)
+			refs = append(refs, upstreamRef{upstream: *additionalChart.Upstream, source: source})
+			dependencyMap, err := GetDependencyMap(ctx, p.fs, additionalChart.GeneratedChangesRootDir())
+			if err != nil {
+				return nil, fmt.Errorf("unable to load dependencies of %s: %w", source, err)
+			}
+			for name, dependency := range dependencyMap {
+				refs = append(refs, upstreamRef{upstream: dependency.Upstream, source: filepath.Join(source, name)})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// WarmCache pulls every upstream referenced by the packages so that they land in the puller.RootCache,
+// which must be initialized beforehand. Upstreams that already exist within the repository are skipped.
+func WarmCache(ctx context.Context, repoRoot string, packages []*Package) error {
+	refs, err := getUpstreamRefs(ctx, packages)
+	if err != nil {
+		return err
+	}
+
+	rootFs := filesystem.GetFilesystem(repoRoot)
+	// pulls must land within the repository to be added to the cache
+	absTempDir, err := os.MkdirTemp(repoRoot, "cache-warm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(absTempDir)
+	tempDir, err := filesystem.GetRelativePath(rootFs, absTempDir)
+	if err != nil {
+		return err
+	}
+	tempFs, err := rootFs.Chroot(tempDir)
+	if err != nil {
+		return err
+	}
+
+	pulled := make(map[string]bool)
+	for i, ref := range refs {
+		if ref.upstream.IsWithinPackage() {
+			continue
+		}
+		keyer, ok := ref.upstream.(puller.OfflineCacheKeyer)
+		if !ok {
+			logger.Log(ctx, slog.LevelDebug, "skipping upstream that cannot be cached", slog.String("source", ref.source))
+			continue
+		}
+		key := keyer.OfflineCacheKey()
+		if pulled[key] {
+			continue
+		}
+		logger.Log(ctx, slog.LevelInfo, "warming cache", slog.String("source", ref.source), slog.String("key", key))
+		pullPath := fmt.Sprintf("upstream-%d", i)
+		if err := ref.upstream.Pull(ctx, rootFs, tempFs, pullPath); err != nil {
+			return fmt.Errorf("unable to pull upstream of %s: %w", ref.source, err)
+		}
+		if err := filesystem.RemoveAll(tempFs, pullPath); err != nil {
+			return err
+		}
+		pulled[key] = true
+	}
+	logger.Log(ctx, slog.LevelInfo, "cache warmed", slog.Int("upstreams", len(pulled)))
+	return nil
+}
+
+// CheckCached returns a puller.NotCachedError listing every upstream referenced by the packages that is missing from the cache
+func CheckCached(ctx context.Context, packages []*Package) error {
+	refs, err := getUpstreamRefs(ctx, packages)
+	if err != nil {
+		return err
+	}
+	upstreams := make([]puller.Puller, 0, len(refs))
+	for _, ref := range refs {
+		if !ref.upstream.IsWithinPackage() {
+			upstreams = append(upstreams, ref.upstream)
+		}
+	}
+	return puller.CheckCached(ctx, upstreams)
+}
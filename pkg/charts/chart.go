@@ -25,6 +25,8 @@ type Chart struct {
 	IgnoreDependencies []string `yaml:"ignoreDependencies"`
 	// ReplacePaths marks paths as those that should be replaced instead of patches. Consequently, these paths will exist in both generated-changes/excludes and generated-changes/overlay
 	ReplacePaths []string `yaml:"replacePaths"`
+	// YamlPatchPaths marks YAML files whose changes should be stored as JSON Patch operations in generated-changes/yamlpatch instead of patches
+	YamlPatchPaths []string `yaml:"yamlPatchPaths,omitempty"`
 
 	// The version of this chart in Upstream. This value is set to a non-nil value on Prepare.
 	// GenerateChart will fail if this value is not set (e.g. chart must be prepared first)
@@ -95,6 +97,21 @@ func (c *Chart) Prepare(ctx context.Context, rootFs, pkgFs billy.Filesystem) err
 	return nil
 }
 
+// pullPreviousUpstream pulls the upstream the patches were made against into previousDir, converted into a Helm chart like
+// the upstream is on prepare, so that they can be rebased onto the new upstream
+func (c *Chart) pullPreviousUpstream(ctx context.Context, rootFs, pkgFs billy.Filesystem, previous puller.Puller, previousDir string) error {
+	if err := filesystem.RemoveAll(pkgFs, previousDir); err != nil {
+		return err
+	}
+	if err := previous.Pull(ctx, rootFs, pkgFs, previousDir); err != nil {
+		return fmt.Errorf("encountered error while trying to pull the previous upstream into %s: %s", previousDir, err)
+	}
+	if err := helm.ConvertToHelmChart(ctx, pkgFs, previousDir); err != nil {
+		return fmt.Errorf("encountered error while trying to convert the previous upstream at %s into a Helm chart: %s", previousDir, err)
+	}
+	return nil
+}
+
 // GeneratePatch generates a patch on a forked Helm chart based on local changes
 func (c *Chart) GeneratePatch(ctx context.Context, rootFs, pkgFs billy.Filesystem) error {
 	if c.Upstream.IsWithinPackage() {
@@ -121,21 +138,22 @@ func (c *Chart) GeneratePatch(ctx context.Context, rootFs, pkgFs billy.Filesyste
 		return fmt.Errorf("encountered error while trying to prepare dependencies in %s: %s", c.OriginalDir(), err)
 	}
 	defer filesystem.RemoveAll(pkgFs, c.OriginalDir())
-	if err := change.GenerateChanges(ctx, pkgFs, c.OriginalDir(), c.WorkingDir, c.GeneratedChangesRootDir(), c.ReplacePaths); err != nil {
+	if err := change.GenerateChanges(ctx, pkgFs, c.OriginalDir(), c.WorkingDir, c.GeneratedChangesRootDir(), c.ReplacePaths, c.YamlPatchPaths); err != nil {
 		return fmt.Errorf("encountered error while generating changes from %s to %s and placing it in %s: %s", c.OriginalDir(), c.WorkingDir, c.GeneratedChangesRootDir(), err)
 	}
 	return nil
 }
 
-// GenerateChart generates the chart and stores it in the assets and charts directory
-func (c *Chart) GenerateChart(ctx context.Context, rootFs, pkgFs billy.Filesystem, packageVersion *int, version *semver.Version, autoGenBumpVersion *semver.Version, omitBuildMetadataOnExport bool) error {
+// GenerateChart generates the chart and stores it in the assets and charts directory. It returns the path of the archive within rootFs.
+func (c *Chart) GenerateChart(ctx context.Context, rootFs, pkgFs billy.Filesystem, packageVersion *int, version *semver.Version, autoGenBumpVersion *semver.Version, omitBuildMetadataOnExport bool) (string, error) {
 	if c.UpstreamChartVersion == nil {
-		return fmt.Errorf("cannot generate chart since it has never been prepared: upstreamChartVersion is not set")
+		return "", fmt.Errorf("cannot generate chart since it has never been prepared: upstreamChartVersion is not set")
 	}
-	if err := helm.ExportHelmChart(ctx, rootFs, pkgFs, c.WorkingDir, packageVersion, version, autoGenBumpVersion, *c.UpstreamChartVersion, omitBuildMetadataOnExport); err != nil {
-		return fmt.Errorf("encountered error while trying to export Helm chart for %s: %s", c.WorkingDir, err)
+	tgzPath, err := helm.ExportHelmChart(ctx, rootFs, pkgFs, c.WorkingDir, packageVersion, version, autoGenBumpVersion, *c.UpstreamChartVersion, omitBuildMetadataOnExport)
+	if err != nil {
+		return "", fmt.Errorf("encountered error while trying to export Helm chart for %s: %s", c.WorkingDir, err)
 	}
-	return nil
+	return tgzPath, nil
 }
 
 // OriginalDir returns a working directory where we can place the original chart from upstream
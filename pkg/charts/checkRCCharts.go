@@ -6,6 +6,7 @@ import (
 
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/output"
 )
 
 // CheckRCCharts checks for any charts that have RC versions
@@ -32,3 +33,26 @@ func CheckRCCharts(ctx context.Context, repoRoot string) (map[string][]string, e
 
 	return rcChartVersionMap, nil
 }
+
+// RCReport lists the images with RC tags and the charts with RC versions that are tracked by the release.yaml
+type RCReport struct {
+	// Images maps each image to its RC tags
+	Images map[string][]string `json:"images"`
+	// Charts maps each chart to its RC versions
+	Charts map[string][]string `json:"charts"`
+}
+
+// Failed returns whether an image or a chart is a release candidate
+func (r RCReport) Failed() bool {
+	return len(r.Images) > 0 || len(r.Charts) > 0
+}
+
+// Header returns the columns of the RC report
+func (r RCReport) Header() []string {
+	return []string{"KIND", "NAME", "RC"}
+}
+
+// Rows returns the images, then the charts of the RC report
+func (r RCReport) Rows() [][]string {
+	return append(output.ListRows("image", r.Images), output.ListRows("chart", r.Charts)...)
+}
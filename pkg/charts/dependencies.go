@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
@@ -16,6 +15,8 @@ import (
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
 	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/puller"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
 	helmChart "helm.sh/helm/v3/pkg/chart"
 	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
 	helmCLI "helm.sh/helm/v3/pkg/cli"
@@ -24,11 +25,6 @@ import (
 	"sigs.k8s.io/yaml"
 )
 
-// helmRepoFetchMutex protects concurrent HTTP requests to Helm repositories
-// This ensures that only one goroutine can query Helm repo indexes at a time,
-// preventing rate limiting and HTTP/2 GOAWAY errors from concurrent requests
-var helmRepoFetchMutex sync.Mutex
-
 // PrepareDependencies prepares all of the dependencies of a given chart and regenerates the requirements.yaml or Chart.yaml
 func PrepareDependencies(ctx context.Context, rootFs, pkgFs billy.Filesystem, mainHelmChartPath string, gcRootDir string, ignoreDependencies []string) error {
 	logger.Log(ctx, slog.LevelInfo, "loading dependencies")
@@ -208,10 +204,14 @@ func LoadDependencies(ctx context.Context, pkgFs billy.Filesystem, mainHelmChart
 			continue
 		}
 
+		if puller.OfflineMode {
+			return fmt.Errorf("dependency %s has no %s and cannot be looked up in %s in offline mode", dependencyName, path.DependencyOptionsFile, dependency.Repository)
+		}
+
 		logger.Log(ctx, slog.LevelDebug, "looking for dependency", slog.String("dependencyName", dependencyName), slog.String("repository", dependency.Repository))
 
-		// Acquire mutex to serialize Helm repository queries and prevent rate limiting
-		helmRepoFetchMutex.Lock()
+		// Serialize queries to the same Helm repository to prevent rate limiting and HTTP/2 GOAWAY errors
+		unlock := scheduler.Lock(dependency.Repository)
 		dependencyURL, err := helmRepo.FindChartInRepoURL(
 			dependency.Repository,
 			dependencyName,
@@ -219,7 +219,7 @@ func LoadDependencies(ctx context.Context, pkgFs billy.Filesystem, mainHelmChart
 			"", "", "",
 			helmGetter.All(&helmCLI.EnvSettings{}),
 		)
-		helmRepoFetchMutex.Unlock()
+		unlock()
 
 		if err != nil {
 			return fmt.Errorf("encountered error while trying to find the repository for dependency %s: %s", dependency.Name, err)
@@ -9,9 +9,11 @@ import (
 
 	"github.com/blang/semver"
 	"github.com/go-git/go-billy/v5"
+	"github.com/rancher/charts-build-scripts/pkg/change"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/helm"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/puller"
 )
 
 // Package represents the configuration of a particular forked Helm chart
@@ -40,6 +42,11 @@ type Package struct {
 	rootFs billy.Filesystem
 }
 
+// PackageName returns the name of the package, e.g. to name the task that works on it
+func PackageName(p *Package) string {
+	return p.Name
+}
+
 // Prepare pulls in a package based on the spec to the local git repository
 func (p *Package) Prepare(ctx context.Context) error {
 	logger.Log(ctx, slog.LevelInfo, "make prepare")
@@ -77,6 +84,41 @@ func (p *Package) Prepare(ctx context.Context) error {
 	return nil
 }
 
+// RebasePatches prepares the package like Prepare, but patches of the generated changes that no longer apply to the upstream
+// are merged with it instead of failing: the previous upstream is the base, the patched previous upstream is ours and
+// the new upstream is theirs. Conflicts are left in the working directories with git-style conflict markers.
+// If previous is nil, the base of the main chart is made of the lines each hunk expects, as for the additional charts.
+func (p *Package) RebasePatches(ctx context.Context, previous puller.Puller) (*change.RebaseReport, error) {
+	logger.Log(ctx, slog.LevelInfo, "make patch-rebase")
+
+	if previous != nil && !p.Chart.Upstream.IsWithinPackage() {
+		previousDir := change.PreviousUpstreamDir(p.Chart.WorkingDir)
+		defer filesystem.RemoveAll(p.fs, previousDir)
+		if err := p.Chart.pullPreviousUpstream(ctx, p.rootFs, p.fs, previous, previousDir); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &change.RebaseReport{}
+	if err := p.Prepare(change.WithRebaseReport(ctx, report)); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// AuditPatches prepares the package like Prepare and reports, for each patch of the generated changes, whether it still applies
+// to the current upstream, applies with fuzz or is partially or fully redundant because the upstream already contains its changes.
+// Hunks that do not apply are left out instead of failing, so the package is cleaned once audited.
+func (p *Package) AuditPatches(ctx context.Context) (*change.AuditReport, error) {
+	logger.Log(ctx, slog.LevelInfo, "make patch-audit")
+
+	report := &change.AuditReport{}
+	if err := p.Prepare(change.WithAuditReport(ctx, report)); err != nil {
+		return report, err
+	}
+	return report, p.Clean(ctx)
+}
+
 // GeneratePatch generates a patch on a forked Helm chart based on local changes
 func (p *Package) GeneratePatch(ctx context.Context) error {
 	logger.Log(ctx, slog.LevelInfo, "make patch")
@@ -105,49 +147,50 @@ func (p *Package) GeneratePatch(ctx context.Context) error {
 
 // GenerateCharts creates Helm chart archives for each chart after preparing it
 func (p *Package) GenerateCharts(ctx context.Context, omitBuildMetadataOnExport bool) error {
+	_, err := p.generateCharts(ctx, omitBuildMetadataOnExport)
+	return err
+}
+
+// generateCharts creates Helm chart archives for each chart after preparing it and returns their paths within the repository
+func (p *Package) generateCharts(ctx context.Context, omitBuildMetadataOnExport bool) ([]string, error) {
 	logger.Log(ctx, slog.LevelInfo, "make charts")
 
 	if p.DoNotRelease {
 		logger.Log(ctx, slog.LevelInfo, "skipping package marked doNotRelease")
-		return nil
+		return nil, nil
 	}
 	if err := p.Prepare(ctx); err != nil {
 		logger.Log(ctx, slog.LevelError, "failed preparing chart", slog.String("workingDir", p.WorkingDir))
-		return errors.New("failed preparing chart: " + err.Error())
+		return nil, errors.New("failed preparing chart: " + err.Error())
 	}
 
 	// Add PackageVersion to format
-	err := p.Chart.GenerateChart(ctx, p.rootFs, p.fs, p.PackageVersion, p.Version, p.AutoGeneratedBumpVersion, omitBuildMetadataOnExport)
+	tgzPath, err := p.Chart.GenerateChart(ctx, p.rootFs, p.fs, p.PackageVersion, p.Version, p.AutoGeneratedBumpVersion, omitBuildMetadataOnExport)
 	if err != nil {
 		logger.Log(ctx, slog.LevelError, "failed exporting main chart", slog.String("workingDir", p.WorkingDir))
-		return errors.New("failed exporting main chart: " + err.Error())
+		return nil, errors.New("failed exporting main chart: " + err.Error())
 	}
+	tgzPaths := []string{tgzPath}
 
 	for _, additionalChart := range p.AdditionalCharts {
-		err = additionalChart.GenerateChart(ctx, p.rootFs, p.fs, p.PackageVersion, p.Version, p.AutoGeneratedBumpVersion, omitBuildMetadataOnExport)
+		tgzPath, err = additionalChart.GenerateChart(ctx, p.rootFs, p.fs, p.PackageVersion, p.Version, p.AutoGeneratedBumpVersion, omitBuildMetadataOnExport)
 		if err != nil {
 			logger.Log(ctx, slog.LevelError, "failed exporting additional chart", slog.String("workingDir", p.WorkingDir))
-			return errors.New("failed exporting additional chart: " + err.Error())
+			return nil, errors.New("failed exporting additional chart: " + err.Error())
 		}
+		tgzPaths = append(tgzPaths, tgzPath)
 	}
 
 	if err := helm.CreateOrUpdateHelmIndex(ctx, p.rootFs); err != nil {
-		return err
+		return nil, err
 	}
-	return p.Clean(ctx)
+	return tgzPaths, p.Clean(ctx)
 }
 
 // Clean removes all other files except for the package.yaml, patch, and overlay/ files from a package
 func (p *Package) Clean(ctx context.Context) error {
 	logger.Log(ctx, slog.LevelInfo, "make clean")
 
-	chartPathsToClean := []string{p.Chart.OriginalDir()}
-	if !p.Chart.Upstream.IsWithinPackage() {
-		chartPathsToClean = append(chartPathsToClean, p.Chart.WorkingDir)
-	} else {
-		// Local charts should clean up added dependencies
-		chartPathsToClean = append(chartPathsToClean, filepath.Join(p.Chart.WorkingDir, "charts"))
-	}
 	for _, additionalChart := range p.AdditionalCharts {
 		if additionalChart.Upstream != nil && (*additionalChart.Upstream).IsWithinPackage() {
 			// Working directory never needs to be clean for an additional chart
@@ -162,9 +205,8 @@ func (p *Package) Clean(ctx context.Context) error {
 				return fmt.Errorf("encountered error while reverting changes from %s to main chart: %s", additionalChart.WorkingDir, err)
 			}
 		}
-		chartPathsToClean = append(chartPathsToClean, additionalChart.OriginalDir(), additionalChart.WorkingDir)
 	}
-	for _, chartPath := range chartPathsToClean {
+	for _, chartPath := range p.preparedPaths() {
 		logger.Log(ctx, slog.LevelDebug, "cleaning", slog.String("chartPath", chartPath))
 		if err := filesystem.RemoveAll(p.fs, chartPath); err != nil {
 			return fmt.Errorf("encountered error while trying to remove %s from package %s: %s", chartPath, p.Name, err)
@@ -172,3 +214,22 @@ func (p *Package) Clean(ctx context.Context) error {
 	}
 	return nil
 }
+
+// preparedPaths returns the paths within the package that only exist once it is prepared and are removed by Clean
+func (p *Package) preparedPaths() []string {
+	chartPaths := []string{p.Chart.OriginalDir()}
+	if !p.Chart.Upstream.IsWithinPackage() {
+		chartPaths = append(chartPaths, p.Chart.WorkingDir)
+	} else {
+		// Local charts should clean up added dependencies
+		chartPaths = append(chartPaths, filepath.Join(p.Chart.WorkingDir, "charts"))
+	}
+	for _, additionalChart := range p.AdditionalCharts {
+		if additionalChart.Upstream != nil && (*additionalChart.Upstream).IsWithinPackage() {
+			// Working directory never needs to be clean for an additional chart
+			continue
+		}
+		chartPaths = append(chartPaths, additionalChart.OriginalDir(), additionalChart.WorkingDir)
+	}
+	return chartPaths
+}
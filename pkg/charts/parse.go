@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"reflect"
 	"strings"
 
 	"github.com/blang/semver"
@@ -14,6 +15,7 @@ import (
 	"github.com/rancher/charts-build-scripts/pkg/options"
 	"github.com/rancher/charts-build-scripts/pkg/path"
 	"github.com/rancher/charts-build-scripts/pkg/puller"
+	"gopkg.in/yaml.v2"
 	helmRegistry "helm.sh/helm/v3/pkg/registry"
 )
 
@@ -84,6 +86,25 @@ func ListPackages(ctx context.Context, repoRoot string, specificPackage string)
 	return packageList, filesystem.WalkDir(ctx, rootFs, path.RepositoryPackagesDir, listPackages)
 }
 
+// PackageList is the report of the packages found within the repository
+type PackageList struct {
+	Packages []string `json:"packages"`
+}
+
+// Header returns the columns of the package list
+func (l PackageList) Header() []string {
+	return []string{"PACKAGE"}
+}
+
+// Rows returns a row per package
+func (l PackageList) Rows() [][]string {
+	rows := make([][]string, len(l.Packages))
+	for i, name := range l.Packages {
+		rows[i] = []string{name}
+	}
+	return rows
+}
+
 // GetPackage returns a Package based on the options provided
 func GetPackage(ctx context.Context, rootFs billy.Filesystem, name string) (*Package, error) {
 	// Get pkgFs
@@ -147,6 +168,31 @@ func GetPackage(ctx context.Context, rootFs billy.Filesystem, name string) (*Pac
 	return &p, nil
 }
 
+// GetPreviousUpstream returns the upstream of the main chart of the package in previousPackageYaml, the contents of an earlier
+// package.yaml of the package (e.g. the committed one), so that patches can be rebased from it onto the current upstream.
+// It returns nil if that upstream exists within the package or is configured like the current one.
+func GetPreviousUpstream(ctx context.Context, p *Package, previousPackageYaml []byte) (puller.Puller, error) {
+	var previousOpt options.PackageOptions
+	if err := yaml.Unmarshal(previousPackageYaml, &previousOpt); err != nil {
+		return nil, fmt.Errorf("cannot parse the previous package options of %s: %s", p.Name, err)
+	}
+	packageOpt, err := options.LoadPackageOptionsFromFile(ctx, p.fs, path.PackageOptionsFile)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(previousOpt.MainChartOptions.UpstreamOptions, packageOpt.MainChartOptions.UpstreamOptions) {
+		return nil, nil
+	}
+	upstream, err := GetUpstream(ctx, previousOpt.MainChartOptions.UpstreamOptions)
+	if err != nil {
+		return nil, err
+	}
+	if upstream.IsWithinPackage() {
+		return nil, nil
+	}
+	return upstream, nil
+}
+
 // GetChartFromOptions returns a Chart based on the options provided
 func GetChartFromOptions(ctx context.Context, opt options.ChartOptions) (Chart, error) {
 	upstream, err := GetUpstream(ctx, opt.UpstreamOptions)
@@ -162,6 +208,7 @@ func GetChartFromOptions(ctx context.Context, opt options.ChartOptions) (Chart,
 		Upstream:           upstream,
 		IgnoreDependencies: opt.IgnoreDependencies,
 		ReplacePaths:       opt.ReplacePaths,
+		YamlPatchPaths:     opt.YamlPatchPaths,
 	}, nil
 }
 
@@ -181,6 +228,7 @@ func GetAdditionalChartFromOptions(ctx context.Context, opt options.AdditionalCh
 		WorkingDir:         opt.WorkingDir,
 		IgnoreDependencies: opt.IgnoreDependencies,
 		ReplacePaths:       opt.ReplacePaths,
+		YamlPatchPaths:     opt.YamlPatchPaths,
 	}
 	if opt.UpstreamOptions != nil {
 		upstream, err := GetUpstream(ctx, *opt.UpstreamOptions)
@@ -217,6 +265,16 @@ func GetAdditionalChartFromOptions(ctx context.Context, opt options.AdditionalCh
 
 // GetUpstream returns the appropriate Upstream given the options provided
 func GetUpstream(ctx context.Context, opt options.UpstreamOptions) (puller.Puller, error) {
+	if opt.Provenance != nil && (opt.HelmRepository != nil || !isArchiveURL(opt.URL)) {
+		return nil, fmt.Errorf("provenance can only be required for an upstream archive (must contain .tgz)")
+	}
+	if opt.HelmRepository != nil {
+		upstream, err := puller.GetHelmRepository(*opt.HelmRepository)
+		if err != nil {
+			return nil, err
+		}
+		return upstream, nil
+	}
 	if opt.URL == "" {
 		return nil, fmt.Errorf("URL is not defined")
 	}
@@ -239,20 +297,31 @@ func GetUpstream(ctx context.Context, opt options.UpstreamOptions) (puller.Pulle
 	}
 	if helmRegistry.IsOCI(opt.URL) {
 		upstream := puller.Registry{
-			URL: opt.URL,
+			URL:    opt.URL,
+			Digest: opt.Digest,
 		}
 		return upstream, nil
 	}
 	if strings.HasSuffix(opt.URL, ".git") {
+		if host := puller.GetGitHost(opt.URL); len(host) > 0 && !puller.IsGithubURL(opt.URL) {
+			// Repositories hosted outside of github.com (GitLab, Gitea, self-hosted) keep their full clone URL
+			upstream, err := puller.GetGitRepository(opt, opt.ChartRepoBranch)
+			if err != nil {
+				return nil, err
+			}
+			return upstream, nil
+		}
 		upstream, err := puller.GetGithubRepository(opt, opt.ChartRepoBranch)
 		if err != nil {
 			return nil, err
 		}
 		return upstream, nil
 	}
-	if strings.HasSuffix(opt.URL, ".tgz") || strings.Contains(opt.URL, ".tar.gz") {
+	if isArchiveURL(opt.URL) {
 		upstream := puller.Archive{
-			URL: opt.URL,
+			URL:        opt.URL,
+			Digest:     opt.Digest,
+			Provenance: opt.Provenance,
 		}
 		if opt.Subdirectory != nil {
 			upstream.Subdirectory = opt.Subdirectory
@@ -261,3 +330,8 @@ func GetUpstream(ctx context.Context, opt options.UpstreamOptions) (puller.Pulle
 	}
 	return nil, fmt.Errorf("URL is invalid (must contain .git or .tgz)")
 }
+
+// isArchiveURL returns whether the URL points to a .tgz archive
+func isArchiveURL(url string) bool {
+	return strings.HasSuffix(url, ".tgz") || strings.Contains(url, ".tar.gz")
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"log/slog"
-	"os"
 	"path/filepath"
 
 	"github.com/go-git/go-billy/v5"
@@ -30,7 +29,8 @@ func Delete(ctx context.Context, rootFs billy.Filesystem, assets []string, versi
 
 // DeleteVersion will check and remove assets/<chart>; charts/<chart>
 func DeleteVersion(ctx context.Context, rootFs billy.Filesystem, chart, version string) error {
-	logger.Log(ctx, slog.LevelInfo, "remove", slog.String("chart", chart), slog.String("version", version))
+	ctx = logger.WithChart(ctx, chart, version)
+	logger.Log(ctx, slog.LevelInfo, "remove")
 	if chart == "" {
 		return errors.New("chart not provided")
 	}
@@ -66,6 +66,11 @@ func DeleteVersion(ctx context.Context, rootFs billy.Filesystem, chart, version
 	}
 	logger.Log(ctx, slog.LevelDebug, "removed", slog.String("chartPath", chartPath))
 
+	// remove the provenance file of the asset, if it was signed
+	if err := filesystem.RemoveAll(rootFs, assetPath+helm.ProvenanceExt); err != nil {
+		return errors.New("failed to remove: " + assetPath + helm.ProvenanceExt + " error: " + err.Error())
+	}
+
 	// remove asset version .tgz
 	if err := removeDirFile(ctx, rootFs, assetPath, filepath.Join(path.RepositoryAssetsDir, chart)); err != nil {
 		return err
@@ -147,7 +152,7 @@ func deleteIndexEntry(ctx context.Context, rootFs billy.Filesystem, chart, versi
 
 	// replace the old map with the new one without the entry version
 	index.Entries[chart] = newEntry[chart]
-	if err := index.WriteFile(filesystem.GetAbsPath(rootFs, path.RepositoryHelmIndexFile), os.ModePerm); err != nil {
+	if err := helm.WriteIndexYaml(rootFs, index); err != nil {
 		return errors.New("deleting index entry; failed to write index.yaml: " + err.Error())
 	}
 
@@ -0,0 +1,256 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+)
+
+const (
+	// envPrefix is the prefix of the environment variables that hold credentials for a host.
+	// e.g. CHARTS_AUTH_GITLAB_EXAMPLE_COM_TOKEN holds a token for gitlab.example.com
+	envPrefix = "CHARTS_AUTH_"
+	// defaultTokenUsername is the username sent along a token when Basic authentication is required (e.g. Git over HTTPS)
+	defaultTokenUsername = "x-access-token"
+	redacted             = "REDACTED"
+)
+
+// Credentials represent the secrets used to authenticate against a host
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+	// source describes where the credentials were found, used for logging
+	source string
+}
+
+// IsEmpty returns whether there is nothing to authenticate with
+func (c Credentials) IsEmpty() bool {
+	return c.Username == "" && c.Password == "" && c.Token == ""
+}
+
+// BasicAuth returns the username and password to use for Basic authentication.
+// A token takes precedence over a password.
+func (c Credentials) BasicAuth() (string, string) {
+	if c.Token != "" {
+		username := c.Username
+		if username == "" {
+			username = defaultTokenUsername
+		}
+		return username, c.Token
+	}
+	return c.Username, c.Password
+}
+
+// SetAuthHeader sets the Authorization header of the request.
+// A token without username is sent as a Bearer token, everything else uses Basic authentication.
+func (c Credentials) SetAuthHeader(req *http.Request) {
+	if c.IsEmpty() {
+		return
+	}
+	if c.Token != "" && c.Username == "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		return
+	}
+	req.SetBasicAuth(c.BasicAuth())
+}
+
+// GitConfigEnv returns the environment variables that make the git CLI authenticate with these credentials
+// without putting them on the command line or in the remote URL.
+// The entry is added after the GIT_CONFIG_KEY_<n>/GIT_CONFIG_VALUE_<n> entries already set in the environment, if any.
+func (c Credentials) GitConfigEnv() []string {
+	if c.IsEmpty() {
+		return nil
+	}
+	username, password := c.BasicAuth()
+	header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+
+	// git fails with a clear error if the count is not a number, the environment is left as it is for it to report it
+	count := 0
+	if existing, ok := os.LookupEnv("GIT_CONFIG_COUNT"); ok {
+		var err error
+		if count, err = strconv.Atoi(existing); err != nil || count < 0 {
+			return nil
+		}
+	}
+	return []string{
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", count+1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=http.extraHeader", count),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, header),
+	}
+}
+
+// String never prints secrets
+func (c Credentials) String() string {
+	if c.IsEmpty() {
+		return "none"
+	}
+	return fmt.Sprintf("username=%s password=%s token=%s source=%s", c.Username, redact(c.Password), redact(c.Token), c.source)
+}
+
+// LogValue implements slog.LogValuer so that secrets are never logged
+func (c Credentials) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("username", c.Username),
+		slog.String("password", redact(c.Password)),
+		slog.String("token", redact(c.Token)),
+		slog.String("source", c.source),
+	)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// RedactURL hides the password of any userinfo embedded in the URL
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// RootKeychain is the keychain used by all pullers to look up credentials
+var RootKeychain = NewKeychain(nil)
+
+// InitRootKeychain initializes the RootKeychain with the per-host entries found in the configuration.yaml
+func InitRootKeychain(ctx context.Context, hosts []options.HostCredentials) {
+	for _, h := range hosts {
+		logger.Log(ctx, slog.LevelDebug, "configured credentials", slog.String("host", h.Host),
+			slog.String("usernameEnv", h.UsernameEnv), slog.String("passwordEnv", h.PasswordEnv), slog.String("tokenEnv", h.TokenEnv))
+	}
+	RootKeychain = NewKeychain(hosts)
+}
+
+// Keychain looks up credentials for a host in the following order:
+// per-host entries of the configuration.yaml, CHARTS_AUTH_<HOST>_{USERNAME,PASSWORD,TOKEN} environment variables,
+// the netrc file ($NETRC or ~/.netrc) and the docker config file ($DOCKER_CONFIG/config.json or ~/.docker/config.json)
+type Keychain struct {
+	hosts  map[string]options.HostCredentials
+	getenv func(string) string
+	// netrcPath and dockerConfigPath override the default locations of these files, used for testing
+	netrcPath        string
+	dockerConfigPath string
+}
+
+// NewKeychain returns a Keychain that knows about the given per-host entries
+func NewKeychain(hosts []options.HostCredentials) *Keychain {
+	k := &Keychain{
+		hosts:  make(map[string]options.HostCredentials, len(hosts)),
+		getenv: os.Getenv,
+	}
+	for _, h := range hosts {
+		k.hosts[strings.ToLower(h.Host)] = h
+	}
+	return k
+}
+
+// ForURL returns the credentials for the host of an http(s) URL.
+// Any other kind of URL (e.g. scp-like Git URLs using SSH) gets no credentials.
+func (k *Keychain) ForURL(ctx context.Context, rawURL string) (Credentials, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci") {
+		return Credentials{}, nil
+	}
+	return k.Get(ctx, u.Hostname())
+}
+
+// Get returns the credentials for the host, or empty credentials if none are found
+func (k *Keychain) Get(ctx context.Context, host string) (Credentials, error) {
+	host = strings.ToLower(host)
+
+	creds := k.fromConfig(ctx, host)
+	if creds.IsEmpty() {
+		creds = k.fromEnv(host)
+	}
+	if creds.IsEmpty() {
+		c, err := k.fromNetrc(host)
+		if err != nil {
+			return Credentials{}, err
+		}
+		creds = c
+	}
+	if creds.IsEmpty() {
+		c, err := k.fromDockerConfig(host)
+		if err != nil {
+			return Credentials{}, err
+		}
+		creds = c
+	}
+
+	if !creds.IsEmpty() {
+		logger.Log(ctx, slog.LevelDebug, "found credentials", slog.String("host", host), slog.Any("credentials", creds))
+	}
+	return creds, nil
+}
+
+func (k *Keychain) fromConfig(ctx context.Context, host string) Credentials {
+	h, ok := k.hosts[host]
+	if !ok {
+		return Credentials{}
+	}
+	creds := Credentials{
+		Username: h.Username,
+		source:   "configuration.yaml",
+	}
+	if h.UsernameEnv != "" {
+		creds.Username = k.getenv(h.UsernameEnv)
+	}
+	if h.PasswordEnv != "" {
+		creds.Password = k.getenv(h.PasswordEnv)
+	}
+	if h.TokenEnv != "" {
+		creds.Token = k.getenv(h.TokenEnv)
+	}
+	if creds.Password == "" && creds.Token == "" {
+		logger.Log(ctx, slog.LevelWarn, "credentials configured but no secret found in the environment", slog.String("host", host))
+	}
+	return creds
+}
+
+func (k *Keychain) fromEnv(host string) Credentials {
+	prefix := envPrefix + envHost(host)
+	return Credentials{
+		Username: k.getenv(prefix + "_USERNAME"),
+		Password: k.getenv(prefix + "_PASSWORD"),
+		Token:    k.getenv(prefix + "_TOKEN"),
+		source:   "environment",
+	}
+}
+
+// envHost converts a host to the form used in environment variable names, e.g. gitlab.example.com -> GITLAB_EXAMPLE_COM
+func envHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, host)
+}
+
+// homePath returns the path of a file within the user's home directory, or an empty string if there is no home
+func (k *Keychain) homePath(elem ...string) string {
+	home := k.getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(append([]string{home}, elem...)...)
+}
@@ -0,0 +1,154 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fromNetrc returns the login and password of the machine entry matching the host, falling back to the default entry
+func (k *Keychain) fromNetrc(host string) (Credentials, error) {
+	netrcPath := k.netrcPath
+	if netrcPath == "" {
+		netrcPath = k.getenv("NETRC")
+	}
+	if netrcPath == "" {
+		netrcPath = k.homePath(".netrc")
+	}
+	if netrcPath == "" {
+		return Credentials{}, nil
+	}
+	data, err := os.ReadFile(netrcPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Credentials{}, nil
+	}
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to read netrc file %s: %w", netrcPath, err)
+	}
+	return parseNetrc(string(data), host), nil
+}
+
+// parseNetrc parses the machine, default, login and password tokens of a netrc file; macros are skipped
+func parseNetrc(data, host string) Credentials {
+	var matched, fallback *Credentials
+	var current *Credentials
+
+	fields := strings.Fields(data)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if i+1 >= len(fields) {
+				break
+			}
+			i++
+			current = &Credentials{source: "netrc"}
+			if matched == nil && strings.EqualFold(fields[i], host) {
+				matched = current
+			}
+		case "default":
+			current = &Credentials{source: "netrc"}
+			if fallback == nil {
+				fallback = current
+			}
+		case "login":
+			if current != nil && i+1 < len(fields) {
+				i++
+				current.Username = fields[i]
+			}
+		case "password":
+			if current != nil && i+1 < len(fields) {
+				i++
+				current.Password = fields[i]
+			}
+		case "macdef":
+			// a macro definition runs until an empty line, which is lost when splitting on whitespace, so stop parsing
+			current = nil
+			i = len(fields)
+		}
+	}
+	if matched != nil {
+		return *matched
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return Credentials{}
+}
+
+// dockerConfig represents the parts of the docker config.json relevant to authentication
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+}
+
+// fromDockerConfig returns the credentials stored in the auths section of the docker config.json; credential helpers are not supported
+func (k *Keychain) fromDockerConfig(host string) (Credentials, error) {
+	configPath := k.dockerConfigPath
+	if configPath == "" {
+		if dockerConfigDir := k.getenv("DOCKER_CONFIG"); dockerConfigDir != "" {
+			configPath = filepath.Join(dockerConfigDir, "config.json")
+		} else {
+			configPath = k.homePath(".docker", "config.json")
+		}
+	}
+	if configPath == "" {
+		return Credentials{}, nil
+	}
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Credentials{}, nil
+	}
+	if err != nil {
+		return Credentials{}, fmt.Errorf("unable to read docker config file %s: %w", configPath, err)
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Credentials{}, fmt.Errorf("unable to parse docker config file %s: %w", configPath, err)
+	}
+
+	for key, auth := range config.Auths {
+		if !strings.EqualFold(dockerConfigHost(key), host) {
+			continue
+		}
+		creds := Credentials{
+			Username: auth.Username,
+			Password: auth.Password,
+			Token:    auth.IdentityToken,
+			source:   "docker config",
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credentials{}, fmt.Errorf("unable to decode auth for %s in docker config file %s: %w", key, configPath, err)
+			}
+			username, password, _ := strings.Cut(string(decoded), ":")
+			creds.Username, creds.Password = username, password
+		}
+		return creds, nil
+	}
+	return Credentials{}, nil
+}
+
+// dockerConfigHost returns the hostname of a docker config auths key, which may be a plain host or a URL (e.g. https://index.docker.io/v1/)
+func dockerConfigHost(key string) string {
+	if strings.Contains(key, "://") {
+		if u, err := url.Parse(key); err == nil {
+			return u.Hostname()
+		}
+	}
+	host, _, _ := strings.Cut(key, "/")
+	if h, _, found := strings.Cut(host, ":"); found {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,36 @@
+package credentials
+
+import (
+	"net/http"
+)
+
+// HTTPClient returns a client that authenticates every request with the credentials the RootKeychain holds for its host.
+// Since credentials are looked up per request, a redirect to another host never receives them.
+func HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: authTransport{base: http.DefaultTransport},
+	}
+}
+
+// authTransport adds the Authorization header to requests that do not already carry one
+type authTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	creds, err := RootKeychain.Get(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if creds.IsEmpty() {
+		return t.base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the original request
+	authReq := req.Clone(req.Context())
+	creds.SetAuthHeader(authReq)
+	return t.base.RoundTrip(authReq)
+}
@@ -0,0 +1,71 @@
+package diff
+
+import "strings"
+
+// HunkStatus is the outcome of checking a single hunk against a file
+type HunkStatus string
+
+const (
+	// HunkApplies means the hunk applies where it is expected or at an offset
+	HunkApplies HunkStatus = "applies"
+	// HunkFuzzed means the hunk only applies with fuzz
+	HunkFuzzed HunkStatus = "fuzzed"
+	// HunkRedundant means the file already contains the change: the hunk reverse-applies cleanly
+	HunkRedundant HunkStatus = "redundant"
+	// HunkFails means the hunk neither applies nor reverse-applies
+	HunkFails HunkStatus = "fails"
+)
+
+// Audit checks every hunk of fileDiff against content, in order, and applies the ones that apply.
+// A hunk that does not apply cleanly but whose changes content already contains is redundant and left out,
+// as are the hunks that fail. It returns the patched contents and the status of each hunk.
+func Audit(content []byte, fileDiff *FileDiff) ([]byte, []HunkStatus) {
+	lines := splitLines(content)
+	statuses := make([]HunkStatus, len(fileDiff.Hunks))
+	var out []string
+	// pos is the first line of lines that has not been copied to out yet
+	pos := 0
+	offset := 0
+	for i, hunk := range fileDiff.Hunks {
+		old, new, leading, trailing := hunk.split()
+		start := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			// an empty range refers to the line before it
+			start = hunk.OldStart
+		}
+
+		// an exact match wins over a reversed one, which wins over a fuzzy one.
+		// An empty side only matches an empty file, so that creating or removing a file is not taken for granted.
+		at, _, ok := locate(lines, pos, start+offset, old, leading, trailing, 0)
+		ok = ok && (len(old) > 0 || len(lines) == 0)
+		fuzz := 0
+		if !ok {
+			if at, _, ok := locate(lines, pos, start+offset, new, leading, trailing, 0); ok && (len(new) > 0 || len(lines) == 0) {
+				statuses[i] = HunkRedundant
+				out = append(out, lines[pos:at+len(new)]...)
+				pos = at + len(new)
+				offset = at - start
+				continue
+			}
+			if len(old) > 0 {
+				at, fuzz, ok = locate(lines, pos, start+offset, old, leading, trailing, maxFuzz)
+			}
+		}
+		if !ok {
+			statuses[i] = HunkFails
+			continue
+		}
+
+		statuses[i] = HunkApplies
+		if fuzz > 0 {
+			statuses[i] = HunkFuzzed
+		}
+		lead, trail := min(fuzz, leading), min(fuzz, trailing)
+		out = append(out, lines[pos:at+lead]...)
+		out = append(out, new[lead:len(new)-trail]...)
+		pos = at + len(old) - trail
+		offset = at - start
+	}
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), statuses
+}
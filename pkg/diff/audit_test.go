@@ -0,0 +1,56 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Audit(t *testing.T) {
+	patch := "--- charts-original/file\n+++ charts/file\n" +
+		"@@ -2,3 +2,3 @@\n b\n-c\n+X\n d\n" +
+		"@@ -9,3 +9,3 @@\n i\n-j\n+Y\n k\n"
+
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		statuses []HunkStatus
+	}{
+		{
+			name:     "#1 - both hunks apply",
+			content:  "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			want:     "a\nb\nX\nd\ne\nf\ng\nh\ni\nY\nk\n",
+			statuses: []HunkStatus{HunkApplies, HunkApplies},
+		},
+		{
+			name:     "#2 - first hunk merged upstream",
+			content:  "a\nb\nX\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			want:     "a\nb\nX\nd\ne\nf\ng\nh\ni\nY\nk\n",
+			statuses: []HunkStatus{HunkRedundant, HunkApplies},
+		},
+		{
+			name:     "#3 - both hunks merged upstream",
+			content:  "a\nb\nX\nd\ne\nf\ng\nh\ni\nY\nk\n",
+			want:     "a\nb\nX\nd\ne\nf\ng\nh\ni\nY\nk\n",
+			statuses: []HunkStatus{HunkRedundant, HunkRedundant},
+		},
+		{
+			name:     "#4 - fuzz and failure",
+			content:  "a\nb\nZ\nd\ne\nf\ng\nh\nchanged\nj\nk\n",
+			want:     "a\nb\nZ\nd\ne\nf\ng\nh\nchanged\nY\nk\n",
+			statuses: []HunkStatus{HunkFails, HunkFuzzed},
+		},
+	}
+
+	fileDiffs, err := Parse([]byte(patch))
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, statuses := Audit([]byte(tt.content), fileDiffs[0])
+			assert.Equal(t, tt.want, string(got))
+			assert.Equal(t, tt.statuses, statuses)
+		})
+	}
+}
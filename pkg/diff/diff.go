@@ -0,0 +1,467 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+)
+
+// horizonLines is the number of identical lines kept around the differing region before comparing, as GNU diff does for -u
+const horizonLines = DefaultContext
+
+// change is a run of deleted lines from the old file and inserted lines in the new file.
+// line0 and line1 are the 0-based indexes of the first line of the run in each file.
+type change struct {
+	line0, line1      int
+	deleted, inserted int
+}
+
+// splitLines splits content into lines, each keeping its trailing newline; the last line might not have one
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:i+1]))
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// isBinary reports whether content should be treated as binary, which GNU diff decides by looking for a NUL byte
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// hasNewline reports whether line ends with a newline
+func hasNewline(line string) bool {
+	return strings.HasSuffix(line, "\n")
+}
+
+// computeChanges returns the runs of changes that turn a into b.
+//
+// It follows the steps of GNU diff so that the same hunks are produced: identical ends are trimmed down to
+// horizonLines, lines that cannot match (or match too often) are discarded, a minimal edit script is found
+// with Myers' divide and conquer algorithm and runs of changes are finally slid to the same boundaries.
+// The heuristics GNU diff uses to give up on very expensive comparisons are not implemented.
+func computeChanges(a, b []string) []change {
+	// find the identical prefix and suffix, keeping horizonLines of each around the differing region
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	prefix = max(prefix-horizonLines, 0)
+	suffix = max(suffix-horizonLines, 0)
+
+	f := newFiles(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	f.discardConfusingLines()
+	f.compareSeq(0, len(f.undiscarded[0]), 0, len(f.undiscarded[1]))
+	f.shiftBoundaries()
+	return f.buildScript(prefix)
+}
+
+// files holds the state of the comparison of two sequences of lines.
+// changed has a false sentinel at each end so that changed[i+1] tells whether line i changed.
+type files struct {
+	equivs      [2][]int
+	changed     [2][]bool
+	undiscarded [2][]int
+	realIndexes [2][]int
+	// fd and bd are the furthest reaching points of the forward and backward searches for each diagonal
+	fd, bd []int
+	// diagOffset is added to a diagonal to get its index in fd and bd
+	diagOffset int
+}
+
+func newFiles(a, b []string) *files {
+	f := &files{}
+	classes := make(map[string]int)
+	for i, lines := range [2][]string{a, b} {
+		f.equivs[i] = make([]int, len(lines))
+		for j, line := range lines {
+			class, ok := classes[line]
+			if !ok {
+				// equivalence class 0 is never used, as in GNU diff
+				class = len(classes) + 1
+				classes[line] = class
+			}
+			f.equivs[i][j] = class
+		}
+		f.changed[i] = make([]bool, len(lines)+2)
+	}
+	return f
+}
+
+// discardConfusingLines marks as changed the lines that do not match any line of the other file before comparing,
+// along with lines that match too many lines when they are surrounded by such lines
+func (f *files) discardConfusingLines() {
+	var counts [2]map[int]int
+	for i := range f.equivs {
+		counts[i] = make(map[int]int)
+		for _, class := range f.equivs[i] {
+			counts[i][class]++
+		}
+	}
+
+	var discarded [2][]byte
+	for i := range f.equivs {
+		end := len(f.equivs[i])
+		discards := make([]byte, end)
+		otherCounts := counts[1-i]
+		// many is roughly 5 times the square root of the number of lines
+		many := 5
+		for tem := (end / 64) >> 2; tem > 0; tem >>= 2 {
+			many *= 2
+		}
+		for j, class := range f.equivs[i] {
+			nmatch := otherCounts[class]
+			if nmatch == 0 {
+				discards[j] = 1
+			} else if nmatch > many {
+				discards[j] = 2
+			}
+		}
+		discarded[i] = discards
+	}
+
+	// only discard provisional lines in the middle of runs of discardable lines
+	for i := range discarded {
+		discards := discarded[i]
+		end := len(discards)
+		for j := 0; j < end; j++ {
+			if discards[j] == 2 {
+				discards[j] = 0
+				continue
+			}
+			if discards[j] == 0 {
+				continue
+			}
+			// find the end of this run of discardable lines and count the provisional ones
+			k := j
+			provisional := 0
+			for ; k < end && discards[k] != 0; k++ {
+				if discards[k] == 2 {
+					provisional++
+				}
+			}
+			// cancel provisional discards at the end and shrink the run
+			for k > j && discards[k-1] == 2 {
+				k--
+				discards[k] = 0
+				provisional--
+			}
+			length := k - j
+
+			if provisional*4 > length {
+				// too many provisional lines in the run, cancel all of them
+				for k > j {
+					k--
+					if discards[k] == 2 {
+						discards[k] = 0
+					}
+				}
+				continue
+			}
+
+			// cancel any subrun of minimum or more provisional lines, minimum being roughly the square root of length/4
+			minimum := 1
+			for tem := length >> 2; tem>>2 > 0; tem >>= 2 {
+				minimum <<= 1
+			}
+			minimum++
+			consec := 0
+			for k = 0; k < length; k++ {
+				if discards[j+k] != 2 {
+					consec = 0
+				} else if consec++; consec == minimum {
+					// back up to the start of the subrun to cancel all of it
+					k -= consec
+				} else if consec > minimum {
+					discards[j+k] = 0
+				}
+			}
+
+			// cancel provisional lines from each end until 3 non-provisional lines in a row or the first
+			// non-provisional line at least 8 lines in
+			consec = 0
+			for k = 0; k < length; k++ {
+				if k >= 8 && discards[j+k] == 1 {
+					break
+				}
+				if discards[j+k] == 2 {
+					consec = 0
+					discards[j+k] = 0
+				} else if discards[j+k] == 0 {
+					consec = 0
+				} else {
+					consec++
+				}
+				if consec == 3 {
+					break
+				}
+			}
+			j += length - 1
+			consec = 0
+			for k = 0; k < length; k++ {
+				if k >= 8 && discards[j-k] == 1 {
+					break
+				}
+				if discards[j-k] == 2 {
+					consec = 0
+					discards[j-k] = 0
+				} else if discards[j-k] == 0 {
+					consec = 0
+				} else {
+					consec++
+				}
+				if consec == 3 {
+					break
+				}
+			}
+		}
+	}
+
+	for i := range discarded {
+		for j, d := range discarded[i] {
+			if d == 0 {
+				f.undiscarded[i] = append(f.undiscarded[i], f.equivs[i][j])
+				f.realIndexes[i] = append(f.realIndexes[i], j)
+			} else {
+				f.changed[i][j+1] = true
+			}
+		}
+	}
+
+	size := len(f.undiscarded[0]) + len(f.undiscarded[1]) + 3
+	f.fd = make([]int, size)
+	f.bd = make([]int, size)
+	f.diagOffset = len(f.undiscarded[1]) + 1
+}
+
+// compareSeq marks the changed lines between undiscarded[0][xoff:xlim] and undiscarded[1][yoff:ylim]
+func (f *files) compareSeq(xoff, xlim, yoff, ylim int) {
+	xv, yv := f.undiscarded[0], f.undiscarded[1]
+	// slide down the bottom initial diagonal and up the top one
+	for xoff < xlim && yoff < ylim && xv[xoff] == yv[yoff] {
+		xoff++
+		yoff++
+	}
+	for xoff < xlim && yoff < ylim && xv[xlim-1] == yv[ylim-1] {
+		xlim--
+		ylim--
+	}
+
+	switch {
+	case xoff == xlim:
+		for ; yoff < ylim; yoff++ {
+			f.changed[1][f.realIndexes[1][yoff]+1] = true
+		}
+	case yoff == ylim:
+		for ; xoff < xlim; xoff++ {
+			f.changed[0][f.realIndexes[0][xoff]+1] = true
+		}
+	default:
+		xmid, ymid := f.diag(xoff, xlim, yoff, ylim)
+		f.compareSeq(xoff, xmid, yoff, ymid)
+		f.compareSeq(xmid, xlim, ymid, ylim)
+	}
+}
+
+// diag finds the midpoint of the shortest edit script between the two sequences by searching
+// forwards and backwards at the same time until the searches meet
+func (f *files) diag(xoff, xlim, yoff, ylim int) (int, int) {
+	xv, yv := f.undiscarded[0], f.undiscarded[1]
+	fd := func(d int) *int { return &f.fd[d+f.diagOffset] }
+	bd := func(d int) *int { return &f.bd[d+f.diagOffset] }
+
+	dmin, dmax := xoff-ylim, xlim-yoff
+	fmid, bmid := xoff-yoff, xlim-ylim
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+	odd := (fmid-bmid)&1 != 0
+
+	*fd(fmid) = xoff
+	*bd(bmid) = xlim
+
+	for {
+		// extend the forward search by an edit step in each diagonal
+		if fmin > dmin {
+			fmin--
+			*fd(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*fd(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			tlo, thi := *fd(d - 1), *fd(d + 1)
+			x0 := tlo + 1
+			if tlo < thi {
+				x0 = thi
+			}
+			x, y := x0, x0-d
+			for x < xlim && y < ylim && xv[x] == yv[y] {
+				x++
+				y++
+			}
+			*fd(d) = x
+			if odd && bmin <= d && d <= bmax && *bd(d) <= x {
+				return x, y
+			}
+		}
+
+		// extend the backward search the same way
+		if bmin > dmin {
+			bmin--
+			*bd(bmin - 1) = int(^uint(0) >> 1)
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*bd(bmax + 1) = int(^uint(0) >> 1)
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			tlo, thi := *bd(d - 1), *bd(d + 1)
+			x0 := thi - 1
+			if tlo < thi {
+				x0 = tlo
+			}
+			x, y := x0, x0-d
+			for xoff < x && yoff < y && xv[x-1] == yv[y-1] {
+				x--
+				y--
+			}
+			*bd(d) = x
+			if !odd && fmin <= d && d <= fmax && x <= *fd(d) {
+				return x, y
+			}
+		}
+	}
+}
+
+// shiftBoundaries slides each run of changes so that it merges with neighbouring runs when possible,
+// or otherwise ends as late as possible, preferring to line up with a run of changes in the other file
+func (f *files) shiftBoundaries() {
+	for i := range f.changed {
+		// changed and otherChanged are indexed from -1 thanks to the sentinels
+		changed := func(k int) *bool { return &f.changed[i][k+1] }
+		otherChanged := func(k int) bool { return f.changed[1-i][k+1] }
+		equivs := f.equivs[i]
+		end := len(equivs)
+
+		k, j := 0, 0
+		for {
+			// find the beginning of the next run of changes, tracking the corresponding line in the other file
+			for k < end && !*changed(k) {
+				for otherChanged(j) {
+					j++
+				}
+				j++
+				k++
+			}
+			if k == end {
+				break
+			}
+			start := k
+			// find the end of this run of changes
+			for k++; *changed(k); k++ {
+			}
+			for otherChanged(j) {
+				j++
+			}
+
+			var runLength, corresponding int
+			for {
+				runLength = k - start
+
+				// move the run back while the previous unchanged line matches the last changed one
+				for start > 0 && equivs[start-1] == equivs[k-1] {
+					start--
+					*changed(start) = true
+					k--
+					*changed(k) = false
+					for *changed(start - 1) {
+						start--
+					}
+					for j--; otherChanged(j); j-- {
+					}
+				}
+
+				// corresponding is the end of the run at the last point it lines up with a run of changes in the other file
+				corresponding = end
+				if otherChanged(j - 1) {
+					corresponding = k
+				}
+
+				// move the run forward while the first changed line matches the next unchanged one
+				for k != end && equivs[start] == equivs[k] {
+					*changed(start) = false
+					start++
+					*changed(k) = true
+					k++
+					for *changed(k) {
+						k++
+					}
+					for j++; otherChanged(j); j++ {
+						corresponding = k
+					}
+				}
+
+				if runLength == k-start {
+					break
+				}
+			}
+
+			// move the fully merged run back to a corresponding run in the other file if possible
+			for corresponding < k {
+				start--
+				*changed(start) = true
+				k--
+				*changed(k) = false
+				for j--; otherChanged(j); j-- {
+				}
+			}
+		}
+	}
+}
+
+// buildScript turns the changed lines into runs of changes, offsetting line numbers by the trimmed prefix
+func (f *files) buildScript(prefix int) []change {
+	var changes []change
+	changed0, changed1 := f.changed[0][1:], f.changed[1][1:]
+	len0, len1 := len(f.equivs[0]), len(f.equivs[1])
+	i0, i1 := 0, 0
+	for i0 < len0 || i1 < len1 {
+		if changed0[i0] || changed1[i1] {
+			line0, line1 := i0, i1
+			for changed0[i0] {
+				i0++
+			}
+			for changed1[i1] {
+				i1++
+			}
+			changes = append(changes, change{
+				line0:    line0 + prefix,
+				line1:    line1 + prefix,
+				deleted:  i0 - line0,
+				inserted: i1 - line1,
+			})
+		}
+		i0++
+		i1++
+	}
+	return changes
+}
@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// MergeLabels are the names printed next to the conflict markers
+type MergeLabels struct {
+	Ours   string
+	Base   string
+	Theirs string
+}
+
+// Merge does a 3-way merge of the changes made by ours and theirs on top of base.
+// Conflicting changes are written between git-style conflict markers, including the base section (diff3 style).
+// It returns the merged contents and the number of conflicts.
+func Merge(base, ours, theirs []byte, labels MergeLabels) ([]byte, int) {
+	merged, conflicts := mergeLines(splitLines(base), splitLines(ours), splitLines(theirs), labels)
+	return []byte(strings.Join(merged, "")), len(conflicts)
+}
+
+// side is the set of changes one side of a merge made to the base
+type side struct {
+	lines   []string
+	changes []change
+	// next is the index of the first change that was not merged yet
+	next int
+	// offset is the difference between the line numbers of this side and the base after the merged changes
+	offset int
+}
+
+// mergeLines returns the merged lines and the [start, end) ranges of base lines that conflict
+func mergeLines(base, ours, theirs []string, labels MergeLabels) ([]string, [][2]int) {
+	sides := [2]*side{
+		{lines: ours, changes: computeChanges(base, ours)},
+		{lines: theirs, changes: computeChanges(base, theirs)},
+	}
+
+	var merged []string
+	var conflicts [][2]int
+	pos := 0
+	for sides[0].next < len(sides[0].changes) || sides[1].next < len(sides[1].changes) {
+		// start a chunk with the change that comes first in the base
+		lo := len(base) + 1
+		for _, s := range sides {
+			if s.next < len(s.changes) {
+				lo = min(lo, s.changes[s.next].line0)
+			}
+		}
+		// extend the chunk with every change of either side that overlaps or touches it
+		hi := lo
+		var inChunk [2][]change
+		for extended := true; extended; {
+			extended = false
+			for i, s := range sides {
+				for s.next < len(s.changes) && s.changes[s.next].line0 <= hi {
+					c := s.changes[s.next]
+					inChunk[i] = append(inChunk[i], c)
+					hi = max(hi, c.line0+c.deleted)
+					s.next++
+					extended = true
+				}
+			}
+		}
+
+		merged = append(merged, base[pos:lo]...)
+		pos = hi
+
+		// the lines each side replaced base[lo:hi] with
+		var regions [2][]string
+		for i, s := range sides {
+			start := lo + s.offset
+			for _, c := range inChunk[i] {
+				s.offset += c.inserted - c.deleted
+			}
+			regions[i] = s.lines[start : hi+s.offset]
+		}
+
+		switch {
+		case len(inChunk[1]) == 0:
+			merged = append(merged, regions[0]...)
+		case len(inChunk[0]) == 0:
+			merged = append(merged, regions[1]...)
+		case slices.Equal(regions[0], regions[1]):
+			merged = append(merged, regions[0]...)
+		default:
+			conflicts = append(conflicts, [2]int{lo, hi})
+			merged = appendConflict(merged, "<<<<<<< "+labels.Ours, regions[0])
+			merged = appendConflict(merged, "||||||| "+labels.Base, base[lo:hi])
+			merged = appendConflict(merged, "=======", regions[1])
+			merged = appendConflict(merged, ">>>>>>> "+labels.Theirs, nil)
+		}
+	}
+	merged = append(merged, base[pos:]...)
+	return merged, conflicts
+}
+
+// appendConflict appends a conflict marker followed by lines, making sure the marker starts on its own line
+func appendConflict(merged []string, marker string, lines []string) []string {
+	if n := len(merged); n > 0 && !hasNewline(merged[n-1]) {
+		merged[n-1] += "\n"
+	}
+	merged = append(merged, strings.TrimSpace(marker)+"\n")
+	return append(merged, lines...)
+}
@@ -0,0 +1,55 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Merge(t *testing.T) {
+	labels := MergeLabels{Ours: "ours", Base: "base", Theirs: "theirs"}
+	base := "a\nb\nc\nd\ne\nf\ng\n"
+
+	tests := []struct {
+		name          string
+		ours          string
+		theirs        string
+		want          string
+		wantConflicts int
+	}{
+		{
+			name:   "#1 - changes far apart",
+			ours:   "a\nB\nc\nd\ne\nf\ng\n",
+			theirs: "a\nb\nc\nd\ne\nF\ng\n",
+			want:   "a\nB\nc\nd\ne\nF\ng\n",
+		},
+		{
+			name:   "#2 - same change on both sides",
+			ours:   "a\nb\nC\nd\ne\nf\ng\n",
+			theirs: "a\nb\nC\nd\ne\nf\ng\n",
+			want:   "a\nb\nC\nd\ne\nf\ng\n",
+		},
+		{
+			name:          "#3 - conflicting changes",
+			ours:          "a\nb\nours\nd\ne\nf\ng\n",
+			theirs:        "a\nb\ntheirs\nd\ne\nf\ng\n",
+			want:          "a\nb\n<<<<<<< ours\nours\n||||||| base\nc\n=======\ntheirs\n>>>>>>> theirs\nd\ne\nf\ng\n",
+			wantConflicts: 1,
+		},
+		{
+			name:          "#4 - insertions at the same place",
+			ours:          "a\nb\nc\nd\nours\ne\nf\ng\n",
+			theirs:        "a\nb\nc\nd\ntheirs\ne\nf\ng\n",
+			want:          "a\nb\nc\nd\n<<<<<<< ours\nours\n||||||| base\n=======\ntheirs\n>>>>>>> theirs\ne\nf\ng\n",
+			wantConflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge([]byte(base), []byte(tt.ours), []byte(tt.theirs), labels)
+			assert.Equal(t, tt.want, string(got))
+			assert.Equal(t, tt.wantConflicts, conflicts)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxFuzz is the number of context lines at each end of a hunk that can be ignored to apply it, as GNU patch does by default
+	maxFuzz = 2
+	// mergeWindow is how many lines around the expected position of a hunk are searched when merging it
+	mergeWindow = 100
+)
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// FileDiff is the part of a unified diff that applies to a single file
+type FileDiff struct {
+	OldName string
+	NewName string
+	Hunks   []Hunk
+}
+
+// Hunk is a single hunk of a unified diff
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	// Lines are the lines of the hunk with their ' ', '-' or '+' prefix.
+	// Each line keeps its newline unless it was followed by a "\ No newline at end of file" marker.
+	Lines []string
+}
+
+// Header returns the header of the hunk as found in the patch
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", headerRange(h.OldStart, h.OldLines), headerRange(h.NewStart, h.NewLines))
+}
+
+func headerRange(start, lines int) string {
+	if lines == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// HunkError is returned when a hunk cannot be found in the file it should apply to
+type HunkError struct {
+	// Hunk is the 1-based index of the hunk within the file diff
+	Hunk   int
+	Header string
+}
+
+func (e *HunkError) Error() string {
+	return fmt.Sprintf("hunk #%d (%s) does not apply", e.Hunk, e.Header)
+}
+
+// Parse parses every file diff within a unified diff. Lines outside of file diffs are ignored, as patch does.
+func Parse(patch []byte) ([]*FileDiff, error) {
+	lines := splitLines(patch)
+	var fileDiffs []*FileDiff
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.HasPrefix(line, "Binary files ") {
+			return nil, fmt.Errorf("binary files cannot be patched: %s", strings.TrimSuffix(line, "\n"))
+		}
+		if !strings.HasPrefix(line, "--- ") || i+1 == len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			i++
+			continue
+		}
+		fileDiff := &FileDiff{
+			OldName: parseName(strings.TrimPrefix(line, "--- ")),
+			NewName: parseName(strings.TrimPrefix(lines[i+1], "+++ ")),
+		}
+		i += 2
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse hunk #%d of %s: %w", len(fileDiff.Hunks)+1, fileDiff.NewName, err)
+			}
+			fileDiff.Hunks = append(fileDiff.Hunks, hunk)
+			i = next
+		}
+		fileDiffs = append(fileDiffs, fileDiff)
+	}
+	if len(fileDiffs) == 0 && len(lines) > 0 {
+		return nil, fmt.Errorf("no file diffs found in patch")
+	}
+	return fileDiffs, nil
+}
+
+// parseName drops the newline and any timestamp that follows the file name in a header line
+func parseName(name string) string {
+	name = strings.TrimSuffix(name, "\n")
+	if i := strings.IndexByte(name, '\t'); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// parseHunk parses the hunk starting at lines[i] and returns the index of the line after it
+func parseHunk(lines []string, i int) (Hunk, int, error) {
+	var hunk Hunk
+	match := hunkHeaderRegex.FindStringSubmatch(lines[i])
+	if match == nil {
+		return hunk, i, fmt.Errorf("invalid header %q", strings.TrimSuffix(lines[i], "\n"))
+	}
+	hunk.OldStart, _ = strconv.Atoi(match[1])
+	hunk.OldLines = 1
+	if match[2] != "" {
+		hunk.OldLines, _ = strconv.Atoi(match[2])
+	}
+	hunk.NewStart, _ = strconv.Atoi(match[3])
+	hunk.NewLines = 1
+	if match[4] != "" {
+		hunk.NewLines, _ = strconv.Atoi(match[4])
+	}
+	i++
+
+	oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+	for oldLeft > 0 || newLeft > 0 {
+		if i == len(lines) {
+			return hunk, i, fmt.Errorf("unexpected end of patch in %s", hunk.Header())
+		}
+		line := lines[i]
+		switch line[0] {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\n':
+			// context lines made of whitespace only sometimes lose their prefix
+			line = " " + line
+			oldLeft--
+			newLeft--
+		default:
+			return hunk, i, fmt.Errorf("unexpected line %q in %s", strings.TrimSuffix(line, "\n"), hunk.Header())
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return hunk, i, fmt.Errorf("more lines than expected in %s", hunk.Header())
+		}
+		hunk.Lines = append(hunk.Lines, line)
+		i++
+		if i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+			hunk.Lines[len(hunk.Lines)-1] = strings.TrimSuffix(line, "\n")
+			i++
+		}
+	}
+	return hunk, i, nil
+}
+
+// split returns the lines the hunk expects to find and the lines it replaces them with,
+// along with the number of context lines at the start and at the end of the hunk
+func (h Hunk) split() (old, new []string, leading, trailing int) {
+	for _, line := range h.Lines {
+		switch line[0] {
+		case ' ':
+			old = append(old, line[1:])
+			new = append(new, line[1:])
+		case '-':
+			old = append(old, line[1:])
+		case '+':
+			new = append(new, line[1:])
+		}
+	}
+	for leading < len(h.Lines) && h.Lines[leading][0] == ' ' {
+		leading++
+	}
+	for trailing < len(h.Lines)-leading && h.Lines[len(h.Lines)-1-trailing][0] == ' ' {
+		trailing++
+	}
+	return old, new, leading, trailing
+}
+
+// Apply applies the hunks of fileDiff to content, in order.
+// Like GNU patch, a hunk that is not found where it is expected is looked up at an offset and,
+// failing that, with up to maxFuzz context lines ignored at each end.
+func Apply(content []byte, fileDiff *FileDiff) ([]byte, error) {
+	result, err := apply(content, fileDiff, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Content, nil
+}
+
+// Status is the outcome of applying a patch to a file
+type Status string
+
+const (
+	// StatusClean means every hunk applied where it was expected or at an offset
+	StatusClean Status = "clean"
+	// StatusFuzzed means some hunks needed fuzz or a 3-way merge with the file to apply
+	StatusFuzzed Status = "fuzzed"
+	// StatusConflicted means some hunks conflict with the file
+	StatusConflicted Status = "conflicted"
+)
+
+// RebaseResult is the outcome of rebasing a patch onto a file
+type RebaseResult struct {
+	Content []byte
+	Status  Status
+	// Conflicts are the 1-based indexes of the hunks that conflict
+	Conflicts []int
+}
+
+// Rebase applies the hunks of fileDiff to content like Apply, but never fails on a hunk.
+// The lines a hunk expects to find are the base of a 3-way merge between the lines it replaces them with
+// and the part of content that lines up best with them; conflicts are written with conflict markers.
+func Rebase(content []byte, fileDiff *FileDiff, labels MergeLabels) RebaseResult {
+	result, _ := apply(content, fileDiff, &labels)
+	return result
+}
+
+// RebaseOnto rebases the hunks of fileDiff onto content, the new version of base, which is the file the patch was made against.
+// If the patch does not apply cleanly to content, it is applied to base and the patched base is 3-way merged with content,
+// so that the base of the merge is the whole previous file rather than the lines each hunk expects.
+// It falls back to Rebase if the patch does not apply to base either.
+func RebaseOnto(base, content []byte, fileDiff *FileDiff, labels MergeLabels) RebaseResult {
+	if result, err := apply(content, fileDiff, nil); err == nil && result.Status == StatusClean {
+		return result
+	}
+	ours, err := Apply(base, fileDiff)
+	if err != nil {
+		return Rebase(content, fileDiff, labels)
+	}
+
+	merged, conflicts := mergeLines(splitLines(base), splitLines(ours), splitLines(content), labels)
+	result := RebaseResult{Content: []byte(strings.Join(merged, "")), Status: StatusFuzzed}
+	if len(conflicts) == 0 {
+		return result
+	}
+	result.Status = StatusConflicted
+	for i, hunk := range fileDiff.Hunks {
+		start := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			start = hunk.OldStart
+		}
+		end := start + hunk.OldLines
+		for _, conflict := range conflicts {
+			if conflict[0] <= end && start <= conflict[1] {
+				result.Conflicts = append(result.Conflicts, i+1)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func apply(content []byte, fileDiff *FileDiff, labels *MergeLabels) (RebaseResult, error) {
+	result := RebaseResult{Status: StatusClean}
+	lines := splitLines(content)
+	var out []string
+	// pos is the first line of lines that has not been copied to out yet
+	pos := 0
+	offset := 0
+	for i, hunk := range fileDiff.Hunks {
+		old, new, leading, trailing := hunk.split()
+		start := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			// an empty range refers to the line before it
+			start = hunk.OldStart
+		}
+
+		at, fuzz, ok := locate(lines, pos, start+offset, old, leading, trailing, maxFuzz)
+		if ok {
+			if fuzz > 0 {
+				result.Status = StatusFuzzed
+			}
+			lead, trail := min(fuzz, leading), min(fuzz, trailing)
+			out = append(out, lines[pos:at+lead]...)
+			out = append(out, new[lead:len(new)-trail]...)
+			pos = at + len(old) - trail
+			offset = at - start
+			continue
+		}
+		if labels == nil {
+			return result, &HunkError{Hunk: i + 1, Header: hunk.Header()}
+		}
+
+		regionStart, regionEnd := alignRegion(lines, pos, start+offset, old)
+		merged, conflicts := mergeLines(old, new, lines[regionStart:regionEnd], *labels)
+		if len(conflicts) > 0 {
+			result.Status = StatusConflicted
+			result.Conflicts = append(result.Conflicts, i+1)
+		} else if result.Status == StatusClean {
+			result.Status = StatusFuzzed
+		}
+		out = append(out, lines[pos:regionStart]...)
+		out = append(out, merged...)
+		pos = regionEnd
+		offset = regionStart - start
+	}
+	out = append(out, lines[pos:]...)
+	result.Content = []byte(strings.Join(out, ""))
+	return result, nil
+}
+
+// alignRegion returns the part of lines, at or after pos and within mergeWindow lines of expected,
+// that lines up best with old. The region is empty and at expected if no line of old can be found.
+func alignRegion(lines []string, pos, expected int, old []string) (int, int) {
+	expected = min(max(expected, pos), len(lines))
+	lo := max(pos, expected-mergeWindow)
+	hi := min(len(lines), expected+len(old)+mergeWindow)
+	window := lines[lo:hi]
+
+	// walk both sequences to find the first and last lines of old that match a line of the window
+	first, last := -1, -1
+	var firstAt, lastAt int
+	k, w := 0, 0
+	for _, c := range append(computeChanges(old, window), change{line0: len(old), line1: len(window)}) {
+		for ; k < c.line0; k, w = k+1, w+1 {
+			if first < 0 {
+				first, firstAt = k, w
+			}
+			last, lastAt = k, w
+		}
+		k += c.deleted
+		w += c.inserted
+	}
+	if first < 0 {
+		return expected, expected
+	}
+	regionStart := max(lo+firstAt-first, lo)
+	regionEnd := min(lo+lastAt+len(old)-last, hi)
+	return regionStart, regionEnd
+}
+
+// locate returns where old starts within lines, at or after pos, searching outwards from expected.
+// It also returns the fuzz, at most fuzzLimit, needed to find it.
+func locate(lines []string, pos, expected int, old []string, leading, trailing, fuzzLimit int) (int, int, bool) {
+	for fuzz := 0; fuzz <= fuzzLimit; fuzz++ {
+		lead, trail := min(fuzz, leading), min(fuzz, trailing)
+		if fuzz > 0 && lead == 0 && trail == 0 {
+			// nothing more to ignore
+			break
+		}
+		pattern := old[lead : len(old)-trail]
+		last := len(lines) - len(pattern)
+		for delta := 0; ; delta++ {
+			forward, backward := expected+lead+delta, expected+lead-delta
+			if forward > last && backward < pos {
+				break
+			}
+			if forward >= pos && forward <= last && matches(lines[forward:], pattern) {
+				return forward - lead, fuzz, true
+			}
+			if delta > 0 && backward >= pos && backward <= last && matches(lines[backward:], pattern) {
+				return backward - lead, fuzz, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// matches reports whether lines start with pattern; a missing newline at the end of a file is not a difference
+func matches(lines, pattern []string) bool {
+	for i, p := range pattern {
+		if strings.TrimSuffix(lines[i], "\n") != strings.TrimSuffix(p, "\n") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Apply(t *testing.T) {
+	patch := "--- charts-original/file\n+++ charts/file\n" +
+		"@@ -2,3 +2,3 @@\n b\n-c\n+X\n d\n" +
+		"@@ -9,3 +9,3 @@\n i\n-j\n+Y\n k\n"
+
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantErrHunk int
+	}{
+		{
+			name:    "#1 - exact position",
+			content: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			want:    "a\nb\nX\nd\ne\nf\ng\nh\ni\nY\nk\n",
+		},
+		{
+			name:    "#2 - at an offset",
+			content: "new\nnew\na\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			want:    "new\nnew\na\nb\nX\nd\ne\nf\ng\nh\ni\nY\nk\n",
+		},
+		{
+			name:    "#3 - with fuzz",
+			content: "a\nb\nc\nd\ne\nf\ng\nh\nchanged\nj\nk\n",
+			want:    "a\nb\nX\nd\ne\nf\ng\nh\nchanged\nY\nk\n",
+		},
+		{
+			name:        "#4 - second hunk does not apply",
+			content:     "a\nb\nc\nd\ne\nf\ng\nh\ni\nchanged\nk\n",
+			wantErrHunk: 2,
+		},
+	}
+
+	fileDiffs, err := Parse([]byte(patch))
+	assert.NoError(t, err)
+	assert.Len(t, fileDiffs, 1)
+	assert.Equal(t, "charts-original/file", fileDiffs[0].OldName)
+	assert.Equal(t, "charts/file", fileDiffs[0].NewName)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.content), fileDiffs[0])
+			if tt.wantErrHunk > 0 {
+				var hunkErr *HunkError
+				assert.ErrorAs(t, err, &hunkErr)
+				assert.Equal(t, tt.wantErrHunk, hunkErr.Hunk)
+				assert.Equal(t, "@@ -9,3 +9,3 @@", hunkErr.Header)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func Test_ApplyUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+	}{
+		{name: "#1 - missing newline added", from: "x\ny", to: "x\ny\n"},
+		{name: "#2 - missing newline removed", from: "x\ny\n", to: "x\nz"},
+		{name: "#3 - new file", from: "", to: "a\nb\n"},
+		{name: "#4 - file emptied", from: "a\nb\n", to: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileDiffs, err := Parse(Unified("a/file", "b/file", []byte(tt.from), []byte(tt.to)))
+			assert.NoError(t, err)
+			got, err := Apply([]byte(tt.from), fileDiffs[0])
+			assert.NoError(t, err)
+			assert.Equal(t, tt.to, string(got))
+		})
+	}
+}
+
+func Test_Parse(t *testing.T) {
+	_, err := Parse([]byte("Binary files a/icon.png and b/icon.png differ\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("garbage\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte("--- a/file\n+++ b/file\n@@ -1,2 +1,2 @@\n a\n"))
+	assert.Error(t, err)
+}
+
+func Test_Rebase(t *testing.T) {
+	labels := MergeLabels{Ours: "file.patch", Base: "previous upstream", Theirs: "upstream"}
+	// the patch changes b and f: the previous upstream was a to h
+	patch := "--- charts-original/file\n+++ charts/file\n" +
+		"@@ -1,8 +1,8 @@\n a\n-b\n+B\n c\n d\n e\n-f\n+F\n g\n h\n"
+
+	tests := []struct {
+		name          string
+		content       string
+		want          string
+		wantStatus    Status
+		wantConflicts []int
+	}{
+		{
+			name:       "#1 - same upstream",
+			content:    "a\nb\nc\nd\ne\nf\ng\nh\n",
+			want:       "a\nB\nc\nd\ne\nF\ng\nh\n",
+			wantStatus: StatusClean,
+		},
+		{
+			name:       "#2 - upstream changed a line the patch does not touch",
+			content:    "a\nb\nc\nnew d\ne\nf\ng\nh\n",
+			want:       "a\nB\nc\nnew d\ne\nF\ng\nh\n",
+			wantStatus: StatusFuzzed,
+		},
+		{
+			name:          "#3 - upstream changed a line the patch changes",
+			content:       "a\nb\nc\nd\ne\nnew f\ng\nh\n",
+			want:          "a\nB\nc\nd\ne\n<<<<<<< file.patch\nF\n||||||| previous upstream\nf\n=======\nnew f\n>>>>>>> upstream\ng\nh\n",
+			wantStatus:    StatusConflicted,
+			wantConflicts: []int{1},
+		},
+	}
+
+	fileDiffs, err := Parse([]byte(patch))
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Rebase([]byte(tt.content), fileDiffs[0], labels)
+			assert.Equal(t, tt.want, string(result.Content))
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantConflicts, result.Conflicts)
+		})
+	}
+}
+
+func Test_RebaseOnto(t *testing.T) {
+	labels := MergeLabels{Ours: "file.patch", Base: "previous upstream", Theirs: "upstream"}
+	base := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	// the patch changes b and f of the previous upstream
+	patch := "--- charts-original/file\n+++ charts/file\n" +
+		"@@ -1,8 +1,8 @@\n a\n-b\n+B\n c\n d\n e\n-f\n+F\n g\n h\n"
+
+	tests := []struct {
+		name          string
+		base          string
+		content       string
+		want          string
+		wantStatus    Status
+		wantConflicts []int
+	}{
+		{
+			name:       "#1 - same upstream",
+			base:       base,
+			content:    base,
+			want:       "a\nB\nc\nd\ne\nF\ng\nh\n",
+			wantStatus: StatusClean,
+		},
+		{
+			name:       "#2 - upstream added and changed lines the patch does not touch",
+			base:       base,
+			content:    "z\na\nb\nc\nD\ne\nf\ng\nh\ni\n",
+			want:       "z\na\nB\nc\nD\ne\nF\ng\nh\ni\n",
+			wantStatus: StatusFuzzed,
+		},
+		{
+			name:          "#3 - upstream changed a line the patch changes",
+			base:          base,
+			content:       "a\nb\nc\nd\ne\nnew f\ng\nh\n",
+			want:          "a\nB\nc\nd\ne\n<<<<<<< file.patch\nF\n||||||| previous upstream\nf\n=======\nnew f\n>>>>>>> upstream\ng\nh\n",
+			wantStatus:    StatusConflicted,
+			wantConflicts: []int{1},
+		},
+		{
+			name:       "#4 - the patch does not apply to the previous upstream",
+			base:       "x\n",
+			content:    "a\nb\nc\nnew d\ne\nf\ng\nh\n",
+			want:       "a\nB\nc\nnew d\ne\nF\ng\nh\n",
+			wantStatus: StatusFuzzed,
+		},
+	}
+
+	fileDiffs, err := Parse([]byte(patch))
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := RebaseOnto([]byte(tt.base), []byte(tt.content), fileDiffs[0], labels)
+			assert.Equal(t, tt.want, string(result.Content))
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.Equal(t, tt.wantConflicts, result.Conflicts)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	// DefaultContext is the number of unchanged lines shown around each change, as in diff -u
+	DefaultContext = 3
+
+	noNewlineMarker = "\\ No newline at end of file\n"
+)
+
+// Unified returns the unified diff that turns from into to, labelling the files with fromName and toName.
+// The output matches GNU diff -uN without timestamps; it is empty if both contents are the same.
+// As in GNU diff, binary contents are not compared line by line.
+func Unified(fromName, toName string, from, to []byte) []byte {
+	if bytes.Equal(from, to) {
+		return nil
+	}
+	if isBinary(from) || isBinary(to) {
+		return []byte(fmt.Sprintf("Binary files %s and %s differ\n", fromName, toName))
+	}
+
+	a, b := splitLines(from), splitLines(to)
+	changes := computeChanges(a, b)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n", fromName)
+	fmt.Fprintf(&buf, "+++ %s\n", toName)
+	for len(changes) > 0 {
+		n := hunkLength(changes, DefaultContext)
+		writeHunk(&buf, a, b, changes[:n], DefaultContext)
+		changes = changes[n:]
+	}
+	return buf.Bytes()
+}
+
+// hunkLength returns how many changes are close enough to the first one to be printed in the same hunk
+func hunkLength(changes []change, context int) int {
+	threshold := 2*context + 1
+	n := 1
+	for n < len(changes) {
+		prev := changes[n-1]
+		if changes[n].line0-(prev.line0+prev.deleted) >= threshold {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// writeHunk writes a single hunk made of changes with context lines around them
+func writeHunk(buf *bytes.Buffer, a, b []string, changes []change, context int) {
+	first, last := changes[0], changes[len(changes)-1]
+	first0 := max(first.line0-context, 0)
+	first1 := max(first.line1-context, 0)
+	last0 := min(last.line0+last.deleted-1+context, len(a)-1)
+	last1 := min(last.line1+last.inserted-1+context, len(b)-1)
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(first0, last0), hunkRange(first1, last1))
+
+	i, j := first0, first1
+	for i <= last0 || j <= last1 {
+		if len(changes) == 0 || i < changes[0].line0 {
+			writeLine(buf, ' ', a[i])
+			i++
+			j++
+			continue
+		}
+		for k := 0; k < changes[0].deleted; k++ {
+			writeLine(buf, '-', a[i])
+			i++
+		}
+		for k := 0; k < changes[0].inserted; k++ {
+			writeLine(buf, '+', b[j])
+			j++
+		}
+		changes = changes[1:]
+	}
+}
+
+// hunkRange formats the 0-based inclusive range of lines [first, last] as found in a hunk header.
+// An empty range refers to the line before it, which is what patch expects.
+func hunkRange(first, last int) string {
+	switch {
+	case last < first:
+		return fmt.Sprintf("%d,0", last+1)
+	case last == first:
+		return fmt.Sprintf("%d", first+1)
+	default:
+		return fmt.Sprintf("%d,%d", first+1, last-first+1)
+	}
+}
+
+func writeLine(buf *bytes.Buffer, prefix byte, line string) {
+	buf.WriteByte(prefix)
+	buf.WriteString(line)
+	if !hasNewline(line) {
+		buf.WriteString("\n" + noNewlineMarker)
+	}
+}
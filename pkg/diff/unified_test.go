@@ -0,0 +1,68 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the expected outputs were produced by GNU diff -uN, without timestamps
+func Test_Unified(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "#1 - same contents",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "#2 - changes far apart are split in two hunks",
+			from: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n",
+			to:   "a\nb\nX\nd\ne\nf\ng\nh\ni\nj\nk\nY\nm\n",
+			want: "--- a/file\n+++ b/file\n" +
+				"@@ -1,6 +1,6 @@\n a\n b\n-c\n+X\n d\n e\n f\n" +
+				"@@ -9,5 +9,5 @@\n i\n j\n k\n-l\n+Y\n m\n",
+		},
+		{
+			name: "#3 - insertion at the end",
+			from: "a\nb\nc\nd\ne\n",
+			to:   "a\nb\nc\nd\ne\nf\n",
+			want: "--- a/file\n+++ b/file\n@@ -3,3 +3,4 @@\n c\n d\n e\n+f\n",
+		},
+		{
+			name: "#4 - insertion within repeated lines is slid down",
+			from: "{{- end }}\n{{- end }}\nfoo\n",
+			to:   "{{- end }}\n{{- end }}\n{{- end }}\nfoo\n",
+			want: "--- a/file\n+++ b/file\n@@ -1,3 +1,4 @@\n {{- end }}\n {{- end }}\n+{{- end }}\n foo\n",
+		},
+		{
+			name: "#5 - missing newline at end of file",
+			from: "x\ny",
+			to:   "x\ny\n",
+			want: "--- a/file\n+++ b/file\n@@ -1,2 +1,2 @@\n x\n-y\n\\ No newline at end of file\n+y\n",
+		},
+		{
+			name: "#6 - new file",
+			from: "",
+			to:   "new\n",
+			want: "--- a/file\n+++ b/file\n@@ -0,0 +1 @@\n+new\n",
+		},
+		{
+			name: "#7 - binary file",
+			from: "a\x00b",
+			to:   "a\x00c",
+			want: "Binary files a/file and b/file differ\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(Unified("a/file", "b/file", []byte(tt.from), []byte(tt.to))))
+		})
+	}
+}
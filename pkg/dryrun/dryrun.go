@@ -0,0 +1,128 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+)
+
+// Action is the kind of change a command would make
+type Action string
+
+const (
+	// ActionCreate means a file would be created
+	ActionCreate Action = "create"
+	// ActionModify means the contents or the permissions of a file would change
+	ActionModify Action = "modify"
+	// ActionRemove means a file would be removed
+	ActionRemove Action = "remove"
+	// ActionCommit means a Git commit would be created
+	ActionCommit Action = "commit"
+	// ActionPush means a Git branch would be pushed
+	ActionPush Action = "push"
+	// ActionOCIPush means a chart would be pushed to an OCI registry
+	ActionOCIPush Action = "oci-push"
+	// ActionImageCopy means an image and its signatures would be copied between registries
+	ActionImageCopy Action = "image-copy"
+)
+
+// Change is a single entry of the plan of a dry run
+type Change struct {
+	Action Action `json:"action"`
+	// Target is what the change applies to, e.g. the path of a file or the reference of an image
+	Target string `json:"target"`
+	// Detail describes the change, e.g. the message of a commit or the source of an image
+	Detail string `json:"detail,omitempty"`
+}
+
+var (
+	enabled bool
+	mu      sync.Mutex
+	changes []Change
+)
+
+// Enable turns on the dry-run mode: commands record the changes they would make instead of making them
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = true
+}
+
+// Enabled returns whether the dry-run mode is on
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// Suspend turns off the dry-run mode until the returned function is called.
+// It is meant for work done in a sandbox that is thrown away once the changes it made were recorded.
+func Suspend() (resume func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	was := enabled
+	enabled = false
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		enabled = was
+	}
+}
+
+// Record adds a change to the plan instead of making it
+func Record(ctx context.Context, action Action, target, detail string) {
+	logger.Log(ctx, slog.LevelInfo, "dry run: skipping", slog.String("action", string(action)), slog.String("target", target), slog.String("detail", detail))
+	mu.Lock()
+	defer mu.Unlock()
+	changes = append(changes, Change{Action: action, Target: target, Detail: detail})
+}
+
+// Recorded returns the changes added by Record, in order
+func Recorded() []Change {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Change(nil), changes...)
+}
+
+// Plan is every change a dry run would have made
+type Plan struct {
+	// Files are the files that would be created, modified or removed, sorted by path
+	Files []Change `json:"files"`
+	// Actions are the commits, pushes and copies that would be made, in order
+	Actions []Change `json:"actions"`
+}
+
+// NewPlan returns the plan made of the given file changes and of the changes added by Record
+func NewPlan(files []Change) Plan {
+	files = append([]Change(nil), files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Target < files[j].Target
+	})
+	return Plan{Files: files, Actions: Recorded()}
+}
+
+// Print writes the plan as a table, or as JSON if porcelain is set
+func (p Plan) Print(w io.Writer, porcelain bool) error {
+	if porcelain {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	}
+	if len(p.Files) == 0 && len(p.Actions) == 0 {
+		_, err := fmt.Fprintln(w, "dry run: nothing would change")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tTARGET\tDETAIL")
+	for _, c := range append(p.Files, p.Actions...) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Action, c.Target, c.Detail)
+	}
+	return tw.Flush()
+}
@@ -16,15 +16,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/util"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/osfs"
+	billyUtil "github.com/go-git/go-billy/v5/util"
 )
 
-// GetFilesystem returns a filesystem rooted at the provided path
+// GetFilesystem returns a filesystem rooted at the provided path.
+// During a dry run, the filesystem reads from disk but keeps every write in memory.
 func GetFilesystem(path string) billy.Filesystem {
+	if dryrun.Enabled() {
+		return newOverlayFs(path)
+	}
 	return osfs.New(path)
 }
 
@@ -48,9 +54,12 @@ func GetRelativePath(fs billy.Filesystem, abspath string) (string, error) {
 
 // PathExists checks if a path exists on the filesystem or returns an error
 func PathExists(ctx context.Context, fs billy.Filesystem, path string) (bool, error) {
-	absPath := GetAbsPath(fs, path)
-
-	_, err := os.Stat(absPath)
+	var err error
+	if o, ok := fs.(*overlayFs); ok {
+		_, err = o.Stat(path)
+	} else {
+		_, err = os.Stat(GetAbsPath(fs, path))
+	}
 	if err == nil {
 		return true, nil
 	}
@@ -62,6 +71,9 @@ func PathExists(ctx context.Context, fs billy.Filesystem, path string) (bool, er
 
 // UpdatePermissions updates the permissions for a given path to the mode provided
 func UpdatePermissions(fs billy.Filesystem, path string, mode int64) error {
+	if o, ok := fs.(*overlayFs); ok {
+		return o.Chmod(path, os.FileMode(mode))
+	}
 	absPath := GetAbsPath(fs, path)
 	return os.Chmod(absPath, os.FileMode(mode))
 }
@@ -77,6 +89,9 @@ func CreateFileAndDirs(fs billy.Filesystem, path string) (billy.File, error) {
 
 // RemoveAll removes all files and directories located at the path
 func RemoveAll(fs billy.Filesystem, path string) error {
+	if o, ok := fs.(*overlayFs); ok {
+		return o.RemoveAll(path)
+	}
 	return os.RemoveAll(GetAbsPath(fs, path))
 }
 
@@ -161,6 +176,12 @@ func CopyFile(ctx context.Context, fs billy.Filesystem, srcPath string, dstPath
 
 // GetChartArchive gets a chart tgz file from a url and drops it into the path specified on the filesystem
 func GetChartArchive(fs billy.Filesystem, url string, path string) error {
+	return GetChartArchiveWithClient(http.DefaultClient, fs, url, path)
+}
+
+// GetChartArchiveWithClient gets a chart tgz file from a url using the provided client (e.g. one that authenticates requests)
+// and drops it into the path specified on the filesystem
+func GetChartArchiveWithClient(client *http.Client, fs billy.Filesystem, url string, path string) error {
 	// Create file
 	tgz, err := CreateFileAndDirs(fs, path)
 	if err != nil {
@@ -168,11 +189,14 @@ func GetChartArchive(fs billy.Filesystem, url string, path string) error {
 	}
 	defer tgz.Close()
 	// Get tgz
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return fmt.Errorf("unable to get chart archive: %s", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to get chart archive: status code %d", resp.StatusCode)
+	}
 	// Copy into the tgz
 	if _, err = io.Copy(tgz, resp.Body); err != nil {
 		return fmt.Errorf("unable to create chart archive: %s", err)
@@ -509,6 +533,97 @@ func compareTars(ctx context.Context, leftFile, rightFile io.Reader) (bool, erro
 	return identical, nil
 }
 
+// ArchiveDiff lists the files that differ between a tgz archive and a directory, by path relative to the root of each
+type ArchiveDiff struct {
+	OnlyInArchive []string
+	OnlyInDir     []string
+	Modified      []string
+}
+
+// Empty returns whether the archive and the directory hold the same files
+func (d ArchiveDiff) Empty() bool {
+	return len(d.OnlyInArchive) == 0 && len(d.OnlyInDir) == 0 && len(d.Modified) == 0
+}
+
+// CompareTgzWithDir checks to see if the file contents of the archive found at tgzPath, below its root directory, match the files of the directory at dirPath
+// Like CompareTgzs, it compares the sha1sum of the file contents, ignoring any other information (e.g. file modes, timestamps, etc.)
+func CompareTgzWithDir(ctx context.Context, fs billy.Filesystem, tgzPath, dirPath string) (ArchiveDiff, error) {
+	var diff ArchiveDiff
+	tgz, err := fs.Open(tgzPath)
+	if err != nil {
+		return diff, err
+	}
+	defer tgz.Close()
+	gzipReader, err := gzip.NewReader(tgz)
+	if err != nil {
+		return diff, fmt.Errorf("unable to read gzip formatted file: %s", err)
+	}
+	defer gzipReader.Close()
+
+	archiveHashes := make(map[string]string)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		h, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return diff, fmt.Errorf("ran into error while trying to read files in %s: %v", tgzPath, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		rootPath, err := GetRootPath(ctx, h.Name)
+		if err != nil {
+			return diff, err
+		}
+		hash := sha1.New()
+		if _, err := io.Copy(hash, tarReader); err != nil {
+			return diff, fmt.Errorf("could not compute hash of %s: %v", h.Name, err)
+		}
+		archiveHashes[strings.TrimPrefix(h.Name, rootPath+"/")] = string(hash.Sum(nil))
+	}
+
+	err = WalkDir(ctx, fs, dirPath, func(ctx context.Context, fs billy.Filesystem, path string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		relativePath, err := MovePath(ctx, path, dirPath, "")
+		if err != nil {
+			return err
+		}
+		archiveHash, ok := archiveHashes[relativePath]
+		if !ok {
+			diff.OnlyInDir = append(diff.OnlyInDir, relativePath)
+			return nil
+		}
+		delete(archiveHashes, relativePath)
+		f, err := fs.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hash := sha1.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return fmt.Errorf("could not compute hash of %s: %v", path, err)
+		}
+		if string(hash.Sum(nil)) != archiveHash {
+			diff.Modified = append(diff.Modified, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return diff, err
+	}
+	for relativePath := range archiveHashes {
+		diff.OnlyInArchive = append(diff.OnlyInArchive, relativePath)
+	}
+	sort.Strings(diff.OnlyInArchive)
+	sort.Strings(diff.OnlyInDir)
+	sort.Strings(diff.Modified)
+	return diff, nil
+}
+
 // ArchiveDir archives a directory or a file into a tgz file and put it at destTgzPath which should end with .tgz
 func ArchiveDir(ctx context.Context, fs billy.Filesystem, srcPath, destTgzPath string) error {
 	logger.Log(ctx, slog.LevelDebug, "archive directory inside .tgz", slog.String("srcPath", srcPath), slog.String("destTgzPath", destTgzPath))
@@ -596,6 +711,9 @@ type RelativePathPairFunc func(ctx context.Context, fs billy.Filesystem, leftPat
 // WalkDir walks through a directory given by dirPath rooted in the filesystem and performs doFunc at the path
 // The path on each call will be relative to the filesystem provided.
 func WalkDir(ctx context.Context, fs billy.Filesystem, dirPath string, doFunc RelativePathFunc) error {
+	if o, ok := fs.(*overlayFs); ok {
+		return o.walk(ctx, dirPath, doFunc)
+	}
 	// Create all necessary directories
 	return filepath.Walk(GetAbsPath(fs, dirPath), func(abspath string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -637,6 +755,14 @@ func CopyDir(ctx context.Context, fs billy.Filesystem, srcDir string, dstDir str
 			return fs.MkdirAll(dstPath, os.ModePerm)
 		}
 
+		if _, ok := fs.(*overlayFs); ok {
+			data, err := billyUtil.ReadFile(fs, srcPath)
+			if err != nil {
+				return err
+			}
+			return billyUtil.WriteFile(fs, dstPath, data, os.ModePerm)
+		}
+
 		data, err := os.ReadFile(GetAbsPath(fs, srcPath))
 		if err != nil {
 			return err
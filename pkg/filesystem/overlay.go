@@ -0,0 +1,557 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+)
+
+// overlayState holds the writes of a dry run. Paths are absolute so that every filesystem returned
+// by GetFilesystem during a dry run sees the writes made through the others.
+type overlayState struct {
+	mu sync.Mutex
+	// disk is the real filesystem, which is only ever read
+	disk billy.Filesystem
+	// mem holds the files and directories that were written, which hide the ones on disk
+	mem billy.Filesystem
+	// removed holds the paths that were removed from disk
+	removed map[string]bool
+	// touched holds the paths that were written or removed
+	touched map[string]bool
+}
+
+var (
+	dryRunOverlay     *overlayState
+	dryRunOverlayOnce sync.Once
+)
+
+func getDryRunOverlay() *overlayState {
+	dryRunOverlayOnce.Do(func() {
+		dryRunOverlay = &overlayState{
+			disk:    osfs.New("/"),
+			mem:     memfs.New(),
+			removed: make(map[string]bool),
+			touched: make(map[string]bool),
+		}
+	})
+	return dryRunOverlay
+}
+
+// overlayFs is a filesystem that reads from disk but keeps every write in memory
+type overlayFs struct {
+	state *overlayState
+	root  string
+}
+
+func newOverlayFs(root string) billy.Filesystem {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		absRoot = filepath.Clean(root)
+	}
+	return &overlayFs{state: getDryRunOverlay(), root: absRoot}
+}
+
+// overlayFile keeps the name a file was opened with
+type overlayFile struct {
+	billy.File
+	name string
+}
+
+func (f *overlayFile) Name() string {
+	return f.name
+}
+
+func (o *overlayFs) abs(path string) string {
+	return filepath.Join(o.root, path)
+}
+
+func (s *overlayState) inMem(abspath string) bool {
+	_, err := s.mem.Lstat(abspath)
+	return err == nil
+}
+
+// isRemoved returns whether the path or one of its parents was removed from disk
+func (s *overlayState) isRemoved(abspath string) bool {
+	for p := abspath; ; p = filepath.Dir(p) {
+		if s.removed[p] {
+			return true
+		}
+		if p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+func (s *overlayState) stat(abspath string, lstat bool) (os.FileInfo, error) {
+	if s.inMem(abspath) {
+		if lstat {
+			return s.mem.Lstat(abspath)
+		}
+		return s.mem.Stat(abspath)
+	}
+	if s.isRemoved(abspath) {
+		return nil, &os.PathError{Op: "stat", Path: abspath, Err: os.ErrNotExist}
+	}
+	if lstat {
+		return s.disk.Lstat(abspath)
+	}
+	return s.disk.Stat(abspath)
+}
+
+// copyUp copies a file from disk into memory so that it can be modified
+func (s *overlayState) copyUp(abspath string) error {
+	if s.inMem(abspath) || s.isRemoved(abspath) {
+		return nil
+	}
+	info, err := s.disk.Stat(abspath)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	data, err := billyUtil.ReadFile(s.disk, abspath)
+	if err != nil {
+		return err
+	}
+	return billyUtil.WriteFile(s.mem, abspath, data, info.Mode().Perm())
+}
+
+func (o *overlayFs) Create(filename string) (billy.File, error) {
+	return o.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *overlayFs) Open(filename string) (billy.File, error) {
+	return o.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (o *overlayFs) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	s := o.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	abspath := o.abs(filename)
+	var f billy.File
+	var err error
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		if s.inMem(abspath) {
+			f, err = s.mem.OpenFile(abspath, flag, perm)
+		} else if s.isRemoved(abspath) {
+			err = &os.PathError{Op: "open", Path: abspath, Err: os.ErrNotExist}
+		} else {
+			f, err = s.disk.OpenFile(abspath, flag, perm)
+		}
+	} else {
+		_, statErr := s.stat(abspath, false)
+		if statErr == nil && flag&os.O_EXCL != 0 {
+			return nil, &os.PathError{Op: "open", Path: abspath, Err: os.ErrExist}
+		}
+		if statErr != nil && flag&os.O_CREATE == 0 {
+			return nil, statErr
+		}
+		// files that exist on disk keep their contents and permissions, as they would with os.OpenFile
+		if err := s.copyUp(abspath); err != nil {
+			return nil, err
+		}
+		f, err = s.mem.OpenFile(abspath, flag&^os.O_EXCL|os.O_CREATE, perm)
+		s.touched[abspath] = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &overlayFile{File: f, name: filename}, nil
+}
+
+func (o *overlayFs) Stat(filename string) (os.FileInfo, error) {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+	return o.state.stat(o.abs(filename), false)
+}
+
+func (o *overlayFs) Lstat(filename string) (os.FileInfo, error) {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+	return o.state.stat(o.abs(filename), true)
+}
+
+func (o *overlayFs) Rename(oldpath, newpath string) error {
+	info, err := o.Lstat(oldpath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := o.MkdirAll(newpath, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := o.ReadDir(oldpath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := o.Rename(filepath.Join(oldpath, entry.Name()), filepath.Join(newpath, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return o.Remove(oldpath)
+	}
+	data, err := billyUtil.ReadFile(o, oldpath)
+	if err != nil {
+		return err
+	}
+	if err := billyUtil.WriteFile(o, newpath, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return o.Remove(oldpath)
+}
+
+func (o *overlayFs) Remove(filename string) error {
+	s := o.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	abspath := o.abs(filename)
+	info, err := s.stat(abspath, true)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := o.readDir(abspath)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("remove %s: directory not empty", abspath)
+		}
+	}
+	return s.remove(abspath)
+}
+
+// remove removes a path from memory and hides it on disk
+func (s *overlayState) remove(abspath string) error {
+	if s.inMem(abspath) {
+		if err := billyUtil.RemoveAll(s.mem, abspath); err != nil {
+			return err
+		}
+	}
+	if _, err := s.disk.Lstat(abspath); err == nil {
+		s.removed[abspath] = true
+	}
+	s.touched[abspath] = true
+	return nil
+}
+
+// RemoveAll removes a path and everything it contains, like os.RemoveAll
+func (o *overlayFs) RemoveAll(path string) error {
+	s := o.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	abspath := o.abs(path)
+	info, err := s.stat(abspath, true)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		// every file within the directory is part of the plan
+		var files []string
+		var collect func(dir string) error
+		collect = func(dir string) error {
+			entries, err := o.readDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				child := filepath.Join(dir, entry.Name())
+				if entry.IsDir() {
+					if err := collect(child); err != nil {
+						return err
+					}
+					continue
+				}
+				files = append(files, child)
+			}
+			return nil
+		}
+		if err := collect(abspath); err != nil {
+			return err
+		}
+		for _, file := range files {
+			s.touched[file] = true
+		}
+	}
+	return s.remove(abspath)
+}
+
+func (o *overlayFs) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+func (o *overlayFs) TempFile(dir, prefix string) (billy.File, error) {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+
+	f, err := o.state.mem.TempFile(o.abs(dir), prefix)
+	if err != nil {
+		return nil, err
+	}
+	o.state.touched[f.Name()] = true
+	name, err := filepath.Rel(o.root, f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &overlayFile{File: f, name: name}, nil
+}
+
+func (o *overlayFs) ReadDir(path string) ([]os.FileInfo, error) {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+	return o.readDir(o.abs(path))
+}
+
+// readDir lists the entries of a directory in memory and on disk, sorted by name. The state must be locked.
+func (o *overlayFs) readDir(abspath string) ([]os.FileInfo, error) {
+	s := o.state
+	info, err := s.stat(abspath, false)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("readdir %s: not a directory", abspath)
+	}
+	entries := make(map[string]os.FileInfo)
+	if !s.isRemoved(abspath) {
+		if diskEntries, err := s.disk.ReadDir(abspath); err == nil {
+			for _, entry := range diskEntries {
+				if !s.removed[filepath.Join(abspath, entry.Name())] {
+					entries[entry.Name()] = entry
+				}
+			}
+		}
+	}
+	if s.inMem(abspath) {
+		memEntries, err := s.mem.ReadDir(abspath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range memEntries {
+			entries[entry.Name()] = entry
+		}
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		infos = append(infos, entry)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+func (o *overlayFs) MkdirAll(filename string, perm os.FileMode) error {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+
+	abspath := o.abs(filename)
+	if info, err := o.state.stat(abspath, false); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("mkdir %s: not a directory", abspath)
+		}
+		if !o.state.inMem(abspath) {
+			return nil
+		}
+	}
+	return o.state.mem.MkdirAll(abspath, perm)
+}
+
+func (o *overlayFs) Symlink(target, link string) error {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+
+	abspath := o.abs(link)
+	if _, err := o.state.stat(abspath, true); err == nil {
+		return os.ErrExist
+	}
+	o.state.touched[abspath] = true
+	return o.state.mem.Symlink(target, abspath)
+}
+
+func (o *overlayFs) Readlink(link string) (string, error) {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+
+	abspath := o.abs(link)
+	if o.state.inMem(abspath) {
+		return o.state.mem.Readlink(abspath)
+	}
+	if o.state.isRemoved(abspath) {
+		return "", &os.PathError{Op: "readlink", Path: abspath, Err: os.ErrNotExist}
+	}
+	return o.state.disk.Readlink(abspath)
+}
+
+// Chmod changes the permissions of a file in memory
+func (o *overlayFs) Chmod(name string, mode os.FileMode) error {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+
+	abspath := o.abs(name)
+	if _, err := o.state.stat(abspath, false); err != nil {
+		return err
+	}
+	if err := o.state.copyUp(abspath); err != nil {
+		return err
+	}
+	if !o.state.inMem(abspath) {
+		// directories are only created in memory when something is written within them
+		return nil
+	}
+	o.state.touched[abspath] = true
+	return o.state.mem.(interface {
+		Chmod(name string, mode os.FileMode) error
+	}).Chmod(abspath, mode)
+}
+
+func (o *overlayFs) Chroot(path string) (billy.Filesystem, error) {
+	return &overlayFs{state: o.state, root: o.abs(path)}, nil
+}
+
+func (o *overlayFs) Root() string {
+	return o.root
+}
+
+// walk walks the directory like filepath.Walk, listing the entries in memory and on disk
+func (o *overlayFs) walk(ctx context.Context, dirPath string, doFunc RelativePathFunc) error {
+	info, err := o.Lstat(dirPath)
+	if err != nil {
+		// Path does not exist anymore, so do not walk it
+		return nil
+	}
+	if err := doFunc(ctx, o, dirPath, info.IsDir()); err != nil {
+		if !util.IsSoftErrorOn() {
+			return err
+		}
+		logger.Log(ctx, slog.LevelError, "error walkFunc", logger.Err(err))
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	entries, err := o.ReadDir(dirPath)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if err := o.walk(ctx, filepath.Join(dirPath, entry.Name()), doFunc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DryRunChanges returns the files that the dry run would have created, modified or removed,
+// relative to the current working directory when they are within it
+func DryRunChanges() ([]dryrun.Change, error) {
+	if dryRunOverlay == nil {
+		return nil, nil
+	}
+	s := dryRunOverlay
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var changes []dryrun.Change
+	for abspath := range s.touched {
+		var onDisk, inOverlay os.FileInfo
+		if info, err := s.disk.Lstat(abspath); err == nil {
+			onDisk = info
+		}
+		if info, err := s.stat(abspath, true); err == nil {
+			inOverlay = info
+		}
+
+		var action dryrun.Action
+		switch {
+		case onDisk == nil && inOverlay == nil:
+			continue
+		case onDisk == nil:
+			if inOverlay.IsDir() {
+				continue
+			}
+			action = dryrun.ActionCreate
+		case inOverlay == nil:
+			if onDisk.IsDir() {
+				continue
+			}
+			action = dryrun.ActionRemove
+		default:
+			if onDisk.IsDir() || inOverlay.IsDir() || !s.inMem(abspath) {
+				continue
+			}
+			changed, err := s.changed(abspath, onDisk, inOverlay)
+			if err != nil {
+				return nil, err
+			}
+			if !changed {
+				continue
+			}
+			action = dryrun.ActionModify
+		}
+
+		target := abspath
+		if rel, err := filepath.Rel(cwd, abspath); err == nil && !strings.HasPrefix(rel, "..") {
+			target = rel
+		}
+		changes = append(changes, dryrun.Change{Action: action, Target: target})
+	}
+	return changes, nil
+}
+
+// changed returns whether a file in memory differs from the file on disk it hides
+func (s *overlayState) changed(abspath string, onDisk, inOverlay os.FileInfo) (bool, error) {
+	if onDisk.Mode() != inOverlay.Mode() {
+		return true, nil
+	}
+	if onDisk.Mode()&os.ModeSymlink != 0 {
+		diskTarget, err := s.disk.Readlink(abspath)
+		if err != nil {
+			return false, err
+		}
+		memTarget, err := s.mem.Readlink(abspath)
+		if err != nil {
+			return false, err
+		}
+		return diskTarget != memTarget, nil
+	}
+	diskData, err := billyUtil.ReadFile(s.disk, abspath)
+	if err != nil {
+		return false, err
+	}
+	memFile, err := s.mem.Open(abspath)
+	if err != nil {
+		return false, err
+	}
+	defer memFile.Close()
+	memData, err := io.ReadAll(memFile)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return !bytes.Equal(diskData, memData), nil
+}
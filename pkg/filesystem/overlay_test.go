@@ -0,0 +1,77 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_overlayFs(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	root := t.TempDir()
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	write("charts/test/Chart.yaml", "name: test\n")
+	write("charts/test/values.yaml", "replicas: 1\n")
+	write("release.yaml", "test: []\n")
+	write("index.yaml", "entries: {}\n")
+
+	fs := newOverlayFs(root)
+	require.NoError(t, billyUtil.WriteFile(fs, "release.yaml", []byte("test:\n- 1.0.0\n"), 0644))
+	require.NoError(t, billyUtil.WriteFile(fs, "index.yaml", []byte("entries: {}\n"), 0644))
+	require.NoError(t, fs.MkdirAll("assets/test", os.ModePerm))
+	require.NoError(t, billyUtil.WriteFile(fs, "assets/test/test-1.0.0.tgz", []byte("chart"), 0644))
+	require.NoError(t, RemoveAll(fs, "charts"))
+
+	// the overlay sees its own changes
+	data, err := billyUtil.ReadFile(fs, "release.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "test:\n- 1.0.0\n", string(data))
+	exists, err := PathExists(ctx, fs, "charts/test/Chart.yaml")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	var walked []string
+	require.NoError(t, WalkDir(ctx, fs, ".", func(_ context.Context, _ billy.Filesystem, path string, isDir bool) error {
+		if !isDir {
+			walked = append(walked, path)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"assets/test/test-1.0.0.tgz", "index.yaml", "release.yaml"}, walked)
+
+	// the disk is untouched
+	data, err = os.ReadFile(filepath.Join(root, "release.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "test: []\n", string(data))
+	assert.FileExists(t, filepath.Join(root, "charts/test/Chart.yaml"))
+	assert.NoDirExists(t, filepath.Join(root, "assets"))
+
+	changes, err := DryRunChanges()
+	require.NoError(t, err)
+	var got []dryrun.Change
+	for _, change := range changes {
+		if strings.HasPrefix(change.Target, root) {
+			change.Target = strings.TrimPrefix(change.Target, root+string(filepath.Separator))
+			got = append(got, change)
+		}
+	}
+	// writing the same contents is not a change
+	assert.ElementsMatch(t, []dryrun.Change{
+		{Action: dryrun.ActionCreate, Target: "assets/test/test-1.0.0.tgz"},
+		{Action: dryrun.ActionRemove, Target: "charts/test/Chart.yaml"},
+		{Action: dryrun.ActionRemove, Target: "charts/test/values.yaml"},
+		{Action: dryrun.ActionModify, Target: "release.yaml"},
+	}, got)
+}
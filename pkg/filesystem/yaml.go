@@ -6,8 +6,10 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/go-git/go-billy/v5"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	yamlV2 "gopkg.in/yaml.v2"
 	yamlV3 "gopkg.in/yaml.v3"
@@ -20,9 +22,9 @@ type StreamReader func() (io.ReadCloser, error)
 // efficiently (especially for large files) using a streaming approach
 // into a struct of type YamlFields, specified by the caller.
 // YamlFields is expected to be a struct suitable for YAML unmarshalling.
-//   - filepath: entire file path to the .yaml file
+//   - filePath: entire file path to the .yaml file
 //   - ignoreFormat: ignore legacy yaml format errors
-func LoadYamlFile[YamlFields any](ctx context.Context, filepath string, ignoreFormat bool) (*YamlFields, error) {
+func LoadYamlFile[YamlFields any](ctx context.Context, filePath string, ignoreFormat bool) (*YamlFields, error) {
 	/*
 		See the example of a valid YamlFields struct for regsync.yaml
 
@@ -34,11 +36,11 @@ func LoadYamlFile[YamlFields any](ctx context.Context, filepath string, ignoreFo
 	*/
 
 	reader := func() (io.ReadCloser, error) {
-		return os.Open(filepath)
+		return GetFilesystem(filepath.Dir(filePath)).Open(filepath.Base(filePath))
 	}
 	var yamlFields *YamlFields
 
-	logger.Log(ctx, slog.LevelDebug, "decoding", slog.String("filepath", filepath))
+	logger.Log(ctx, slog.LevelDebug, "decoding", slog.String("filepath", filePath))
 
 	if err := safeDecodeYaml(ctx, reader, &yamlFields, ignoreFormat); err != nil {
 		return nil, err
@@ -132,7 +134,7 @@ func decodeErrorsToIgnore(err error) (ignore bool) {
 //   - filePath: The full path to the yaml file.
 //   - truncate: If true, the file is created or truncated.
 //     If false, it's opened for read/write, or created if it doesn't exist.
-func CreateAndOpenYamlFile(ctx context.Context, filePath string, truncate bool) (*os.File, error) {
+func CreateAndOpenYamlFile(ctx context.Context, filePath string, truncate bool) (billy.File, error) {
 	flags := os.O_RDWR | os.O_CREATE
 
 	if truncate {
@@ -142,7 +144,7 @@ func CreateAndOpenYamlFile(ctx context.Context, filePath string, truncate bool)
 
 	const permissions = 0644
 
-	file, err := os.OpenFile(filePath, flags, permissions)
+	file, err := GetFilesystem(filepath.Dir(filePath)).OpenFile(filepath.Base(filePath), flags, permissions)
 	if err != nil {
 		logger.Log(ctx, slog.LevelError, "", slog.Group("open failure", filePath, flags, logger.Err(err)))
 		return nil, err
@@ -152,7 +154,7 @@ func CreateAndOpenYamlFile(ctx context.Context, filePath string, truncate bool)
 }
 
 // UpdateYamlFile receives a map and updates a yaml file
-func UpdateYamlFile(file *os.File, imageTagMap map[string][]string) error {
+func UpdateYamlFile(file io.Writer, imageTagMap map[string][]string) error {
 	encoder := yamlV3.NewEncoder(file)
 	encoder.SetIndent(2)
 	defer encoder.Close()
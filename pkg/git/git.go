@@ -8,9 +8,14 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 )
@@ -203,14 +208,19 @@ func (g *Git) FetchAndCheckoutBranch(ctx context.Context, branch string) error {
 	return g.CheckoutBranch(branch)
 }
 
-// FetchBranch fetches a branch
+// FetchBranch fetches a branch and updates the local branch.
+// During a dry run, only the remote-tracking branch is updated.
 func (g *Git) FetchBranch(branch string) error {
 	upstreamRemote, err := g.getUpstreamRemote()
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command("git", "-C", g.Dir, "fetch", upstreamRemote, branch+":"+branch)
+	refspec := branch + ":" + branch
+	if dryrun.Enabled() {
+		refspec = branch
+	}
+	cmd := exec.Command("git", "-C", g.Dir, "fetch", upstreamRemote, refspec)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -232,6 +242,10 @@ func (g *Git) CheckoutFile(branch, file string) error {
 		return err
 	}
 
+	if dryrun.Enabled() {
+		return g.checkoutFileDryRun(branch, file)
+	}
+
 	targetBranch := upstreamRemote + "/" + branch
 	cmd := exec.Command("git", "-C", g.Dir, "checkout", targetBranch, "--", file)
 	cmd.Stdout = os.Stdout
@@ -239,9 +253,26 @@ func (g *Git) CheckoutFile(branch, file string) error {
 	return cmd.Run()
 }
 
+// checkoutFileDryRun writes the file from the upstream remote branch to the dry-run overlay instead of the working tree
+func (g *Git) checkoutFileDryRun(branch, file string) error {
+	content, err := g.ShowFileFromRemoteBranch(context.Background(), branch, file)
+	if err != nil {
+		return err
+	}
+	fs := filesystem.GetFilesystem(g.Dir)
+	if err := fs.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	return billyUtil.WriteFile(fs, file, content, 0644)
+}
+
 // CreateAndCheckoutBranch creates and checks out to a given branch.
 // Equivalent to: git checkout -b <branch>
 func (g *Git) CreateAndCheckoutBranch(branch string) error {
+	if dryrun.Enabled() {
+		// the commits that would be made on the branch are recorded, see AddAndCommit
+		return nil
+	}
 	cmd := exec.Command("git", "-C", g.Dir, "checkout", "-b", branch)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -286,8 +317,23 @@ func (g *Git) StatusProcelain(ctx context.Context) (bool, error) {
 // AddAndCommit stages all changes and commits them with a given message,
 // equivalent to: git add -A && git commit -m message
 func (g *Git) AddAndCommit(message string) error {
+	return g.AddAndCommitPaths(message)
+}
+
+// AddAndCommitPaths stages the changes under the given paths, or all changes if none is given, and commits them with a given message,
+// equivalent to: git add -A -- paths && git commit -m message
+func (g *Git) AddAndCommitPaths(message string, paths ...string) error {
+	if dryrun.Enabled() {
+		dryrun.Record(context.Background(), dryrun.ActionCommit, message, g.Dir)
+		return nil
+	}
+
 	// Stage all changes, including deletions
-	cmd := exec.Command("git", "-C", g.Dir, "add", "-A")
+	args := []string{"-C", g.Dir, "add", "-A"}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+	cmd := exec.Command("git", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -295,7 +341,7 @@ func (g *Git) AddAndCommit(message string) error {
 	}
 
 	// Commit the staged changes
-	cmd2 := exec.Command("git", "commit", "-m", message)
+	cmd2 := exec.Command("git", "-C", g.Dir, "commit", "-m", message)
 	cmd2.Stdout = os.Stdout
 	cmd2.Stderr = os.Stderr
 	return cmd2.Run()
@@ -303,6 +349,11 @@ func (g *Git) AddAndCommit(message string) error {
 
 // PushBranch pushes the current branch to a given remote name
 func (g *Git) PushBranch(remote, branch string) error {
+	if dryrun.Enabled() {
+		dryrun.Record(context.Background(), dryrun.ActionPush, remote+"/"+branch, g.Dir)
+		return nil
+	}
+
 	cmd := exec.Command("git", "-C", g.Dir, "push", remote, branch)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -354,6 +405,10 @@ func (g *Git) Restore() error {
 // ResetHEAD resets the HEAD of the git repository
 // ex: git reset HEAD
 func (g *Git) ResetHEAD() error {
+	if dryrun.Enabled() {
+		// nothing was staged, see CheckoutFile
+		return nil
+	}
 	return exec.Command("git", "-C", g.Dir, "reset", "HEAD").Run()
 }
 
@@ -394,6 +449,106 @@ func (g *Git) Status(ctx context.Context) error {
 	return cmd.Run()
 }
 
+// AddWorktree checks out the current HEAD in a new detached worktree at dir
+// Equivalent to: git worktree add --detach <dir> HEAD
+func (g *Git) AddWorktree(ctx context.Context, dir string) error {
+	logger.Log(ctx, slog.LevelDebug, "adding worktree", slog.String("dir", dir))
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "worktree", "add", "--detach", dir, "HEAD").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to add worktree %s: %w (output: %s)", dir, err, string(output))
+	}
+	return nil
+}
+
+// RemoveWorktree removes a worktree and everything it contains
+// Equivalent to: git worktree remove --force <dir>
+func (g *Git) RemoveWorktree(ctx context.Context, dir string) error {
+	logger.Log(ctx, slog.LevelDebug, "removing worktree", slog.String("dir", dir))
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "worktree", "remove", "--force", dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to remove worktree %s: %w (output: %s)", dir, err, string(output))
+	}
+	return nil
+}
+
+// HeadCommit returns the hash of the current HEAD
+// Equivalent to: git rev-parse HEAD
+func (g *Git) HeadCommit(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CommitSubjects returns the subjects of the commits made since the given commit, oldest first
+// Equivalent to: git log --reverse --format=%s <since>..HEAD
+func (g *Git) CommitSubjects(ctx context.Context, since string) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "log", "--reverse", "--format=%s", since+"..HEAD").Output()
+	if err != nil {
+		return nil, err
+	}
+	return nonEmptyLines(output), nil
+}
+
+// ChangedFiles returns the files of the working tree that differ from the given commit, including untracked files,
+// and the files of the commit that were removed from the working tree
+// Equivalent to: git diff --name-status --no-renames <since> && git ls-files --others --exclude-standard
+func (g *Git) ChangedFiles(ctx context.Context, since string) (changed, removed []string, err error) {
+	diff, err := g.DiffNameStatus(ctx, since)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range diff {
+		if file.Status == "D" {
+			removed = append(removed, file.Path)
+		} else {
+			changed = append(changed, file.Path)
+		}
+	}
+
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "ls-files", "--others", "--exclude-standard").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+	changed = append(changed, nonEmptyLines(output)...)
+	return changed, removed, nil
+}
+
+// FileStatus is a file listed by DiffNameStatus with its status letter: A (added), D (deleted), M (modified), etc.
+type FileStatus struct {
+	Status string
+	Path   string
+}
+
+// DiffNameStatus returns the files that differ between the given revisions, e.g. a commit or base...HEAD
+// Equivalent to: git diff --name-status --no-renames <revisions>
+func (g *Git) DiffNameStatus(ctx context.Context, revisions string) ([]FileStatus, error) {
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "diff", "--name-status", "--no-renames", revisions).Output()
+	if err != nil {
+		return nil, err
+	}
+	var files []FileStatus
+	for _, line := range nonEmptyLines(output) {
+		status, file, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected output of git diff: %s", line)
+		}
+		files = append(files, FileStatus{Status: status, Path: file})
+	}
+	return files, nil
+}
+
+func nonEmptyLines(output []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
 // ShowFileFromRemoteBranch fetches file content from upstream remote branch
 // Equivalent to: git show <upstream>/<branch>:<filePath>
 func (g *Git) ShowFileFromRemoteBranch(ctx context.Context, branch, filePath string) ([]byte, error) {
@@ -420,6 +575,60 @@ func (g *Git) ShowFileFromRemoteBranch(ctx context.Context, branch, filePath str
 	return output, nil
 }
 
+// ShowFile returns the content of a file at a revision, or an error wrapping os.ErrNotExist if the revision does not have it
+// Equivalent to: git show <revision>:<filePath>
+func (g *Git) ShowFile(ctx context.Context, revision, filePath string) ([]byte, error) {
+	target := revision + ":" + filePath
+	if err := exec.CommandContext(ctx, "git", "-C", g.Dir, "cat-file", "-e", target).Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w", target, os.ErrNotExist)
+	}
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "show", target).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to show file %s: %w", target, err)
+	}
+	return output, nil
+}
+
+// CommitTime returns the committer date of a revision
+// Equivalent to: git log -1 --format=%cI <revision>
+func (g *Git) CommitTime(ctx context.Context, revision string) (time.Time, error) {
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "log", "-1", "--format=%cI", revision, "--").CombinedOutput()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown revision %s: %w (output: %s)", revision, err, string(output))
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(output)))
+}
+
+// FetchRemoteBranch updates the remote-tracking branch of the upstream remote without touching the local branches
+// Equivalent to: git fetch <upstream> <branch>
+func (g *Git) FetchRemoteBranch(ctx context.Context, branch string) error {
+	upstreamRemote, err := g.getUpstreamRemote()
+	if err != nil {
+		return err
+	}
+	logger.Log(ctx, slog.LevelInfo, "fetching branch", slog.String("remote", upstreamRemote), slog.String("branch", branch))
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "fetch", upstreamRemote, branch).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s/%s: %w (output: %s)", upstreamRemote, branch, err, string(output))
+	}
+	return nil
+}
+
+// RemoteBranchCommitAt returns the commit the upstream remote branch pointed to at the given time,
+// or an empty string if the branch had no commit yet
+// Equivalent to: git rev-list -1 --first-parent --before=<at> <upstream>/<branch>
+func (g *Git) RemoteBranchCommitAt(ctx context.Context, branch string, at time.Time) (string, error) {
+	upstreamRemote, err := g.getUpstreamRemote()
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.CommandContext(ctx, "git", "-C", g.Dir, "rev-list", "-1", "--first-parent", "--before="+at.Format(time.RFC3339), upstreamRemote+"/"+branch, "--").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to list the commits of %s/%s: %w (output: %s)", upstreamRemote, branch, err, string(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
 // SparseCloneSubdirectory performs a sparse Git clone of only a specific subdirectory
 // using Git CLI commands. This is significantly more efficient than cloning the entire
 // repository when only a small subdirectory is needed.
@@ -436,11 +645,14 @@ func (g *Git) ShowFileFromRemoteBranch(ctx context.Context, branch, filePath str
 //   - subdirectory: Path to subdirectory within the repo (e.g., "charts/rancher-monitoring/...")
 //   - fs: Billy filesystem for path operations
 //   - path: Destination path where the repository should be cloned
+//   - creds: Credentials for the host of the URL, passed to git through the environment
+//     so that they never show up in the command line or logs
 //
 // Returns an error if the operation fails.
-func SparseCloneSubdirectory(ctx context.Context, url, commit, subdirectory string, fs billy.Filesystem, path string) error {
+func SparseCloneSubdirectory(ctx context.Context, url, commit, subdirectory string, fs billy.Filesystem, path string, creds credentials.Credentials) error {
 	logger.Log(ctx, slog.LevelDebug, "sparse cloning",
-		slog.String("url", url),
+		slog.String("url", credentials.RedactURL(url)),
+		slog.Any("credentials", creds),
 		slog.String("commit", commit),
 		slog.String("subdirectory", subdirectory))
 
@@ -456,6 +668,7 @@ func SparseCloneSubdirectory(ctx context.Context, url, commit, subdirectory stri
 		absPath,
 	)
 
+	cloneCmd.Env = append(os.Environ(), creds.GitConfigEnv()...)
 	if output, err := cloneCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("sparse clone failed: %w, output: %s", err, string(output))
 	}
@@ -467,6 +680,7 @@ func SparseCloneSubdirectory(ctx context.Context, url, commit, subdirectory stri
 		subdirectory,
 	)
 
+	sparseCmd.Env = append(os.Environ(), creds.GitConfigEnv()...)
 	if output, err := sparseCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("sparse-checkout set failed: %w, output: %s", err, string(output))
 	}
@@ -477,6 +691,7 @@ func SparseCloneSubdirectory(ctx context.Context, url, commit, subdirectory stri
 		"checkout", commit,
 	)
 
+	checkoutCmd.Env = append(os.Environ(), creds.GitConfigEnv()...)
 	if output, err := checkoutCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("checkout commit failed: %w, output: %s", err, string(output))
 	}
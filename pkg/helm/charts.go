@@ -4,23 +4,26 @@ import (
 	"errors"
 
 	"github.com/go-git/go-billy/v5"
-	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	billyUtil "github.com/go-git/go-billy/v5/util"
 	"github.com/rancher/charts-build-scripts/pkg/path"
 	helmChart "helm.sh/helm/v3/pkg/chart"
-	helmChartUtil "helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
 )
 
 // LoadChartYaml will load a given chart.yaml file for the target chart and version
 func LoadChartYaml(rootFs billy.Filesystem, chart, version string) (*helmChart.Metadata, error) {
 	// Get Chart.yaml path and load it
 	chartYamlPath := path.RepositoryChartsDir + "/" + chart + "/" + version + "/Chart.yaml"
-	absChartPath := filesystem.GetAbsPath(rootFs, chartYamlPath)
 
-	// Load Chart.yaml file
-	chartMetadata, err := helmChartUtil.LoadChartfile(absChartPath)
+	// Load Chart.yaml file from the filesystem, that is the dry-run overlay if enabled
+	data, err := billyUtil.ReadFile(rootFs, chartYamlPath)
 	if err != nil {
 		return nil, errors.New("could not load: " + chartYamlPath + " err: " + err.Error())
 	}
+	chartMetadata := new(helmChart.Metadata)
+	if err := yaml.Unmarshal(data, chartMetadata); err != nil {
+		return nil, errors.New("could not load: " + chartYamlPath + " err: " + err.Error())
+	}
 
 	return chartMetadata, nil
 }
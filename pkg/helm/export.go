@@ -8,13 +8,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/blang/semver"
 	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
 	helmAction "helm.sh/helm/v3/pkg/action"
 	helmChart "helm.sh/helm/v3/pkg/chart"
 	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
@@ -30,30 +31,27 @@ var (
 	maxPatchNum        = patchNumMultiplier - 1
 )
 
-// archiveGenerationMutex protects concurrent archive generation operations
-// This ensures that only one goroutine can generate Helm chart archives at a time,
-// preventing race conditions on temporary directory creation and file comparison
-var archiveGenerationMutex sync.Mutex
-
 // ExportHelmChart creates a Helm chart archive and an unarchived Helm chart at RepositoryAssetDirpath and RepositoryChartDirPath
-// helmChartPath is a relative path (rooted at the package level) that contains the chart.
-func ExportHelmChart(ctx context.Context, rootFs, fs billy.Filesystem, helmChartPath string, packageVersion *int, version *semver.Version, autoGenBumpVersion *semver.Version, upstreamChartVersion string, omitBuildMetadata bool) error {
+// helmChartPath is a relative path (rooted at the package level) that contains the chart. It returns the path of the archive within rootFs.
+func ExportHelmChart(ctx context.Context, rootFs, fs billy.Filesystem, helmChartPath string, packageVersion *int, version *semver.Version, autoGenBumpVersion *semver.Version, upstreamChartVersion string, omitBuildMetadata bool) (string, error) {
 
 	if err := removeOrigFiles(ctx, filesystem.GetAbsPath(fs, helmChartPath)); err != nil {
-		return fmt.Errorf("failed to remove .orig files: %s", err)
+		return "", fmt.Errorf("failed to remove .orig files: %s", err)
 	}
 
 	chart, err := loadHelmChart(fs, helmChartPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Parse the chart version (if autoGenBumpVersion is not nil, it will be used as the version)
 	chartVersion, err := parseChartVersion(packageVersion, version, upstreamChartVersion, chart.Metadata.Version, autoGenBumpVersion, omitBuildMetadata)
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	ctx = logger.WithChart(ctx, chart.Metadata.Name, chartVersion)
+
 	// Assets are indexed by chart name, independent of which package that chart is contained within
 	chartAssetsDirpath := filepath.Join(path.RepositoryAssetsDir, chart.Metadata.Name)
 	// All generated charts are indexed by chart name and version
@@ -61,26 +59,26 @@ func ExportHelmChart(ctx context.Context, rootFs, fs billy.Filesystem, helmChart
 
 	// Create directories structure
 	if err := handleDirStructure(rootFs, chartAssetsDirpath, chartChartsDirpath); err != nil {
-		return err
+		return "", err
 	}
 	defer filesystem.PruneEmptyDirsInPath(ctx, rootFs, chartAssetsDirpath)
 	defer filesystem.PruneEmptyDirsInPath(ctx, rootFs, chartChartsDirpath)
 
-	// Acquire mutex to serialize archive generation and prevent race conditions
-	archiveGenerationMutex.Lock()
+	// Archives of the same chart share a temporary directory and are compared against the same assets
+	unlock := scheduler.Lock(chartAssetsDirpath)
 	tgzPath, err := GenerateArchive(ctx, rootFs, fs, helmChartPath, chartAssetsDirpath, &chartVersion)
-	archiveGenerationMutex.Unlock()
+	unlock()
 
 	if err != nil {
-		return err
+		return "", err
 	}
 	// Unarchive the generated package
 	if err := filesystem.UnarchiveTgz(ctx, rootFs, tgzPath, "", chartChartsDirpath, true); err != nil {
-		return err
+		return "", err
 	}
 
 	logger.Log(ctx, slog.LevelInfo, "exported chart", slog.String("chartChartsDirPath", chartChartsDirpath), slog.String("tgzPath", tgzPath))
-	return nil
+	return tgzPath, nil
 }
 
 // removeOrigFiles removes all files ending with .orig in the specified directory
@@ -170,6 +168,7 @@ func handleDirStructure(rootFs billy.Filesystem, chartAssetsDirpath, chartCharts
 
 // GenerateArchive produces a Helm chart archive. If an archive exists at that path already, it does a deep check of the internal
 // contents of the archive and only updates the archive if something within it has been changed.
+// If signing is set up, see SetupSigning, the archive is signed with a provenance file next to it.
 func GenerateArchive(ctx context.Context, rootFs, fs billy.Filesystem, helmChartPath, chartAssetsDirpath string, chartVersion *string) (string, error) {
 	absHelmChartPath := filesystem.GetAbsPath(fs, helmChartPath)
 	// Run helm package
@@ -177,18 +176,32 @@ func GenerateArchive(ctx context.Context, rootFs, fs billy.Filesystem, helmChart
 	if chartVersion != nil {
 		pkg.Version = *chartVersion
 	}
-	// Create a temporary asset at assets/{chart}.temp/{chart}-{version}.tgz
-	pkg.Destination = filesystem.GetAbsPath(rootFs, chartAssetsDirpath) + ".temp"
+	// helm writes the package to disk, so it is written outside of the repository and copied through rootFs,
+	// which keeps it in memory during a dry run
+	stagingDir, err := os.MkdirTemp("", "helm-package")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stagingDir)
+	pkg.Destination = stagingDir
 	pkg.DependencyUpdate = false
 	absTgzPath, err := pkg.Run(absHelmChartPath, nil)
 	if err != nil {
 		return "", err
 	}
-	tempTgzPath, err := filesystem.GetRelativePath(rootFs, absTgzPath)
+	data, err := os.ReadFile(absTgzPath)
 	if err != nil {
 		return "", err
 	}
+	// Create a temporary asset at assets/{chart}.temp/{chart}-{version}.tgz
+	tempTgzPath := filepath.Join(chartAssetsDirpath+".temp", filepath.Base(absTgzPath))
+	if err := rootFs.MkdirAll(filepath.Dir(tempTgzPath), os.ModePerm); err != nil {
+		return "", err
+	}
 	defer filesystem.RemoveAll(rootFs, filepath.Dir(tempTgzPath))
+	if err := billyUtil.WriteFile(rootFs, tempTgzPath, data, 0644); err != nil {
+		return "", err
+	}
 	// Path where we expect the tgz file to be deposited
 	tgzPath := filepath.Join(chartAssetsDirpath, filepath.Base(tempTgzPath))
 	// Check if original tgz existed
@@ -213,5 +226,8 @@ func GenerateArchive(ctx context.Context, rootFs, fs billy.Filesystem, helmChart
 	} else {
 		logger.Log(ctx, slog.LevelInfo, "archive is up-to-date", slog.String("tgzPath", tgzPath))
 	}
+	if err := updateProvenance(ctx, rootFs, tgzPath, shouldUpdateArchive); err != nil {
+		return "", err
+	}
 	return tgzPath, nil
 }
@@ -0,0 +1,38 @@
+package helm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GenerateArchive_dryRun(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	t.Cleanup(dryrun.Suspend())
+	dryrun.Enable()
+
+	rootDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "packages", "demo", "charts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "packages", "demo", "charts", "Chart.yaml"), []byte("apiVersion: v2\nname: demo\nversion: 0.1.0\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "assets", "demo"), 0755))
+	rootFs := filesystem.GetFilesystem(rootDir)
+	fs := filesystem.GetFilesystem(filepath.Join(rootDir, "packages", "demo"))
+
+	tgzPath, err := GenerateArchive(ctx, rootFs, fs, "charts", "assets/demo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "assets/demo/demo-0.1.0.tgz", tgzPath)
+
+	exists, err := filesystem.PathExists(ctx, rootFs, tgzPath)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.NoFileExists(t, filepath.Join(rootDir, tgzPath))
+	assert.NoDirExists(t, filepath.Join(rootDir, "assets", "demo.temp"))
+}
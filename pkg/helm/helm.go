@@ -1,36 +1,34 @@
 package helm
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 
 	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
 	"github.com/rancher/charts-build-scripts/pkg/config"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
 	"github.com/rancher/charts-build-scripts/pkg/util"
+	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
 )
 
-// indexMutex protects concurrent access to index.yaml file operations
-// This ensures that only one goroutine can read/modify/write the index at a time
-var indexMutex sync.Mutex
-
 // CreateOrUpdateHelmIndex either creates or updates the index.yaml for the repository this package is within
 func CreateOrUpdateHelmIndex(ctx context.Context, rootFs billy.Filesystem) error {
-	// Acquire the lock to ensure exclusive access to index.yaml
-	indexMutex.Lock()
-	// Defer the unlock to ensure it happens even if we return early or encounter an error
-	defer indexMutex.Unlock()
-
-	absRepositoryAssetsDir := filesystem.GetAbsPath(rootFs, path.RepositoryAssetsDir)
-	absRepositoryHelmIndexFile := filesystem.GetAbsPath(rootFs, path.RepositoryHelmIndexFile)
+	// Only one task can read/modify/write the index at a time
+	defer scheduler.Lock(path.RepositoryHelmIndexFile)()
 
 	var helmIndexFile *helmRepo.IndexFile
 
@@ -41,7 +39,7 @@ func CreateOrUpdateHelmIndex(ctx context.Context, rootFs billy.Filesystem) error
 	}
 
 	if exists {
-		helmIndexFile, err = helmRepo.LoadIndexFile(absRepositoryHelmIndexFile)
+		helmIndexFile, err = loadIndexYaml(rootFs)
 		if err != nil {
 			return errors.New("encountered error while trying to load existing index file: " + err.Error())
 		}
@@ -50,7 +48,7 @@ func CreateOrUpdateHelmIndex(ctx context.Context, rootFs billy.Filesystem) error
 	}
 
 	// Generate the current index file from the assets/ directory
-	newHelmIndexFile, err := helmRepo.IndexDirectory(absRepositoryAssetsDir, path.RepositoryAssetsDir)
+	newHelmIndexFile, err := indexAssets(rootFs)
 	if err != nil {
 		return errors.New("encountered error while trying to generate new Helm index: " + err.Error())
 	}
@@ -78,7 +76,7 @@ func CreateOrUpdateHelmIndex(ctx context.Context, rootFs billy.Filesystem) error
 	// Trade-off: ~500ms overhead in concurrent validate runs for consistency
 
 	// Write new index to disk
-	err = mergedIndex.WriteFile(absRepositoryHelmIndexFile, os.ModePerm)
+	err = WriteIndexYaml(rootFs, mergedIndex)
 	if err != nil {
 		return errors.New("encountered error while trying to write updated Helm index into index.yaml: " + err.Error())
 	}
@@ -87,6 +85,89 @@ func CreateOrUpdateHelmIndex(ctx context.Context, rootFs billy.Filesystem) error
 	return nil
 }
 
+// indexAssets generates an index of the charts archived in the assets/ directory and its subdirectories,
+// like helmRepo.IndexDirectory does, reading them through the filesystem
+func indexAssets(rootFs billy.Filesystem) (*helmRepo.IndexFile, error) {
+	index := helmRepo.NewIndexFile()
+	archives, err := listAssets(rootFs)
+	if err != nil {
+		return index, err
+	}
+
+	for _, archive := range archives {
+		data, err := billyUtil.ReadFile(rootFs, archive)
+		if err != nil {
+			return index, err
+		}
+		chart, err := helmLoader.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			// Assume this is not a chart.
+			continue
+		}
+		digest, err := provenance.Digest(bytes.NewReader(data))
+		if err != nil {
+			return index, err
+		}
+		if err := index.MustAdd(chart.Metadata, filepath.Base(archive), filepath.Dir(archive), digest); err != nil {
+			return index, fmt.Errorf("failed adding to %s to index: %w", filepath.Base(archive), err)
+		}
+		// Reference the provenance file of signed archives, which Helm expects at the url of the archive followed by .prov
+		if _, err := rootFs.Stat(archive + ProvenanceExt); err == nil {
+			chartVersions := index.Entries[chart.Metadata.Name]
+			chartVersion := chartVersions[len(chartVersions)-1]
+			if chartVersion.Annotations == nil {
+				chartVersion.Annotations = make(map[string]string)
+			}
+			chartVersion.Annotations[ProvenanceAnnotation] = chartVersion.URLs[0] + ProvenanceExt
+		} else if !os.IsNotExist(err) {
+			return index, err
+		}
+	}
+	return index, nil
+}
+
+// listArchives returns the .tgz files within a directory, sorted by name
+func listArchives(fs billy.Filesystem, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var archives []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".tgz" {
+			archives = append(archives, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(archives)
+	return archives, nil
+}
+
+// listAssets returns the archives in the assets/ directory and its subdirectories
+func listAssets(rootFs billy.Filesystem) ([]string, error) {
+	archives, err := listArchives(rootFs, path.RepositoryAssetsDir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := rootFs.ReadDir(path.RepositoryAssetsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		moreArchives, err := listArchives(rootFs, filepath.Join(path.RepositoryAssetsDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, moreArchives...)
+	}
+	return archives, nil
+}
+
 // CheckVersionStandards validates that all chart versions follow the allowed prerelease standards
 // Only -alpha., -beta., and -rc. prerelease identifiers are allowed
 // Returns an error if any version contains an invalid prerelease identifier
@@ -219,8 +300,6 @@ func applyBlocklist(ctx context.Context, index *helmRepo.IndexFile) error {
 
 // OpenIndexYaml will check and open the index.yaml file in the local repository at the default file path
 func OpenIndexYaml(ctx context.Context, rootFs billy.Filesystem) (*helmRepo.IndexFile, error) {
-	helmIndexFilePath := filesystem.GetAbsPath(rootFs, path.RepositoryHelmIndexFile)
-
 	exists, err := filesystem.PathExists(ctx, rootFs, path.RepositoryHelmIndexFile)
 	if err != nil {
 		return nil, err
@@ -229,7 +308,44 @@ func OpenIndexYaml(ctx context.Context, rootFs billy.Filesystem) (*helmRepo.Inde
 		return nil, errors.New("index.yaml file does not exist in the local repository")
 	}
 
-	return helmRepo.LoadIndexFile(helmIndexFilePath)
+	return loadIndexYaml(rootFs)
+}
+
+// loadIndexYaml loads the index.yaml file in the local repository through the filesystem, so that the writes of a dry run are seen
+func loadIndexYaml(rootFs billy.Filesystem) (*helmRepo.IndexFile, error) {
+	data, err := billyUtil.ReadFile(rootFs, path.RepositoryHelmIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIndexYaml(data)
+}
+
+// ParseIndexYaml parses the contents of an index.yaml file like helmRepo.LoadIndexFile does
+func ParseIndexYaml(data []byte) (*helmRepo.IndexFile, error) {
+	tempIndex, err := os.CreateTemp("", "temp-index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempIndex.Name())
+	defer tempIndex.Close()
+
+	if _, err := tempIndex.Write(data); err != nil {
+		return nil, err
+	}
+	return helmRepo.LoadIndexFile(tempIndex.Name())
+}
+
+// WriteIndexYaml writes the index.yaml file in the local repository at the default file path,
+// with the same contents and permissions as helmRepo.IndexFile.WriteFile
+func WriteIndexYaml(rootFs billy.Filesystem, index *helmRepo.IndexFile) error {
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := billyUtil.WriteFile(rootFs, path.RepositoryHelmIndexFile, data, os.ModePerm); err != nil {
+		return err
+	}
+	return filesystem.UpdatePermissions(rootFs, path.RepositoryHelmIndexFile, int64(os.ModePerm))
 }
 
 // SortVersions sorts chart versions with custom RC handling
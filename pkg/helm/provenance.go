@@ -0,0 +1,267 @@
+package helm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+const (
+	// ProvenanceExt is appended to the path of an archive to get the path of its provenance file
+	ProvenanceExt = ".prov"
+	// ProvenanceAnnotation is set on the index.yaml entries whose archive has a provenance file, to the url of that file
+	ProvenanceAnnotation = "catalog.cattle.io/provenance"
+)
+
+// Problems reported by VerifyAssetsProvenance for an asset
+const (
+	// ProvenanceMissing is an asset without a provenance file
+	ProvenanceMissing = "missing"
+	// ProvenanceInvalid is an asset whose provenance file is not signed by a trusted key or does not match the archive
+	ProvenanceInvalid = "invalid"
+)
+
+// SigningOptions configures the PGP key that signs the archives generated by GenerateArchive
+type SigningOptions struct {
+	// Key is the name of the key within the keyring, e.g. its email
+	Key string
+	// Keyring is the path of the keyring holding the secret key
+	Keyring string
+	// PassphraseFile is the path of a file whose first line is the passphrase of the key, if it is encrypted
+	PassphraseFile string
+}
+
+// signer signs the generated archives; nil unless SetupSigning was called
+var signer *provenance.Signatory
+
+// SetupSigning makes GenerateArchive write a provenance file next to every archive, signed with the key of the options.
+// The key is decrypted once, so a missing key or a wrong passphrase fails before any chart is generated.
+func SetupSigning(opts SigningOptions) error {
+	if opts.Key == "" {
+		return errors.New("the name of the signing key must be provided")
+	}
+	s, err := provenance.NewFromKeyring(opts.Keyring, opts.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load keyring %s: %w", opts.Keyring, err)
+	}
+	if s.Entity == nil {
+		return fmt.Errorf("key %q not found in keyring %s", opts.Key, opts.Keyring)
+	}
+	if err := s.DecryptKey(passphraseFromFile(opts.PassphraseFile)); err != nil {
+		return fmt.Errorf("failed to decrypt key %q: %w", opts.Key, err)
+	}
+	signer = s
+	return nil
+}
+
+// passphraseFromFile returns a provenance.PassphraseFetcher that reads the first line of the file
+func passphraseFromFile(passphraseFile string) provenance.PassphraseFetcher {
+	return func(name string) ([]byte, error) {
+		if passphraseFile == "" {
+			return nil, fmt.Errorf("key %q is encrypted but no passphrase file was provided", name)
+		}
+		f, err := os.Open(passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		passphrase, _, err := bufio.NewReader(f).ReadLine()
+		return passphrase, err
+	}
+}
+
+// Keyring holds the public keys trusted to sign chart archives
+type Keyring struct {
+	signatory *provenance.Signatory
+}
+
+// LoadKeyring loads the keyring file at keyringPath
+func LoadKeyring(keyringPath string) (*Keyring, error) {
+	s, err := provenance.NewFromKeyring(keyringPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring %s: %w", keyringPath, err)
+	}
+	return &Keyring{signatory: s}, nil
+}
+
+// Verify checks that prov is a provenance file signed by a key of the keyring for the archive named archiveName.
+// It returns the identity of the key that signed it.
+func (k *Keyring) Verify(archiveName string, archive, prov []byte) (string, error) {
+	var signedBy string
+	err := withTempFiles(map[string][]byte{archiveName: archive, archiveName + ProvenanceExt: prov}, func(dir string) error {
+		archivePath := filepath.Join(dir, archiveName)
+		verification, err := k.signatory.Verify(archivePath, archivePath+ProvenanceExt)
+		if err != nil {
+			return err
+		}
+		for name := range verification.SignedBy.Identities {
+			signedBy = name
+			break
+		}
+		return nil
+	})
+	return signedBy, err
+}
+
+// sign returns the provenance file of the archive named archiveName, signed with the key set up by SetupSigning
+func sign(archiveName string, archive []byte) ([]byte, error) {
+	var prov string
+	err := withTempFiles(map[string][]byte{archiveName: archive}, func(dir string) error {
+		var err error
+		prov, err = signer.ClearSign(filepath.Join(dir, archiveName))
+		return err
+	})
+	return []byte(prov), err
+}
+
+// withTempFiles writes the files in a temporary directory, since the provenance package only works with paths
+// and archives are read through the filesystem of the repository (e.g. during a dry run)
+func withTempFiles(files map[string][]byte, do func(dir string) error) error {
+	dir, err := os.MkdirTemp("", "provenance")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return do(dir)
+}
+
+// updateProvenance keeps the provenance file of the archive at tgzPath in sync with it. When signing is set up,
+// the archive is signed again only if it was updated or its provenance file is missing or not signed by the key,
+// since signatures differ each time; otherwise a stale provenance file of an updated archive is removed.
+func updateProvenance(ctx context.Context, rootFs billy.Filesystem, tgzPath string, updated bool) error {
+	provPath := tgzPath + ProvenanceExt
+	exists, err := filesystem.PathExists(ctx, rootFs, provPath)
+	if err != nil {
+		return err
+	}
+	if signer == nil {
+		if updated && exists {
+			logger.Log(ctx, slog.LevelWarn, "removing provenance file of an updated archive", slog.String("provPath", provPath))
+			return rootFs.Remove(provPath)
+		}
+		return nil
+	}
+
+	archive, err := billyUtil.ReadFile(rootFs, tgzPath)
+	if err != nil {
+		return err
+	}
+	if exists && !updated {
+		prov, err := billyUtil.ReadFile(rootFs, provPath)
+		if err != nil {
+			return err
+		}
+		if _, err := (&Keyring{signatory: signer}).Verify(filepath.Base(tgzPath), archive, prov); err == nil {
+			logger.Log(ctx, slog.LevelDebug, "provenance file is up-to-date", slog.String("provPath", provPath))
+			return nil
+		}
+	}
+	prov, err := sign(filepath.Base(tgzPath), archive)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", tgzPath, err)
+	}
+	if err := billyUtil.WriteFile(rootFs, provPath, prov, 0644); err != nil {
+		return err
+	}
+	logger.Log(ctx, slog.LevelInfo, "signed archive", slog.String("provPath", provPath))
+	return nil
+}
+
+// ProvenanceReport is the result of VerifyAssetsProvenance
+type ProvenanceReport struct {
+	// Checked is the number of assets that were verified
+	Checked int `json:"checked"`
+	// Problems are the assets without a valid provenance file, sorted by path
+	Problems []ProvenanceProblem `json:"problems"`
+}
+
+// ProvenanceProblem is an asset without a valid provenance file
+type ProvenanceProblem struct {
+	Asset string `json:"asset"`
+	// Problem is one of ProvenanceMissing or ProvenanceInvalid
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Header returns the columns of the report
+func (r ProvenanceReport) Header() []string {
+	return []string{"ASSET", "PROBLEM", "DETAIL"}
+}
+
+// Rows returns a row for each problem
+func (r ProvenanceReport) Rows() [][]string {
+	rows := make([][]string, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		rows = append(rows, []string{p.Asset, p.Problem, p.Detail})
+	}
+	return rows
+}
+
+// VerifyAssetsProvenance checks that every archive in the assets/ directory has a provenance file signed by a key of the keyring.
+// The report lists the assets without a valid provenance file; an error is also returned if there is any.
+func VerifyAssetsProvenance(ctx context.Context, rootFs billy.Filesystem, keyring *Keyring) (*ProvenanceReport, error) {
+	assets, err := listAssets(rootFs)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ProvenanceReport{Checked: len(assets), Problems: []ProvenanceProblem{}}
+	for _, asset := range assets {
+		problem, detail, err := verifyAssetProvenance(ctx, rootFs, keyring, asset)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			logger.Log(ctx, slog.LevelWarn, "asset has no valid provenance", slog.String("asset", asset), slog.String("problem", problem), slog.String("detail", detail))
+			report.Problems = append(report.Problems, ProvenanceProblem{Asset: asset, Problem: problem, Detail: detail})
+		}
+	}
+	sort.SliceStable(report.Problems, func(i, j int) bool { return report.Problems[i].Asset < report.Problems[j].Asset })
+
+	if len(report.Problems) > 0 {
+		return report, fmt.Errorf("%d of %d assets have no valid provenance", len(report.Problems), len(assets))
+	}
+	return report, nil
+}
+
+// verifyAssetProvenance returns the problem of the provenance file of the asset, if any
+func verifyAssetProvenance(ctx context.Context, rootFs billy.Filesystem, keyring *Keyring, asset string) (problem, detail string, err error) {
+	provPath := asset + ProvenanceExt
+	exists, err := filesystem.PathExists(ctx, rootFs, provPath)
+	if err != nil {
+		return "", "", err
+	}
+	if !exists {
+		return ProvenanceMissing, provPath + " does not exist", nil
+	}
+	archive, err := billyUtil.ReadFile(rootFs, asset)
+	if err != nil {
+		return "", "", err
+	}
+	prov, err := billyUtil.ReadFile(rootFs, provPath)
+	if err != nil {
+		return "", "", err
+	}
+	signedBy, err := keyring.Verify(filepath.Base(asset), archive, prov)
+	if err != nil {
+		return ProvenanceInvalid, err.Error(), nil
+	}
+	logger.Log(ctx, slog.LevelDebug, "verified provenance", slog.String("asset", asset), slog.String("signedBy", signedBy))
+	return "", "", nil
+}
@@ -0,0 +1,104 @@
+package helm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp" //nolint
+)
+
+// newKeyring writes a new PGP key for the identity to a secret and a public keyring, and returns their paths
+func newKeyring(t *testing.T, name string) (secring, pubring string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	secring, pubring = filepath.Join(dir, "secring.gpg"), filepath.Join(dir, "pubring.gpg")
+	f, err := os.Create(secring)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(f, nil))
+	require.NoError(t, f.Close())
+	f, err = os.Create(pubring)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(f))
+	require.NoError(t, f.Close())
+	return secring, pubring
+}
+
+func Test_GenerateArchive_provenance(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	t.Cleanup(func() { signer = nil })
+
+	rootDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "packages", "demo", "charts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "packages", "demo", "charts", "Chart.yaml"), []byte("apiVersion: v2\nname: demo\nversion: 0.1.0\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "assets", "demo"), 0755))
+	rootFs := filesystem.GetFilesystem(rootDir)
+	fs := filesystem.GetFilesystem(filepath.Join(rootDir, "packages", "demo"))
+
+	secring, pubring := newKeyring(t, "charts")
+	assert.Error(t, SetupSigning(SigningOptions{Key: "unknown", Keyring: secring}))
+	require.NoError(t, SetupSigning(SigningOptions{Key: "charts", Keyring: secring}))
+
+	tgzPath, err := GenerateArchive(ctx, rootFs, fs, "charts", "assets/demo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "assets/demo/demo-0.1.0.tgz", tgzPath)
+	prov, err := os.ReadFile(filepath.Join(rootDir, tgzPath+ProvenanceExt))
+	require.NoError(t, err)
+
+	keyring, err := LoadKeyring(pubring)
+	require.NoError(t, err)
+	report, err := VerifyAssetsProvenance(ctx, rootFs, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Checked)
+	assert.Empty(t, report.Problems)
+
+	// signatures differ each time, so an archive that did not change is not signed again
+	_, err = GenerateArchive(ctx, rootFs, fs, "charts", "assets/demo", nil)
+	require.NoError(t, err)
+	unchanged, err := os.ReadFile(filepath.Join(rootDir, tgzPath+ProvenanceExt))
+	require.NoError(t, err)
+	assert.Equal(t, prov, unchanged)
+
+	index, err := indexAssets(rootFs)
+	require.NoError(t, err)
+	chartVersion, err := index.Get("demo", "0.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "assets/demo/demo-0.1.0.tgz.prov", chartVersion.Annotations[ProvenanceAnnotation])
+
+	// a key that is not trusted
+	_, otherPubring := newKeyring(t, "other")
+	otherKeyring, err := LoadKeyring(otherPubring)
+	require.NoError(t, err)
+	report, err = VerifyAssetsProvenance(ctx, rootFs, otherKeyring)
+	assert.Error(t, err)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, ProvenanceProblem{Asset: tgzPath, Problem: ProvenanceInvalid, Detail: report.Problems[0].Detail}, report.Problems[0])
+
+	// an archive without provenance file
+	require.NoError(t, os.Remove(filepath.Join(rootDir, tgzPath+ProvenanceExt)))
+	report, err = VerifyAssetsProvenance(ctx, rootFs, keyring)
+	assert.Error(t, err)
+	assert.Equal(t, []ProvenanceProblem{{Asset: tgzPath, Problem: ProvenanceMissing, Detail: tgzPath + ".prov does not exist"}}, report.Problems)
+
+	// the missing provenance file is written again even if the archive did not change
+	_, err = GenerateArchive(ctx, rootFs, fs, "charts", "assets/demo", nil)
+	require.NoError(t, err)
+	_, err = VerifyAssetsProvenance(ctx, rootFs, keyring)
+	assert.NoError(t, err)
+
+	// without signing, the provenance file of an updated archive is removed since it no longer matches
+	signer = nil
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "packages", "demo", "charts", "values.yaml"), []byte("replicas: 1\n"), 0644))
+	_, err = GenerateArchive(ctx, rootFs, fs, "charts", "assets/demo", nil)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(rootDir, tgzPath+ProvenanceExt))
+}
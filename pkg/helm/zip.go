@@ -92,8 +92,12 @@ func DumpAssets(ctx context.Context, repoRoot string, specificAsset string) erro
 
 		// Get path to unarchive tgz to
 		foundAsset = true
-		absAssetPath := filesystem.GetAbsPath(fs, tgzPath)
-		chart, err := helmLoader.Load(absAssetPath)
+		tgzFile, err := fs.Open(tgzPath)
+		if err != nil {
+			return err
+		}
+		chart, err := helmLoader.LoadArchive(tgzFile)
+		tgzFile.Close()
 		if err != nil {
 			return fmt.Errorf("could not load Helm chart: %s", err)
 		}
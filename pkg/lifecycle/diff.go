@@ -0,0 +1,259 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/output"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+)
+
+// StatusAt computes the lifecycle status of the branch version as lifecycle-status would have at a git revision of the charts repository:
+// with the version rules, the lifecycle policy and the index.yaml of the revision, compared with the index.yaml of the
+// production and development branches of the upstream remote as they were when the revision was committed.
+func StatusAt(ctx context.Context, g *git.Git, revision, branchVersion string) (*Status, error) {
+	committed, err := g.CommitTime(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// the lifecycle policy is loaded from the filesystem of the dependencies, see loadPolicy
+	rootFs := memfs.New()
+	policy, err := g.ShowFile(ctx, revision, path.LifecyclePolicyFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := billyUtil.WriteFile(rootFs, path.LifecyclePolicyFile, policy, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Dependencies{RootFs: rootFs, Git: g}
+	d.VR, err = d.rules(ctx, branchVersion, func(ctx context.Context, fs billy.Filesystem) (*VersionRules, error) {
+		data, err := g.ShowFile(ctx, revision, path.VersionRulesFile)
+		if err != nil {
+			return nil, err
+		}
+		vr := &VersionRules{Rules: make(map[string]Version)}
+		return vr, json.Unmarshal(data, vr)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", revision, err)
+	}
+
+	if d.AssetsVersionsMap, err = assetsAt(ctx, g, revision); err != nil {
+		return nil, err
+	}
+	for _, branch := range []string{d.VR.ProdBranch, d.VR.DevBranch} {
+		if err := g.FetchRemoteBranch(ctx, branch); err != nil {
+			return nil, err
+		}
+	}
+	releasedAssets, err := remoteBranchAssetsAt(ctx, g, d.VR.ProdBranch, committed)
+	if err != nil {
+		return nil, err
+	}
+	devAssets, err := remoteBranchAssetsAt(ctx, g, d.VR.DevBranch, committed)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{ld: d}
+	status.listCurrentAssetsVersionsOnTheCurrentBranch()
+	status.compareReleasedAndDevAssets(releasedAssets, devAssets)
+	if err := status.separateReleaseFromForwardPort(ctx); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// assetsAt returns the versions of every chart of the index.yaml at the revision
+func assetsAt(ctx context.Context, g *git.Git, revision string) (map[string][]Asset, error) {
+	data, err := g.ShowFile(ctx, revision, path.RepositoryHelmIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	helmIndexFile, err := helm.ParseIndexYaml(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index.yaml at %s: %w", revision, err)
+	}
+	return assetsFromIndex(helmIndexFile), nil
+}
+
+// remoteBranchAssetsAt returns the versions of every chart of the index.yaml of the upstream remote branch at the given time,
+// or none if the branch did not exist yet
+func remoteBranchAssetsAt(ctx context.Context, g *git.Git, branch string, at time.Time) (map[string][]Asset, error) {
+	commit, err := g.RemoteBranchCommitAt(ctx, branch, at)
+	if err != nil {
+		return nil, err
+	}
+	if commit == "" {
+		logger.Log(ctx, slog.LevelWarn, "branch has no commit at that time, considering it empty", slog.String("branch", branch), slog.Time("at", at))
+		return map[string][]Asset{}, nil
+	}
+	logger.Log(ctx, slog.LevelDebug, "reading index.yaml", slog.String("branch", branch), slog.String("commit", commit))
+	return assetsAt(ctx, g, commit)
+}
+
+// StatusDiff lists what changed in the lifecycle status of a branch version between two git revisions, by chart
+type StatusDiff struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	BranchVersion string `json:"branch_version"`
+	// Released are the chart versions of the branch version released on the production branch since From
+	Released map[string][]string `json:"released"`
+	// ForwardPorted are the chart versions of older branch versions released on the production branch since From
+	ForwardPorted map[string][]string `json:"forward_ported"`
+	// OutOfLifecycle are the chart versions of the current branch that left the lifecycle since From
+	OutOfLifecycle map[string][]string `json:"out_of_lifecycle"`
+	// Removed are the chart versions of the current branch at From that are no longer there at To
+	Removed map[string][]string `json:"removed"`
+}
+
+// DiffStatus compares the lifecycle status at two revisions, e.g. computed by StatusAt.
+// If chart is not empty, only its versions are compared.
+func DiffStatus(ctx context.Context, from, to *Status, fromRevision, toRevision, chart string) *StatusDiff {
+	diff := &StatusDiff{
+		From:           fromRevision,
+		To:             toRevision,
+		BranchVersion:  to.ld.VR.BranchVersion,
+		Released:       make(map[string][]string),
+		ForwardPorted:  make(map[string][]string),
+		OutOfLifecycle: make(map[string][]string),
+		Removed:        make(map[string][]string),
+	}
+
+	wasReleased := versionSet(from.AssetsReleasedInLifecycle, from.AssetsReleasedOutLifecycle)
+	for name, versions := range versionSet(to.AssetsReleasedInLifecycle, to.AssetsReleasedOutLifecycle) {
+		for version := range versions {
+			if wasReleased[name][version] {
+				continue
+			}
+			// the same split as separateReleaseFromForwardPort
+			if toRelease, err := to.ld.VR.CheckChartVersionToRelease(ctx, version); err == nil && toRelease {
+				diff.Released[name] = append(diff.Released[name], version)
+			} else {
+				diff.ForwardPorted[name] = append(diff.ForwardPorted[name], version)
+			}
+		}
+	}
+
+	wasOut := versionSet(from.AssetsOutLifecycleCurrentBranch)
+	for name, versions := range versionSet(to.AssetsOutLifecycleCurrentBranch) {
+		for version := range versions {
+			if !wasOut[name][version] {
+				diff.OutOfLifecycle[name] = append(diff.OutOfLifecycle[name], version)
+			}
+		}
+	}
+
+	isPresent := versionSet(to.AssetsInLifecycleCurrentBranch, to.AssetsOutLifecycleCurrentBranch)
+	for name, versions := range versionSet(from.AssetsInLifecycleCurrentBranch, from.AssetsOutLifecycleCurrentBranch) {
+		for version := range versions {
+			if !isPresent[name][version] {
+				diff.Removed[name] = append(diff.Removed[name], version)
+			}
+		}
+	}
+
+	for _, lists := range diff.lists() {
+		for name, versions := range lists.versions {
+			if chart != "" && name != chart {
+				delete(lists.versions, name)
+				continue
+			}
+			sort.Slice(versions, func(i, j int) bool {
+				return util.SortUpstreamAppVersions(versions[i], versions[j])
+			})
+		}
+	}
+	return diff
+}
+
+// versionSet returns the set of versions of each chart of the lists of assets
+func versionSet(lists ...map[string][]Asset) map[string]map[string]bool {
+	set := make(map[string]map[string]bool)
+	for _, assets := range lists {
+		for name, versions := range assets {
+			for _, version := range versions {
+				if set[name] == nil {
+					set[name] = make(map[string]bool)
+				}
+				set[name][version.Version] = true
+			}
+		}
+	}
+	return set
+}
+
+// lists returns every list of the diff with its title, in the order of the report
+func (d *StatusDiff) lists() []struct {
+	name, title string
+	versions    map[string][]string
+} {
+	return []struct {
+		name, title string
+		versions    map[string][]string
+	}{
+		{"released", "Released", d.Released},
+		{"forward_ported", "Forward-ported", d.ForwardPorted},
+		{"out_of_lifecycle", "Out of the lifecycle", d.OutOfLifecycle},
+		{"removed", "Removed", d.Removed},
+	}
+}
+
+// Header returns the columns of the lifecycle diff
+func (d *StatusDiff) Header() []string {
+	return []string{"CHANGE", "CHART", "VERSIONS"}
+}
+
+// Rows returns a row per chart of each list of the lifecycle diff, named after its JSON field
+func (d *StatusDiff) Rows() [][]string {
+	var rows [][]string
+	for _, list := range d.lists() {
+		rows = append(rows, output.ListRows(list.name, list.versions)...)
+	}
+	return rows
+}
+
+// Markdown returns the lifecycle diff as release notes: a section per list that is not empty, with a bullet per chart
+func (d *StatusDiff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Lifecycle changes of %s from `%s` to `%s`\n", d.BranchVersion, d.From, d.To)
+	empty := true
+	for _, list := range d.lists() {
+		if len(list.versions) == 0 {
+			continue
+		}
+		empty = false
+		fmt.Fprintf(&b, "\n### %s\n\n", list.title)
+		charts := make([]string, 0, len(list.versions))
+		for chart := range list.versions {
+			charts = append(charts, chart)
+		}
+		sort.Strings(charts)
+		for _, chart := range charts {
+			fmt.Fprintf(&b, "- **%s**: %s\n", chart, strings.Join(list.versions[chart], ", "))
+		}
+	}
+	if empty {
+		b.WriteString("\nNo changes.\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiffStatus(t *testing.T) {
+	ld := &Dependencies{VR: &VersionRules{BranchVersion: "2.9", MinVersion: 104, MaxVersion: 105}}
+	from := &Status{
+		ld:                             ld,
+		AssetsInLifecycleCurrentBranch: map[string][]Asset{"fleet": {{Version: "103.0.0+up0.9.0"}, {Version: "104.0.0+up0.10.0"}}},
+		AssetsReleasedInLifecycle:      map[string][]Asset{"fleet": {{Version: "103.0.0+up0.9.0"}}},
+	}
+	to := &Status{
+		ld:                              ld,
+		AssetsInLifecycleCurrentBranch:  map[string][]Asset{"fleet": {{Version: "104.0.0+up0.10.0"}, {Version: "104.1.0+up0.10.1"}}},
+		AssetsOutLifecycleCurrentBranch: map[string][]Asset{"fleet": {{Version: "103.1.0+up0.9.1"}}},
+		AssetsReleasedInLifecycle:       map[string][]Asset{"fleet": {{Version: "104.0.0+up0.10.0"}, {Version: "104.1.0+up0.10.1"}}},
+		AssetsReleasedOutLifecycle:      map[string][]Asset{"fleet": {{Version: "103.1.0+up0.9.1"}}, "rancher-logging": {{Version: "103.0.0+up4.3.0"}}},
+	}
+
+	diff := DiffStatus(context.Background(), from, to, "v2.9.1", "v2.9.2", "")
+	assert.Equal(t, &StatusDiff{
+		From:           "v2.9.1",
+		To:             "v2.9.2",
+		BranchVersion:  "2.9",
+		Released:       map[string][]string{"fleet": {"104.1.0+up0.10.1", "104.0.0+up0.10.0"}},
+		ForwardPorted:  map[string][]string{"fleet": {"103.1.0+up0.9.1"}, "rancher-logging": {"103.0.0+up4.3.0"}},
+		OutOfLifecycle: map[string][]string{"fleet": {"103.1.0+up0.9.1"}},
+		Removed:        map[string][]string{"fleet": {"103.0.0+up0.9.0"}},
+	}, diff)
+
+	assert.Equal(t, "## Lifecycle changes of 2.9 from `v2.9.1` to `v2.9.2`\n"+
+		"\n### Released\n\n- **fleet**: 104.1.0+up0.10.1, 104.0.0+up0.10.0\n"+
+		"\n### Forward-ported\n\n- **fleet**: 103.1.0+up0.9.1\n- **rancher-logging**: 103.0.0+up4.3.0\n"+
+		"\n### Out of the lifecycle\n\n- **fleet**: 103.1.0+up0.9.1\n"+
+		"\n### Removed\n\n- **fleet**: 103.0.0+up0.9.0\n", diff.Markdown())
+
+	// the chart filter
+	diff = DiffStatus(context.Background(), from, to, "v2.9.1", "v2.9.2", "rancher-logging")
+	assert.Equal(t, map[string][]string{"rancher-logging": {"103.0.0+up4.3.0"}}, diff.ForwardPorted)
+	assert.Empty(t, diff.Released)
+	assert.Empty(t, diff.Removed)
+
+	// no changes
+	assert.Equal(t, "## Lifecycle changes of 2.9 from `v2.9.2` to `v2.9.2`\n\nNo changes.\n", DiffStatus(context.Background(), to, to, "v2.9.2", "v2.9.2", "").Markdown())
+}
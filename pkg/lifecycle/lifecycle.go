@@ -19,8 +19,18 @@ var (
 
 // Asset represents an asset with its version and path in the repository
 type Asset struct {
-	Version string
-	path    string
+	Version string `json:"version"`
+	// Rule is the rule of the lifecycle policy that decided whether the asset is in the lifecycle, see VersionRules.Evaluate
+	Rule string `json:"rule,omitempty"`
+	path string
+}
+
+// String returns the version of the asset, followed by the rule that decided its lifecycle unless it is the default one
+func (a Asset) String() string {
+	if a.Rule == "" || a.Rule == RuleDefault {
+		return a.Version
+	}
+	return a.Version + " (" + a.Rule + ")"
 }
 
 // Dependencies holds the necessary filesystem,
@@ -2,24 +2,23 @@ package lifecycle
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 )
 
-// Logs is a struct that holds the file and file path of the log file
+// Logs is a struct that holds the file and file path of the log file,
+// and the logger that writes to it with the same handler as the default logger
 type Logs struct {
 	File     *os.File
 	FilePath string
+	log      *slog.Logger
 }
 
-const separator = "\n"
-const ender = "\n__________________________________________________________________\n"
-
 // CreateLogs creates a new log file and returns a logs struct with the file and file path
 func CreateLogs(ctx context.Context, fileName, detail string) (*Logs, error) {
 	// get a timestamp
@@ -40,73 +39,63 @@ func CreateLogs(ctx context.Context, fileName, detail string) (*Logs, error) {
 		return nil, err
 	}
 
-	return &Logs{File: file, FilePath: filePath}, nil
+	return &Logs{File: file, FilePath: filePath, log: slog.New(logger.NewHandler(file, slog.LevelDebug))}, nil
 }
 
 // WriteHEAD writes the header of the log file with the version rules, dates and necessary information
 // to help analyze the current situation on the charts versions regarding the release process.
 func (l *Logs) WriteHEAD(ctx context.Context, versionRules *VersionRules, title string) {
-	l.Write(ctx, title, "INFO")
-	currentTime := time.Now()
-	l.Write(ctx, currentTime.Format("2006-01-02 15:04:05"), "INFO")
-	l.Write(ctx, fmt.Sprintf("Branch Version: %s", versionRules.BranchVersion), "INFO")
-	l.Write(ctx, fmt.Sprintf("minimal version: %d", versionRules.MinVersion), "INFO")
-	l.Write(ctx, fmt.Sprintf("max version: %d", versionRules.MaxVersion), "INFO")
-	l.Write(ctx, fmt.Sprintf("development branch: %s", versionRules.DevBranch), "INFO")
-	l.Write(ctx, fmt.Sprintf("production branch: %s", versionRules.ProdBranch), "INFO")
-
 	rules := make(map[string]string, len(versionRules.Rules))
 	for k, v := range versionRules.Rules {
 		rules[fmt.Sprintf("%s", k)] = fmt.Sprintf("min: %s, max: %s", v.Min, v.Max)
 	}
 
-	rulesJSON, err := json.MarshalIndent(rules, "", "    ")
-	if err != nil {
-		logger.Log(ctx, slog.LevelError, "failed to marshal rules to JSON", logger.Err(err))
-		l.Write(ctx, fmt.Sprintf("rules: %v\n", versionRules.Rules), "INFO")
-	} else {
-		l.Write(ctx, fmt.Sprintf("rules: %s\n", rulesJSON), "INFO")
-	}
+	l.log.LogAttrs(ctx, slog.LevelInfo, title,
+		slog.String("branchVersion", versionRules.BranchVersion),
+		slog.Int("minVersion", versionRules.MinVersion),
+		slog.Int("maxVersion", versionRules.MaxVersion),
+		slog.Int("previousBranches", versionRules.Policy.previousBranches()),
+		slog.String("developmentBranch", versionRules.DevBranch),
+		slog.String("productionBranch", versionRules.ProdBranch),
+		slog.Any("rules", rules))
 }
 
-// Write writes the data to the log file and prints it to the console with customizations.
+// Write writes the data to the log file as a record of the level given by logType (INFO, WARN or ERROR).
+// Records are self-delimited, so the SEPARATE and END types that used to format the file write nothing.
 func (l *Logs) Write(ctx context.Context, data string, logType string) {
 	switch logType {
-	case "INFO":
-		if _, err := l.File.WriteString("INFO=" + data + "\n"); err != nil {
-			logger.Log(ctx, slog.LevelError, "failed to write logs", logger.Err(err))
-		}
-	case "WARN":
-		if _, err := l.File.WriteString("WARN=" + data + "\n"); err != nil {
-			logger.Log(ctx, slog.LevelError, "failed to write logs", logger.Err(err))
-		}
-	case "ERROR":
-		if _, err := l.File.WriteString("ERROR=" + data + "\n"); err != nil {
-			logger.Log(ctx, slog.LevelError, "failed to write logs", logger.Err(err))
-		}
-	case "SEPARATE":
-		if _, err := l.File.WriteString(separator); err != nil {
-			logger.Log(ctx, slog.LevelError, "failed to write logs", logger.Err(err))
-		}
-	case "END":
-		if _, err := l.File.WriteString("\n" + ender + "\n"); err != nil {
-			logger.Log(ctx, slog.LevelError, "failed to write logs", logger.Err(err))
-		}
+	case "SEPARATE", "END":
+		return
 	default:
-		if _, err := l.File.WriteString(data + "\n"); err != nil {
-			logger.Log(ctx, slog.LevelError, "failed to write logs", logger.Err(err))
-		}
+		l.log.LogAttrs(ctx, logLevel(logType), data)
 	}
 }
 
-// WriteVersions receives the loaded assets versions map and writes it to the log file
-// in human-readable format
+// WriteVersions receives the loaded assets versions map and writes a record per chart with its versions to the log file
 func (l *Logs) WriteVersions(ctx context.Context, assetsVersions map[string][]Asset, logType string) {
-	for asset, versions := range assetsVersions {
-		l.Write(ctx, "", "SEPARATE")
-		l.Write(ctx, asset, logType)
-		for _, version := range versions {
-			l.Write(ctx, version.Version, "")
+	charts := make([]string, 0, len(assetsVersions))
+	for chart := range assetsVersions {
+		charts = append(charts, chart)
+	}
+	sort.Strings(charts)
+
+	for _, chart := range charts {
+		versions := make([]string, len(assetsVersions[chart]))
+		for i, asset := range assetsVersions[chart] {
+			versions[i] = asset.String()
 		}
+		l.log.LogAttrs(ctx, logLevel(logType), chart, slog.Any("versions", versions))
+	}
+}
+
+// logLevel returns the level of the records written with the given logType
+func logLevel(logType string) slog.Level {
+	switch logType {
+	case "WARN":
+		return slog.LevelWarn
+	case "ERROR":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
 	}
 }
@@ -0,0 +1,366 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+)
+
+// The release states of the chart versions of the development branch of a branch version in the matrix
+const (
+	// StateReleased is a chart version released on the production branch and in the lifecycle
+	StateReleased = "released"
+	// StateReleasedOutLifecycle is a chart version released on the production branch but out of the lifecycle
+	StateReleasedOutLifecycle = "released-out-of-lifecycle"
+	// StateToBeReleased is a chart version of the branch version that is in the lifecycle but not released yet
+	StateToBeReleased = "to-be-released"
+	// StateToBeForwardPorted is a chart version of an older branch version that is in the lifecycle but not released yet
+	StateToBeForwardPorted = "to-be-forward-ported"
+	// StateReleaseCandidate is a release candidate in the lifecycle, which is never released
+	StateReleaseCandidate = "release-candidate"
+	// StateOutLifecycle is a chart version that is neither released nor in the lifecycle
+	StateOutLifecycle = "out-of-lifecycle"
+)
+
+// Matrix is the lifecycle status of every chart on every branch version of the version rules
+type Matrix struct {
+	// BranchVersions are the branch versions whose production and development branches exist, oldest first
+	BranchVersions []string `json:"branch_versions"`
+	// MissingBranches are the branches of the version rules that the upstream remote does not have
+	MissingBranches []string `json:"missing_branches"`
+	// Charts holds a cell per chart and branch version
+	Charts map[string]map[string]*MatrixCell `json:"charts"`
+}
+
+// MatrixCell is the status of the versions of a chart on a branch version
+type MatrixCell struct {
+	// Versions are the chart versions of the development branch, newest first
+	Versions []MatrixVersion `json:"versions"`
+	// ForwardPortGaps are the chart versions released on an older branch version, in the lifecycle of this one,
+	// but missing from its development branch, newest first
+	ForwardPortGaps []string `json:"forward_port_gaps,omitempty"`
+}
+
+// MatrixVersion is a chart version of the development branch of a branch version with its release state
+type MatrixVersion struct {
+	Version string `json:"version"`
+	State   string `json:"state"`
+	// Rule is the rule of the lifecycle policy that decided whether the version is in the lifecycle
+	Rule string `json:"rule"`
+}
+
+// branchStatus is the lifecycle status of a branch version computed from its remote branches
+type branchStatus struct {
+	*Status
+	released map[string][]Asset
+	dev      map[string][]Asset
+}
+
+// BuildMatrix computes the lifecycle status of every branch version of the version rules of the repository
+// from the index.yaml of its production and development branches on the upstream remote, without checking them out.
+// Each branch version follows the lifecycle policy of its development branch.
+// If chart is not empty, only its versions are reported.
+func BuildMatrix(ctx context.Context, rootFs billy.Filesystem, g *git.Git, chart string) (*Matrix, error) {
+	rules, err := loadFromJSON(ctx, rootFs)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		return nil, fmt.Errorf("%s not found", path.VersionRulesFile)
+	}
+
+	matrix := &Matrix{Charts: make(map[string]map[string]*MatrixCell)}
+	statuses := make(map[string]*branchStatus)
+	for _, branchVersion := range sortBranchVersions(rules.Rules) {
+		ctx := logger.WithAttrs(ctx, slog.String("branchVersion", branchVersion))
+		prodBranch, devBranch := rules.ProdBranchPrefix+branchVersion, rules.DevBranchPrefix+branchVersion
+
+		missing := false
+		for _, branch := range []string{prodBranch, devBranch} {
+			if err := g.FetchRemoteBranch(ctx, branch); err != nil {
+				logger.Log(ctx, slog.LevelWarn, "skipping branch version", slog.String("branch", branch), logger.Err(err))
+				matrix.MissingBranches = append(matrix.MissingBranches, branch)
+				missing = true
+			}
+		}
+		if missing {
+			continue
+		}
+
+		status, err := remoteBranchStatus(ctx, rootFs, g, branchVersion, prodBranch, devBranch)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", branchVersion, err)
+		}
+		statuses[branchVersion] = status
+		matrix.BranchVersions = append(matrix.BranchVersions, branchVersion)
+	}
+
+	for _, branchVersion := range matrix.BranchVersions {
+		status := statuses[branchVersion]
+		for _, list := range []struct {
+			state  string
+			assets map[string][]Asset
+		}{
+			{StateReleased, status.AssetsReleasedInLifecycle},
+			{StateReleasedOutLifecycle, status.AssetsReleasedOutLifecycle},
+			{StateToBeReleased, status.AssetsToBeReleased},
+			{StateToBeForwardPorted, status.AssetsToBeForwardPorted},
+			{StateReleaseCandidate, releaseCandidates(status.Status)},
+			{StateOutLifecycle, status.AssetsNotReleasedOutLifecycle},
+		} {
+			for name, versions := range list.assets {
+				for _, version := range versions {
+					cell := matrix.cell(name, branchVersion)
+					cell.Versions = append(cell.Versions, MatrixVersion{Version: version.Version, State: list.state, Rule: version.Rule})
+				}
+			}
+		}
+		for name, versions := range forwardPortGaps(statuses, matrix.BranchVersions, branchVersion) {
+			matrix.cell(name, branchVersion).ForwardPortGaps = versions
+		}
+	}
+
+	for name, cells := range matrix.Charts {
+		if chart != "" && name != chart {
+			delete(matrix.Charts, name)
+			continue
+		}
+		for _, cell := range cells {
+			sort.Slice(cell.Versions, func(i, j int) bool {
+				return util.SortUpstreamAppVersions(cell.Versions[i].Version, cell.Versions[j].Version)
+			})
+		}
+	}
+	return matrix, nil
+}
+
+// remoteBranchStatus computes the lifecycle status of the branch version like lifecycle-status does on its development branch
+func remoteBranchStatus(ctx context.Context, rootFs billy.Filesystem, g *git.Git, branchVersion, prodBranch, devBranch string) (*branchStatus, error) {
+	// the lifecycle policy is loaded from the filesystem of the dependencies, see loadPolicy
+	policyFs := memfs.New()
+	if err := g.CheckFileExists(path.LifecyclePolicyFile, devBranch); err == nil {
+		policy, err := g.ShowFileFromRemoteBranch(ctx, devBranch, path.LifecyclePolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := billyUtil.WriteFile(policyFs, path.LifecyclePolicyFile, policy, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Dependencies{RootFs: policyFs, Git: g}
+	var err error
+	d.VR, err = d.rules(ctx, branchVersion, func(ctx context.Context, _ billy.Filesystem) (*VersionRules, error) {
+		return loadFromJSON(ctx, rootFs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &branchStatus{}
+	if status.released, err = remoteBranchAssets(ctx, g, prodBranch); err != nil {
+		return nil, err
+	}
+	if status.dev, err = remoteBranchAssets(ctx, g, devBranch); err != nil {
+		return nil, err
+	}
+	d.AssetsVersionsMap = status.dev
+
+	status.Status = &Status{ld: d}
+	status.listCurrentAssetsVersionsOnTheCurrentBranch()
+	status.compareReleasedAndDevAssets(status.released, status.dev)
+	if err := status.separateReleaseFromForwardPort(ctx); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// remoteBranchAssets returns the versions of every chart of the index.yaml of the upstream remote branch
+func remoteBranchAssets(ctx context.Context, g *git.Git, branch string) (map[string][]Asset, error) {
+	data, err := g.ShowFileFromRemoteBranch(ctx, branch, path.RepositoryHelmIndexFile)
+	if err != nil {
+		return nil, err
+	}
+	helmIndexFile, err := helm.ParseIndexYaml(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index.yaml of %s: %w", branch, err)
+	}
+	return assetsFromIndex(helmIndexFile), nil
+}
+
+// releaseCandidates returns the chart versions in the lifecycle and not released that separateReleaseFromForwardPort left out
+func releaseCandidates(s *Status) map[string][]Asset {
+	candidates := make(map[string][]Asset)
+	for name, versions := range s.AssetsNotReleasedInLifecycle {
+		for _, version := range versions {
+			if s.ld.VR.CheckForRCVersion(version.Version) {
+				candidates[name] = append(candidates[name], version)
+			}
+		}
+	}
+	return candidates
+}
+
+// forwardPortGaps returns the chart versions released on the production branch of a branch version older than the given one,
+// in its lifecycle but missing from its development branch
+func forwardPortGaps(statuses map[string]*branchStatus, branchVersions []string, branchVersion string) map[string][]string {
+	status := statuses[branchVersion]
+	present := versionSet(status.dev)
+	gaps := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, older := range branchVersions {
+		if older == branchVersion {
+			break
+		}
+		for name, versions := range statuses[older].released {
+			for _, version := range versions {
+				if present[name][version.Version] || seen[name+"/"+version.Version] {
+					continue
+				}
+				if !status.ld.VR.Evaluate(name, version.Version).InLifecycle {
+					continue
+				}
+				seen[name+"/"+version.Version] = true
+				gaps[name] = append(gaps[name], version.Version)
+			}
+		}
+	}
+	for _, versions := range gaps {
+		sort.Slice(versions, func(i, j int) bool {
+			return util.SortUpstreamAppVersions(versions[i], versions[j])
+		})
+	}
+	return gaps
+}
+
+// sortBranchVersions returns the branch versions of the rules, oldest first
+func sortBranchVersions(rules map[string]Version) []string {
+	branchVersions := make([]string, 0, len(rules))
+	for branchVersion := range rules {
+		branchVersions = append(branchVersions, branchVersion)
+	}
+	parse := func(branchVersion string) (int, int) {
+		major, minor, _ := strings.Cut(branchVersion, ".")
+		majorInt, _ := strconv.Atoi(major)
+		minorInt, _ := strconv.Atoi(minor)
+		return majorInt, minorInt
+	}
+	sort.Slice(branchVersions, func(i, j int) bool {
+		majorI, minorI := parse(branchVersions[i])
+		majorJ, minorJ := parse(branchVersions[j])
+		if majorI != majorJ {
+			return majorI < majorJ
+		}
+		return minorI < minorJ
+	})
+	return branchVersions
+}
+
+// cell returns the cell of the chart and branch version, creating it if needed
+func (m *Matrix) cell(chart, branchVersion string) *MatrixCell {
+	if m.Charts[chart] == nil {
+		m.Charts[chart] = make(map[string]*MatrixCell)
+	}
+	if m.Charts[chart][branchVersion] == nil {
+		m.Charts[chart][branchVersion] = &MatrixCell{Versions: []MatrixVersion{}}
+	}
+	return m.Charts[chart][branchVersion]
+}
+
+// chartNames returns the charts of the matrix, sorted
+func (m *Matrix) chartNames() []string {
+	charts := make([]string, 0, len(m.Charts))
+	for chart := range m.Charts {
+		charts = append(charts, chart)
+	}
+	sort.Strings(charts)
+	return charts
+}
+
+// Header returns the columns of the lifecycle matrix
+func (m *Matrix) Header() []string {
+	return []string{"CHART", "BRANCH", "VERSIONS", "FORWARD-PORT GAPS"}
+}
+
+// Rows returns a row per chart and branch version, with each version followed by its release state
+func (m *Matrix) Rows() [][]string {
+	var rows [][]string
+	for _, chart := range m.chartNames() {
+		for _, branchVersion := range m.BranchVersions {
+			cell, ok := m.Charts[chart][branchVersion]
+			if !ok {
+				continue
+			}
+			versions := make([]string, 0, len(cell.Versions))
+			for _, version := range cell.Versions {
+				versions = append(versions, version.Version+" ("+version.State+")")
+			}
+			rows = append(rows, []string{chart, branchVersion, strings.Join(versions, ", "), strings.Join(cell.ForwardPortGaps, ", ")})
+		}
+	}
+	return rows
+}
+
+// HTML writes the lifecycle matrix as an HTML page with a row per chart and a column per branch version
+func (m *Matrix) HTML(w io.Writer) error {
+	type row struct {
+		Chart string
+		Cells []*MatrixCell
+	}
+	rows := make([]row, 0, len(m.Charts))
+	for _, chart := range m.chartNames() {
+		r := row{Chart: chart}
+		for _, branchVersion := range m.BranchVersions {
+			r.Cells = append(r.Cells, m.Charts[chart][branchVersion])
+		}
+		rows = append(rows, r)
+	}
+	return matrixHTML.Execute(w, struct {
+		*Matrix
+		Rows []row
+	}{m, rows})
+}
+
+var matrixHTML = template.Must(template.New("matrix").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Lifecycle matrix</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; font-size: 13px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; vertical-align: top; text-align: left; }
+li { list-style: none; }
+ul { margin: 0; padding: 0; }
+.released { color: #1a7f37; }
+.released-out-of-lifecycle { color: #cf222e; font-weight: bold; }
+.to-be-released { color: #9a6700; }
+.to-be-forward-ported { color: #8250df; }
+.release-candidate { color: #57606a; font-style: italic; }
+.out-of-lifecycle { color: #57606a; text-decoration: line-through; }
+.gap { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>Lifecycle matrix</h1>
+{{if .MissingBranches}}<p>Missing branches: {{range $i, $b := .MissingBranches}}{{if $i}}, {{end}}{{$b}}{{end}}</p>
+{{end}}<table>
+<tr><th>Chart</th>{{range .BranchVersions}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Chart}}</th>{{range .Cells}}<td>{{if .}}<ul>{{range .Versions}}<li class="{{.State}}" title="{{.State}} ({{.Rule}})">{{.Version}}</li>{{end}}{{range .ForwardPortGaps}}<li class="gap" title="forward-port gap">{{.}} (missing)</li>{{end}}</ul>{{end}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
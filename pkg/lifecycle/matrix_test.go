@@ -0,0 +1,74 @@
+package lifecycle
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sortBranchVersions(t *testing.T) {
+	rules := map[string]Version{"2.10": {}, "2.9": {}, "2.11": {}, "2.8": {}}
+	assert.Equal(t, []string{"2.8", "2.9", "2.10", "2.11"}, sortBranchVersions(rules))
+}
+
+func Test_forwardPortGaps(t *testing.T) {
+	rules := map[string]Version{
+		"2.10": {Min: "105.0.0", Max: "106.0.0"},
+		"2.9":  {Min: "104.0.0", Max: "105.0.0"},
+		"2.8":  {Min: "103.0.0", Max: "104.0.0"},
+		"2.7":  {Min: "102.0.0", Max: "103.0.0"},
+	}
+	newStatus := func(branchVersion string, released, dev map[string][]Asset) *branchStatus {
+		vr := &VersionRules{Rules: rules, BranchVersion: branchVersion}
+		require.NoError(t, vr.getMinMaxVersionInts())
+		return &branchStatus{Status: &Status{ld: &Dependencies{VR: vr}}, released: released, dev: dev}
+	}
+	statuses := map[string]*branchStatus{
+		"2.8": newStatus("2.8", map[string][]Asset{
+			"fleet": {{Version: "103.0.0+up0.9.0"}, {Version: "103.1.0+up0.9.1"}, {Version: "102.0.0+up0.8.0"}},
+		}, nil),
+		"2.9": newStatus("2.9", map[string][]Asset{
+			"fleet": {{Version: "104.0.0+up0.10.0"}, {Version: "103.1.0+up0.9.1"}},
+		}, nil),
+		"2.10": newStatus("2.10", nil, map[string][]Asset{
+			"fleet": {{Version: "105.0.0+up0.11.0"}, {Version: "103.0.0+up0.9.0"}},
+		}),
+	}
+	branchVersions := []string{"2.8", "2.9", "2.10"}
+
+	// 102.0.0 is out of the lifecycle of 2.10, 103.0.0 is on its development branch, 103.1.0 was released on both older branches
+	assert.Equal(t, map[string][]string{"fleet": {"104.0.0+up0.10.0", "103.1.0+up0.9.1"}}, forwardPortGaps(statuses, branchVersions, "2.10"))
+	assert.Empty(t, forwardPortGaps(statuses, branchVersions, "2.8"))
+}
+
+func Test_Matrix_HTML(t *testing.T) {
+	matrix := &Matrix{
+		BranchVersions:  []string{"2.9", "2.10"},
+		MissingBranches: []string{"release-v2.8"},
+		Charts: map[string]map[string]*MatrixCell{
+			"fleet": {
+				"2.9":  {Versions: []MatrixVersion{{Version: "104.0.0+up0.10.0", State: StateReleased, Rule: RuleDefault}}},
+				"2.10": {Versions: []MatrixVersion{{Version: "105.0.0+up0.11.0", State: StateToBeReleased, Rule: RuleDefault}}, ForwardPortGaps: []string{"104.0.0+up0.10.0"}},
+			},
+			"<script>": {"2.9": {Versions: []MatrixVersion{}}},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, matrix.HTML(&buf))
+	html := buf.String()
+	assert.Contains(t, html, "<p>Missing branches: release-v2.8</p>")
+	assert.Contains(t, html, "<tr><th>Chart</th><th>2.9</th><th>2.10</th></tr>")
+	assert.Contains(t, html, `<tr><th>fleet</th><td><ul><li class="released" title="released (default)">104.0.0&#43;up0.10.0</li></ul></td>`+
+		`<td><ul><li class="to-be-released" title="to-be-released (default)">105.0.0&#43;up0.11.0</li><li class="gap" title="forward-port gap">104.0.0&#43;up0.10.0 (missing)</li></ul></td></tr>`)
+	// chart names are escaped, and a chart missing from a branch version has an empty cell
+	assert.Contains(t, html, "<tr><th>&lt;script&gt;</th><td><ul></ul></td><td></td></tr>")
+
+	assert.Equal(t, [][]string{
+		{"<script>", "2.9", "", ""},
+		{"fleet", "2.9", "104.0.0+up0.10.0 (released)", ""},
+		{"fleet", "2.10", "105.0.0+up0.11.0 (to-be-released)", "104.0.0+up0.10.0"},
+	}, matrix.Rows())
+}
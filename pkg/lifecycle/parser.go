@@ -23,15 +23,7 @@ func getAssetsMapFromIndex(absRepositoryHelmIndexFile, currentChart string) (map
 
 	switch {
 	case currentChart == "":
-		for chartName, entry := range helmIndexFile.Entries {
-			for _, chartVersion := range entry {
-				annotatedVersions = append(annotatedVersions, Asset{
-					Version: chartVersion.Version,
-				})
-			}
-			assetsMap[chartName] = annotatedVersions
-			annotatedVersions = nil // Reset the slice for the next iteration
-		}
+		assetsMap = assetsFromIndex(helmIndexFile)
 
 	case currentChart != "":
 		if _, ok := helmIndexFile.Entries[currentChart]; !ok {
@@ -48,6 +40,21 @@ func getAssetsMapFromIndex(absRepositoryHelmIndexFile, currentChart string) (map
 	return assetsMap, nil
 }
 
+// assetsFromIndex returns a map of the versions of every chart of the index file
+func assetsFromIndex(helmIndexFile *helmRepo.IndexFile) map[string][]Asset {
+	assetsMap := make(map[string][]Asset, len(helmIndexFile.Entries))
+	for chartName, entry := range helmIndexFile.Entries {
+		var annotatedVersions []Asset
+		for _, chartVersion := range entry {
+			annotatedVersions = append(annotatedVersions, Asset{
+				Version: chartVersion.Version,
+			})
+		}
+		assetsMap[chartName] = annotatedVersions
+	}
+	return assetsMap
+}
+
 // populateAssetsVersionsPath will combine the information from the index.yaml file and the assets directory to get the path of each asset version for each chart.
 // It will populate the assetsVersionsMap with the path of the assets.
 // It walks through the assets directory and compares the version of the assets with the version of the assets in the index.yaml file.
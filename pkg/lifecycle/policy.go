@@ -0,0 +1,304 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-billy/v5"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+	"gopkg.in/yaml.v2"
+)
+
+// PolicyVersion is the version of the lifecycle policy file format that these scripts understand
+const PolicyVersion = 1
+
+// defaultPreviousBranches is the number of branch versions before the current one whose chart versions a branch holds,
+// when the policy does not say otherwise
+const defaultPreviousBranches = 2
+
+// eolLayout is the format of the end of life dates of the policy
+const eolLayout = "2006-01-02"
+
+// RuleDefault is the rule of the decisions that no chart rule or exception of the policy matched
+const RuleDefault = "default"
+
+// Policy is the declarative lifecycle policy of a charts repository, stored in config/lifecycle_policy.yaml.
+// It decides which chart versions a branch holds; without a policy file, every chart follows the default rule.
+type Policy struct {
+	// Version is the version of the file format, see PolicyVersion
+	Version int `yaml:"version"`
+	// Default applies to every chart version that no chart rule matches
+	Default DefaultRule `yaml:"default"`
+	// Charts are the rules of specific charts; the first rule that matches a chart version applies
+	Charts []ChartRule `yaml:"charts,omitempty"`
+	// Exceptions are chart versions pinned in the lifecycle whatever the rules say
+	Exceptions []Exception `yaml:"exceptions,omitempty"`
+
+	// now returns the current time, to compare with the end of life dates
+	now func() time.Time
+}
+
+// DefaultRule is the rule that applies to every chart version that no chart rule matches
+type DefaultRule struct {
+	// PreviousBranches is the number of branch versions before the current one whose chart versions are kept (2 if unset)
+	PreviousBranches *int `yaml:"previousBranches,omitempty"`
+}
+
+// ChartRule overrides the default rule for the versions of a chart
+type ChartRule struct {
+	// Name identifies the rule in the reports
+	Name string `yaml:"name"`
+	// Chart is the name of the chart, or a pattern like rancher-monitoring*
+	Chart string `yaml:"chart"`
+	// Versions is a semver constraint (e.g. <103.0.0-0) the chart versions must satisfy for the rule to match; every version matches if empty
+	Versions string `yaml:"versions,omitempty"`
+	// PreviousBranches is the number of branch versions before the current one whose chart versions are kept; the default one if unset
+	PreviousBranches *int `yaml:"previousBranches,omitempty"`
+	// EOL is the end of life date (YYYY-MM-DD) after which the matching chart versions are out of the lifecycle
+	EOL string `yaml:"eol,omitempty"`
+
+	versions *semver.Constraints
+	eol      time.Time
+	// minVersion is the major of the minimum version of the branch version PreviousBranches before the current one, see resolvePolicyBranches
+	minVersion int
+}
+
+// Exception pins chart versions in the lifecycle, whatever the rules say
+type Exception struct {
+	// Name identifies the exception in the reports
+	Name string `yaml:"name"`
+	// Chart is the name of the chart, or a pattern like rancher-monitoring*
+	Chart string `yaml:"chart"`
+	// Versions is a semver constraint (e.g. =102.0.0+up3.17.10) the pinned chart versions satisfy; every version if empty
+	Versions string `yaml:"versions,omitempty"`
+	// Reason explains why the chart versions are pinned
+	Reason string `yaml:"reason"`
+
+	versions *semver.Constraints
+}
+
+// Decision is the result of evaluating the lifecycle policy for a chart version
+type Decision struct {
+	// InLifecycle indicates whether the branch holds the chart version
+	InLifecycle bool `json:"inLifecycle"`
+	// Rule is the name of the chart rule or the exception that matched, or RuleDefault
+	Rule string `json:"rule"`
+	// Reason explains the decision
+	Reason string `json:"reason"`
+}
+
+// loadPolicy loads the lifecycle policy file of the repository, or returns nil if there is none
+func loadPolicy(ctx context.Context, fs billy.Filesystem) (*Policy, error) {
+	data, err := billyUtil.ReadFile(fs, path.LifecyclePolicyFile)
+	if os.IsNotExist(err) {
+		logger.Log(ctx, slog.LevelDebug, "no lifecycle policy file, following the default rule", slog.String("file", path.LifecyclePolicyFile))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lifecycle policy %s: %w", path.LifecyclePolicyFile, err)
+	}
+	return policy, nil
+}
+
+// ParsePolicy parses and checks the contents of a lifecycle policy file
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, err
+	}
+	if policy.Version != PolicyVersion {
+		return nil, fmt.Errorf("unsupported version %d: must be %d", policy.Version, PolicyVersion)
+	}
+	if err := checkPreviousBranches("default", policy.Default.PreviousBranches); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	checkName := func(name, chart string) error {
+		if name == "" {
+			return fmt.Errorf("the rules and exceptions of chart %q must have a name", chart)
+		}
+		if names[name] || name == RuleDefault {
+			return fmt.Errorf("the name %q is used more than once", name)
+		}
+		names[name] = true
+		if chart == "" {
+			return fmt.Errorf("%s: chart must be provided", name)
+		}
+		if _, err := filepath.Match(chart, ""); err != nil {
+			return fmt.Errorf("%s: invalid chart pattern %q: %w", name, chart, err)
+		}
+		return nil
+	}
+
+	for i := range policy.Charts {
+		rule := &policy.Charts[i]
+		if err := checkName(rule.Name, rule.Chart); err != nil {
+			return nil, err
+		}
+		if err := checkPreviousBranches(rule.Name, rule.PreviousBranches); err != nil {
+			return nil, err
+		}
+		var err error
+		if rule.versions, err = parseConstraint(rule.Name, rule.Versions); err != nil {
+			return nil, err
+		}
+		if rule.EOL != "" {
+			if rule.eol, err = time.Parse(eolLayout, rule.EOL); err != nil {
+				return nil, fmt.Errorf("%s: invalid eol %q: must be YYYY-MM-DD", rule.Name, rule.EOL)
+			}
+		}
+	}
+	for i := range policy.Exceptions {
+		exception := &policy.Exceptions[i]
+		if err := checkName(exception.Name, exception.Chart); err != nil {
+			return nil, err
+		}
+		if exception.Reason == "" {
+			return nil, fmt.Errorf("%s: reason must be provided", exception.Name)
+		}
+		var err error
+		if exception.versions, err = parseConstraint(exception.Name, exception.Versions); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+func checkPreviousBranches(name string, previousBranches *int) error {
+	if previousBranches != nil && *previousBranches < 0 {
+		return fmt.Errorf("%s: previousBranches cannot be negative", name)
+	}
+	return nil
+}
+
+func parseConstraint(name, constraint string) (*semver.Constraints, error) {
+	if constraint == "" {
+		return nil, nil
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid versions %q: %w", name, constraint, err)
+	}
+	return c, nil
+}
+
+// matches returns whether the chart version is one of the chart and satisfies the constraint, if any
+func matches(chartPattern string, constraint *semver.Constraints, chart, version string) bool {
+	if ok, _ := filepath.Match(chartPattern, chart); !ok {
+		return false
+	}
+	if constraint == nil {
+		return true
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return constraint.Check(v)
+}
+
+// previousBranches returns the number of previous branch versions kept by the default rule
+func (p *Policy) previousBranches() int {
+	if p == nil || p.Default.PreviousBranches == nil {
+		return defaultPreviousBranches
+	}
+	return *p.Default.PreviousBranches
+}
+
+// resolvePolicyBranches checks that the branch versions the policy goes back to are defined in the version rules
+// and stores the major of their minimum versions, so that evaluating a chart version cannot fail.
+// Unlike the number of previous branch versions set by the policy, the default one may go back further than the oldest branch version.
+func (v *VersionRules) resolvePolicyBranches() error {
+	p := v.Policy
+	if p == nil {
+		return nil
+	}
+	if p.Default.PreviousBranches != nil {
+		min, err := v.minVersionInt(*p.Default.PreviousBranches)
+		if err != nil {
+			return fmt.Errorf("%s: previousBranches: %w", RuleDefault, err)
+		}
+		v.MinVersion = min
+	}
+	for i := range p.Charts {
+		rule := &p.Charts[i]
+		if rule.PreviousBranches == nil {
+			continue
+		}
+		var err error
+		if rule.minVersion, err = v.minVersionInt(*rule.PreviousBranches); err != nil {
+			return fmt.Errorf("%s: previousBranches: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate decides whether the branch holds the chart version: the first exception that pins it keeps it,
+// otherwise the first chart rule that matches it applies, otherwise the default rule.
+// A rule keeps the chart versions from its number of previous branch versions up to the current one,
+// unless its end of life date has passed.
+func (v *VersionRules) Evaluate(chart, chartVersion string) Decision {
+	p := v.Policy
+	if p != nil {
+		for _, exception := range p.Exceptions {
+			if matches(exception.Chart, exception.versions, chart, chartVersion) {
+				return Decision{InLifecycle: true, Rule: exception.Name, Reason: "pinned: " + exception.Reason}
+			}
+		}
+		for _, rule := range p.Charts {
+			if !matches(rule.Chart, rule.versions, chart, chartVersion) {
+				continue
+			}
+			if rule.EOL != "" && !p.currentTime().Before(rule.eol) {
+				return Decision{InLifecycle: false, Rule: rule.Name, Reason: "end of life since " + rule.EOL}
+			}
+			if rule.PreviousBranches != nil {
+				return v.decideByBranches(rule.Name, chartVersion, *rule.PreviousBranches, rule.minVersion)
+			}
+			return v.decideByBranches(rule.Name, chartVersion, p.previousBranches(), v.MinVersion)
+		}
+	}
+	return v.decideByBranches(RuleDefault, chartVersion, p.previousBranches(), v.MinVersion)
+}
+
+// decideByBranches keeps the chart version if its major version is between minVersion, the minimum of the branch version
+// previousBranches minor versions before the current one, and the maximum of the current branch version
+func (v *VersionRules) decideByBranches(rule, chartVersion string, previousBranches, minVersion int) Decision {
+	chartVersionInt, _ := strconv.Atoi(strings.Split(chartVersion, ".")[0])
+	/**
+	Rule Example:
+	Branch version: 2.9
+	Min version of 2.7: 102
+	Max version of 2.9: 105
+	Therefore, with 2 previous branches, the chart version must be >= 102 and < 105
+	*/
+	switch {
+	case chartVersionInt < minVersion:
+		return Decision{InLifecycle: false, Rule: rule, Reason: fmt.Sprintf("older than the %d previous branch versions (< %d)", previousBranches, minVersion)}
+	case chartVersionInt >= v.MaxVersion:
+		return Decision{InLifecycle: false, Rule: rule, Reason: fmt.Sprintf("newer than the branch version (>= %d)", v.MaxVersion)}
+	default:
+		return Decision{InLifecycle: true, Rule: rule, Reason: fmt.Sprintf("within the %d previous branch versions (%d <= version < %d)", previousBranches, minVersion, v.MaxVersion)}
+	}
+}
+
+func (p *Policy) currentTime() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,187 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `version: 1
+default:
+  previousBranches: 2
+charts:
+  - name: monitoring-keeps-3-minors
+    chart: rancher-monitoring*
+    previousBranches: 3
+  - name: logging-102-eol
+    chart: rancher-logging
+    versions: "<103.0.0-0"
+    previousBranches: 3
+    eol: 2026-06-30
+exceptions:
+  - name: pinned-logging
+    chart: rancher-logging
+    versions: "=102.0.0+up3.17.10"
+    reason: kept for a customer upgrade path
+`
+
+func Test_ParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, 2, policy.previousBranches())
+	assert.Len(t, policy.Charts, 2)
+	assert.Len(t, policy.Exceptions, 1)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "#1 - unsupported version", data: "version: 2\n"},
+		{name: "#2 - unknown field", data: "version: 1\nkeep: 3\n"},
+		{name: "#3 - negative previousBranches", data: "version: 1\ndefault:\n  previousBranches: -1\n"},
+		{name: "#4 - rule without name", data: "version: 1\ncharts:\n  - chart: fleet\n"},
+		{name: "#5 - rule without chart", data: "version: 1\ncharts:\n  - name: fleet\n"},
+		{name: "#6 - duplicated name", data: "version: 1\ncharts:\n  - name: fleet\n    chart: fleet\nexceptions:\n  - name: fleet\n    chart: fleet\n    reason: pinned\n"},
+		{name: "#7 - invalid versions", data: "version: 1\ncharts:\n  - name: fleet\n    chart: fleet\n    versions: \"not a constraint\"\n"},
+		{name: "#8 - invalid eol", data: "version: 1\ncharts:\n  - name: fleet\n    chart: fleet\n    eol: 30/06/2026\n"},
+		{name: "#9 - exception without reason", data: "version: 1\nexceptions:\n  - name: fleet\n    chart: fleet\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_Evaluate(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	now := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	policy.now = func() time.Time { return now }
+
+	vr := &VersionRules{
+		Rules: map[string]Version{
+			"2.10": {Min: "105.0.0", Max: "106.0.0"},
+			"2.9":  {Min: "104.0.0", Max: "105.0.0"},
+			"2.8":  {Min: "103.0.0", Max: "104.0.0"},
+			"2.7":  {Min: "102.0.0", Max: "103.0.0"},
+		},
+		BranchVersion: "2.10",
+		Policy:        policy,
+	}
+	require.NoError(t, vr.getMinMaxVersionInts())
+	assert.Equal(t, 103, vr.MinVersion)
+	assert.Equal(t, 106, vr.MaxVersion)
+
+	tests := []struct {
+		name    string
+		chart   string
+		version string
+		want    Decision
+	}{
+		{
+			name: "#1 - default rule in lifecycle", chart: "fleet", version: "104.1.0+up0.10.0",
+			want: Decision{InLifecycle: true, Rule: RuleDefault, Reason: "within the 2 previous branch versions (103 <= version < 106)"},
+		},
+		{
+			name: "#2 - default rule too old", chart: "fleet", version: "102.0.0+up0.9.0",
+			want: Decision{InLifecycle: false, Rule: RuleDefault, Reason: "older than the 2 previous branch versions (< 103)"},
+		},
+		{
+			name: "#3 - newer than the branch", chart: "fleet", version: "106.0.0+up0.11.0",
+			want: Decision{InLifecycle: false, Rule: RuleDefault, Reason: "newer than the branch version (>= 106)"},
+		},
+		{
+			name: "#4 - chart rule keeps 3 minors", chart: "rancher-monitoring-crd", version: "102.0.0+up40.1.2",
+			want: Decision{InLifecycle: true, Rule: "monitoring-keeps-3-minors", Reason: "within the 3 previous branch versions (102 <= version < 106)"},
+		},
+		{
+			name: "#5 - chart rule past its eol", chart: "rancher-logging", version: "102.0.1+up3.17.11",
+			want: Decision{InLifecycle: false, Rule: "logging-102-eol", Reason: "end of life since 2026-06-30"},
+		},
+		{
+			name: "#6 - chart rule whose versions do not match", chart: "rancher-logging", version: "104.0.0+up4.4.0",
+			want: Decision{InLifecycle: true, Rule: RuleDefault, Reason: "within the 2 previous branch versions (103 <= version < 106)"},
+		},
+		{
+			name: "#7 - pinned exception", chart: "rancher-logging", version: "102.0.0+up3.17.10",
+			want: Decision{InLifecycle: true, Rule: "pinned-logging", Reason: "pinned: kept for a customer upgrade path"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, vr.Evaluate(tt.chart, tt.version))
+			assert.Equal(t, tt.want.InLifecycle, vr.CheckChartVersionForLifecycle(tt.chart, tt.version))
+		})
+	}
+
+	// before the eol date, the rule keeps the versions of its branches
+	now = time.Date(2026, 6, 29, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, Decision{InLifecycle: true, Rule: "logging-102-eol", Reason: "within the 3 previous branch versions (102 <= version < 106)"}, vr.Evaluate("rancher-logging", "102.0.1+up3.17.11"))
+}
+
+func Test_rules_policy(t *testing.T) {
+	fs := memfs.New()
+	require.NoError(t, util.WriteFile(fs, path.LifecyclePolicyFile, []byte("version: 1\ndefault:\n  previousBranches: 1\n"), 0644))
+	load := func(ctx context.Context, fs billy.Filesystem) (*VersionRules, error) {
+		return &VersionRules{Rules: map[string]Version{
+			"2.9": {Min: "104.0.0", Max: "105.0.0"},
+			"2.8": {Min: "103.0.0", Max: "104.0.0"},
+			"2.7": {Min: "101.0.0", Max: "103.0.0"},
+		}}, nil
+	}
+
+	d := &Dependencies{RootFs: fs}
+	vr, err := d.rules(context.Background(), "2.9", load)
+	require.NoError(t, err)
+	assert.Equal(t, 103, vr.MinVersion)
+	assert.Equal(t, 105, vr.MaxVersion)
+
+	require.NoError(t, util.WriteFile(fs, path.LifecyclePolicyFile, []byte("version: 2\n"), 0644))
+	_, err = d.rules(context.Background(), "2.9", load)
+	assert.Error(t, err)
+}
+
+func Test_resolvePolicyBranches(t *testing.T) {
+	rules := map[string]Version{
+		"2.10": {Min: "105.0.0", Max: "106.0.0"},
+		"2.9":  {Min: "104.0.0", Max: "105.0.0"},
+		"2.8":  {Min: "103.0.0", Max: "104.0.0"},
+	}
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "#1 - chart rule within the rules", policy: "version: 1\ncharts:\n  - name: fleet\n    chart: fleet\n    previousBranches: 2\n"},
+		{name: "#2 - chart rule beyond the rules", policy: "version: 1\ncharts:\n  - name: fleet\n    chart: fleet\n    previousBranches: 3\n", wantErr: true},
+		{name: "#3 - default beyond the rules", policy: "version: 1\ndefault:\n  previousBranches: 3\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePolicy([]byte(tt.policy))
+			require.NoError(t, err)
+			vr := &VersionRules{Rules: rules, BranchVersion: "2.10", Policy: policy}
+			err = vr.getMinMaxVersionInts()
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "branch version 2.7, 3 before 2.10, is not defined in the rules")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, Decision{InLifecycle: true, Rule: "fleet", Reason: "within the 2 previous branch versions (103 <= version < 106)"}, vr.Evaluate("fleet", "103.0.0+up0.9.0"))
+		})
+	}
+
+	// without a policy, the default rule of the oldest branch versions keeps every older chart version
+	vr := &VersionRules{Rules: rules, BranchVersion: "2.9"}
+	require.NoError(t, vr.getMinMaxVersionInts())
+	assert.Equal(t, 0, vr.MinVersion)
+}
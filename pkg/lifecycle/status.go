@@ -5,6 +5,7 @@ import (
 
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/output"
 	"github.com/rancher/charts-build-scripts/pkg/path"
 )
 
@@ -47,6 +48,42 @@ func (ld *Dependencies) getStatus(ctx context.Context) (*Status, error) {
 	return status, nil
 }
 
+// Header returns the columns of the lifecycle status
+func (s *Status) Header() []string {
+	return []string{"STATUS", "CHART", "VERSIONS"}
+}
+
+// Rows returns a row per chart of each list of the lifecycle status, named after its JSON field.
+// Versions decided by a chart rule or an exception of the lifecycle policy are followed by its name.
+func (s *Status) Rows() [][]string {
+	var rows [][]string
+	for _, list := range []struct {
+		name   string
+		assets map[string][]Asset
+	}{
+		{"in_lifecycle_current_branch", s.AssetsInLifecycleCurrentBranch},
+		{"out_lifecycle_current_branch", s.AssetsOutLifecycleCurrentBranch},
+		{"released_in_lifecycle", s.AssetsReleasedInLifecycle},
+		{"not_released_out_lifecycle", s.AssetsNotReleasedOutLifecycle},
+		{"not_released_in_lifecycle", s.AssetsNotReleasedInLifecycle},
+		{"released_out_lifecycle", s.AssetsReleasedOutLifecycle},
+		{"to_be_released", s.AssetsToBeReleased},
+		{"to_be_forward_ported", s.AssetsToBeForwardPorted},
+	} {
+		versions := make(map[string][]string, len(list.assets))
+		for chart, assets := range list.assets {
+			if len(assets) == 0 {
+				continue
+			}
+			for _, asset := range assets {
+				versions[chart] = append(versions[chart], asset.String())
+			}
+		}
+		rows = append(rows, output.ListRows(list.name, versions)...)
+	}
+	return rows
+}
+
 // createLogFiles will create the log files for the current branch, production and development branches
 // and the assets to be released and forward ported, returning the logs objects for each file.
 func createLogFiles(ctx context.Context, chart string) (*Logs, *Logs, *Logs, error) {
@@ -160,8 +197,9 @@ func (s *Status) listCurrentAssetsVersionsOnTheCurrentBranch() {
 
 	for asset, versions := range s.ld.AssetsVersionsMap {
 		for _, version := range versions {
-			inLifecycle := s.ld.VR.CheckChartVersionForLifecycle(version.Version)
-			if inLifecycle {
+			decision := s.ld.VR.Evaluate(asset, version.Version)
+			version.Rule = decision.Rule
+			if decision.InLifecycle {
 				insideLifecycle[asset] = append(insideLifecycle[asset], version)
 			} else {
 				outsideLifecycle[asset] = append(outsideLifecycle[asset], version)
@@ -266,7 +304,9 @@ func (s *Status) compareReleasedAndDevAssets(releasedAssets, developmentAssets m
 			// check if the version is already released
 			released := checkIfVersionIsReleased(devVersion.Version, releasedVersions)
 			// check if the version is in the lifecycle
-			inLifecycle := s.ld.VR.CheckChartVersionForLifecycle(devVersion.Version)
+			decision := s.ld.VR.Evaluate(devAsset, devVersion.Version)
+			devVersion.Rule = decision.Rule
+			inLifecycle := decision.InLifecycle
 
 			switch {
 			case released && inLifecycle:
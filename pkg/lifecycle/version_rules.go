@@ -37,10 +37,12 @@ type VersionRules struct {
 	DevBranchPrefix  string             `json:"dev-branch-prefix"`
 	ProdBranch       string             `json:"prod-branch,omitempty"`
 	ProdBranchPrefix string             `json:"prod-branch-prefix"`
+	// Policy holds the chart rules and exceptions of config/lifecycle_policy.yaml; nil if there is no such file
+	Policy *Policy `json:"-"`
 }
 
-// rules will check and convert the provided branch version,
-// create the hard-coded rules for the charts repository and calculate the minimum and maximum versions according to the branch version.
+// rules will check and convert the provided branch version, load the lifecycle policy of the charts repository
+// and calculate the minimum and maximum versions of its default rule according to the branch version.
 func (d *Dependencies) rules(ctx context.Context, branchVersion string, jsonLoad jsonLoader) (*VersionRules, error) {
 	if branchVersion == "" {
 		return nil, errorNoBranchVersion
@@ -57,6 +59,10 @@ func (d *Dependencies) rules(ctx context.Context, branchVersion string, jsonLoad
 
 	v.BranchVersion = branchVersion
 
+	if v.Policy, err = loadPolicy(ctx, d.RootFs); err != nil {
+		return nil, err
+	}
+
 	// Calculate the min and maximum versions allowed for the current branch version lifecycle
 	if err := v.getMinMaxVersionInts(); err != nil {
 		return nil, err
@@ -93,15 +99,15 @@ func loadFromJSON(ctx context.Context, fs billy.Filesystem) (*VersionRules, erro
 	return vr, nil
 }
 
-// Current lifecycle rules are:
+// The default lifecycle rule is:
 //
-//	Branch can only hold until 2 previous versions of the current branch version.
+//	Branch can only hold until the previous versions of the current branch version given by the policy (2 by default).
 //	Branch cannot hold versions from newer branches, only older ones.
 //
-// See CheckChartVersionForLifecycle() for more details.
+// See Evaluate() for more details.
 func (v *VersionRules) getMinMaxVersionInts() error {
 	// e.g: 2.9 - 0.2 = 2.7
-	minVersionStr := v.Rules[(branchVersionMinorSum(v.BranchVersion, -2))].Min
+	minVersionStr := v.Rules[(branchVersionMinorSum(v.BranchVersion, -v.Policy.previousBranches()))].Min
 	maxVersionStr := v.Rules[v.BranchVersion].Max
 
 	var err error
@@ -122,9 +128,26 @@ func (v *VersionRules) getMinMaxVersionInts() error {
 
 	v.MinVersion = min
 	v.MaxVersion = max
+	if err := v.resolvePolicyBranches(); err != nil {
+		return fmt.Errorf("invalid lifecycle policy %s: %w", path.LifecyclePolicyFile, err)
+	}
 	return nil
 }
 
+// minVersionInt returns the major of the minimum version of the branch version previousBranches minor versions before the current one,
+// or an error if that branch version is not defined in the rules
+func (v *VersionRules) minVersionInt(previousBranches int) (int, error) {
+	branchVersion := branchVersionMinorSum(v.BranchVersion, -previousBranches)
+	rule, ok := v.Rules[branchVersion]
+	if !ok {
+		return 0, fmt.Errorf("branch version %s, %d before %s, is not defined in the rules", branchVersion, previousBranches, v.BranchVersion)
+	}
+	if rule.Min == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(strings.Split(rule.Min, ".")[0])
+}
+
 // convertBranchVersion will convert the received string flag into a float32
 func convertBranchVersion(branchVersion string) (float32, error) {
 	floatVersion, err := strconv.ParseFloat(branchVersion, 32)
@@ -141,23 +164,13 @@ func ExtractBranchVersion(branch string) string {
 }
 
 // CheckChartVersionForLifecycle will
-// Check if the chart version is within the range of the current version:
+// Check if the chart version is in the lifecycle of the current branch version according to the policy:
+//
+//	If the chart version is in the lifecycle, return true, otherwise return false
 //
-//	If the chart version is within the range, return true, otherwise return false
-func (v *VersionRules) CheckChartVersionForLifecycle(chartVersion string) bool {
-	chartVersionInt, _ := strconv.Atoi(strings.Split(chartVersion, ".")[0])
-	/**
-	Rule Example:
-	Branch version: 2.9
-	Min version: 104
-	Max version: 105
-	Therefore, the chart version must be >= (104 - 2) and < 105
-	i.e: 102 <= chartVersion < 105
-	*/
-	if chartVersionInt >= v.MinVersion && chartVersionInt < v.MaxVersion {
-		return true
-	}
-	return false
+// See Evaluate() for the rule that decided.
+func (v *VersionRules) CheckChartVersionForLifecycle(chart, chartVersion string) bool {
+	return v.Evaluate(chart, chartVersion).InLifecycle
 }
 
 // CheckChartVersionToRelease will return if the current versyion being analyzed is the one to be released or not
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/lmittmann/tint"
+)
+
+const (
+	// FormatText prints log records as colored lines for humans
+	FormatText = "text"
+	// FormatJSON prints log records as one JSON object per line
+	FormatJSON = "json"
+)
+
+var (
+	formatMu sync.Mutex
+	format   = FormatText
+)
+
+// Options configures the default logger
+type Options struct {
+	// Format is FormatText or FormatJSON
+	Format string
+	// Level is the minimum level of the records that are logged
+	Level slog.Level
+	// Console receives the records in color when the format is text; nil disables it
+	Console io.Writer
+	// File receives a copy of every record without colors; nil disables it
+	File io.Writer
+}
+
+// Setup makes the default logger write to the console and to the file of the options, in the format of the options.
+// Every record carries the attributes added to its context by WithAttrs.
+func Setup(opts Options) error {
+	if opts.Format == "" {
+		opts.Format = FormatText
+	}
+	if opts.Format != FormatText && opts.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q: must be one of text or json", opts.Format)
+	}
+	formatMu.Lock()
+	format = opts.Format
+	formatMu.Unlock()
+
+	var handlers []slog.Handler
+	if opts.Console != nil {
+		handlers = append(handlers, newHandler(opts.Console, opts.Format, opts.Level, true))
+	}
+	if opts.File != nil {
+		handlers = append(handlers, newHandler(opts.File, opts.Format, opts.Level, false))
+	}
+	slog.SetDefault(slog.New(teeHandler(handlers)))
+	return nil
+}
+
+// NewHandler returns a handler that writes records of at least the given level to w, without colors,
+// in the format of the default logger. It is meant for files written alongside the default logger.
+func NewHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	return newHandler(w, format, level, false)
+}
+
+func newHandler(w io.Writer, format string, level slog.Leveler, color bool) slog.Handler {
+	var h slog.Handler
+	if format == FormatJSON {
+		h = slog.NewJSONHandler(w, &slog.HandlerOptions{AddSource: true, Level: level})
+	} else {
+		h = tint.NewHandler(w, &tint.Options{AddSource: true, Level: level, TimeFormat: "15:04:05", NoColor: !color})
+	}
+	return contextHandler{h}
+}
+
+// contextHandler adds the attributes of the context of each record to the record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// teeHandler sends every record to each of its handlers
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Setup(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		format = FormatText
+	})
+
+	var console, file bytes.Buffer
+	require.NoError(t, Setup(Options{Format: FormatJSON, Level: slog.LevelInfo, Console: &console, File: &file}))
+
+	ctx := WithPackage(context.Background(), "rancher-monitoring")
+	ctx = WithChart(ctx, "rancher-monitoring-crd", "104.0.0")
+	ctx = WithChart(ctx, "rancher-monitoring", "104.1.0")
+	Log(ctx, slog.LevelError, "failed to export chart", slog.String("path", "charts"))
+	Log(ctx, slog.LevelDebug, "filtered out by the level")
+
+	assert.Equal(t, console.String(), file.String())
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	require.Len(t, lines, 1)
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "failed to export chart", record["msg"])
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "charts", record["path"])
+	assert.Equal(t, "rancher-monitoring", record["package"])
+	// the attributes of the context are replaced by the ones with the same key that were added later
+	assert.Equal(t, "rancher-monitoring", record["chart"])
+	assert.Equal(t, "104.1.0", record["version"])
+
+	// other handlers use the same format
+	var other bytes.Buffer
+	slog.New(NewHandler(&other, slog.LevelDebug)).InfoContext(ctx, "lifecycle")
+	assert.True(t, json.Valid(other.Bytes()))
+	assert.Contains(t, other.String(), `"package":"rancher-monitoring"`)
+
+	assert.Error(t, Setup(Options{Format: "xml"}))
+}
+
+func Test_Setup_text(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	var file bytes.Buffer
+	require.NoError(t, Setup(Options{Level: slog.LevelInfo, File: &file}))
+	Log(WithPackage(context.Background(), "fleet"), slog.LevelWarn, "skipping package")
+
+	// files have no colors
+	assert.NotContains(t, file.String(), "\x1b[")
+	assert.Contains(t, file.String(), "WRN")
+	assert.Contains(t, file.String(), "skipping package package=fleet")
+}
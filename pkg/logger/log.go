@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"runtime"
+	"slices"
 	"time"
 )
 
@@ -26,6 +27,31 @@ func Log(ctx context.Context, lvl slog.Level, msg string, attrs ...slog.Attr) {
 	logger.Handler().Handle(ctx, record)
 }
 
+type attrsKey struct{}
+
+// WithAttrs returns a context under which every record logged carries the given attributes, see Setup.
+// An attribute replaces the one with the same key that was already in the context.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	for _, attr := range existing {
+		if !slices.ContainsFunc(attrs, func(a slog.Attr) bool { return a.Key == attr.Key }) {
+			merged = append(merged, attr)
+		}
+	}
+	return context.WithValue(ctx, attrsKey{}, append(merged, attrs...))
+}
+
+// WithPackage returns a context under which every record logged carries the name of the package
+func WithPackage(ctx context.Context, name string) context.Context {
+	return WithAttrs(ctx, slog.String("package", name))
+}
+
+// WithChart returns a context under which every record logged carries the name and the version of the chart
+func WithChart(ctx context.Context, name, version string) context.Context {
+	return WithAttrs(ctx, slog.String("chart", name), slog.String("version", version))
+}
+
 // Err - log error with a message
 func Err(err error) slog.Attr {
 	return slog.Any("error", err)
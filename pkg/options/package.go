@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
@@ -37,6 +38,8 @@ type ChartOptions struct {
 	IgnoreDependencies []string `yaml:"ignoreDependencies"`
 	// ReplacePaths marks paths as those that should be replaced instead of patches. Consequently, these paths will exist in both generated-changes/excludes and generated-changes/overlay
 	ReplacePaths []string `yaml:"replacePaths"`
+	// YamlPatchPaths marks YAML files whose changes should be stored as JSON Patch operations in generated-changes/yamlpatch instead of patches
+	YamlPatchPaths []string `yaml:"yamlPatchPaths,omitempty"`
 }
 
 // UpstreamOptions represents the options presented to users to define where the upstream Helm chart is located
@@ -49,6 +52,28 @@ type UpstreamOptions struct {
 	Commit *string `yaml:"commit,omitempty"`
 	// ChartRepoBranch represents a specific branch to pull from a upstream remote repository
 	ChartRepoBranch *string `yaml:"chartRepoBranch,omitempty"`
+	// Digest represents the expected sha256 digest (sha256:<hex>) of the archive or OCI manifest pointed to by the URL
+	Digest *string `yaml:"digest,omitempty"`
+	// HelmRepository represents a classic Helm HTTP repository to pull the chart from, resolved through its index.yaml
+	HelmRepository *HelmRepositoryOptions `yaml:"helmRepository,omitempty"`
+	// Provenance requires the archive pointed to by the URL to have a valid provenance file at the URL followed by .prov
+	Provenance *ProvenanceOptions `yaml:"provenance,omitempty"`
+}
+
+// ProvenanceOptions represents how to verify the provenance file of an upstream archive
+type ProvenanceOptions struct {
+	// Keyring is the path, relative to the root of the repository, of the keyring holding the public keys trusted to sign the archive
+	Keyring string `yaml:"keyring"`
+}
+
+// HelmRepositoryOptions represents a chart published on a classic Helm HTTP repository
+type HelmRepositoryOptions struct {
+	// RepoURL is the URL of the Helm repository that serves the index.yaml
+	RepoURL string `yaml:"repoURL"`
+	// Chart is the name of the chart within the Helm repository
+	Chart string `yaml:"chart"`
+	// Version is a semver version or constraint (e.g. ~1.2.0). The newest matching version is pulled; if empty, the latest stable version is pulled
+	Version string `yaml:"version,omitempty"`
 }
 
 // AdditionalChartOptions represent the options presented to users to be able to configure the way an additional chart is built using these scripts
@@ -63,6 +88,8 @@ type AdditionalChartOptions struct {
 	IgnoreDependencies []string `yaml:"ignoreDependencies"`
 	// ReplacePaths marks paths as those that should be replaced instead of patches. Consequently, these paths will exist in both generated-changes/excludes and generated-changes/overlay
 	ReplacePaths []string `yaml:"replacePaths"`
+	// YamlPatchPaths marks YAML files whose changes should be stored as JSON Patch operations in generated-changes/yamlpatch instead of patches
+	YamlPatchPaths []string `yaml:"yamlPatchPaths,omitempty"`
 }
 
 // CRDChartOptions represent any options that are configurable for CRD charts
@@ -88,6 +115,23 @@ type ChartsScriptOptions struct {
 	// OmitBuildMetadataOnExport instructs the scripts to not add in a +up build metadata flag for forked charts
 	// If false, any forked chart whose version differs from the original source version will have the version VERSION+upORIGINAL_VERSION
 	OmitBuildMetadataOnExport bool `yaml:"omitBuildMetadataOnExport"`
+	// Credentials represent how to authenticate against the hosts that serve private upstreams
+	Credentials []HostCredentials `yaml:"credentials,omitempty"`
+}
+
+// HostCredentials represents how to authenticate against a single host.
+// Secrets are never stored in the configuration file, only the names of the environment variables that hold them
+type HostCredentials struct {
+	// Host is the hostname the credentials apply to (e.g. gitlab.example.com)
+	Host string `yaml:"host"`
+	// Username is the username to authenticate with; UsernameEnv takes precedence if set
+	Username string `yaml:"username,omitempty"`
+	// UsernameEnv is the environment variable that holds the username
+	UsernameEnv string `yaml:"usernameEnv,omitempty"`
+	// PasswordEnv is the environment variable that holds the password
+	PasswordEnv string `yaml:"passwordEnv,omitempty"`
+	// TokenEnv is the environment variable that holds an access token
+	TokenEnv string `yaml:"tokenEnv,omitempty"`
 }
 
 // HelmRepoConfiguration represents the configuration of the Helm Repository that exposes your charts
@@ -95,6 +139,21 @@ type HelmRepoConfiguration struct {
 	CNAME string `yaml:"cname"`
 }
 
+// DefaultCNAME is the host of the Helm Repository when the configuration has no CNAME
+const DefaultCNAME = "charts.rancher.io"
+
+// URL returns the URL the Helm Repository is served at: https://<CNAME>, or the CNAME itself if it has a scheme
+func (h HelmRepoConfiguration) URL() string {
+	cname := h.CNAME
+	if cname == "" {
+		cname = DefaultCNAME
+	}
+	if !strings.Contains(cname, "://") {
+		cname = "https://" + cname
+	}
+	return strings.TrimSuffix(cname, "/")
+}
+
 // LoadPackageOptionsFromFile unmarshalls the struct found at the file to YAML and reads it into memory
 func LoadPackageOptionsFromFile(ctx context.Context, fs billy.Filesystem, path string) (PackageOptions, error) {
 	var packageOptions PackageOptions
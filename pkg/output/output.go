@@ -0,0 +1,149 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the format reports are printed in
+type Format string
+
+const (
+	// FormatTable prints reports as a table for humans
+	FormatTable Format = "table"
+	// FormatJSON prints reports as indented JSON
+	FormatJSON Format = "json"
+	// FormatYAML prints reports as YAML
+	FormatYAML Format = "yaml"
+	// FormatMarkdown prints reports as Markdown, e.g. for release notes or pull request comments
+	FormatMarkdown Format = "markdown"
+	// FormatHTML prints reports as a standalone HTML page, e.g. to be published for release managers
+	FormatHTML Format = "html"
+)
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatTable, FormatJSON, FormatYAML, FormatMarkdown, FormatHTML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q: must be one of table, json, yaml, markdown or html", name)
+	}
+}
+
+// Report is a result of a command that can be printed in any format.
+// JSON and YAML are both encoded from the json tags of the report, so that they share the same schema.
+type Report interface {
+	// Header returns the titles of the columns of the table
+	Header() []string
+	// Rows returns the rows of the table, each with as many cells as the header
+	Rows() [][]string
+}
+
+// MarkdownReport is a report with its own Markdown rendering; other reports are printed as a Markdown table
+type MarkdownReport interface {
+	Report
+	// Markdown returns the report as a Markdown document
+	Markdown() string
+}
+
+// HTMLReport is a report with its own HTML rendering; other reports are printed as an HTML table
+type HTMLReport interface {
+	Report
+	// HTML writes the report as a standalone HTML page
+	HTML(w io.Writer) error
+}
+
+// Print writes the report to w in the given format
+func Print(w io.Writer, format Format, report Report) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case FormatYAML:
+		data, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(report.Header(), "\t"))
+		for _, row := range report.Rows() {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case FormatMarkdown:
+		if r, ok := report.(MarkdownReport); ok {
+			_, err := io.WriteString(w, r.Markdown())
+			return err
+		}
+		_, err := io.WriteString(w, MarkdownTable(report.Header(), report.Rows()))
+		return err
+	case FormatHTML:
+		if r, ok := report.(HTMLReport); ok {
+			return r.HTML(w)
+		}
+		return htmlTable.Execute(w, report)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// ListRows returns a row made of kind, the key and its comma-separated values for each key of lists, sorted by key
+func ListRows(kind string, lists map[string][]string) [][]string {
+	keys := make([]string, 0, len(lists))
+	for key := range lists {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []string{kind, key, strings.Join(lists[key], ", ")})
+	}
+	return rows
+}
+
+// MarkdownTable returns a Markdown table with the given header and rows, escaping the pipes of the cells
+func MarkdownTable(header []string, rows [][]string) string {
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for i, cell := range cells {
+			escaped[i] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		b.WriteString("| " + strings.Join(escaped, " | ") + " |\n")
+	}
+	writeRow(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return b.String()
+}
+
+// htmlTable prints a report as an HTML page with a table with the same columns as FormatTable
+var htmlTable = template.Must(template.New("table").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"></head>
+<body>
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
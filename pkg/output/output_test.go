@@ -0,0 +1,110 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testReport struct {
+	Charts map[string][]string `json:"charts"`
+}
+
+func (r testReport) Header() []string {
+	return []string{"KIND", "CHART", "VERSIONS"}
+}
+
+func (r testReport) Rows() [][]string {
+	return ListRows("chart", r.Charts)
+}
+
+func Test_Print(t *testing.T) {
+	report := testReport{Charts: map[string][]string{
+		"rancher-monitoring": {"104.1.0", "104.0.0"},
+		"fleet":              {"105.0.0"},
+	}}
+
+	tests := []struct {
+		name   string
+		format Format
+		want   string
+	}{
+		{
+			name:   "table",
+			format: FormatTable,
+			want: `KIND   CHART               VERSIONS
+chart  fleet               105.0.0
+chart  rancher-monitoring  104.1.0, 104.0.0
+`,
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			want: `{
+  "charts": {
+    "fleet": [
+      "105.0.0"
+    ],
+    "rancher-monitoring": [
+      "104.1.0",
+      "104.0.0"
+    ]
+  }
+}
+`,
+		},
+		{
+			name:   "yaml",
+			format: FormatYAML,
+			want: `charts:
+  fleet:
+  - 105.0.0
+  rancher-monitoring:
+  - 104.1.0
+  - 104.0.0
+`,
+		},
+		{
+			name:   "markdown",
+			format: FormatMarkdown,
+			want: `| KIND | CHART | VERSIONS |
+| --- | --- | --- |
+| chart | fleet | 105.0.0 |
+| chart | rancher-monitoring | 104.1.0, 104.0.0 |
+`,
+		},
+		{
+			name:   "html",
+			format: FormatHTML,
+			want: `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"></head>
+<body>
+<table>
+<tr><th>KIND</th><th>CHART</th><th>VERSIONS</th></tr>
+<tr><td>chart</td><td>fleet</td><td>105.0.0</td></tr>
+<tr><td>chart</td><td>rancher-monitoring</td><td>104.1.0, 104.0.0</td></tr>
+</table>
+</body>
+</html>
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, Print(&buf, tt.format, report))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func Test_ParseFormat(t *testing.T) {
+	format, err := ParseFormat("JSON")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
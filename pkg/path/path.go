@@ -41,6 +41,9 @@ const (
 	// GeneratedChangesPatchDir is a directory that contains patches within GeneratedChangesDir
 	GeneratedChangesPatchDir = "patch"
 
+	// GeneratedChangesYamlPatchDir is a directory that contains YAML patches (JSON Patch operations on YAML documents) within GeneratedChangesDir
+	GeneratedChangesYamlPatchDir = "yamlpatch"
+
 	// DependencyOptionsFile is a file that contains information about how to prepare your dependency
 	// The expected structure of this file is one that can be marshalled into a ChartOptions struct
 	DependencyOptionsFile = "dependency.yaml"
@@ -60,6 +63,9 @@ const (
 	// DefaultCachePath represents the default place to put a cache on pulled values
 	DefaultCachePath = ".charts-build-scripts/.cache"
 
+	// BuildStateFile is the file that records the inputs and the assets of the last export of each package
+	BuildStateFile = ".charts-build-scripts/build-state.json"
+
 	// RepositoryLogosDir is a directory on your Staging/Live branch that contains the files with the logos of each chart
 	RepositoryLogosDir = "assets/logos"
 
@@ -72,6 +78,9 @@ const (
 	// VersionRulesFile is the file that contains the version rules for the current branch on charts-build-scripts
 	VersionRulesFile = "config/version_rules.json"
 
+	// LifecyclePolicyFile is the file that contains the chart rules and exceptions of the lifecycle on top of the version rules
+	LifecyclePolicyFile = "config/lifecycle_policy.yaml"
+
 	// RepositoryStateFile is a file to hold the current status of the released and developed assets versions
 	RepositoryStateFile = "config/state.json"
 
@@ -7,6 +7,8 @@ import (
 	"os"
 
 	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
@@ -20,16 +22,71 @@ type Archive struct {
 	URL string `yaml:"url"`
 	// Subdirectory represents a specific directory within the upstream pointed to by the URL to treat as the root
 	Subdirectory *string `yaml:"subdirectory"`
+	// Digest represents the expected sha256 digest of the archive
+	Digest *string `yaml:"digest"`
+	// Provenance, if set, requires the archive to have a valid provenance file at the URL followed by .prov
+	Provenance *options.ProvenanceOptions `yaml:"provenance"`
 }
 
-// Pull grabs the archive
+// CacheKey returns the key to use for caching, made of the URL, the digest and the keyring if provenance is required,
+// so that an archive cached without verification is never served to an upstream that requires it.
+// It is empty if the archive is not pinned by a digest, since another archive can be published at the same URL.
+func (u Archive) CacheKey() string {
+	if u.Digest == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s@%s", u.offlineCacheKey(), normalizeDigest(*u.Digest))
+}
+
+// OfflineCacheKey returns the key the archive is served from in offline mode
+func (u Archive) OfflineCacheKey() string {
+	if u.Digest != nil {
+		return u.CacheKey()
+	}
+	return u.offlineCacheKey()
+}
+
+// offlineCacheKey returns the key made of the URL and the keyring if provenance is required
+func (u Archive) offlineCacheKey() string {
+	key := "archive:" + u.String()
+	if u.Provenance != nil {
+		key = fmt.Sprintf("%s[provenance=%s]", key, u.Provenance.Keyring)
+	}
+	return key
+}
+
+// Pull grabs the archive, unless it is already cached
 func (u Archive) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path string) error {
-	logger.Log(ctx, slog.LevelInfo, "pulling from upstream", slog.String("URL", u.URL), slog.String("path", path))
+	pull := func() error {
+		return u.pull(ctx, rootFs, fs, path)
+	}
+	if u.Digest == nil {
+		// the archive can change at the same URL, the last pull is only served in offline mode
+		return pullWithAlias(ctx, u.OfflineCacheKey(), fs, path, pull)
+	}
+	return pullWithCache(ctx, u.CacheKey(), fs, path, pull)
+}
 
-	if err := filesystem.GetChartArchive(fs, u.URL, chartArchiveFilepath); err != nil {
+// pull downloads the archive and unpacks it into the path
+func (u Archive) pull(ctx context.Context, rootFs, fs billy.Filesystem, path string) error {
+	logger.Log(ctx, slog.LevelInfo, "pulling from upstream", slog.String("URL", credentials.RedactURL(u.URL)), slog.String("path", path))
+
+	if err := filesystem.GetChartArchiveWithClient(credentials.HTTPClient(), fs, u.URL, chartArchiveFilepath); err != nil {
 		return err
 	}
 	defer fs.Remove(chartArchiveFilepath)
+	archive, err := util.ReadFile(fs, chartArchiveFilepath)
+	if err != nil {
+		return err
+	}
+	if err := checkDigest(ctx, u.URL, u.Digest, sha256Digest(archive)); err != nil {
+		return err
+	}
+	if u.Provenance != nil {
+		if err := verifyProvenance(ctx, rootFs, u.URL, u.Provenance.Keyring, archive); err != nil {
+			return err
+		}
+	}
 	if err := fs.MkdirAll(path, os.ModePerm); err != nil {
 		return err
 	}
@@ -47,7 +104,9 @@ func (u Archive) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path str
 // GetOptions returns the path used to construct this upstream
 func (u Archive) GetOptions() options.UpstreamOptions {
 	return options.UpstreamOptions{
-		URL: u.URL,
+		URL:        u.URL,
+		Digest:     u.Digest,
+		Provenance: u.Provenance,
 	}
 }
 
@@ -2,50 +2,114 @@ package puller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 )
 
+const (
+	// cacheIndexFile tracks every entry of the cache, relative to the cache path
+	cacheIndexFile = "index.json"
+	// cacheObjectsDir holds the content of every entry of the cache, relative to the cache path
+	cacheObjectsDir = "objects"
+)
+
 // RootCache is the cache at the root of the repository
 var RootCache cacher = &noopCache{}
 
-// InitRootCache initializes a cache at the repository's root to be used, if it does not currently exist
-func InitRootCache(ctx context.Context, repoRoot string, cacheMode bool, path string) error {
+// OfflineMode indicates that every upstream must be served from the RootCache without reaching the network
+var OfflineMode = false
+
+// NotCachedError is returned in offline mode when upstreams are missing from the cache
+type NotCachedError struct {
+	// Keys are the cache keys that are missing
+	Keys []string
+}
+
+func (e *NotCachedError) Error() string {
+	return fmt.Sprintf("not cached: %d upstream(s) missing from the cache in offline mode, run cache-warm on a host with network access: %s", len(e.Keys), strings.Join(e.Keys, ", "))
+}
+
+// OfflineCacheKeyer is implemented by pullers that can be served from the cache in offline mode
+type OfflineCacheKeyer interface {
+	// OfflineCacheKey returns the key the upstream is served from in offline mode; it must be computed without reaching the network
+	OfflineCacheKey() string
+}
+
+// CheckCached returns a NotCachedError listing every upstream that cannot be served from the RootCache.
+// Upstreams that do not need the network (e.g. local charts) are ignored.
+func CheckCached(ctx context.Context, upstreams []Puller) error {
+	var missing []string
+	for _, upstream := range upstreams {
+		keyer, ok := upstream.(OfflineCacheKeyer)
+		if !ok {
+			continue
+		}
+		key := keyer.OfflineCacheKey()
+		if !RootCache.Has(ctx, key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return &NotCachedError{Keys: missing}
+	}
+	return nil
+}
+
+// InitRootCache initializes a cache at the repository's root to be used, if it does not currently exist.
+// Once the entries of the cache take more than maxSize bytes, the least recently used ones are evicted; a maxSize of 0 disables the limit.
+func InitRootCache(ctx context.Context, repoRoot string, cacheMode bool, path string, maxSize int64) error {
 	if !cacheMode {
 		return nil
 	}
 
-	logger.Log(ctx, slog.LevelInfo, "setting up cache", slog.String("path", path))
-	// Get repository filesystem
-	rootFs := filesystem.GetFilesystem(repoRoot)
-
-	// Instantiate cache
-	if err := rootFs.MkdirAll(path, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create cache directory at %s/%s: %s", rootFs.Root(), path, err)
-	}
-	cacheFs, err := rootFs.Chroot(path)
+	logger.Log(ctx, slog.LevelInfo, "setting up cache", slog.String("path", path), slog.Int64("maxSize", maxSize))
+	c, err := openCache(repoRoot, path)
 	if err != nil {
-		return fmt.Errorf("failed to get cacheFs based on cache in %s/%s: %s", rootFs.Root(), path, err)
-	}
-	RootCache = &cache{
-		rootFs:  rootFs,
-		cacheFs: cacheFs,
+		return err
 	}
+	c.maxSize = maxSize
+	RootCache = c
 	return nil
 }
 
-// CleanRootCache removes any existing entries in the cache
-func CleanRootCache(ctx context.Context, repoRoot string, path string) error {
+// CleanRootCache removes any existing entries in the cache.
+// If olderThan is set, only the entries that have not been used for that long are removed.
+func CleanRootCache(ctx context.Context, repoRoot string, path string, olderThan time.Duration) error {
 	rootFs := filesystem.GetFilesystem(repoRoot)
-	if err := filesystem.RemoveAll(rootFs, path); err != nil {
+	if olderThan == 0 {
+		if err := filesystem.RemoveAll(rootFs, path); err != nil {
+			return err
+		}
+		return filesystem.PruneEmptyDirsInPath(ctx, rootFs, path)
+	}
+	exists, err := filesystem.PathExists(ctx, rootFs, path)
+	if err != nil || !exists {
 		return err
 	}
-	return filesystem.PruneEmptyDirsInPath(ctx, rootFs, path)
+	c, err := openCache(repoRoot, path)
+	if err != nil {
+		return err
+	}
+	removed, err := c.Prune(ctx, olderThan)
+	if err != nil {
+		return err
+	}
+	logger.Log(ctx, slog.LevelInfo, "cleaned cache", slog.Int("removed", removed), slog.Duration("olderThan", olderThan))
+	return nil
 }
 
 type cacher interface {
@@ -56,6 +120,18 @@ type cacher interface {
 	// Get gets the value of key from the cache and places it at the path in fs
 	// If it does not exist, it return false
 	Get(ctx context.Context, key string, fs billy.Filesystem, path string) (bool, error)
+
+	// Prune removes every entry that has not been used within the duration and returns how many were removed
+	Prune(ctx context.Context, olderThan time.Duration) (int, error)
+
+	// Has returns whether there is an entry for the key
+	Has(ctx context.Context, key string) bool
+
+	// IsEnabled returns whether entries are actually stored, so that callers can skip work only needed to compute keys
+	IsEnabled() bool
+
+	// Size returns the sum of the size of every entry, in bytes
+	Size() int64
 }
 
 // noopCache doesn't do anything
@@ -71,29 +147,185 @@ func (c *noopCache) Get(ctx context.Context, key string, fs billy.Filesystem, pa
 	return false, nil
 }
 
-// cache stores contents at the root of wherever cacheFs points to
+// Prune does not do anything
+func (c *noopCache) Prune(ctx context.Context, olderThan time.Duration) (int, error) {
+	return 0, nil
+}
+
+// Has returns false
+func (c *noopCache) Has(ctx context.Context, key string) bool {
+	return false
+}
+
+// IsEnabled returns false
+func (c *noopCache) IsEnabled() bool {
+	return false
+}
+
+// Size returns 0
+func (c *noopCache) Size() int64 {
+	return 0
+}
+
+// pullWithCache places the cached contents of key at path, or calls pull and caches what it placed at path.
+// An empty key disables caching. In offline mode, pull is never called.
+func pullWithCache(ctx context.Context, key string, fs billy.Filesystem, path string, pull func() error) error {
+	if OfflineMode && len(key) == 0 {
+		return errors.New("upstream cannot be served from the cache in offline mode")
+	}
+	if len(key) > 0 {
+		pulledFromCache, err := RootCache.Get(ctx, key, fs, path)
+		if err != nil {
+			return err
+		}
+		if pulledFromCache {
+			logger.Log(ctx, slog.LevelInfo, "pulled from cache", slog.String("key", key), slog.String("path", path))
+			return nil
+		}
+		if OfflineMode {
+			return &NotCachedError{Keys: []string{key}}
+		}
+	}
+
+	if err := pull(); err != nil {
+		return err
+	}
+
+	if len(key) > 0 {
+		addedToCache, err := RootCache.Add(ctx, key, fs, path)
+		if err != nil {
+			return err
+		}
+		if addedToCache {
+			logger.Log(ctx, slog.LevelInfo, "cached", slog.String("key", key), slog.String("path", path))
+		}
+	}
+	return nil
+}
+
+// pullWithAlias is used for upstreams whose content can change under the same name (e.g. the head of a branch).
+// pull is always called when online, and its result is stored under the alias so that it can be served in offline mode.
+func pullWithAlias(ctx context.Context, alias string, fs billy.Filesystem, path string, pull func() error) error {
+	if OfflineMode {
+		return pullWithCache(ctx, alias, fs, path, pull)
+	}
+	if err := pull(); err != nil {
+		return err
+	}
+	if RootCache.IsEnabled() {
+		if _, err := RootCache.Add(ctx, alias, fs, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheIndex tracks the entries stored in the cache, keyed by their content address
+type cacheIndex struct {
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+// cacheEntry describes a single directory stored in the cache
+type cacheEntry struct {
+	// Key is the key the entry was added with (e.g. URL plus digest or version)
+	Key string `json:"key"`
+	// Size is the sum of the size of every file in the entry, in bytes
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// cache is a content-addressed store: each key is hashed and its contents are stored under objects/<hash>.
+// The index file keeps track of the size and last use of every entry, which allows LRU eviction.
 type cache struct {
 	rootFs  billy.Filesystem
 	cacheFs billy.Filesystem
+	// maxSize is the maximum size of all entries in bytes; 0 means unlimited
+	maxSize int64
+	now     func() time.Time
+
+	// mu guards the index since packages can be pulled concurrently
+	mu    sync.Mutex
+	index cacheIndex
+}
+
+// openCache creates the cache directory if needed and loads its index
+func openCache(repoRoot string, path string) (*cache, error) {
+	// Get repository filesystem
+	rootFs := filesystem.GetFilesystem(repoRoot)
+
+	// Instantiate cache
+	if err := rootFs.MkdirAll(path, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory at %s/%s: %s", rootFs.Root(), path, err)
+	}
+	cacheFs, err := rootFs.Chroot(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cacheFs based on cache in %s/%s: %s", rootFs.Root(), path, err)
+	}
+	c := &cache{
+		rootFs:  rootFs,
+		cacheFs: cacheFs,
+		now:     time.Now,
+		index:   cacheIndex{Entries: map[string]*cacheEntry{}},
+	}
+	if err := c.loadIndex(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Has returns whether there is an entry for the key
+func (c *cache) Has(ctx context.Context, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	address := contentAddress(key)
+	if _, ok := c.index.Entries[address]; !ok {
+		return false
+	}
+	exists, err := filesystem.PathExists(ctx, c.cacheFs, objectPath(address))
+	return err == nil && exists
+}
+
+// IsEnabled returns true
+func (c *cache) IsEnabled() bool {
+	return true
 }
 
-// Add copies the contents of the path in fs to the path specified by key in the cacheFs
+// Size returns the sum of the size of every entry, in bytes
+func (c *cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total int64
+	for _, entry := range c.index.Entries {
+		total += entry.Size
+	}
+	return total
+}
+
+// Add copies the contents of the path in fs to the content address of key in the cacheFs
 func (c *cache) Add(ctx context.Context, key string, fs billy.Filesystem, path string) (bool, error) {
 	if len(key) == 0 {
 		// cannot cache without key
 		return false, nil
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	address := contentAddress(key)
+	entryPath := objectPath(address)
 	// Get paths from perspective of rootFs
 	rootPath, err := c.getRootPath(ctx, fs, path)
 	if err != nil {
 		return false, err
 	}
-	rootCacheKeyPath, err := c.getRootPath(ctx, c.cacheFs, key)
+	rootCacheKeyPath, err := c.getRootPath(ctx, c.cacheFs, entryPath)
 	if err != nil {
 		return false, err
 	}
-	// Remove any existing keys at that path
-	if err := c.removeKey(ctx, key); err != nil {
+	// Remove any existing entry at that address
+	if err := c.removeEntry(address); err != nil {
 		return false, err
 	}
 	// Figure out if you are adding a directory or a file
@@ -106,51 +338,117 @@ func (c *cache) Add(ctx context.Context, key string, fs billy.Filesystem, path s
 		return false, fmt.Errorf("cannot cache directory located at %s: caching files is not supported", filesystem.GetAbsPath(fs, path))
 	}
 	// Perform copying
-	err = filesystem.CopyDir(ctx, c.rootFs, rootPath, rootCacheKeyPath)
+	if err := filesystem.CopyDir(ctx, c.rootFs, rootPath, rootCacheKeyPath); err != nil {
+		return false, err
+	}
+	size, err := dirSize(filesystem.GetAbsPath(c.cacheFs, entryPath))
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	now := c.now()
+	c.index.Entries[address] = &cacheEntry{
+		Key:      key,
+		Size:     size,
+		Created:  now,
+		LastUsed: now,
+	}
+	if err := c.evict(ctx, address); err != nil {
+		return false, err
+	}
+	return true, c.saveIndex()
 }
 
+// Get copies the contents stored at the content address of key into the path in fs
 func (c *cache) Get(ctx context.Context, key string, fs billy.Filesystem, path string) (bool, error) {
 	if len(key) == 0 {
 		// cannot cache without key
 		return false, nil
 	}
-	// Check if cache entry exists
-	exists, err := filesystem.PathExists(ctx, c.cacheFs, key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	address := contentAddress(key)
+	entryPath := objectPath(address)
+	entry, ok := c.index.Entries[address]
+	if !ok {
+		// cache entry does not exist
+		return false, nil
+	}
+	// Check if cache entry still exists on disk
+	exists, err := filesystem.PathExists(ctx, c.cacheFs, entryPath)
 	if err != nil {
 		return false, fmt.Errorf("encountered error while trying to get key %s from cache: %s", key, err)
 	}
 	if !exists {
-		// cache entry does not exist
-		return false, nil
+		delete(c.index.Entries, address)
+		return false, c.saveIndex()
 	}
 	// Get paths from perspective of rootFs
 	rootPath, err := c.getRootPath(ctx, fs, path)
 	if err != nil {
 		return false, err
 	}
-	rootCacheKeyPath, err := c.getRootPath(ctx, c.cacheFs, key)
+	rootCacheKeyPath, err := c.getRootPath(ctx, c.cacheFs, entryPath)
 	if err != nil {
 		return false, err
 	}
-	// Ensure the key is a folder
-	rootCacheKeyFileInfo, err := c.cacheFs.Lstat(key)
-	if err != nil {
-		return false, fmt.Errorf("unable to get information about directory in path %s: %s", filesystem.GetAbsPath(c.cacheFs, key), err)
-	}
-	// Key is not a directory
-	if !rootCacheKeyFileInfo.IsDir() {
-		return false, fmt.Errorf("cannot retrieve non-directory located at %s: only retrieving directories from cache is supported", filesystem.GetAbsPath(c.cacheFs, key))
-	}
 	// Perform copying
-	err = filesystem.CopyDir(ctx, c.rootFs, rootCacheKeyPath, rootPath)
-	if err != nil {
+	if err := filesystem.CopyDir(ctx, c.rootFs, rootCacheKeyPath, rootPath); err != nil {
 		return false, err
 	}
-	return true, nil
+	entry.LastUsed = c.now()
+	return true, c.saveIndex()
+}
+
+// Prune removes every entry that has not been used within the duration
+func (c *cache) Prune(ctx context.Context, olderThan time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	threshold := c.now().Add(-olderThan)
+	removed := 0
+	for address, entry := range c.index.Entries {
+		if !entry.LastUsed.Before(threshold) {
+			continue
+		}
+		logger.Log(ctx, slog.LevelDebug, "removing cache entry", slog.String("key", entry.Key), slog.Time("lastUsed", entry.LastUsed))
+		if err := c.removeEntry(address); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, c.saveIndex()
+}
+
+// evict removes the least recently used entries until the cache fits within maxSize, never evicting the entry at keep
+func (c *cache) evict(ctx context.Context, keep string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	var total int64
+	addresses := make([]string, 0, len(c.index.Entries))
+	for address, entry := range c.index.Entries {
+		total += entry.Size
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return c.index.Entries[addresses[i]].LastUsed.Before(c.index.Entries[addresses[j]].LastUsed)
+	})
+	for _, address := range addresses {
+		if total <= c.maxSize {
+			break
+		}
+		if address == keep {
+			continue
+		}
+		entry := c.index.Entries[address]
+		logger.Log(ctx, slog.LevelDebug, "evicting cache entry", slog.String("key", entry.Key), slog.Int64("size", entry.Size))
+		if err := c.removeEntry(address); err != nil {
+			return err
+		}
+		total -= entry.Size
+	}
+	return nil
 }
 
 func (c *cache) getRootPath(ctx context.Context, fs billy.Filesystem, path string) (string, error) {
@@ -162,9 +460,62 @@ func (c *cache) getRootPath(ctx context.Context, fs billy.Filesystem, path strin
 	return rootPath, err
 }
 
-func (c *cache) removeKey(ctx context.Context, key string) error {
-	if err := filesystem.RemoveAll(c.cacheFs, key); err != nil {
-		return fmt.Errorf("unable to remove key %s from cache: %s", key, err)
+// removeEntry removes the contents and the index entry stored at the address
+func (c *cache) removeEntry(address string) error {
+	if err := filesystem.RemoveAll(c.cacheFs, objectPath(address)); err != nil {
+		return fmt.Errorf("unable to remove entry %s from cache: %s", address, err)
 	}
+	delete(c.index.Entries, address)
 	return nil
 }
+
+func (c *cache) loadIndex() error {
+	data, err := os.ReadFile(filesystem.GetAbsPath(c.cacheFs, cacheIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read cache index: %s", err)
+	}
+	if err := json.Unmarshal(data, &c.index); err != nil {
+		return fmt.Errorf("unable to parse cache index %s: %s", filesystem.GetAbsPath(c.cacheFs, cacheIndexFile), err)
+	}
+	if c.index.Entries == nil {
+		c.index.Entries = map[string]*cacheEntry{}
+	}
+	return nil
+}
+
+func (c *cache) saveIndex() error {
+	data, err := json.MarshalIndent(c.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filesystem.GetAbsPath(c.cacheFs, cacheIndexFile), data, 0644)
+}
+
+// contentAddress returns the address at which the contents of key are stored
+func contentAddress(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// objectPath returns the path of the contents stored at the address, relative to the cache path
+func objectPath(address string) string {
+	return filepath.Join(cacheObjectsDir, address[:2], address)
+}
+
+// dirSize returns the sum of the size of every file within the directory
+func dirSize(absPath string) (int64, error) {
+	var size int64
+	err := filepath.Walk(absPath, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
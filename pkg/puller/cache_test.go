@@ -0,0 +1,156 @@
+package puller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeChart creates a directory at path within the repository holding a single file of the given size
+func writeChart(t *testing.T, repoRoot, path string, size int) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Join(repoRoot, path), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(repoRoot, path, "Chart.yaml"), make([]byte, size), 0644))
+}
+
+func Test_cache(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	repoRoot := t.TempDir()
+	rootFs := filesystem.GetFilesystem(repoRoot)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c, err := openCache(repoRoot, ".cache")
+	assert.NoError(t, err)
+	c.now = func() time.Time { return now }
+	c.maxSize = 250
+
+	// adding and getting an entry places the same contents at the new path
+	writeChart(t, repoRoot, "pulled/a", 100)
+	added, err := c.Add(ctx, "archive:https://example.com/a-1.0.0.tgz", rootFs, "pulled/a")
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	found, err := c.Get(ctx, "archive:https://example.com/a-1.0.0.tgz", rootFs, "restored/a")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.FileExists(t, filepath.Join(repoRoot, "restored/a/Chart.yaml"))
+
+	found, err = c.Get(ctx, "archive:https://example.com/a-2.0.0.tgz", rootFs, "restored/a2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// b is added later and a is used after it, so b is the least recently used entry when c goes over the limit
+	now = now.Add(time.Hour)
+	writeChart(t, repoRoot, "pulled/b", 100)
+	_, err = c.Add(ctx, "archive:https://example.com/b-1.0.0.tgz", rootFs, "pulled/b")
+	assert.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	_, err = c.Get(ctx, "archive:https://example.com/a-1.0.0.tgz", rootFs, "restored/a-again")
+	assert.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	writeChart(t, repoRoot, "pulled/c", 100)
+	_, err = c.Add(ctx, "oci:oci://example.com/c:1.0.0", rootFs, "pulled/c")
+	assert.NoError(t, err)
+
+	assert.Len(t, c.index.Entries, 2)
+	assert.Equal(t, int64(200), c.Size())
+	assert.Contains(t, c.index.Entries, contentAddress("archive:https://example.com/a-1.0.0.tgz"))
+	assert.NotContains(t, c.index.Entries, contentAddress("archive:https://example.com/b-1.0.0.tgz"))
+	assert.NoDirExists(t, filepath.Join(repoRoot, ".cache", objectPath(contentAddress("archive:https://example.com/b-1.0.0.tgz"))))
+
+	// the index is persisted
+	reopened, err := openCache(repoRoot, ".cache")
+	assert.NoError(t, err)
+	assert.Equal(t, len(c.index.Entries), len(reopened.index.Entries))
+
+	// pruning only removes the entries that were not used recently
+	now = now.Add(90 * time.Minute)
+	removed, err := c.Prune(ctx, 2*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Len(t, c.index.Entries, 1)
+	assert.Contains(t, c.index.Entries, contentAddress("oci:oci://example.com/c:1.0.0"))
+}
+
+func Test_CacheKey(t *testing.T) {
+	digest := "sha256:0123"
+	subdirectory := "chart"
+
+	unprefixed := "0123"
+
+	// without a digest, the contents can change under the same URL: only the last pull is kept for offline mode
+	archive := Archive{URL: "https://example.com/chart.tgz"}
+	assert.Empty(t, archive.CacheKey())
+	assert.Equal(t, "archive:https://example.com/chart.tgz", archive.OfflineCacheKey())
+	assert.False(t, IsPinned(archive))
+	registry := Registry{URL: "oci://example.com/chart:1.0.0"}
+	assert.Empty(t, registry.CacheKey())
+	assert.Equal(t, "oci:oci://example.com/chart:1.0.0", registry.OfflineCacheKey())
+	assert.False(t, IsPinned(registry))
+
+	// the digest is the same with or without the sha256: prefix
+	archive = Archive{URL: "https://example.com/chart.tgz", Subdirectory: &subdirectory, Digest: &digest}
+	assert.Equal(t, "archive:https://example.com/chart.tgz[path=chart]@sha256:0123", archive.CacheKey())
+	assert.Equal(t, archive.CacheKey(), archive.OfflineCacheKey())
+	assert.Equal(t, archive.CacheKey(), Archive{URL: "https://example.com/chart.tgz", Subdirectory: &subdirectory, Digest: &unprefixed}.CacheKey())
+	assert.True(t, IsPinned(archive))
+	registry = Registry{URL: "oci://example.com/chart:1.0.0", Digest: &unprefixed}
+	assert.Equal(t, "oci:oci://example.com/chart:1.0.0@sha256:0123", registry.CacheKey())
+	assert.True(t, IsPinned(registry))
+}
+
+func Test_offline(t *testing.T) {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	repoRoot := t.TempDir()
+	rootFs := filesystem.GetFilesystem(repoRoot)
+
+	c, err := openCache(repoRoot, ".cache")
+	assert.NoError(t, err)
+	defaultRootCache := RootCache
+	RootCache = c
+	OfflineMode = true
+	defer func() {
+		RootCache = defaultRootCache
+		OfflineMode = false
+	}()
+
+	cached := HelmRepository{RepoURL: "https://charts.example.com", Chart: "cached"}
+	writeChart(t, repoRoot, "pulled/cached", 10)
+	_, err = c.Add(ctx, cached.OfflineCacheKey(), rootFs, "pulled/cached")
+	assert.NoError(t, err)
+
+	missingArchive := Archive{URL: "https://example.com/missing-1.0.0.tgz"}
+	branch := "main"
+	missingBranch, err := GetGitRepository(options.UpstreamOptions{URL: "https://gitlab.example.com/group/chart.git"}, &branch)
+	assert.NoError(t, err)
+	upstreams := []Puller{cached, missingArchive, missingBranch}
+
+	// every missing upstream is listed
+	err = CheckCached(ctx, upstreams)
+	var notCached *NotCachedError
+	assert.ErrorAs(t, err, &notCached)
+	assert.Equal(t, []string{missingArchive.OfflineCacheKey(), missingBranch.OfflineCacheKey()}, notCached.Keys)
+
+	// the network is never reached
+	pulled := false
+	pull := func() error {
+		pulled = true
+		return nil
+	}
+	assert.NoError(t, pullWithAlias(ctx, cached.OfflineCacheKey(), rootFs, "restored/cached", pull))
+	assert.FileExists(t, filepath.Join(repoRoot, "restored/cached/Chart.yaml"))
+	assert.ErrorAs(t, missingArchive.Pull(ctx, rootFs, rootFs, "restored/missing"), &notCached)
+	assert.Error(t, pullWithCache(ctx, "", rootFs, "restored/uncacheable", pull))
+	assert.False(t, pulled)
+}
@@ -0,0 +1,44 @@
+package puller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+)
+
+const sha256DigestPrefix = "sha256:"
+
+// sha256Digest returns the digest of data in the sha256:<hex> format
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return sha256DigestPrefix + hex.EncodeToString(sum[:])
+}
+
+// normalizeDigest returns the digest in the sha256:<hex> format, whether it was given with or without the prefix
+func normalizeDigest(digest string) string {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if !strings.HasPrefix(digest, sha256DigestPrefix) {
+		digest = sha256DigestPrefix + digest
+	}
+	return digest
+}
+
+// checkDigest logs the observed digest of the content pulled from url so that it can be pinned in the package.yaml
+// and fails if it does not match the expected digest, when one is provided
+func checkDigest(ctx context.Context, url string, expected *string, observed string) error {
+	logger.Log(ctx, slog.LevelInfo, "observed upstream digest", slog.String("URL", credentials.RedactURL(url)), slog.String("digest", observed))
+	if expected == nil {
+		return nil
+	}
+	expectedDigest := normalizeDigest(*expected)
+	if expectedDigest != observed {
+		return fmt.Errorf("digest mismatch for %s: expected %s but got %s", credentials.RedactURL(url), expectedDigest, observed)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package puller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkDigest(t *testing.T) {
+	observed := sha256Digest([]byte("chart"))
+	bareHex := observed[len(sha256DigestPrefix):]
+	upperCase := "SHA256:" + bareHex
+	other := sha256Digest([]byte("re-published chart"))
+
+	tests := []struct {
+		name        string
+		expected    *string
+		expectedErr bool
+	}{
+		{name: "#1 - no digest pinned", expected: nil},
+		{name: "#2 - matching digest", expected: &observed},
+		{name: "#3 - matching digest without prefix", expected: &bareHex},
+		{name: "#4 - matching digest with different case", expected: &upperCase},
+		{name: "#5 - mismatching digest", expected: &other, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDigest(context.Background(), "https://example.com/chart.tgz", tt.expected, observed)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package puller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	gogit "github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	git "github.com/rancher/charts-build-scripts/pkg/git"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
+)
+
+const (
+	githubHost = "github.com"
+	// branchRefPrefix is prepended to branch names in cache keys so that they are never mistaken for commits
+	branchRefPrefix = "refs/heads/"
+)
+
+// GetGitRepository gets a Git repository hosted anywhere (GitLab, Gitea, self-hosted, etc.) from options
+func GetGitRepository(upstreamOptions options.UpstreamOptions, branch *string) (GitRepository, error) {
+	var gitRepo GitRepository
+
+	if !strings.HasSuffix(upstreamOptions.URL, ".git") {
+		return gitRepo, fmt.Errorf("URL does not seem to point to a Git repository: %s", upstreamOptions.URL)
+	}
+	if len(GetGitHost(upstreamOptions.URL)) == 0 {
+		return gitRepo, fmt.Errorf("URL does not seem to be valid for a Git repository: %s", upstreamOptions.URL)
+	}
+
+	return GitRepository{
+		URL:          upstreamOptions.URL,
+		Subdirectory: upstreamOptions.Subdirectory,
+		Commit:       upstreamOptions.Commit,
+		branch:       branch,
+	}, nil
+}
+
+// GetGitHost returns the host that serves the Git repository pointed to by the URL.
+// It supports URLs with a scheme (https://host/group/repo.git, ssh://git@host/group/repo.git)
+// and scp-like URLs (git@host:group/repo.git). It returns an empty string if no host can be found.
+func GetGitHost(repoURL string) string {
+	if strings.Contains(repoURL, "://") {
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+	// scp-like syntax: [user@]host:path
+	hostAndPath := strings.SplitN(repoURL, ":", 2)
+	if len(hostAndPath) != 2 {
+		return ""
+	}
+	host := hostAndPath[0]
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	return host
+}
+
+// IsGithubURL returns whether the URL points to a repository hosted on github.com
+func IsGithubURL(repoURL string) bool {
+	return GetGitHost(repoURL) == githubHost
+}
+
+// GitRepository represents a repository hosted on any Git server.
+// Unlike GithubRepository, the clone URL is kept exactly as written in the package.yaml,
+// which allows nested group paths (e.g. https://gitlab.example.com/group/sub/chart.git)
+type GitRepository struct {
+	// URL represents the clone URL of the repository
+	URL string `yaml:"url"`
+	// Subdirectory represents a specific directory within the upstream pointed to by the URL to treat as the root
+	Subdirectory *string `yaml:"subdirectory"`
+	// Commit represents a specific commit hash to treat as the head
+	Commit *string `yaml:"commit"`
+
+	// Branch represents a specific branch to pull from
+	branch *string `yaml:"branch"`
+}
+
+// CacheKey returns the key to use for caching
+func (r GitRepository) CacheKey() string {
+	if !r.IsCacheable() {
+		return ""
+	}
+	return filepath.Join(".gitrepos", r.String())
+}
+
+// IsCacheable returns whether this repository can be cached without resolving the head of its branch
+func (r GitRepository) IsCacheable() bool {
+	return r.Commit != nil
+}
+
+// Pull grabs the repository
+func (r GitRepository) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path string) error {
+	return r.source().pull(ctx, fs, path)
+}
+
+// OfflineCacheKey returns the key the repository is served from in offline mode
+func (r GitRepository) OfflineCacheKey() string {
+	return r.source().offlineCacheKey()
+}
+
+func (r GitRepository) source() gitSource {
+	return gitSource{
+		url:          r.URL,
+		name:         r.repoPath(),
+		commit:       r.Commit,
+		branch:       r.branch,
+		subdirectory: r.Subdirectory,
+		cacheKeyAt: func(commit string) string {
+			r.Commit = &commit
+			return r.CacheKey()
+		},
+	}
+}
+
+// GetOptions returns the path used to construct this upstream
+func (r GitRepository) GetOptions() options.UpstreamOptions {
+	return options.UpstreamOptions{
+		URL:             r.URL,
+		Subdirectory:    r.Subdirectory,
+		Commit:          r.Commit,
+		ChartRepoBranch: r.branch,
+	}
+}
+
+// IsWithinPackage returns whether this upstream already exists within the package
+func (r GitRepository) IsWithinPackage() bool {
+	return false
+}
+
+func (r GitRepository) String() string {
+	repoStr := filepath.Join(GetGitHost(r.URL), r.repoPath())
+	if r.Commit != nil {
+		repoStr = fmt.Sprintf("%s@%s", repoStr, *r.Commit)
+	}
+	if r.Subdirectory != nil {
+		repoStr = fmt.Sprintf("%s/%s", repoStr, *r.Subdirectory)
+	}
+	return repoStr
+}
+
+// repoPath returns the path of the repository within its host without the .git suffix, e.g. group/sub/chart
+func (r GitRepository) repoPath() string {
+	repoPath := strings.TrimSuffix(r.URL, ".git")
+	if strings.Contains(repoPath, "://") {
+		if u, err := url.Parse(repoPath); err == nil {
+			repoPath = u.Path
+		}
+	} else if hostAndPath := strings.SplitN(repoPath, ":", 2); len(hostAndPath) == 2 {
+		repoPath = hostAndPath[1]
+	}
+	return strings.Trim(repoPath, "/")
+}
+
+// gitSource holds everything needed to pull a directory out of a Git repository, regardless of where it is hosted
+type gitSource struct {
+	// url is the URL used to clone the repository
+	url string
+	// name is a human-readable name of the repository used for logging
+	name         string
+	commit       *string
+	branch       *string
+	subdirectory *string
+	// cacheKeyAt returns the key used on the RootCache for the repository at a commit
+	cacheKeyAt func(commit string) string
+}
+
+// pull clones the repository at the commit or branch, moves the subdirectory to the root of path and caches the result.
+// Branches are cached by the commit they point to, which requires asking the remote for the head of the branch.
+func (s gitSource) pull(ctx context.Context, fs billy.Filesystem, path string) error {
+	creds, err := credentials.RootKeychain.ForURL(ctx, s.url)
+	if err != nil {
+		return err
+	}
+	var auth transport.AuthMethod
+	if !creds.IsEmpty() {
+		username, password := creds.BasicAuth()
+		auth = &githttp.BasicAuth{Username: username, Password: password}
+	}
+
+	pullAtHead := func() error {
+		var cacheKey string
+		switch {
+		case s.commit != nil:
+			cacheKey = s.cacheKeyAt(*s.commit)
+		case s.branch != nil && RootCache.IsEnabled():
+			head, err := resolveBranchHead(ctx, s.url, *s.branch, auth)
+			if err != nil {
+				logger.Log(ctx, slog.LevelWarn, "unable to resolve the head of the branch, skipping cache", slog.String("branch", *s.branch), logger.Err(err))
+				break
+			}
+			cacheKey = s.cacheKeyAt(head)
+		}
+		logger.Log(ctx, slog.LevelInfo, "pulling from upstream", slog.String("url", credentials.RedactURL(s.url)), slog.Bool("isCacheable", len(cacheKey) > 0))
+
+		return pullWithCache(ctx, cacheKey, fs, path, func() error {
+			return s.clone(ctx, fs, path, auth, creds)
+		})
+	}
+
+	if s.commit == nil && s.branch != nil {
+		// the head of the branch can only be resolved online, so the last pull of the branch is also stored under the branch itself
+		return pullWithAlias(ctx, s.offlineCacheKey(), fs, path, pullAtHead)
+	}
+	return pullAtHead()
+}
+
+// offlineCacheKey returns the key the repository is served from in offline mode
+func (s gitSource) offlineCacheKey() string {
+	if s.commit == nil && s.branch != nil {
+		return s.cacheKeyAt(branchRefPrefix + *s.branch)
+	}
+	if s.commit != nil {
+		return s.cacheKeyAt(*s.commit)
+	}
+	return ""
+}
+
+// clone clones the repository at the commit or branch and moves the subdirectory to the root of path
+func (s gitSource) clone(ctx context.Context, fs billy.Filesystem, path string, auth transport.AuthMethod, creds credentials.Credentials) error {
+	switch {
+	case s.commit == nil && s.branch == nil:
+		logger.Log(ctx, slog.LevelError, "Git Repo pull; a commit or a branch is required in the package.yaml")
+		return errors.New("no commit or branch specified")
+	case s.branch != nil:
+		logger.Log(ctx, slog.LevelDebug, "", slog.String("branch", *s.branch), slog.String("url", credentials.RedactURL(s.url)))
+		_, err := gogit.PlainClone(filesystem.GetAbsPath(fs, path), false, &gogit.CloneOptions{
+			URL:           s.url,
+			Auth:          auth,
+			ReferenceName: git.GetLocalBranchRefName(*s.branch),
+			SingleBranch:  true,
+			Depth:         1,
+		})
+		if err != nil {
+			return err
+		}
+	case s.commit != nil && s.subdirectory == nil:
+		logger.Log(ctx, slog.LevelDebug, "SLOW", slog.String("commit", *s.commit), slog.String("url", credentials.RedactURL(s.url)))
+
+		// full clones of the same repository are serialized
+		unlock := scheduler.Lock(s.url)
+		repo, err := gogit.PlainClone(filesystem.GetAbsPath(fs, path), false, &gogit.CloneOptions{
+			URL:  s.url,
+			Auth: auth,
+		})
+		unlock()
+		if err != nil {
+			return err
+		}
+
+		wt, err := repo.Worktree()
+		if err != nil {
+			return err
+		}
+		err = wt.Checkout(&gogit.CheckoutOptions{
+			Hash: plumbing.NewHash(*s.commit),
+		})
+		if err != nil {
+			return err
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return errors.New("unable to confirm if checkout was successful: " + err.Error())
+		}
+		if head.Hash().String() != *s.commit {
+			return errors.New("unable to checkout commit, may not be a valid commit hash from upstream: " + *s.commit)
+		}
+	case s.commit != nil && s.subdirectory != nil:
+		if err := git.SparseCloneSubdirectory(ctx, s.url, *s.commit, *s.subdirectory, fs, path, creds); err != nil {
+			return err
+		}
+	}
+
+	if err := filesystem.RemoveAll(fs, filepath.Join(path, ".git")); err != nil {
+		return err
+	}
+
+	if s.subdirectory != nil {
+		logger.Log(ctx, slog.LevelDebug, "", slog.String("subdirectory", *s.subdirectory))
+		if len(*s.subdirectory) > 0 {
+			if err := filesystem.MakeSubdirectoryRoot(ctx, fs, path, *s.subdirectory); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveBranchHead asks the remote for the commit the branch currently points to
+func resolveBranchHead(ctx context.Context, url, branch string, auth transport.AuthMethod) (string, error) {
+	remote := gogit.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	refs, err := remote.ListContext(ctx, &gogit.ListOptions{Auth: auth})
+	if err != nil {
+		return "", err
+	}
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == branchRef {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", branch, credentials.RedactURL(url))
+}
@@ -0,0 +1,79 @@
+package puller
+
+import (
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetGitHost(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "#1 - github https", url: "https://github.com/rancher/charts.git", want: "github.com"},
+		{name: "#2 - github scp-like", url: "git@github.com:rancher/charts.git", want: "github.com"},
+		{name: "#3 - gitlab nested groups", url: "https://gitlab.example.com/group/sub/chart.git", want: "gitlab.example.com"},
+		{name: "#4 - ssh with port", url: "ssh://git@gitea.example.com:2222/org/chart.git", want: "gitea.example.com"},
+		{name: "#5 - no host", url: "rancher/charts.git", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GetGitHost(tt.url))
+		})
+	}
+}
+
+func Test_GetGitRepository(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	subdirectory := "charts/chart"
+
+	tests := []struct {
+		name        string
+		opts        options.UpstreamOptions
+		wantString  string
+		wantCache   string
+		expectedErr bool
+	}{
+		{
+			name:       "#1 - nested group path with commit and subdirectory",
+			opts:       options.UpstreamOptions{URL: "https://gitlab.example.com/group/sub/chart.git", Commit: &commit, Subdirectory: &subdirectory},
+			wantString: "gitlab.example.com/group/sub/chart@" + commit + "/" + subdirectory,
+			wantCache:  ".gitrepos/gitlab.example.com/group/sub/chart@" + commit + "/" + subdirectory,
+		},
+		{
+			name:       "#2 - scp-like URL without commit is not cacheable",
+			opts:       options.UpstreamOptions{URL: "git@gitea.example.com:org/chart.git"},
+			wantString: "gitea.example.com/org/chart",
+			wantCache:  "",
+		},
+		{
+			name:        "#3 - not a git URL",
+			opts:        options.UpstreamOptions{URL: "https://gitlab.example.com/group/chart.tgz"},
+			expectedErr: true,
+		},
+		{
+			name:        "#4 - no host",
+			opts:        options.UpstreamOptions{URL: "group/chart.git"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := GetGitRepository(tt.opts, nil)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantString, repo.String())
+			assert.Equal(t, tt.wantCache, repo.CacheKey())
+			// the clone URL must be kept as written
+			assert.Equal(t, tt.opts.URL, repo.GetOptions().URL)
+		})
+	}
+}
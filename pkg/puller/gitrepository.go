@@ -2,24 +2,14 @@ package puller
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log/slog"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/go-git/go-billy/v5"
-	gogit "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/rancher/charts-build-scripts/pkg/filesystem"
-	git "github.com/rancher/charts-build-scripts/pkg/git"
-	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
 )
 
-var fullCloneMutex sync.Mutex
-
 const (
 	httpsURLFmt = "https://github.com/%s/%s.git"
 	sshURLFmt   = "git@github.com:%s/%s.git"
@@ -70,7 +60,7 @@ func (r GithubRepository) CacheKey() string {
 	return filepath.Join(".gitrepos", r.String())
 }
 
-// IsCacheable returns whether this repository can be cached
+// IsCacheable returns whether this repository can be cached without resolving the head of its branch
 func (r GithubRepository) IsCacheable() bool {
 	return r.Commit != nil
 }
@@ -87,95 +77,26 @@ func (r GithubRepository) GetSSHURL() string {
 
 // Pull grabs the repository
 func (r GithubRepository) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path string) error {
-	cloneURL := r.GetHTTPSURL()
-	isCacheable := r.IsCacheable()
-	logger.Log(ctx, slog.LevelInfo, "pulling from upstream", slog.String("url", cloneURL), slog.Bool("isCacheable", isCacheable))
-
-	if isCacheable {
-		pulledFromCache, err := RootCache.Get(ctx, r.CacheKey(), fs, path)
-		if err != nil {
-			return err
-		}
-		if pulledFromCache {
-			logger.Log(ctx, slog.LevelInfo, "pulled from cache", slog.String("repo", r.name), slog.String("path", path))
-			return nil
-		}
-	}
-
-	switch {
-	case r.Commit == nil && r.branch == nil:
-		logger.Log(ctx, slog.LevelError, "Git Repo pull; a commit or a branch is required in the package.yaml")
-		return errors.New("no commit or branch specified")
-	case r.branch != nil:
-		logger.Log(ctx, slog.LevelDebug, "", slog.String("branch", *r.branch), slog.String("url", cloneURL))
-		_, err := gogit.PlainClone(filesystem.GetAbsPath(fs, path), false, &gogit.CloneOptions{
-			URL:           cloneURL,
-			ReferenceName: git.GetLocalBranchRefName(*r.branch),
-			SingleBranch:  true,
-			Depth:         1,
-		})
-		if err != nil {
-			return err
-		}
-	case r.Commit != nil && r.Subdirectory == nil:
-		logger.Log(ctx, slog.LevelDebug, "SLOW", slog.String("commit", *r.Commit), slog.String("url", cloneURL))
-
-		fullCloneMutex.Lock()
-		repo, err := gogit.PlainClone(filesystem.GetAbsPath(fs, path), false, &gogit.CloneOptions{
-			URL: cloneURL,
-		})
-		if err != nil {
-			return err
-		}
-		fullCloneMutex.Unlock()
-
-		wt, err := repo.Worktree()
-		if err != nil {
-			return err
-		}
-		err = wt.Checkout(&gogit.CheckoutOptions{
-			Hash: plumbing.NewHash(*r.Commit),
-		})
-		if err != nil {
-			return err
-		}
-		head, err := repo.Head()
-		if err != nil {
-			return errors.New("unable to confirm if checkout was successful: " + err.Error())
-		}
-		if head.Hash().String() != *r.Commit {
-			return errors.New("unable to checkout commit %s, may not be a valid commit hash from upstream: " + *r.Commit)
-		}
-	case r.Commit != nil && r.Subdirectory != nil:
-		if err := git.SparseCloneSubdirectory(ctx, r.GetHTTPSURL(), *r.Commit, *r.Subdirectory, fs, path); err != nil {
-			return err
-		}
-	}
-
-	if err := filesystem.RemoveAll(fs, filepath.Join(path, ".git")); err != nil {
-		return err
-	}
+	return r.source().pull(ctx, fs, path)
+}
 
-	if r.Subdirectory != nil {
-		logger.Log(ctx, slog.LevelDebug, "", slog.String("subdirectory", *r.Subdirectory))
-		if len(*r.Subdirectory) > 0 {
-			if err := filesystem.MakeSubdirectoryRoot(ctx, fs, path, *r.Subdirectory); err != nil {
-				return err
-			}
-		}
-	}
+// OfflineCacheKey returns the key the repository is served from in offline mode
+func (r GithubRepository) OfflineCacheKey() string {
+	return r.source().offlineCacheKey()
+}
 
-	if isCacheable {
-		addedToCache, err := RootCache.Add(ctx, r.CacheKey(), fs, path)
-		if err != nil {
-			return err
-		}
-		if addedToCache {
-			logger.Log(ctx, slog.LevelInfo, "cached", slog.String("repo", r.name), slog.String("path", path))
-		}
+func (r GithubRepository) source() gitSource {
+	return gitSource{
+		url:          r.GetHTTPSURL(),
+		name:         r.name,
+		commit:       r.Commit,
+		branch:       r.branch,
+		subdirectory: r.Subdirectory,
+		cacheKeyAt: func(commit string) string {
+			r.Commit = &commit
+			return r.CacheKey()
+		},
 	}
-
-	return nil
 }
 
 // GetOptions returns the path used to construct this upstream
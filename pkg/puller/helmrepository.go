@@ -0,0 +1,152 @@
+package puller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+// HelmRepository represents a chart published on a classic Helm HTTP repository
+type HelmRepository struct {
+	// RepoURL is the URL of the Helm repository that serves the index.yaml
+	RepoURL string `yaml:"repoURL"`
+	// Chart is the name of the chart within the Helm repository
+	Chart string `yaml:"chart"`
+	// Version is a semver version or constraint; if empty, the latest stable version is used
+	Version string `yaml:"version"`
+}
+
+// GetHelmRepository gets a HelmRepository from options
+func GetHelmRepository(helmRepoOptions options.HelmRepositoryOptions) (HelmRepository, error) {
+	var helmRepository HelmRepository
+
+	if len(helmRepoOptions.RepoURL) == 0 {
+		return helmRepository, fmt.Errorf("repoURL must be provided for a Helm repository upstream")
+	}
+	if !strings.HasPrefix(helmRepoOptions.RepoURL, "http://") && !strings.HasPrefix(helmRepoOptions.RepoURL, "https://") {
+		return helmRepository, fmt.Errorf("repoURL does not seem to point to a Helm HTTP repository: %s", helmRepoOptions.RepoURL)
+	}
+	if len(helmRepoOptions.Chart) == 0 {
+		return helmRepository, fmt.Errorf("chart must be provided for a Helm repository upstream")
+	}
+
+	return HelmRepository{
+		RepoURL: helmRepoOptions.RepoURL,
+		Chart:   helmRepoOptions.Chart,
+		Version: helmRepoOptions.Version,
+	}, nil
+}
+
+// OfflineCacheKey returns the key the chart is served from in offline mode.
+// Since a version constraint can match a newer version at any time, it points to the last version pulled while online.
+func (h HelmRepository) OfflineCacheKey() string {
+	return "helm:" + h.String()
+}
+
+// Pull resolves the chart version through the index.yaml of the repository and grabs its archive
+func (h HelmRepository) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path string) error {
+	return pullWithAlias(ctx, h.OfflineCacheKey(), fs, path, func() error {
+		chartVersion, err := h.resolve(ctx)
+		if err != nil {
+			return err
+		}
+		chartURL, err := helmRepo.ResolveReferenceURL(h.RepoURL, chartVersion.URLs[0])
+		if err != nil {
+			return fmt.Errorf("unable to resolve the URL of %s-%s: %w", h.Chart, chartVersion.Version, err)
+		}
+		logger.Log(ctx, slog.LevelInfo, "resolved chart from Helm repository", slog.String("chart", h.Chart), slog.String("version", chartVersion.Version), slog.String("URL", credentials.RedactURL(chartURL)))
+
+		// the index.yaml records the sha256 of every archive: pinning it verifies the archive and makes it cacheable
+		archive := Archive{URL: chartURL}
+		if len(chartVersion.Digest) > 0 {
+			archive.Digest = &chartVersion.Digest
+		}
+		return archive.Pull(ctx, rootFs, fs, path)
+	})
+}
+
+// LatestVersion returns the newest version of the chart published on the repository that satisfies the configured version
+func (h HelmRepository) LatestVersion(ctx context.Context) (string, error) {
+	chartVersion, err := h.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return chartVersion.Version, nil
+}
+
+// resolve downloads the index.yaml of the repository and returns the newest entry of the chart that satisfies the configured version
+func (h HelmRepository) resolve(ctx context.Context) (*helmRepo.ChartVersion, error) {
+	indexURL := strings.TrimSuffix(h.RepoURL, "/") + "/index.yaml"
+	logger.Log(ctx, slog.LevelDebug, "fetching Helm repository index", slog.String("URL", credentials.RedactURL(indexURL)))
+
+	resp, err := credentials.HTTPClient().Get(indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get index.yaml from %s: %w", h.RepoURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get index.yaml from %s: status code %d", h.RepoURL, resp.StatusCode)
+	}
+
+	// save it to a temporary file to be loaded by Helm
+	tempIndex, err := os.CreateTemp("", "helm-repository-index-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempIndex.Name())
+	defer tempIndex.Close()
+
+	if _, err := io.Copy(tempIndex, resp.Body); err != nil {
+		return nil, err
+	}
+
+	indexFile, err := helmRepo.LoadIndexFile(tempIndex.Name())
+	if err != nil {
+		return nil, fmt.Errorf("unable to load index.yaml from %s: %w", h.RepoURL, err)
+	}
+
+	chartVersion, err := indexFile.Get(h.Chart, h.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find %s matching version %q in %s: %w", h.Chart, h.Version, h.RepoURL, err)
+	}
+	if len(chartVersion.URLs) == 0 {
+		return nil, fmt.Errorf("no download URL found for %s-%s in %s", h.Chart, chartVersion.Version, h.RepoURL)
+	}
+	return chartVersion, nil
+}
+
+// GetOptions returns the path used to construct this upstream
+func (h HelmRepository) GetOptions() options.UpstreamOptions {
+	return options.UpstreamOptions{
+		URL: h.RepoURL,
+		HelmRepository: &options.HelmRepositoryOptions{
+			RepoURL: h.RepoURL,
+			Chart:   h.Chart,
+			Version: h.Version,
+		},
+	}
+}
+
+// IsWithinPackage returns whether this upstream already exists within the package
+func (h HelmRepository) IsWithinPackage() bool {
+	return false
+}
+
+func (h HelmRepository) String() string {
+	repoStr := fmt.Sprintf("%s[chart=%s]", h.RepoURL, h.Chart)
+	if len(h.Version) > 0 {
+		repoStr = fmt.Sprintf("%s[chart=%s,version=%s]", h.RepoURL, h.Chart, h.Version)
+	}
+	return repoStr
+}
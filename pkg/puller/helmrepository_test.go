@@ -0,0 +1,154 @@
+package puller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+const testHelmRepositoryIndex = `apiVersion: v1
+entries:
+  chart:
+  - name: chart
+    version: 1.3.0-rc.1
+    urls:
+    - chart-1.3.0-rc.1.tgz
+  - name: chart
+    version: 1.2.3
+    urls:
+    - chart-1.2.3.tgz
+  - name: chart
+    version: 1.2.0
+    urls:
+    - https://downloads.example.com/chart-1.2.0.tgz
+  - name: chart
+    version: 1.1.9
+    urls:
+    - chart-1.1.9.tgz
+`
+
+func Test_HelmRepository_LatestVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testHelmRepositoryIndex))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		chart       string
+		version     string
+		want        string
+		expectedErr bool
+	}{
+		{name: "#1 - latest stable version", chart: "chart", version: "", want: "1.2.3"},
+		{name: "#2 - exact version", chart: "chart", version: "1.2.0", want: "1.2.0"},
+		{name: "#3 - constraint", chart: "chart", version: "~1.1.0", want: "1.1.9"},
+		{name: "#4 - prerelease constraint", chart: "chart", version: ">=1.3.0-0", want: "1.3.0-rc.1"},
+		{name: "#5 - no matching version", chart: "chart", version: ">=2.0.0", expectedErr: true},
+		{name: "#6 - unknown chart", chart: "other", version: "", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := HelmRepository{RepoURL: server.URL, Chart: tt.chart, Version: tt.version}
+			got, err := h.LatestVersion(context.Background())
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_GetHelmRepository(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        options.HelmRepositoryOptions
+		wantString  string
+		expectedErr bool
+	}{
+		{
+			name:       "#1 - valid with constraint",
+			opts:       options.HelmRepositoryOptions{RepoURL: "https://charts.example.com", Chart: "chart", Version: "^1.2.0"},
+			wantString: "https://charts.example.com[chart=chart,version=^1.2.0]",
+		},
+		{
+			name:       "#2 - valid without version",
+			opts:       options.HelmRepositoryOptions{RepoURL: "https://charts.example.com", Chart: "chart"},
+			wantString: "https://charts.example.com[chart=chart]",
+		},
+		{
+			name:        "#3 - missing chart",
+			opts:        options.HelmRepositoryOptions{RepoURL: "https://charts.example.com"},
+			expectedErr: true,
+		},
+		{
+			name:        "#4 - not an HTTP repository",
+			opts:        options.HelmRepositoryOptions{RepoURL: "oci://registry.example.com/charts", Chart: "chart"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := GetHelmRepository(tt.opts)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantString, h.String())
+		})
+	}
+}
+
+func Test_HelmRepository_Pull_digest(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+	rootFs := filesystem.GetFilesystem(rootDir)
+
+	tgzPath, err := chartutil.Save(&chart.Chart{Metadata: &chart.Metadata{APIVersion: "v2", Name: "chart", Version: "1.2.3"}}, t.TempDir())
+	require.NoError(t, err)
+	archive, err := os.ReadFile(tgzPath)
+	require.NoError(t, err)
+	digest := strings.TrimPrefix(sha256Digest(archive), sha256DigestPrefix)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprintf(w, "apiVersion: v1\nentries:\n  chart:\n  - name: chart\n    version: 1.2.3\n    digest: %s\n    urls:\n    - chart-1.2.3.tgz\n", digest)
+		case "/tampered/index.yaml":
+			fmt.Fprintf(w, "apiVersion: v1\nentries:\n  chart:\n  - name: chart\n    version: 1.2.3\n    digest: %s\n    urls:\n    - ../chart-1.2.3.tgz\n", strings.Repeat("0", 64))
+		case "/chart-1.2.3.tgz":
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// the archive is verified against the digest of the index.yaml
+	assert.NoError(t, HelmRepository{RepoURL: server.URL, Chart: "chart"}.Pull(ctx, rootFs, rootFs, "pulled"))
+	assert.FileExists(t, filepath.Join(rootDir, "pulled", "Chart.yaml"))
+
+	err = HelmRepository{RepoURL: server.URL + "/tampered", Chart: "chart"}.Pull(ctx, rootFs, rootFs, "tampered")
+	assert.ErrorContains(t, err, "digest mismatch")
+}
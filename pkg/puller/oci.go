@@ -2,42 +2,90 @@ package puller
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/go-git/go-billy/v5"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
-	helmGetter "helm.sh/helm/v3/pkg/getter"
+	helmRegistry "helm.sh/helm/v3/pkg/registry"
 )
 
 // Registry holds the URL that represents the link to the chart registry including the chart version
 type Registry struct {
 	URL string `yaml:"url"`
+	// Digest represents the expected sha256 digest of the OCI manifest
+	Digest *string `yaml:"digest"`
 }
 
-// Pull pulls the chart from the registry into the filesystem
+// CacheKey returns the key to use for caching, made of the URL and the digest.
+// It is empty if the chart is not pinned by a digest, since the tag can be re-published.
+func (r Registry) CacheKey() string {
+	if r.Digest == nil {
+		return ""
+	}
+	return fmt.Sprintf("oci:%s@%s", r.URL, normalizeDigest(*r.Digest))
+}
+
+// OfflineCacheKey returns the key the chart is served from in offline mode
+func (r Registry) OfflineCacheKey() string {
+	if r.Digest != nil {
+		return r.CacheKey()
+	}
+	return "oci:" + r.URL
+}
+
+// Pull pulls the chart from the registry into the filesystem, unless it is already cached
 func (r Registry) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path string) error {
+	pull := func() error {
+		return r.pull(ctx, fs, path)
+	}
+	if r.Digest == nil {
+		// the tag can be re-published, the last pull is only served in offline mode
+		return pullWithAlias(ctx, r.OfflineCacheKey(), fs, path, pull)
+	}
+	return pullWithCache(ctx, r.CacheKey(), fs, path, pull)
+}
+
+// pull pulls the chart from the registry and unpacks it into the path
+func (r Registry) pull(ctx context.Context, fs billy.Filesystem, path string) error {
 	logger.Log(ctx, slog.LevelInfo, "pulling from upstream", slog.String("URL", r.URL), slog.String("path", path))
 
-	getter, err := helmGetter.NewOCIGetter()
+	creds, err := credentials.RootKeychain.ForURL(ctx, r.URL)
 	if err != nil {
 		return err
 	}
+	var clientOpts []helmRegistry.ClientOption
+	if !creds.IsEmpty() {
+		clientOpts = append(clientOpts, helmRegistry.ClientOptBasicAuth(creds.BasicAuth()))
+	}
 
-	buffer, err := getter.Get(r.URL)
+	client, err := helmRegistry.NewClient(clientOpts...)
 	if err != nil {
 		return err
 	}
 
+	result, err := client.Pull(strings.TrimPrefix(r.URL, helmRegistry.OCIScheme+"://"), helmRegistry.PullOptWithChart(true), helmRegistry.PullOptIgnoreMissingProv(true))
+	if err != nil {
+		return err
+	}
+
+	// the manifest digest is what identifies an OCI artifact, it changes if the chart is re-published under the same tag
+	if err := checkDigest(ctx, r.URL, r.Digest, result.Manifest.Digest); err != nil {
+		return err
+	}
+
 	tgz, err := filesystem.CreateFileAndDirs(fs, chartArchiveFilepath)
 	if err != nil {
 		return err
 	}
 	defer fs.Remove(chartArchiveFilepath)
 
-	if _, err := tgz.Write(buffer.Bytes()); err != nil {
+	if _, err := tgz.Write(result.Chart.Data); err != nil {
 		return err
 	}
 
@@ -56,7 +104,8 @@ func (r Registry) Pull(ctx context.Context, rootFs, fs billy.Filesystem, path st
 // GetOptions returns the options for the upstream
 func (r Registry) GetOptions() options.UpstreamOptions {
 	return options.UpstreamOptions{
-		URL: r.URL,
+		URL:    r.URL,
+		Digest: r.Digest,
 	}
 }
 
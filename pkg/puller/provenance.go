@@ -0,0 +1,61 @@
+package puller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/rancher/charts-build-scripts/pkg/credentials"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+)
+
+// verifyProvenance downloads the provenance file served at the URL of the archive followed by .prov
+// and fails unless it is signed by a key of the keyring and matches the archive
+func verifyProvenance(ctx context.Context, rootFs billy.Filesystem, archiveURL, keyringPath string, archive []byte) error {
+	if !filepath.IsAbs(keyringPath) {
+		keyringPath = filesystem.GetAbsPath(rootFs, keyringPath)
+	}
+	keyring, err := helm.LoadKeyring(keyringPath)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return err
+	}
+	// the provenance file holds the digest of the archive under the name it was published with
+	archiveName := path.Base(u.Path)
+	// the provenance file is next to the archive, the query of the URL is kept after it
+	u.Path += helm.ProvenanceExt
+	prov, err := download(credentials.HTTPClient(), u.String())
+	if err != nil {
+		return fmt.Errorf("unable to get provenance file of %s: %w", credentials.RedactURL(archiveURL), err)
+	}
+	signedBy, err := keyring.Verify(archiveName, archive, prov)
+	if err != nil {
+		return fmt.Errorf("invalid provenance for %s: %w", credentials.RedactURL(archiveURL), err)
+	}
+	logger.Log(ctx, slog.LevelInfo, "verified upstream provenance", slog.String("URL", credentials.RedactURL(archiveURL)), slog.String("signedBy", signedBy))
+	return nil
+}
+
+// download returns the content served at the URL
+func download(client *http.Client, rawURL string) ([]byte, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
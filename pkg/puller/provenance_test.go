@@ -0,0 +1,89 @@
+package puller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp" //nolint
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+func Test_verifyProvenance(t *testing.T) {
+	ctx := context.Background()
+	rootDir := t.TempDir()
+	rootFs := filesystem.GetFilesystem(rootDir)
+
+	tgzPath, err := chartutil.Save(&chart.Chart{Metadata: &chart.Metadata{APIVersion: "v2", Name: "demo", Version: "0.1.0"}}, rootDir)
+	require.NoError(t, err)
+	archive, err := os.ReadFile(tgzPath)
+	require.NoError(t, err)
+
+	trusted, err := openpgp.NewEntity("charts", "", "charts@example.com", nil)
+	require.NoError(t, err)
+	prov, err := (&provenance.Signatory{Entity: trusted}).ClearSign(tgzPath)
+	require.NoError(t, err)
+	f, err := os.Create(filepath.Join(rootDir, "pubring.gpg"))
+	require.NoError(t, err)
+	require.NoError(t, trusted.Serialize(f))
+	require.NoError(t, f.Close())
+
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	require.NoError(t, err)
+	otherProv, err := (&provenance.Signatory{Entity: other}).ClearSign(tgzPath)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/demo-0.1.0.tgz.prov":
+			w.Write([]byte(prov))
+		case "/other/demo-0.1.0.tgz.prov":
+			w.Write([]byte(otherProv))
+		case "/renamed/chart.tgz.prov":
+			w.Write([]byte(prov))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		expectedErr bool
+	}{
+		{name: "#1 - signed by a trusted key", url: server.URL + "/demo-0.1.0.tgz"},
+		{name: "#2 - query is not part of the provenance url", url: server.URL + "/demo-0.1.0.tgz?download=1"},
+		{name: "#3 - signed by a key that is not trusted", url: server.URL + "/other/demo-0.1.0.tgz", expectedErr: true},
+		{name: "#4 - no provenance file", url: server.URL + "/missing/demo-0.1.0.tgz", expectedErr: true},
+		{name: "#5 - provenance file of an archive with another name", url: server.URL + "/renamed/chart.tgz", expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyProvenance(ctx, rootFs, tt.url, "pubring.gpg", archive)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_Archive_CacheKey_provenance(t *testing.T) {
+	digest := "sha256:0123"
+	archive := Archive{URL: "https://example.com/chart-1.0.0.tgz", Digest: &digest}
+	verified := Archive{URL: archive.URL, Digest: &digest, Provenance: &options.ProvenanceOptions{Keyring: "keys/pubring.gpg"}}
+	assert.NotEqual(t, archive.CacheKey(), verified.CacheKey())
+	archive.Digest, verified.Digest = nil, nil
+	assert.NotEqual(t, archive.OfflineCacheKey(), verified.OfflineCacheKey())
+}
@@ -16,3 +16,19 @@ type Puller interface {
 	// IsWithinPackage returns whether this upstream already exists within the package
 	IsWithinPackage() bool
 }
+
+// CacheKeyer is implemented by upstreams whose contents can be cached; the key is empty if they cannot
+type CacheKeyer interface {
+	// CacheKey returns the key the contents of the upstream are cached under
+	CacheKey() string
+}
+
+// IsPinned returns whether the upstream always pulls the same contents,
+// i.e. it exists within the package or its contents are cached under a fixed key (a commit or a digest)
+func IsPinned(upstream Puller) bool {
+	if upstream.IsWithinPackage() {
+		return true
+	}
+	keyer, ok := upstream.(CacheKeyer)
+	return ok && len(keyer.CacheKey()) > 0
+}
@@ -0,0 +1,31 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fake is an in-memory provider for tests
+type Fake struct {
+	// PullRequests are the pull requests by number
+	PullRequests map[int]*PullRequest
+	// Files are the files changed by each pull request, by number
+	Files map[int][]File
+}
+
+// PullRequest returns the pull request with the given number or ErrNotFound
+func (f *Fake) PullRequest(_ context.Context, number int) (*PullRequest, error) {
+	pr, ok := f.PullRequests[number]
+	if !ok {
+		return nil, fmt.Errorf("%w: #%d", ErrNotFound, number)
+	}
+	return pr, nil
+}
+
+// ListFiles returns the files changed by the pull request with the given number or ErrNotFound
+func (f *Fake) ListFiles(ctx context.Context, number int) ([]File, error) {
+	if _, err := f.PullRequest(ctx, number); err != nil {
+		return nil, err
+	}
+	return f.Files[number], nil
+}
@@ -0,0 +1,70 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/go-github/v85/github"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"golang.org/x/oauth2"
+)
+
+// filesPerPage is the largest page size of the GitHub API
+const filesPerPage = 100
+
+// GitHub looks up pull requests through the GitHub API
+type GitHub struct {
+	client *github.Client
+	owner  string
+	repo   string
+}
+
+// NewGitHub returns a provider for the pull requests of the GitHub repository owner/repo, authenticated with token
+func NewGitHub(ctx context.Context, token, owner, repo string) *GitHub {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	return newGitHub(github.NewClient(oauth2.NewClient(ctx, tokenSource)), owner, repo)
+}
+
+func newGitHub(client *github.Client, owner, repo string) *GitHub {
+	return &GitHub{client: client, owner: owner, repo: repo}
+}
+
+// PullRequest returns the metadata of a pull request
+func (g *GitHub) PullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	pr, resp, err := g.client.PullRequests.Get(ctx, g.owner, g.repo, number)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s/%s#%d", ErrNotFound, g.owner, g.repo, number)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request %d: %w", number, err)
+	}
+	return &PullRequest{
+		Number:     pr.GetNumber(),
+		Title:      pr.GetTitle(),
+		BaseBranch: pr.GetBase().GetRef(),
+		HeadSHA:    pr.GetHead().GetSHA(),
+	}, nil
+}
+
+// ListFiles returns every file changed by a pull request, requesting as many pages as needed
+func (g *GitHub) ListFiles(ctx context.Context, number int) ([]File, error) {
+	var files []File
+	opts := &github.ListOptions{PerPage: filesPerPage}
+	for {
+		page, resp, err := g.client.PullRequests.ListFiles(ctx, g.owner, g.repo, number, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files for pull request %d: %w", number, err)
+		}
+		for _, f := range page {
+			files = append(files, File{Filename: f.GetFilename(), Status: f.GetStatus(), PreviousFilename: f.GetPreviousFilename()})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	logger.Log(ctx, slog.LevelDebug, "listed pull request files", slog.Int("number", number), slog.Int("files", len(files)))
+	return files, nil
+}
@@ -0,0 +1,71 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v85/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGitHub(t *testing.T, handler http.Handler) *GitHub {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	baseURL, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+	client := github.NewClient(nil)
+	client.BaseURL = baseURL
+	return newGitHub(client, "my-fork", "charts")
+}
+
+func Test_GitHub_ListFiles(t *testing.T) {
+	const total = 230
+	gh := newTestGitHub(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/my-fork/charts/pulls/42/files", r.URL.Path)
+		assert.Equal(t, "100", r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if end := page * filesPerPage; end < total {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=100>; rel="next"`, r.URL.Path, page+1))
+		}
+		fmt.Fprint(w, "[")
+		for i := (page - 1) * filesPerPage; i < min(page*filesPerPage, total); i++ {
+			if i%filesPerPage != 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"filename":"assets/chart/chart-%d.tgz","status":"added"}`, i)
+		}
+		fmt.Fprint(w, "]")
+	}))
+
+	files, err := gh.ListFiles(context.Background(), 42)
+	require.NoError(t, err)
+	require.Len(t, files, total)
+	assert.Equal(t, File{Filename: "assets/chart/chart-0.tgz", Status: StatusAdded}, files[0])
+	assert.Equal(t, "assets/chart/chart-229.tgz", files[total-1].Filename)
+}
+
+func Test_GitHub_PullRequest(t *testing.T) {
+	gh := newTestGitHub(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/my-fork/charts/pulls/42" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"number":42,"title":"Release rancher-monitoring","base":{"ref":"release-v2.10"},"head":{"sha":"abc123"}}`)
+	}))
+
+	pr, err := gh.PullRequest(context.Background(), 42)
+	require.NoError(t, err)
+	assert.Equal(t, &PullRequest{Number: 42, Title: "Release rancher-monitoring", BaseBranch: "release-v2.10", HeadSHA: "abc123"}, pr)
+
+	_, err = gh.PullRequest(context.Background(), 43)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,56 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/charts-build-scripts/pkg/git"
+)
+
+// LocalDiff treats the commits of the local repository since it diverged from a base revision as a pull request,
+// so that pull requests can be validated before they are opened or without access to the API of the Git hosting service.
+// The number of the pull request is ignored.
+type LocalDiff struct {
+	repo *git.Git
+	base string
+}
+
+// NewLocalDiff returns a provider for the changes of repo between base and HEAD
+func NewLocalDiff(repo *git.Git, base string) *LocalDiff {
+	return &LocalDiff{repo: repo, base: base}
+}
+
+// PullRequest returns the base and the HEAD of the local changes as a pull request
+func (l *LocalDiff) PullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	head, err := l.repo.HeadCommit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return &PullRequest{Number: number, Title: "local changes since " + l.base, BaseBranch: l.base, HeadSHA: head}, nil
+}
+
+// ListFiles returns the files changed since HEAD diverged from the base
+// Equivalent to: git diff --name-status --no-renames <base>...HEAD
+func (l *LocalDiff) ListFiles(ctx context.Context, _ int) ([]File, error) {
+	diff, err := l.repo.DiffNameStatus(ctx, l.base+"...HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s...HEAD: %w", l.base, err)
+	}
+	files := make([]File, 0, len(diff))
+	for _, f := range diff {
+		files = append(files, File{Filename: f.Path, Status: fileStatus(f.Status)})
+	}
+	return files, nil
+}
+
+// fileStatus maps the status letters of git diff to the statuses of the GitHub API
+func fileStatus(letter string) string {
+	switch letter {
+	case "A":
+		return StatusAdded
+	case "D":
+		return StatusRemoved
+	default:
+		return StatusModified
+	}
+}
@@ -0,0 +1,61 @@
+package pullrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Statuses of the files changed by a pull request
+const (
+	StatusAdded    = "added"
+	StatusRemoved  = "removed"
+	StatusModified = "modified"
+	StatusRenamed  = "renamed"
+)
+
+// DefaultRepository is the repository pull requests are looked up in unless configured otherwise
+const DefaultRepository = "rancher/charts"
+
+// ErrNotFound is returned when a pull request does not exist
+var ErrNotFound = errors.New("pull request not found")
+
+// PullRequest is the metadata of a pull request
+type PullRequest struct {
+	Number int
+	Title  string
+	// BaseBranch is the branch the pull request would be merged into
+	BaseBranch string
+	// HeadSHA is the commit the pull request would merge
+	HeadSHA string
+}
+
+// File is a file changed by a pull request
+type File struct {
+	Filename string
+	// Status is one of StatusAdded, StatusRemoved, StatusModified or StatusRenamed
+	Status string
+	// PreviousFilename is the name of a renamed file before the pull request
+	PreviousFilename string
+}
+
+// Provider looks up pull requests and the files they change, e.g. through the API of a Git hosting service
+type Provider interface {
+	// PullRequest returns the metadata of a pull request or ErrNotFound
+	PullRequest(ctx context.Context, number int) (*PullRequest, error)
+	// ListFiles returns every file changed by a pull request, across all pages
+	ListFiles(ctx context.Context, number int) ([]File, error)
+}
+
+// SplitRepository splits a repository in the owner/repo form, falling back to DefaultRepository if it is empty
+func SplitRepository(repository string) (owner, repo string, err error) {
+	if repository == "" {
+		repository = DefaultRepository
+	}
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", fmt.Errorf("repository %q must be in the owner/repo form", repository)
+	}
+	return owner, repo, nil
+}
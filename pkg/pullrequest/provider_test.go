@@ -0,0 +1,34 @@
+package pullrequest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SplitRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		owner      string
+		repo       string
+		wantErr    bool
+	}{
+		{repository: "", owner: "rancher", repo: "charts"},
+		{repository: "my-fork/charts", owner: "my-fork", repo: "charts"},
+		{repository: "rancher", wantErr: true},
+		{repository: "rancher/charts/extra", wantErr: true},
+		{repository: "/charts", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			owner, repo, err := SplitRepository(tt.repository)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.owner, owner)
+			assert.Equal(t, tt.repo, repo)
+		})
+	}
+}
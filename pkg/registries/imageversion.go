@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/rancher/charts-build-scripts/pkg/config"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
@@ -30,6 +31,20 @@ type Report struct {
 	SkippedUnsupported []string      `json:"skippedUnsupported,omitempty"`
 }
 
+// Header returns the columns of the report
+func (r Report) Header() []string {
+	return []string{"IMAGE", "CURRENT", "LATEST", "NEEDS UPDATE"}
+}
+
+// Rows returns a row per image of the chart
+func (r Report) Rows() [][]string {
+	rows := make([][]string, len(r.Images))
+	for i, image := range r.Images {
+		rows[i] = []string{image.Repository, image.CurrentTag, image.LatestAvailable, strconv.FormatBool(image.NeedsUpdate)}
+	}
+	return rows
+}
+
 var LoadImageVersionList = config.LoadImageVersionList
 
 // collectChartImages walks the unpacked chart source under <repoRoot>/charts/<chart>/<version>
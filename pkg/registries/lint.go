@@ -18,11 +18,30 @@ const rancherNamespace = "rancher/"
 
 // LintWarning represents a violation of image block rules in a chart's values.yaml.
 type LintWarning struct {
-	Asset      string // path to the .tgz file
-	YAMLPath   string // dot-notation path to the offending node, e.g. "httpHeaderInjectorWebhook.proxy.image"
-	Repository string // the repository value found
-	Tag        string // the tag value found (empty string if missing/null)
-	Reason     string // "orphan_repository" | "wrong_namespace"
+	Asset      string `json:"asset"`      // path to the .tgz file
+	YAMLPath   string `json:"yamlPath"`   // dot-notation path to the offending node, e.g. "httpHeaderInjectorWebhook.proxy.image"
+	Repository string `json:"repository"` // the repository value found
+	Tag        string `json:"tag"`        // the tag value found (empty string if missing/null)
+	Reason     string `json:"reason"`     // "orphan_repository" | "wrong_namespace"
+}
+
+// LintReport is the output of LintImageTags
+type LintReport struct {
+	Warnings []LintWarning `json:"warnings"`
+}
+
+// Header returns the columns of the lint report
+func (r LintReport) Header() []string {
+	return []string{"ASSET", "PATH", "REPOSITORY", "TAG", "REASON"}
+}
+
+// Rows returns a row per warning
+func (r LintReport) Rows() [][]string {
+	rows := make([][]string, len(r.Warnings))
+	for i, w := range r.Warnings {
+		rows[i] = []string{w.Asset, w.YAMLPath, w.Repository, w.Tag, w.Reason}
+	}
+	return rows
 }
 
 // LintImageTags enforces three rules on every image block found in the
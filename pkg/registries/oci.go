@@ -13,6 +13,7 @@ import (
 	helmCLI "helm.sh/helm/v3/pkg/cli"
 	helmRegistry "helm.sh/helm/v3/pkg/registry"
 
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
 	"github.com/rancher/charts-build-scripts/pkg/path"
@@ -252,7 +253,14 @@ func (o *oci) checkAndPush(ctx context.Context, release *options.ReleaseOptions)
 	for _, info := range assetsToProcess {
 		logger.Log(ctx, slog.LevelDebug, "pushing", slog.String("asset", info.asset))
 
-		if err := o.push(o.helmClient, info.data, buildPushURL(o.dns, o.customPath, info.chart, info.version)); err != nil {
+		pushURL := buildPushURL(o.dns, o.customPath, info.chart, info.version)
+		if dryrun.Enabled() {
+			dryrun.Record(ctx, dryrun.ActionOCIPush, pushURL, info.asset)
+			pushedAssets = append(pushedAssets, info.asset)
+			continue
+		}
+
+		if err := o.push(o.helmClient, info.data, pushURL); err != nil {
 			logger.Log(ctx, slog.LevelError, "failed to push asset", slog.String("asset", info.asset))
 			pushErrors = append(pushErrors, fmt.Errorf("asset %s: %w", info.asset, err))
 			continue
@@ -0,0 +1,215 @@
+package registries
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
+)
+
+// Problems reported by VerifyPublished for a chart version
+const (
+	// PublishedMissing is a chart version without urls, or whose url is not found
+	PublishedMissing = "missing"
+	// PublishedDigestMismatch is a chart version whose archive served at its url does not have the digest of index.yaml
+	PublishedDigestMismatch = "digest-mismatch"
+	// PublishedUnreachable is a chart version whose url could not be downloaded
+	PublishedUnreachable = "unreachable"
+	// PublishedOCIMissing is a chart version that was not pushed to the OCI registry
+	PublishedOCIMissing = "oci-missing"
+	// PublishedOCIUnreachable is a chart version whose tags could not be listed in the OCI registry
+	PublishedOCIUnreachable = "oci-unreachable"
+)
+
+// PublishedOptions configures VerifyPublished
+type PublishedOptions struct {
+	// BaseURL is the URL of the Helm repository the relative urls of index.yaml are served from
+	BaseURL string
+	// Jobs is the number of chart versions verified at the same time
+	Jobs int
+	// OCIDNS, when set, also checks that every chart version was pushed to the OCI registry at OCIDNS/OCICustomPath
+	OCIDNS        string
+	OCICustomPath string
+	OCIUser       string
+	OCIPassword   string
+	OCIDebug      bool
+}
+
+// PublishedReport is the result of VerifyPublished
+type PublishedReport struct {
+	// BaseURL is the Helm repository the chart versions were downloaded from
+	BaseURL string `json:"baseURL"`
+	// Checked is the number of chart versions of index.yaml that were verified
+	Checked int `json:"checked"`
+	// Problems are the broken or missing chart versions, sorted by chart and version
+	Problems []PublishedProblem `json:"problems"`
+}
+
+// PublishedProblem is a chart version of index.yaml that is not served as expected
+type PublishedProblem struct {
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+	URL     string `json:"url,omitempty"`
+	// Problem is one of PublishedMissing, PublishedDigestMismatch, PublishedUnreachable, PublishedOCIMissing or PublishedOCIUnreachable
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Header returns the columns of the report
+func (r PublishedReport) Header() []string {
+	return []string{"CHART", "VERSION", "PROBLEM", "URL", "DETAIL"}
+}
+
+// Rows returns a row for each problem
+func (r PublishedReport) Rows() [][]string {
+	rows := make([][]string, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		rows = append(rows, []string{p.Chart, p.Version, p.Problem, p.URL, p.Detail})
+	}
+	return rows
+}
+
+// publishedVerifier downloads the chart versions of index.yaml and, if oci is set, checks that they were pushed to the OCI registry
+type publishedVerifier struct {
+	client  *http.Client
+	baseURL *url.URL
+	oci     *oci
+}
+
+// VerifyPublished checks that the Helm repository at the base URL serves every chart version of the local index.yaml
+// with the digest of index.yaml and, when an OCI registry is configured, that every chart version was pushed to it.
+// The report lists the broken or missing chart versions; an error is also returned if there is any.
+func VerifyPublished(ctx context.Context, rootFs billy.Filesystem, opts PublishedOptions) (*PublishedReport, error) {
+	baseURL, err := url.Parse(opts.BaseURL + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", opts.BaseURL, err)
+	}
+
+	index, err := helm.OpenIndexYaml(ctx, rootFs)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &publishedVerifier{client: &http.Client{Timeout: 5 * time.Minute}, baseURL: baseURL}
+	if opts.OCIDNS != "" {
+		if v.oci, err = setupOCI(ctx, opts.OCIDNS, opts.OCICustomPath, opts.OCIUser, opts.OCIPassword, opts.OCIDebug, false); err != nil {
+			return nil, err
+		}
+	}
+
+	report := v.verify(ctx, index, opts.Jobs)
+	report.BaseURL = opts.BaseURL
+	if len(report.Problems) > 0 {
+		return report, fmt.Errorf("%d chart versions are not published as expected at %s", len(report.Problems), opts.BaseURL)
+	}
+	return report, nil
+}
+
+// verify verifies every chart version of the index, at most jobs of them at the same time
+func (v *publishedVerifier) verify(ctx context.Context, index *helmRepo.IndexFile, jobs int) *PublishedReport {
+	var versions []*helmRepo.ChartVersion
+	for _, chartVersions := range index.Entries {
+		versions = append(versions, chartVersions...)
+	}
+
+	report := &PublishedReport{Checked: len(versions), Problems: []PublishedProblem{}}
+	var mu sync.Mutex
+	name := func(cv *helmRepo.ChartVersion) string { return cv.Name + "-" + cv.Version }
+	// verifyVersion never fails: the problems of each chart version are collected in the report instead
+	_ = scheduler.Run(ctx, jobs, versions, name, func(ctx context.Context, cv *helmRepo.ChartVersion) error {
+		problems := v.verifyVersion(logger.WithChart(ctx, cv.Name, cv.Version), cv)
+		mu.Lock()
+		defer mu.Unlock()
+		report.Problems = append(report.Problems, problems...)
+		return nil
+	})
+
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		if report.Problems[i].Chart != report.Problems[j].Chart {
+			return report.Problems[i].Chart < report.Problems[j].Chart
+		}
+		return report.Problems[i].Version < report.Problems[j].Version
+	})
+	return report
+}
+
+// verifyVersion returns the problems of a chart version
+func (v *publishedVerifier) verifyVersion(ctx context.Context, cv *helmRepo.ChartVersion) []PublishedProblem {
+	var problems []PublishedProblem
+	problem := func(u, kind, detail string) {
+		logger.Log(ctx, slog.LevelWarn, "chart version is not published as expected", slog.String("problem", kind), slog.String("detail", detail))
+		problems = append(problems, PublishedProblem{Chart: cv.Name, Version: cv.Version, URL: u, Problem: kind, Detail: detail})
+	}
+
+	if len(cv.URLs) == 0 {
+		problem("", PublishedMissing, "no urls in index.yaml")
+	}
+	for _, u := range cv.URLs {
+		ref, err := url.Parse(u)
+		if err != nil {
+			problem(u, PublishedUnreachable, err.Error())
+			continue
+		}
+		chartURL := v.baseURL.ResolveReference(ref).String()
+		digest, found, err := v.download(ctx, chartURL)
+		switch {
+		case err != nil:
+			problem(chartURL, PublishedUnreachable, err.Error())
+		case !found:
+			problem(chartURL, PublishedMissing, "not found")
+		case digest != cv.Digest:
+			problem(chartURL, PublishedDigestMismatch, fmt.Sprintf("index.yaml digest %s, served digest %s", cv.Digest, digest))
+		}
+	}
+
+	if v.oci != nil {
+		exists, err := v.oci.checkAsset(ctx, v.oci.helmClient, v.oci.dns, v.oci.customPath, cv.Name, cv.Version)
+		switch {
+		case err != nil:
+			problem(buildPushURL(v.oci.dns, v.oci.customPath, cv.Name, cv.Version), PublishedOCIUnreachable, err.Error())
+		case !exists:
+			problem(buildPushURL(v.oci.dns, v.oci.customPath, cv.Name, cv.Version), PublishedOCIMissing, "tag not found")
+		}
+	}
+	return problems
+}
+
+// download returns the sha256 digest of the file at the URL, or found false if there is no such file
+func (v *publishedVerifier) download(ctx context.Context, chartURL string) (digest string, found bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, chartURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, errors.New(resp.Status)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), true, nil
+}
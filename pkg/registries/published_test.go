@@ -0,0 +1,93 @@
+package registries
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	helmRegistry "helm.sh/helm/v3/pkg/registry"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+)
+
+func Test_VerifyPublished(t *testing.T) {
+	served := map[string][]byte{
+		"/assets/demo/demo-1.0.0.tgz":   []byte("demo 1.0.0"),
+		"/assets/demo/demo-1.1.0.tgz":   []byte("tampered demo 1.1.0"),
+		"/assets/fleet/fleet-1.0.0.tgz": []byte("fleet 1.0.0"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := served[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	digest := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	index := helmRepo.NewIndexFile()
+	for _, cv := range []struct{ name, version, data string }{
+		{"demo", "1.0.0", "demo 1.0.0"},
+		{"demo", "1.1.0", "demo 1.1.0"},
+		{"demo", "1.2.0", "demo 1.2.0"},
+		{"fleet", "1.0.0", "fleet 1.0.0"},
+	} {
+		require.NoError(t, index.MustAdd(&chart.Metadata{APIVersion: "v2", Name: cv.name, Version: cv.version}, cv.name+"-"+cv.version+".tgz", "assets/"+cv.name, digest(cv.data)))
+	}
+
+	t.Run("helm repository", func(t *testing.T) {
+		rootDir := t.TempDir()
+		require.NoError(t, index.WriteFile(filepath.Join(rootDir, "index.yaml"), 0644))
+
+		report, err := VerifyPublished(context.Background(), filesystem.GetFilesystem(rootDir), PublishedOptions{BaseURL: server.URL, Jobs: 2})
+		assert.Error(t, err)
+		require.NotNil(t, report)
+		assert.Equal(t, 4, report.Checked)
+		require.Len(t, report.Problems, 2)
+		assert.Equal(t, PublishedProblem{Chart: "demo", Version: "1.1.0", URL: server.URL + "/assets/demo/demo-1.1.0.tgz", Problem: PublishedDigestMismatch,
+			Detail: "index.yaml digest " + digest("demo 1.1.0") + ", served digest " + digest("tampered demo 1.1.0")}, report.Problems[0])
+		assert.Equal(t, PublishedProblem{Chart: "demo", Version: "1.2.0", URL: server.URL + "/assets/demo/demo-1.2.0.tgz", Problem: PublishedMissing, Detail: "not found"}, report.Problems[1])
+	})
+
+	t.Run("oci registry", func(t *testing.T) {
+		baseURL, err := url.Parse(server.URL + "/")
+		require.NoError(t, err)
+		v := &publishedVerifier{client: server.Client(), baseURL: baseURL, oci: &oci{
+			dns:        "registry.example.com",
+			helmClient: &helmRegistry.Client{},
+			checkAsset: func(_ context.Context, _ *helmRegistry.Client, _, _, chart, version string) (bool, error) {
+				if chart == "fleet" {
+					return false, errors.New("503 Service Unavailable")
+				}
+				return version == "1.0.0", nil
+			},
+		}}
+
+		var problems []string
+		for _, p := range v.verify(context.Background(), index, 1).Problems {
+			problems = append(problems, p.Chart+" "+p.Version+" "+p.Problem)
+		}
+		assert.Equal(t, []string{
+			"demo 1.1.0 " + PublishedDigestMismatch,
+			"demo 1.1.0 " + PublishedOCIMissing,
+			"demo 1.2.0 " + PublishedMissing,
+			"demo 1.2.0 " + PublishedOCIMissing,
+			"fleet 1.0.0 " + PublishedOCIUnreachable,
+		}, problems)
+	})
+}
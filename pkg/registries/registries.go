@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/git"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
@@ -73,6 +74,14 @@ func checkStatusAndCommit(ctx context.Context, message string) error {
 	}
 
 	clean, _ := g.StatusProcelain(ctx)
+	if dryrun.Enabled() {
+		// the files were written to memory, the working tree is always clean
+		changes, err := filesystem.DryRunChanges()
+		if err != nil {
+			return err
+		}
+		clean = len(changes) == 0
+	}
 	logger.Log(ctx, slog.LevelDebug, "git status", slog.Bool("clean", clean))
 	if clean {
 		logger.Log(ctx, slog.LevelWarn, "nothing to commit")
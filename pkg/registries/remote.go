@@ -14,6 +14,7 @@ import (
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/output"
 
 	authn "github.com/google/go-containerregistry/pkg/authn"
 	name "github.com/google/go-containerregistry/pkg/name"
@@ -315,31 +316,59 @@ func splitTags(dockerTags, stgTags []string) ([]string, []string) {
 	return dockerOnlyTags, stgAlsoTags
 }
 
+// ImageCheckReport lists the images of the assets/ folder that failed the image check
+type ImageCheckReport struct {
+	// OutOfNamespace are the repositories that are not in the rancher namespace
+	OutOfNamespace []string `json:"outOfNamespace"`
+	// MissingTags maps each repository to its tags that are not on Docker Hub
+	MissingTags map[string][]string `json:"missingTags"`
+}
+
+// Failed returns whether an image failed the image check
+func (r ImageCheckReport) Failed() bool {
+	return len(r.OutOfNamespace) > 0 || len(r.MissingTags) > 0
+}
+
+// Header returns the columns of the image check report
+func (r ImageCheckReport) Header() []string {
+	return []string{"PROBLEM", "IMAGE", "TAGS"}
+}
+
+// Rows returns the images out of the rancher namespace, then the images with missing tags
+func (r ImageCheckReport) Rows() [][]string {
+	rows := make([][]string, 0, len(r.OutOfNamespace)+len(r.MissingTags))
+	for _, image := range r.OutOfNamespace {
+		rows = append(rows, []string{"out-of-namespace", image, ""})
+	}
+	return append(rows, output.ListRows("missing-tags", r.MissingTags)...)
+}
+
 // DockerScan lists the repository tags from the local assets/ folder, compares them
 // against the corresponding Docker Hub repository tags, and reports any discrepancies.
-// It returns an error if an image tag from the assets/ folder is not found on Docker Hub,
+// It returns an error along with the report if an image tag from the assets/ folder is not found on Docker Hub,
 // or if a repository is not in the `rancher` namespace.
-func DockerScan(ctx context.Context) error {
+func DockerScan(ctx context.Context) (*ImageCheckReport, error) {
 	// Get required tags for all images retrieved from the all the values.yaml files in the .tgz files
 	assetsTagMap, err := createAssetValuesRepoTagMap(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// check docker images against the assets/ folder values.yaml repositories/tags
 	failedImages, outOfNamespaceImages, err := checkImagesFromDocker(ctx, assetsTagMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(failedImages) > 0 || len(outOfNamespaceImages) > 0 {
+	report := &ImageCheckReport{OutOfNamespace: outOfNamespaceImages, MissingTags: failedImages}
+	if report.Failed() {
 		logger.Log(ctx, slog.LevelError, "found images outside the rancher namespace", slog.Any("outOfNamespaceImages", outOfNamespaceImages))
 		logger.Log(ctx, slog.LevelError, "images that are not on Docker Hub", slog.Any("failedImages", failedImages))
-		return errors.New("image check has failed")
+		return report, errors.New("image check has failed")
 	}
 
 	logger.Log(ctx, slog.LevelInfo, "all images checked")
-	return nil
+	return report, nil
 }
 
 // checkImagesFromDocker receives a map of repository tags from local assets and fetches the corresponding tags from Docker Hub.
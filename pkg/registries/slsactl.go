@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/charts-build-scripts/pkg/dryrun"
 	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/path"
@@ -112,6 +113,11 @@ func batchSync(ctx context.Context, sourceURL, primeURL, customPath string, imgT
 
 			srcRef := sourceURL + repoImg + ":" + tag
 
+			if dryrun.Enabled() {
+				dryrun.Record(ctx, dryrun.ActionImageCopy, dstRef, srcRef)
+				continue
+			}
+
 			if err := imagecopy.ImageAndSignature(srcRef, dstRef); err != nil {
 				if !errors.Is(err, imagecopy.ErrNoSignaturesFound) {
 					return err
@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+)
+
+// locks holds a *sync.Mutex for each resource that was ever locked
+var locks sync.Map
+
+// Lock acquires the lock of a shared resource (e.g. a file of the repository or a remote URL) and returns the function that releases it.
+// Tasks that use different resources never wait on each other.
+func Lock(resource string) (unlock func()) {
+	l, _ := locks.LoadOrStore(resource, &sync.Mutex{})
+	mu := l.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Run calls do on every task, running at most jobs of them at the same time; jobs lower than 1 runs the tasks one at a time.
+// Every task runs even if others fail: the errors are returned together, in the order of the tasks, each prefixed with the name of its task.
+func Run[T any](ctx context.Context, jobs int, tasks []T, name func(T) string, do func(ctx context.Context, task T) error) error {
+	jobs = max(jobs, 1)
+	logger.Log(ctx, slog.LevelDebug, "running tasks", slog.Int("tasks", len(tasks)), slog.Int("jobs", jobs))
+
+	errs := make([]error, len(tasks))
+	semaphore := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		// stop scheduling tasks once the context is cancelled
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			break
+		}
+
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			taskName := name(task)
+			if err := do(ctx, task); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", taskName, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Run(t *testing.T) {
+	tests := []struct {
+		name string
+		jobs int
+		fail []int
+		want string
+	}{
+		{name: "#1 - serial", jobs: 1},
+		{name: "#2 - bounded", jobs: 3},
+		{name: "#3 - jobs lower than 1 run serially", jobs: 0},
+		{name: "#4 - errors are aggregated in order", jobs: 4, fail: []int{5, 2}, want: "task-2: failed\ntask-5: failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := []int{0, 1, 2, 3, 4, 5, 6, 7}
+			var running, maxRunning, done atomic.Int32
+			err := Run(context.Background(), tt.jobs, tasks, func(i int) string { return "task-" + strconv.Itoa(i) }, func(ctx context.Context, i int) error {
+				n := running.Add(1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				done.Add(1)
+				for _, f := range tt.fail {
+					if f == i {
+						return errors.New("failed")
+					}
+				}
+				return nil
+			})
+
+			assert.Equal(t, int32(len(tasks)), done.Load())
+			assert.LessOrEqual(t, maxRunning.Load(), int32(max(tt.jobs, 1)))
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func Test_Lock(t *testing.T) {
+	var wg sync.WaitGroup
+	var running, maxRunning atomic.Int32
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer Lock("index.yaml")()
+			if n := running.Add(1); n > maxRunning.Load() {
+				maxRunning.Store(n)
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), maxRunning.Load())
+
+	// different resources do not wait on each other
+	unlock := Lock("assets/a")
+	defer unlock()
+	acquired := make(chan struct{})
+	go func() {
+		defer Lock("assets/b")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock of another resource was not acquired")
+	}
+}
@@ -3,10 +3,8 @@ package validate
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log/slog"
 	"path/filepath"
-	"sync"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/rancher/charts-build-scripts/pkg/charts"
@@ -16,6 +14,7 @@ import (
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
 	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/scheduler"
 	"github.com/urfave/cli"
 	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
 )
@@ -30,24 +29,27 @@ import (
 //   - upstream/remote or local repository comparison
 //   - charts/ vs assets/ must match
 //   - helm index.yaml regeneration
-func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, rootFs billy.Filesystem, csOptions *options.ChartsScriptOptions, skip, remoteModeOnly, localModeOnly bool, chart string) error {
+//
+// It returns the comparison against the upstream repository, which is empty if the upstream validation did not run.
+func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, rootFs billy.Filesystem, csOptions *options.ChartsScriptOptions, skip, remoteModeOnly, localModeOnly bool, chart string, jobs int) (CompareGeneratedAssetsResponse, error) {
+	var response CompareGeneratedAssetsResponse
 
 	if err := isGitClean(ctx, repoRoot, false); err != nil {
-		return err
+		return response, err
 	}
 
 	if err := validateReleaseYaml(ctx, rootFs); err != nil {
-		return err
+		return response, err
 	}
 
 	if err := validateIndexYaml(ctx, rootFs); err != nil {
-		return err
+		return response, err
 	}
 
 	// Only skip icon validations for forward-ports
 	if !skip {
 		if err := Icons(ctx, rootFs); err != nil {
-			return err
+			return response, err
 		}
 	}
 
@@ -55,12 +57,12 @@ func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, root
 	if !remoteModeOnly {
 		logger.Log(ctx, slog.LevelInfo, "local validation - regenerate package/<chart>/package.yaml")
 		logger.Log(ctx, slog.LevelInfo, "generating charts")
-		if err := generateChartsConcurrently(ctx, c, repoRoot, chart, csOptions, rootFs); err != nil {
-			return err
+		if err := generateChartsConcurrently(ctx, c, repoRoot, chart, jobs, csOptions, rootFs); err != nil {
+			return response, err
 		}
 
 		if err := isGitClean(ctx, repoRoot, true); err != nil {
-			return err
+			return response, err
 		}
 
 		logger.Log(ctx, slog.LevelInfo, "successfully validated that current charts defined in the packages and assets are up-to-date")
@@ -70,7 +72,7 @@ func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, root
 		if !localModeOnly {
 			releaseOptions, err := options.LoadReleaseYaml(ctx, rootFs)
 			if err != nil {
-				return err
+				return response, err
 			}
 			u := csOptions.ValidateOptions.UpstreamOptions
 			branch := csOptions.ValidateOptions.Branch
@@ -78,8 +80,9 @@ func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, root
 			logger.Log(ctx, slog.LevelInfo, "upstream validation against repository", slog.String("url", u.URL), slog.String("branch", branch))
 			compareGeneratedAssetsResponse, err := CompareGeneratedAssets(ctx, repoRoot, rootFs, u, branch, releaseOptions)
 			if err != nil {
-				return err
+				return response, err
 			}
+			response = compareGeneratedAssetsResponse
 			if !compareGeneratedAssetsResponse.PassedValidation() {
 				// Output charts that have been modified
 				compareGeneratedAssetsResponse.LogDiscrepancies(ctx)
@@ -91,10 +94,10 @@ func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, root
 
 				logger.Log(ctx, slog.LevelInfo, "updating index.yaml")
 				if err := helm.CreateOrUpdateHelmIndex(ctx, rootFs); err != nil {
-					return err
+					return response, err
 				}
 
-				return errors.New("validation against upstream repository: " + u.URL + " at branch: " + branch + " failed")
+				return response, errors.New("validation against upstream repository: " + u.URL + " at branch: " + branch + " failed")
 			}
 		}
 	}
@@ -103,20 +106,20 @@ func ChartsRepository(ctx context.Context, c *cli.Context, repoRoot string, root
 
 	// zipCharts
 	if err := helm.ArchiveCharts(ctx, repoRoot, chart); err != nil {
-		return err
+		return response, err
 	}
 
 	// createOrUpdateIndex
 	if err := helm.CreateOrUpdateHelmIndex(ctx, rootFs); err != nil {
-		return err
+		return response, err
 	}
 
 	if err := isGitClean(ctx, repoRoot, false); err != nil {
-		return err
+		return response, err
 	}
 
 	logger.Log(ctx, slog.LevelInfo, "make validate success")
-	return nil
+	return response, nil
 }
 
 func isGitClean(ctx context.Context, repoRoot string, checkExceptions bool) error {
@@ -226,7 +229,7 @@ func validateIndexYaml(ctx context.Context, rootFs billy.Filesystem) error {
 	return nil
 }
 
-func generateChartsConcurrently(ctx context.Context, c *cli.Context, repoRoot, chart string, csOptions *options.ChartsScriptOptions, rootFs billy.Filesystem) error {
+func generateChartsConcurrently(ctx context.Context, c *cli.Context, repoRoot, chart string, jobs int, csOptions *options.ChartsScriptOptions, rootFs billy.Filesystem) error {
 	packages, err := charts.GetPackages(ctx, repoRoot, chart)
 	if err != nil {
 		return err
@@ -236,14 +239,6 @@ func generateChartsConcurrently(ctx context.Context, c *cli.Context, repoRoot, c
 		return errors.New("should have packages for validation")
 	}
 
-	const maxWorkers = 5
-	var mu sync.Mutex
-	var errs []error
-
-	// Create a buffered channel to limit concurrent workers
-	semaphore := make(chan struct{}, maxWorkers)
-	var wg sync.WaitGroup
-
 	// Filter packages that need processing
 	var packagesToProcess []*charts.Package
 	for _, p := range packages {
@@ -252,42 +247,12 @@ func generateChartsConcurrently(ctx context.Context, c *cli.Context, repoRoot, c
 		}
 	}
 
-	logger.Log(ctx, slog.LevelInfo, "processing charts with worker pool",
-		slog.Int("total_packages", len(packagesToProcess)),
-		slog.Int("max_workers", maxWorkers))
-
-	for _, p := range packagesToProcess {
-		// Respect context cancellation
-		select {
-		case <-ctx.Done():
-			wg.Wait()
-			return ctx.Err()
-		default:
-		}
-
-		wg.Add(1)
-		semaphore <- struct{}{} // Acquire semaphore (blocks if 10 workers are running)
-
-		go func(pkg *charts.Package) {
-			defer wg.Done()
-			defer func() { <-semaphore }() // Release semaphore
-
-			logger.Log(ctx, slog.LevelInfo, "generating chart", slog.String("package", pkg.Name))
-			if err := pkg.GenerateCharts(ctx, csOptions.OmitBuildMetadataOnExport); err != nil {
-				mu.Lock()
-				errs = append(errs, fmt.Errorf("package %s: %w", pkg.Name, err))
-				mu.Unlock()
-			}
-		}(p)
-	}
-
-	// Wait for all goroutines to complete
-	wg.Wait()
+	logger.Log(ctx, slog.LevelInfo, "processing charts", slog.Int("total_packages", len(packagesToProcess)), slog.Int("jobs", jobs))
 
-	// Return all errors
-	if len(errs) > 0 {
-		return errors.Join(errs...)
-	}
-
-	return nil
+	// every package is exported again, whatever the build state says, since validate checks that the result is committed
+	return scheduler.Run(ctx, jobs, packagesToProcess, charts.PackageName, func(ctx context.Context, p *charts.Package) error {
+		ctx = logger.WithPackage(ctx, p.Name)
+		logger.Log(ctx, slog.LevelInfo, "generating chart")
+		return p.GenerateCharts(ctx, csOptions.OmitBuildMetadataOnExport)
+	})
 }
@@ -0,0 +1,214 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher/charts-build-scripts/pkg/helm"
+	"github.com/rancher/charts-build-scripts/pkg/logger"
+	"github.com/rancher/charts-build-scripts/pkg/options"
+)
+
+// Differences reported by CompareIndexFiles for a chart version
+const (
+	// IndexMissing is a chart version of the local index.yaml that is not in the remote one
+	IndexMissing = "missing"
+	// IndexExtra is a chart version of the remote index.yaml that is not in the local one
+	IndexExtra = "extra"
+	// IndexDigestMismatch is a chart version whose digest differs between both index.yaml files
+	IndexDigestMismatch = "digest-mismatch"
+	// IndexModified is a chart version with the same digest whose other fields differ between both index.yaml files
+	IndexModified = "modified"
+)
+
+// IndexCompareOptions configures CompareIndexFiles
+type IndexCompareOptions struct {
+	// CNAME is the host of the Helm repository serving the remote index.yaml, see options.HelmRepoConfiguration
+	CNAME string
+	// IgnoreCreated ignores the created timestamps of the chart versions
+	IgnoreCreated bool
+}
+
+// IndexURL returns the URL of the index.yaml served at the CNAME of a Helm repository, charts.rancher.io if it is empty
+func IndexURL(cname string) string {
+	return options.HelmRepoConfiguration{CNAME: cname}.URL() + "/index.yaml"
+}
+
+// CompareIndexFiles loads the local index.yaml and compares its entries against those of the index.yaml served at the CNAME,
+// returning an error if any chart version is missing, extra or different. The generated timestamps are always ignored.
+func CompareIndexFiles(ctx context.Context, rootFs billy.Filesystem, branch string, opts IndexCompareOptions) (*IndexComparison, error) {
+	if branch == "" {
+		return nil, errors.New("BRANCH environment variable must be set to run compare-index-files")
+	}
+	// verify, search & open current index.yaml file
+	localIndexYaml, err := helm.OpenIndexYaml(ctx, rootFs)
+	if err != nil {
+		return nil, err
+	}
+
+	// download the remote index.yaml
+	report := &IndexComparison{URL: IndexURL(opts.CNAME), Equal: true, Charts: []ChartIndexDiff{}}
+	resp, err := http.Get(report.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteIndexYaml, err := helm.ParseIndexYaml(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// compare both index.yaml files
+	report.Charts, report.Diff = compareIndexes(localIndexYaml, remoteIndexYaml, opts.IgnoreCreated)
+	if len(report.Charts) > 0 {
+		logger.Log(ctx, slog.LevelDebug, "index.yaml files are different", slog.String("diff", report.Diff))
+		report.Equal = false
+		return report, fmt.Errorf("index.yaml files are different at git repository and %s", report.URL)
+	}
+	return report, nil
+}
+
+// compareIndexes returns the differences between the entries of the local and the remote index.yaml files, sorted by chart,
+// and the diff of the fields of the modified chart versions
+func compareIndexes(local, remote *helmRepo.IndexFile, ignoreCreated bool) ([]ChartIndexDiff, string) {
+	var cmpOpts []cmp.Option
+	if ignoreCreated {
+		cmpOpts = append(cmpOpts, cmpopts.IgnoreFields(helmRepo.ChartVersion{}, "Created"))
+	}
+
+	charts := make(map[string]bool, len(local.Entries))
+	for chart := range local.Entries {
+		charts[chart] = true
+	}
+	for chart := range remote.Entries {
+		charts[chart] = true
+	}
+	names := make([]string, 0, len(charts))
+	for chart := range charts {
+		names = append(names, chart)
+	}
+	sort.Strings(names)
+
+	var diffs []ChartIndexDiff
+	var modifiedDiff strings.Builder
+	for _, chart := range names {
+		localVersions := chartVersions(local.Entries[chart])
+		remoteVersions := chartVersions(remote.Entries[chart])
+
+		d := ChartIndexDiff{Chart: chart}
+		for _, version := range sortedKeys(localVersions) {
+			remoteVersion, ok := remoteVersions[version]
+			switch {
+			case !ok:
+				d.Missing = append(d.Missing, version)
+			case localVersions[version].Digest != remoteVersion.Digest:
+				d.DigestMismatch = append(d.DigestMismatch, version)
+			default:
+				if diff := cmp.Diff(localVersions[version], remoteVersion, cmpOpts...); diff != "" {
+					d.Modified = append(d.Modified, version)
+					fmt.Fprintf(&modifiedDiff, "%s %s:\n%s", chart, version, diff)
+				}
+			}
+		}
+		for _, version := range sortedKeys(remoteVersions) {
+			if _, ok := localVersions[version]; !ok {
+				d.Extra = append(d.Extra, version)
+			}
+		}
+
+		if len(d.Missing) > 0 || len(d.Extra) > 0 || len(d.DigestMismatch) > 0 || len(d.Modified) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs, modifiedDiff.String()
+}
+
+// chartVersions indexes the versions of a chart by version
+func chartVersions(versions helmRepo.ChartVersions) map[string]*helmRepo.ChartVersion {
+	m := make(map[string]*helmRepo.ChartVersion, len(versions))
+	for _, v := range versions {
+		m[v.Version] = v
+	}
+	return m
+}
+
+func sortedKeys(m map[string]*helmRepo.ChartVersion) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IndexComparison is the result of CompareIndexFiles
+type IndexComparison struct {
+	// URL is the index.yaml the local one was compared against
+	URL string `json:"url"`
+	// Equal is whether both index.yaml files have the same entries
+	Equal bool `json:"equal"`
+	// Charts are the differences of each chart that differs, sorted by chart
+	Charts []ChartIndexDiff `json:"charts"`
+	// Diff is the difference between the fields of the modified chart versions, if any
+	Diff string `json:"diff,omitempty"`
+}
+
+// ChartIndexDiff lists the versions of a chart that differ between the local and the remote index.yaml files
+type ChartIndexDiff struct {
+	Chart string `json:"chart"`
+	// Missing are the versions of the local index.yaml that are not in the remote one, e.g. not yet published
+	Missing []string `json:"missing,omitempty"`
+	// Extra are the versions of the remote index.yaml that are not in the local one, e.g. removed locally
+	Extra []string `json:"extra,omitempty"`
+	// DigestMismatch are the versions whose archive differs
+	DigestMismatch []string `json:"digestMismatch,omitempty"`
+	// Modified are the versions with the same archive whose other fields differ, e.g. created or urls
+	Modified []string `json:"modified,omitempty"`
+}
+
+// Header returns the columns of the comparison
+func (c IndexComparison) Header() []string {
+	return []string{"CHART", "VERSION", "DIFFERENCE"}
+}
+
+// Rows returns a row for each chart version that differs, the diff is only part of the JSON and YAML outputs
+func (c IndexComparison) Rows() [][]string {
+	var rows [][]string
+	for _, d := range c.Charts {
+		for _, kind := range []struct {
+			name     string
+			versions []string
+		}{
+			{IndexMissing, d.Missing},
+			{IndexExtra, d.Extra},
+			{IndexDigestMismatch, d.DigestMismatch},
+			{IndexModified, d.Modified},
+		} {
+			for _, version := range kind.versions {
+				rows = append(rows, []string{d.Chart, version, kind.name})
+			}
+		}
+	}
+	return rows
+}
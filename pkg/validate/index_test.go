@@ -0,0 +1,100 @@
+package validate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
+)
+
+func Test_IndexURL(t *testing.T) {
+	assert.Equal(t, "https://charts.rancher.io/index.yaml", IndexURL(""))
+	assert.Equal(t, "https://charts.example.com/index.yaml", IndexURL("charts.example.com"))
+	assert.Equal(t, "http://localhost:8080/index.yaml", IndexURL("http://localhost:8080/"))
+}
+
+func Test_CompareIndexFiles(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newIndex := func(generated time.Time, versions map[string]string) *helmRepo.IndexFile {
+		index := helmRepo.NewIndexFile()
+		index.Generated = generated
+		for version, digest := range versions {
+			require.NoError(t, index.MustAdd(&chart.Metadata{APIVersion: "v2", Name: "demo", Version: version}, "demo-"+version+".tgz", "assets/demo", digest))
+		}
+		for _, v := range index.Entries["demo"] {
+			v.Created = created
+		}
+		return index
+	}
+
+	local := newIndex(created, map[string]string{"1.0.0": "aaa", "1.1.0": "bbb", "1.2.0": "ccc", "1.3.0": "ddd"})
+	remote := newIndex(created.Add(time.Hour), map[string]string{"0.9.0": "zzz", "1.0.0": "aaa", "1.1.0": "xxx", "1.2.0": "ccc"})
+	for _, v := range remote.Entries["demo"] {
+		if v.Version == "1.2.0" {
+			v.Created = created.Add(time.Minute)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := yaml.Marshal(remote)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	rootDir := t.TempDir()
+	require.NoError(t, local.WriteFile(filepath.Join(rootDir, "index.yaml"), 0644))
+	rootFs := filesystem.GetFilesystem(rootDir)
+
+	report, err := CompareIndexFiles(context.Background(), rootFs, "release-v2.10", IndexCompareOptions{CNAME: server.URL})
+	assert.Error(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, server.URL+"/index.yaml", report.URL)
+	assert.False(t, report.Equal)
+	assert.Equal(t, []ChartIndexDiff{{
+		Chart:          "demo",
+		Missing:        []string{"1.3.0"},
+		Extra:          []string{"0.9.0"},
+		DigestMismatch: []string{"1.1.0"},
+		Modified:       []string{"1.2.0"},
+	}}, report.Charts)
+	assert.Contains(t, report.Diff, "demo 1.2.0")
+	assert.Equal(t, [][]string{
+		{"demo", "1.3.0", IndexMissing},
+		{"demo", "0.9.0", IndexExtra},
+		{"demo", "1.1.0", IndexDigestMismatch},
+		{"demo", "1.2.0", IndexModified},
+	}, report.Rows())
+
+	// the created timestamps can be ignored, the generated timestamp is always ignored
+	local = newIndex(created, map[string]string{"1.0.0": "aaa", "1.2.0": "ccc"})
+	remote = newIndex(created.Add(time.Hour), map[string]string{"1.0.0": "aaa", "1.2.0": "ccc"})
+	remote.Entries["demo"][0].Created = created.Add(time.Minute)
+	require.NoError(t, local.WriteFile(filepath.Join(rootDir, "index.yaml"), 0644))
+
+	report, err = CompareIndexFiles(context.Background(), rootFs, "release-v2.10", IndexCompareOptions{CNAME: server.URL, IgnoreCreated: true})
+	assert.NoError(t, err)
+	assert.True(t, report.Equal)
+	assert.Empty(t, report.Charts)
+
+	_, err = CompareIndexFiles(context.Background(), rootFs, "release-v2.10", IndexCompareOptions{CNAME: server.URL})
+	assert.Error(t, err)
+
+	require.NoError(t, os.Remove(filepath.Join(rootDir, "index.yaml")))
+	_, err = CompareIndexFiles(context.Background(), rootFs, "release-v2.10", IndexCompareOptions{CNAME: server.URL})
+	assert.Error(t, err)
+}
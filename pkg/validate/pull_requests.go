@@ -5,31 +5,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
-	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
-	"github.com/go-git/go-billy/v5"
-	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-github/v85/github"
-	"golang.org/x/oauth2"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	helmLoader "helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
 
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/helm"
 	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
-)
-
-// owner and repo identify the GitHub repository used for pull request lookups.
-// Referred to: https://github.com/rancher/charts
-const (
-	owner = "rancher"
-	repo  = "charts"
+	"github.com/rancher/charts-build-scripts/pkg/path"
+	"github.com/rancher/charts-build-scripts/pkg/pullrequest"
 )
 
 var (
@@ -39,78 +32,81 @@ var (
 	errModifiedChart = errors.New("released chart cannot be modified")
 	// errMinorPatchVersion is returned when a chart version bumps by more than one patch or minor step.
 	errMinorPatchVersion = errors.New("chart version must be exactly 1 more patch/minor version than the previous chart version")
+	// errCheckpoints is returned when a chart asset added in a PR fails checkpoint 1 or 2.
+	errCheckpoints = errors.New("chart assets failed the pull request checkpoints")
+)
+
+// Checkpoints reported for each chart asset added in a pull request
+const (
+	// CheckpointCharts compares the contents of the asset to charts/<chart>/<version>
+	CheckpointCharts = "assets-charts"
+	// CheckpointIndex compares the asset to its index.yaml entry
+	CheckpointIndex = "assets-index"
 )
 
 // validation holds the pull request metadata and changed files for a single validation session.
 type validation struct {
-	pr    *github.PullRequest
-	files []*github.CommitFile
+	pr    *pullrequest.PullRequest
+	files []pullrequest.File
 	dep   *lifecycle.Dependencies
 }
 
-// loadPullRequestValidation authenticates with GitHub using the given token, fetches the pull
-// request and its changed files, and returns a validation ready for checkpoint evaluation.
-func loadPullRequestValidation(token, prNum string, dep *lifecycle.Dependencies) (*validation, error) {
-	ctx := context.Background()
-
-	tokenSource := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tokenClient := oauth2.NewClient(ctx, tokenSource)
-	gitClient := github.NewClient(tokenClient)
-
-	pNum, err := strconv.Atoi(prNum)
-	if err != nil {
-		return nil, fmt.Errorf("invalid PR number %q: %w", prNum, err)
-	}
-
-	pr, resp, err := gitClient.PullRequests.Get(ctx, owner, repo, pNum)
+// loadPullRequestValidation fetches the pull request and all of its changed files from the provider,
+// and returns a validation ready for checkpoint evaluation.
+func loadPullRequestValidation(ctx context.Context, provider pullrequest.Provider, number int, dep *lifecycle.Dependencies) (*validation, error) {
+	pr, err := provider.PullRequest(ctx, number)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pull request %d: %w", pNum, err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get pull request, status code: %s", resp.Status)
+		return nil, err
 	}
 
-	prFiles, _, err := gitClient.PullRequests.ListFiles(ctx, owner, repo, pNum, nil)
+	files, err := provider.ListFiles(ctx, number)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list files for pull request %d: %w", pNum, err)
+		return nil, err
 	}
+	logger.Log(ctx, slog.LevelInfo, "loaded pull request", slog.Int("number", pr.Number), slog.String("title", pr.Title), slog.Int("files", len(files)))
 
-	return &validation{pr: pr, files: prFiles, dep: dep}, nil
+	return &validation{pr: pr, files: files, dep: dep}, nil
 }
 
-// PullRequests validates a pull request against the release.yaml checkpoints:
+// PullRequests validates a pull request, looked up through the provider, against the release.yaml checkpoints:
 //   - Checkpoint 0: release.yaml is internally consistent and no released chart is modified
-//   - TODO Checkpoint 1: compare contents of assets/ to charts/
-//   - TODO Checkpoint 2: compare assets against index.yaml
+//   - Checkpoint 1: the contents of each added asset match those of charts/<chart>/<version>
+//   - Checkpoint 2: the index.yaml entry of each added asset matches the asset
+//
+// The report holds the results of checkpoints 1 and 2 for each added asset; it is nil if checkpoint 0 failed.
 func PullRequests(ctx context.Context,
-	token, prNum, branch string,
-	dep *lifecycle.Dependencies) error {
-	if token == "" {
-		return errors.New("GH_TOKEN environment variable must be set to run validate-release-charts")
-	}
-	if prNum == "" {
-		return errors.New("PR_NUMBER environment variable must be set to run validate-release-charts")
-	}
+	provider pullrequest.Provider, number int, branch string,
+	dep *lifecycle.Dependencies) (*PullRequestReport, error) {
 	if branch == "" {
-		return errors.New("BRANCH environment variable must be set to run validate-release-charts")
+		return nil, errors.New("BRANCH environment variable must be set to run validate-release-charts")
 	}
 	if !strings.HasPrefix(branch, "release-v") {
-		return errors.New("branch must be in the format release-v2.x")
+		return nil, errors.New("branch must be in the format release-v2.x")
 	}
 
-	v, err := loadPullRequestValidation(token, prNum, dep)
+	v, err := loadPullRequestValidation(ctx, provider, number, dep)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Checkpoint 0
 	releaseOpts, err := options.LoadReleaseYaml(ctx, dep.RootFs)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := v.validateReleaseYaml(ctx, releaseOpts); err != nil {
+		return nil, err
+	}
+
+	// Checkpoints 1 and 2
+	report, err := v.checkAddedAssets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if report.Failed() {
+		return report, errCheckpoints
 	}
-	return v.validateReleaseYaml(ctx, releaseOpts)
+	return report, nil
 }
 
 // validateReleaseYaml validates the release.yaml file against three rules:
@@ -210,14 +206,14 @@ func (v *validation) checkNeverModifyReleasedChart(assetFilePaths map[string]str
 	assetFilePathErrors := make(map[string]error)
 
 	for _, file := range v.files {
-		if _, found := assetFilePaths[*file.Filename]; !found {
+		if _, found := assetFilePaths[file.Filename]; !found {
 			continue
 		}
-		if file.Status != nil && (*file.Status == "added" || *file.Status == "removed") {
+		if file.Status == pullrequest.StatusAdded || file.Status == pullrequest.StatusRemoved {
 			continue
 		}
 		// any status different from "added" or "removed" means the file was modified
-		assetFilePathErrors[*file.Filename] = errModifiedChart
+		assetFilePathErrors[file.Filename] = errModifiedChart
 	}
 
 	// give the biggest amount of information possible to the user that will need to fix the pull request.
@@ -228,56 +224,160 @@ func (v *validation) checkNeverModifyReleasedChart(assetFilePaths map[string]str
 	return nil
 }
 
-// CompareIndexFiles loads the local index.yaml and compares it against the live index.yaml
-// from charts.rancher.io, returning an error if the two differ.
-func CompareIndexFiles(ctx context.Context, rootFs billy.Filesystem, branch string) error {
-	if branch == "" {
-		return errors.New("BRANCH environment variable must be set to run compare-index-files")
-	}
-	// verify, search & open current index.yaml file
-	localIndexYaml, err := helm.OpenIndexYaml(ctx, rootFs)
-	if err != nil {
-		return err
+// PullRequestReport holds the results of checkpoints 1 and 2 for each chart asset added in a pull request
+type PullRequestReport struct {
+	Files []FileCheck `json:"files"`
+}
+
+// FileCheck is the result of a checkpoint for a file of a pull request
+type FileCheck struct {
+	File       string   `json:"file"`
+	Checkpoint string   `json:"checkpoint"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+// Failed returns whether any file failed a checkpoint
+func (r PullRequestReport) Failed() bool {
+	for _, f := range r.Files {
+		if len(f.Problems) > 0 {
+			return true
+		}
 	}
+	return false
+}
 
-	// download index.yaml from charts.rancher.io
-	resp, err := http.Get("https://charts.rancher.io/index.yaml")
-	if err != nil {
-		return err
+// Header returns the columns of the report
+func (r PullRequestReport) Header() []string {
+	return []string{"FILE", "CHECKPOINT", "RESULT"}
+}
+
+// Rows returns a row for each checkpoint of each file
+func (r PullRequestReport) Rows() [][]string {
+	rows := make([][]string, 0, len(r.Files))
+	for _, f := range r.Files {
+		result := "ok"
+		if len(f.Problems) > 0 {
+			result = strings.Join(f.Problems, "; ")
+		}
+		rows = append(rows, []string{f.File, f.Checkpoint, result})
 	}
-	defer resp.Body.Close()
+	return rows
+}
+
+// checkAddedAssets runs checkpoints 1 and 2 on every chart asset added in the pull request
+func (v *validation) checkAddedAssets(ctx context.Context) (*PullRequestReport, error) {
+	report := &PullRequestReport{Files: []FileCheck{}}
+
+	var index *helmRepo.IndexFile
+	for _, file := range v.files {
+		if file.Status != pullrequest.StatusAdded || !isAsset(file.Filename) {
+			continue
+		}
+		if index == nil {
+			var err error
+			if index, err = helm.OpenIndexYaml(ctx, v.dep.RootFs); err != nil {
+				return nil, err
+			}
+		}
+
+		data, err := billyUtil.ReadFile(v.dep.RootFs, file.Filename)
+		if err != nil {
+			return nil, err
+		}
+		chart, err := helmLoader.LoadArchive(bytes.NewReader(data))
+		if err != nil {
+			problem := fmt.Sprintf("not a chart archive: %s", err)
+			report.Files = append(report.Files,
+				FileCheck{File: file.Filename, Checkpoint: CheckpointCharts, Problems: []string{problem}},
+				FileCheck{File: file.Filename, Checkpoint: CheckpointIndex, Problems: []string{problem}})
+			continue
+		}
+		name, version := chart.Metadata.Name, chart.Metadata.Version
+		chartCtx := logger.WithChart(ctx, name, version)
+
+		// Checkpoint 1
+		chartsProblems, err := v.compareAssetToCharts(chartCtx, file.Filename, name, version)
+		if err != nil {
+			return nil, err
+		}
+		report.Files = append(report.Files, FileCheck{File: file.Filename, Checkpoint: CheckpointCharts, Problems: chartsProblems})
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status code %d", resp.StatusCode)
+		// Checkpoint 2
+		indexProblems, err := compareAssetToIndex(index, file.Filename, name, version, data)
+		if err != nil {
+			return nil, err
+		}
+		report.Files = append(report.Files, FileCheck{File: file.Filename, Checkpoint: CheckpointIndex, Problems: indexProblems})
+
+		if len(chartsProblems) > 0 || len(indexProblems) > 0 {
+			logger.Log(chartCtx, slog.LevelError, "asset failed the pull request checkpoints", slog.String("asset", file.Filename))
+		}
 	}
+	return report, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// isAsset returns whether the file is a chart archive of the assets directory
+func isAsset(filename string) bool {
+	return strings.HasPrefix(filename, path.RepositoryAssetsDir+"/") && filepath.Ext(filename) == ".tgz"
+}
+
+// compareAssetToCharts returns the files that differ between the asset and charts/<chart>/<version>
+func (v *validation) compareAssetToCharts(ctx context.Context, asset, name, version string) ([]string, error) {
+	chartDir := filepath.Join(path.RepositoryChartsDir, name, version)
+	exists, err := filesystem.PathExists(ctx, v.dep.RootFs, chartDir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !exists {
+		return []string{chartDir + " does not exist"}, nil
 	}
 
-	// save it to a temporary file
-	tempIndex, err := os.CreateTemp("", "temp-index.yaml")
+	diff, err := filesystem.CompareTgzWithDir(ctx, v.dep.RootFs, asset, chartDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tempIndex.Close()
+	var problems []string
+	for _, f := range diff.OnlyInArchive {
+		problems = append(problems, "missing from "+chartDir+": "+f)
+	}
+	for _, f := range diff.OnlyInDir {
+		problems = append(problems, "missing from the asset: "+f)
+	}
+	for _, f := range diff.Modified {
+		problems = append(problems, "differs from "+chartDir+": "+f)
+	}
+	return problems, nil
+}
 
-	_, err = io.Copy(tempIndex, bytes.NewReader(body))
-	if err != nil {
-		return err
+// compareAssetToIndex returns the fields of the index.yaml entry of the asset that do not match it:
+// the digest must be the one of the asset, the only url its path, and created must be set and not in the future
+func compareAssetToIndex(index *helmRepo.IndexFile, asset, name, version string, data []byte) ([]string, error) {
+	var entry *helmRepo.ChartVersion
+	for _, e := range index.Entries[name] {
+		if e.Version == version {
+			entry = e
+			break
+		}
+	}
+	if entry == nil {
+		return []string{fmt.Sprintf("%s %s has no entry in %s", name, version, path.RepositoryHelmIndexFile)}, nil
 	}
 
-	tempIndexYaml, err := helmRepo.LoadIndexFile(tempIndex.Name())
+	digest, err := provenance.Digest(bytes.NewReader(data))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer os.Remove(tempIndex.Name())
-
-	// compare both index.yaml files
-	if diff := cmp.Diff(localIndexYaml, tempIndexYaml); diff != "" {
-		logger.Log(ctx, slog.LevelDebug, "index.yaml files are different", slog.String("diff", diff))
-		return errors.New("index.yaml files are different at git repository and charts.rancher.io")
+	var problems []string
+	if entry.Digest != digest {
+		problems = append(problems, fmt.Sprintf("digest %s does not match the digest of the asset %s", entry.Digest, digest))
 	}
-	return nil
+	if len(entry.URLs) != 1 || entry.URLs[0] != asset {
+		problems = append(problems, fmt.Sprintf("urls %v must be [%s]", entry.URLs, asset))
+	}
+	if entry.Created.IsZero() {
+		problems = append(problems, "created is not set")
+	} else if entry.Created.After(time.Now()) {
+		problems = append(problems, fmt.Sprintf("created %s is in the future", entry.Created.Format(time.RFC3339)))
+	}
+	return problems, nil
 }
@@ -1,14 +1,25 @@
 package validate
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/google/go-github/v85/github"
+	"github.com/rancher/charts-build-scripts/pkg/filesystem"
 	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
 	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/pullrequest"
+	"github.com/rancher/charts-build-scripts/pkg/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/provenance"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
 )
 
 func Test_validateReleaseYaml(t *testing.T) {
@@ -50,10 +61,10 @@ func Test_validateReleaseYaml(t *testing.T) {
 					"chart-1": {"104.0.0"},
 				},
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 					},
 					dep: &lifecycle.Dependencies{
@@ -74,18 +85,18 @@ func Test_validateReleaseYaml(t *testing.T) {
 					"chart-1": {"104.0.1"},
 				},
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.1.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.1.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 					},
 					dep: &lifecycle.Dependencies{
@@ -117,22 +128,22 @@ func Test_validateReleaseYaml(t *testing.T) {
 					"chart-2": {"104.0.0"},
 				},
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("assets/chart-2/chart-2-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-2/chart-2-104.0.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 					},
 					dep: &lifecycle.Dependencies{
@@ -165,18 +176,18 @@ func Test_validateReleaseYaml(t *testing.T) {
 					"chart-1": {"104.0.0"},
 				},
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("modified"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 					},
 					dep: &lifecycle.Dependencies{
@@ -207,22 +218,22 @@ func Test_validateReleaseYaml(t *testing.T) {
 					"chart-2": {"104.0.0"},
 				},
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("assets/chart-2/chart-2-104.0.0.tgz"),
-							Status:   github.String("modified"),
+							Filename: "assets/chart-2/chart-2-104.0.0.tgz",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 					},
 					dep: &lifecycle.Dependencies{
@@ -258,22 +269,22 @@ func Test_validateReleaseYaml(t *testing.T) {
 					"chart-2": {"104.0.0"},
 				},
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("modfied"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "modfied",
 						},
 						{
-							Filename: github.String("assets/chart-2/chart-2-104.0.0.tgz"),
-							Status:   github.String("modified"),
+							Filename: "assets/chart-2/chart-2-104.0.0.tgz",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 					},
 					dep: &lifecycle.Dependencies{
@@ -592,10 +603,10 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #1 [1 filed added] : Expected NIL",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 					},
 				},
@@ -611,10 +622,10 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #2 [1 filed removed] : Expected NIL",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("removed"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "removed",
 						},
 					},
 				},
@@ -630,10 +641,10 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #3 [1 filed modified] : Expected Error",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("modified"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "modified",
 						},
 					},
 				},
@@ -651,10 +662,10 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #4 [1 filed any wrong state] : Expected Error",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("xxxxxx"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "xxxxxx",
 						},
 					},
 				},
@@ -672,22 +683,22 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #5 [1 filed added; several others modified] : Expected NIL",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-1/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 					},
 				},
@@ -703,51 +714,51 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #6 [Several files added/removed] : Expected Nil",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("assets/chart-2/chart-2-104.1.0.tgz"),
-							Status:   github.String("removed"),
+							Filename: "assets/chart-2/chart-2-104.1.0.tgz",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("assets/chart-3/chart-2-104.2.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-3/chart-2-104.2.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-2/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-2/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("charts/chart-2/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-2/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-2/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-2/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("charts/chart-3/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-3/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("charts/chart-3/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-3/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-3/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-3/value.yaml",
+							Status:   "removed",
 						},
 
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 					},
 				},
@@ -766,59 +777,59 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 			name: "Test #7 [Several files added/removed and several modified] : Expected Error",
 			i: input{
 				validation: validation{
-					files: []*github.CommitFile{
+					files: []pullrequest.File{
 						{
-							Filename: github.String("assets/chart-1/chart-1-104.0.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-1/chart-1-104.0.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("assets/chart-2/chart-2-104.1.0.tgz"),
-							Status:   github.String("removed"),
+							Filename: "assets/chart-2/chart-2-104.1.0.tgz",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("assets/chart-3/chart-3-104.2.0.tgz"),
-							Status:   github.String("added"),
+							Filename: "assets/chart-3/chart-3-104.2.0.tgz",
+							Status:   "added",
 						},
 						{
-							Filename: github.String("assets/chart-4/chart-4-104.0.0.tgz"),
-							Status:   github.String("modified"),
+							Filename: "assets/chart-4/chart-4-104.0.0.tgz",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("assets/chart-4-crd/chart-4-crd-104.0.0.tgz"),
-							Status:   github.String("modified"),
+							Filename: "assets/chart-4-crd/chart-4-crd-104.0.0.tgz",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-1/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-1/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-2/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-2/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("charts/chart-2/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-2/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-2/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-2/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("charts/chart-3/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-3/value.yaml",
+							Status:   "removed",
 						},
 						{
-							Filename: github.String("charts/chart-3/Chart.yaml"),
-							Status:   github.String("modified"),
+							Filename: "charts/chart-3/Chart.yaml",
+							Status:   "modified",
 						},
 						{
-							Filename: github.String("charts/chart-3/value.yaml"),
-							Status:   github.String("removed"),
+							Filename: "charts/chart-3/value.yaml",
+							Status:   "removed",
 						},
 
 						{
-							Filename: github.String("release.yaml"),
-							Status:   github.String("modified"),
+							Filename: "release.yaml",
+							Status:   "modified",
 						},
 					},
 				},
@@ -850,3 +861,153 @@ func Test_checkNeverModifyReleasedChart(t *testing.T) {
 		})
 	}
 }
+
+// newReleaseRepository returns a repository releasing demo 104.0.0: its chart, its asset, its index.yaml entry and release.yaml
+func newReleaseRepository(t *testing.T) string {
+	util.InitSoftErrorMode()
+	ctx := context.Background()
+	rootDir := t.TempDir()
+	chartYaml := "apiVersion: v2\nname: demo\nversion: 104.0.0\n"
+	for dir, files := range map[string]map[string]string{
+		filepath.Join(rootDir, "charts", "demo", "104.0.0"): {"Chart.yaml": chartYaml, "values.yaml": "replicas: 1\n"},
+		filepath.Join(rootDir, "staging", "demo"):           {"Chart.yaml": chartYaml, "values.yaml": "replicas: 1\n"},
+	} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+		}
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "assets", "demo"), 0755))
+	stagingFs := filesystem.GetFilesystem(filepath.Join(rootDir, "staging"))
+	require.NoError(t, filesystem.ArchiveDir(ctx, stagingFs, "demo", "demo-104.0.0.tgz"))
+	require.NoError(t, os.Rename(filepath.Join(rootDir, "staging", "demo-104.0.0.tgz"), filepath.Join(rootDir, "assets", "demo", "demo-104.0.0.tgz")))
+	require.NoError(t, os.RemoveAll(filepath.Join(rootDir, "staging")))
+
+	data, err := os.ReadFile(filepath.Join(rootDir, "assets", "demo", "demo-104.0.0.tgz"))
+	require.NoError(t, err)
+	digest, err := provenance.Digest(bytes.NewReader(data))
+	require.NoError(t, err)
+	index := helmRepo.NewIndexFile()
+	require.NoError(t, index.MustAdd(&chart.Metadata{APIVersion: "v2", Name: "demo", Version: "104.0.0"}, "demo-104.0.0.tgz", "assets/demo", digest))
+	require.NoError(t, index.WriteFile(filepath.Join(rootDir, "index.yaml"), 0644))
+
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "release.yaml"), []byte("demo:\n  - 104.0.0\n"), 0644))
+	return rootDir
+}
+
+func Test_PullRequests(t *testing.T) {
+	ctx := context.Background()
+	rootDir := newReleaseRepository(t)
+	dep := &lifecycle.Dependencies{RootFs: filesystem.GetFilesystem(rootDir), AssetsVersionsMap: map[string][]lifecycle.Asset{}}
+
+	provider := &pullrequest.Fake{
+		PullRequests: map[int]*pullrequest.PullRequest{
+			1: {Number: 1, BaseBranch: "release-v2.9"},
+			2: {Number: 2, BaseBranch: "release-v2.9"},
+		},
+		Files: map[int][]pullrequest.File{
+			1: {
+				{Filename: "assets/demo/demo-104.0.0.tgz", Status: pullrequest.StatusAdded},
+				{Filename: "charts/demo/104.0.0/Chart.yaml", Status: pullrequest.StatusAdded},
+			},
+			2: {{Filename: "assets/demo/demo-104.0.0.tgz", Status: pullrequest.StatusModified}},
+		},
+	}
+
+	report, err := PullRequests(ctx, provider, 1, "release-v2.9", dep)
+	require.NoError(t, err)
+	assert.Equal(t, []FileCheck{
+		{File: "assets/demo/demo-104.0.0.tgz", Checkpoint: CheckpointCharts},
+		{File: "assets/demo/demo-104.0.0.tgz", Checkpoint: CheckpointIndex},
+	}, report.Files)
+
+	_, err = PullRequests(ctx, provider, 2, "release-v2.9", dep)
+	assert.ErrorIs(t, err, errReleaseYaml)
+	_, err = PullRequests(ctx, provider, 3, "release-v2.9", dep)
+	assert.ErrorIs(t, err, pullrequest.ErrNotFound)
+	_, err = PullRequests(ctx, provider, 1, "dev-v2.9", dep)
+	assert.Error(t, err)
+}
+
+func Test_checkAddedAssets(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, rootDir string)
+		want   map[string][]string
+	}{
+		{
+			name: "chart differs from the asset",
+			modify: func(t *testing.T, rootDir string) {
+				chartDir := filepath.Join(rootDir, "charts", "demo", "104.0.0")
+				require.NoError(t, os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte("replicas: 2\n"), 0644))
+				require.NoError(t, os.WriteFile(filepath.Join(chartDir, "README.md"), []byte("# demo\n"), 0644))
+			},
+			want: map[string][]string{
+				CheckpointCharts: {
+					"missing from the asset: README.md",
+					"differs from charts/demo/104.0.0: values.yaml",
+				},
+			},
+		},
+		{
+			name: "chart is missing",
+			modify: func(t *testing.T, rootDir string) {
+				require.NoError(t, os.RemoveAll(filepath.Join(rootDir, "charts")))
+			},
+			want: map[string][]string{
+				CheckpointCharts: {"charts/demo/104.0.0 does not exist"},
+			},
+		},
+		{
+			name: "index entry does not match the asset",
+			modify: func(t *testing.T, rootDir string) {
+				index, err := helmRepo.LoadIndexFile(filepath.Join(rootDir, "index.yaml"))
+				require.NoError(t, err)
+				entry := index.Entries["demo"][0]
+				entry.Digest = "0000"
+				entry.URLs = []string{"https://example.com/demo-104.0.0.tgz"}
+				entry.Created = time.Time{}
+				require.NoError(t, index.WriteFile(filepath.Join(rootDir, "index.yaml"), 0644))
+			},
+			want: map[string][]string{
+				CheckpointIndex: {
+					"digest 0000 does not match the digest of the asset",
+					"urls [https://example.com/demo-104.0.0.tgz] must be [assets/demo/demo-104.0.0.tgz]",
+					"created is not set",
+				},
+			},
+		},
+		{
+			name: "index entry is missing",
+			modify: func(t *testing.T, rootDir string) {
+				require.NoError(t, helmRepo.NewIndexFile().WriteFile(filepath.Join(rootDir, "index.yaml"), 0644))
+			},
+			want: map[string][]string{
+				CheckpointIndex: {"demo 104.0.0 has no entry in index.yaml"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := newReleaseRepository(t)
+			tt.modify(t, rootDir)
+			v := &validation{
+				files: []pullrequest.File{{Filename: "assets/demo/demo-104.0.0.tgz", Status: pullrequest.StatusAdded}},
+				dep:   &lifecycle.Dependencies{RootFs: filesystem.GetFilesystem(rootDir)},
+			}
+
+			report, err := v.checkAddedAssets(context.Background())
+			require.NoError(t, err)
+			assert.True(t, report.Failed())
+			require.Len(t, report.Files, 2)
+			for _, f := range report.Files {
+				want := tt.want[f.Checkpoint]
+				require.Len(t, f.Problems, len(want), f.Checkpoint)
+				for i := range want {
+					// the digest of the asset is not known in advance
+					assert.True(t, strings.HasPrefix(f.Problems[i], want[i]), "%q does not start with %q", f.Problems[i], want[i])
+				}
+			}
+		})
+	}
+}
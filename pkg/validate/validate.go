@@ -16,6 +16,7 @@ import (
 	"github.com/rancher/charts-build-scripts/pkg/lifecycle"
 	"github.com/rancher/charts-build-scripts/pkg/logger"
 	"github.com/rancher/charts-build-scripts/pkg/options"
+	"github.com/rancher/charts-build-scripts/pkg/output"
 	"github.com/rancher/charts-build-scripts/pkg/path"
 	"github.com/rancher/charts-build-scripts/pkg/puller"
 
@@ -25,11 +26,23 @@ import (
 // CompareGeneratedAssetsResponse tracks resources that are added, deleted, and modified when comparing two charts repositories
 type CompareGeneratedAssetsResponse struct {
 	// UntrackedInRelease represents charts that need to be added to the release.yaml
-	UntrackedInRelease options.ReleaseOptions `yaml:"untrackedInRelease,omitempty"`
+	UntrackedInRelease options.ReleaseOptions `json:"untrackedInRelease,omitempty" yaml:"untrackedInRelease,omitempty"`
 	// RemovedPostRelease represents charts that have been removed from the upstream
-	RemovedPostRelease options.ReleaseOptions `yaml:"removedPostRelease,omitempty"`
+	RemovedPostRelease options.ReleaseOptions `json:"removedPostRelease,omitempty" yaml:"removedPostRelease,omitempty"`
 	// ModifiedPostRelease represents charts that have been modified from the upstream
-	ModifiedPostRelease options.ReleaseOptions `yaml:"modifiedPostRelease,omitempty"`
+	ModifiedPostRelease options.ReleaseOptions `json:"modifiedPostRelease,omitempty" yaml:"modifiedPostRelease,omitempty"`
+}
+
+// Header returns the columns of the response
+func (r CompareGeneratedAssetsResponse) Header() []string {
+	return []string{"CHANGE", "CHART", "VERSIONS"}
+}
+
+// Rows returns the untracked, removed and modified charts, in that order
+func (r CompareGeneratedAssetsResponse) Rows() [][]string {
+	rows := output.ListRows("untracked", r.UntrackedInRelease)
+	rows = append(rows, output.ListRows("removed", r.RemovedPostRelease)...)
+	return append(rows, output.ListRows("modified", r.ModifiedPostRelease)...)
 }
 
 // PassedValidation returns whether the response seems to indicate that the chart repositories are in sync
@@ -127,8 +140,10 @@ func CompareGeneratedAssets(ctx context.Context, repoRoot string, repoFs billy.F
 		// Chart exists in local and is not tracked by release.yaml
 		logger.Log(ctx, slog.LevelWarn, "chart is untracked", slog.String("name", chart.Metadata.Name), slog.String("version", chart.Metadata.Version))
 		// If the chart exists in local and not on the upstream it may have been removed by the lifecycle rules
-		isVersionInLifecycle := lifeCycleDep.VR.CheckChartVersionForLifecycle(chart.Metadata.Version)
-		if isVersionInLifecycle {
+		decision := lifeCycleDep.VR.Evaluate(chart.Metadata.Name, chart.Metadata.Version)
+		logger.Log(ctx, slog.LevelInfo, "evaluated lifecycle policy for untracked chart", slog.String("name", chart.Metadata.Name), slog.String("version", chart.Metadata.Version),
+			slog.Bool("inLifecycle", decision.InLifecycle), slog.String("rule", decision.Rule), slog.String("reason", decision.Reason))
+		if decision.InLifecycle {
 			// this chart should not be removed
 			response.UntrackedInRelease = response.UntrackedInRelease.Append(chart.Metadata.Name, chart.Metadata.Version)
 		}